@@ -0,0 +1,330 @@
+// Package analytics computes recognition statistics from bonuses, such as how
+// much each person or group gives and receives, which hashtags are used and
+// how recognition changes over time.
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Options represent options to compute statistics.
+type Options struct {
+	// GroupBy, if set, also aggregates statistics by group. Givers are
+	// grouped for giving statistics and receivers for receiving statistics.
+	GroupBy GroupBy
+	// Interval is the bucket size of the time series. Defaults to Month.
+	Interval Interval
+	// Location is the time zone of the time series buckets. Defaults to UTC.
+	Location *time.Location
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.Interval == "" {
+		o.Interval = Month
+	}
+	if err := o.Interval.Validate(); err != nil {
+		return err
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+	return nil
+}
+
+// Summary is the recognition given and received by a person, a group or
+// everyone.
+type Summary struct {
+	Key string `json:"key"`
+	// Members is the number of distinct people in a group, which is 1 for a
+	// person.
+	Members int `json:"members"`
+	// Given and Received are the total amounts given and received.
+	Given    int `json:"given"`
+	Received int `json:"received"`
+	// GivenCount and ReceivedCount are the number of bonuses given and
+	// received.
+	GivenCount    int `json:"given_count"`
+	ReceivedCount int `json:"received_count"`
+	// UniqueReceivers is the number of distinct people who were given
+	// bonuses, and UniqueGivers is the number of distinct people who gave
+	// bonuses.
+	UniqueReceivers int `json:"unique_receivers"`
+	UniqueGivers    int `json:"unique_givers"`
+	// Hashtags are the number of received bonuses with each hashtag.
+	Hashtags map[string]int `json:"hashtags,omitempty"`
+}
+
+// HashtagCount is the number of bonuses and total amount with a hashtag.
+type HashtagCount struct {
+	Hashtag string `json:"hashtag"`
+	Count   int    `json:"count"`
+	Amount  int    `json:"amount"`
+}
+
+// Point is the recognition given in one bucket of a time series.
+type Point struct {
+	Start  time.Time `json:"start"`
+	Count  int       `json:"count"`
+	Amount int       `json:"amount"`
+}
+
+// Report contains the computed statistics.
+type Report struct {
+	Totals Summary   `json:"totals"`
+	Users  []Summary `json:"users"`
+	// Groups are only computed if the statistics are grouped.
+	Groups     []Summary      `json:"groups,omitempty"`
+	Hashtags   []HashtagCount `json:"hashtags"`
+	TimeSeries []Point        `json:"time_series"`
+}
+
+// accumulator aggregates the statistics of a person, a group or everyone.
+type accumulator struct {
+	members   map[string]bool
+	summary   Summary
+	givers    map[string]bool
+	receivers map[string]bool
+}
+
+func newAccumulator(key string) *accumulator {
+	return &accumulator{
+		members:   map[string]bool{},
+		summary:   Summary{Key: key, Hashtags: map[string]int{}},
+		givers:    map[string]bool{},
+		receivers: map[string]bool{},
+	}
+}
+
+func (a *accumulator) give(giver, receiver string, amount int) {
+	a.members[giver] = true
+	a.summary.Given += amount
+	a.summary.GivenCount++
+	if receiver != "" {
+		a.receivers[receiver] = true
+	}
+}
+
+func (a *accumulator) receive(giver, receiver string, amount int, hashtags []string) {
+	a.members[receiver] = true
+	a.summary.Received += amount
+	a.summary.ReceivedCount++
+	if giver != "" {
+		a.givers[giver] = true
+	}
+	for _, hashtag := range hashtags {
+		a.summary.Hashtags[hashtag]++
+	}
+}
+
+func (a *accumulator) result() Summary {
+	s := a.summary
+	s.Members = len(a.members)
+	s.UniqueGivers = len(a.givers)
+	s.UniqueReceivers = len(a.receivers)
+	if len(s.Hashtags) == 0 {
+		s.Hashtags = nil
+	}
+	return s
+}
+
+// Stats accumulates recognition statistics from a stream of bonuses, so the
+// bonuses do not have to be held in memory.
+type Stats struct {
+	opts     Options
+	totals   *accumulator
+	users    map[string]*accumulator
+	groups   map[string]*accumulator
+	hashtags map[string]*HashtagCount
+	series   map[time.Time]*Point
+	// directory holds the users that were added, whose attributes are used
+	// to group them instead of the attributes embedded in bonuses.
+	directory map[string]bonusly.UserInfoResponse
+}
+
+// New returns statistics with no bonuses added.
+func New(opts Options) (*Stats, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Stats{
+		opts:      opts,
+		totals:    newAccumulator("all"),
+		users:     map[string]*accumulator{},
+		groups:    map[string]*accumulator{},
+		hashtags:  map[string]*HashtagCount{},
+		series:    map[time.Time]*Point{},
+		directory: map[string]bonusly.UserInfoResponse{},
+	}, nil
+}
+
+// AddUser adds a person who may not have given or received any bonuses, so
+// that they are included in the statistics. Their attributes are used to
+// group them rather than those embedded in bonuses, so add users before
+// bonuses.
+func (s *Stats) AddUser(u bonusly.UserInfoResponse) {
+	key := UserKey(&u)
+	if key == "" {
+		return
+	}
+	s.directory[key] = u
+	s.user(key).members[key] = true
+	s.totals.members[key] = true
+	if s.opts.GroupBy != nil {
+		s.group(&u).members[key] = true
+	}
+}
+
+// Add adds a bonus and its child bonuses to the statistics.
+func (s *Stats) Add(b bonusly.BonusResponse) {
+	giver := UserKey(b.Giver)
+	receiver := UserKey(b.Receiver)
+	amount := ptr.Int(b.Amount)
+	hashtags := bonusly.ReasonHashtags(ptr.String(b.Reason))
+	if value := strings.ToLower(b.Value); value != "" && !contains(hashtags, value) {
+		hashtags = append(hashtags, value)
+	}
+
+	if giver != "" {
+		s.totals.give(giver, receiver, amount)
+		s.user(giver).give(giver, receiver, amount)
+		if s.opts.GroupBy != nil {
+			s.group(b.Giver).give(giver, receiver, amount)
+		}
+	}
+	if receiver != "" {
+		s.totals.receive(giver, receiver, amount, hashtags)
+		s.user(receiver).receive(giver, receiver, amount, hashtags)
+		if s.opts.GroupBy != nil {
+			s.group(b.Receiver).receive(giver, receiver, amount, hashtags)
+		}
+	}
+
+	for _, hashtag := range hashtags {
+		hc, ok := s.hashtags[hashtag]
+		if !ok {
+			hc = &HashtagCount{Hashtag: hashtag}
+			s.hashtags[hashtag] = hc
+		}
+		hc.Count++
+		hc.Amount += amount
+	}
+
+	if b.CreatedAt != nil {
+		start := s.opts.Interval.bucket(b.CreatedAt.In(s.opts.Location))
+		p, ok := s.series[start]
+		if !ok {
+			p = &Point{Start: start}
+			s.series[start] = p
+		}
+		p.Count++
+		p.Amount += amount
+	}
+
+	for _, child := range b.ChildBonuses {
+		s.Add(child)
+	}
+}
+
+func (s *Stats) user(key string) *accumulator {
+	a, ok := s.users[key]
+	if !ok {
+		a = newAccumulator(key)
+		s.users[key] = a
+	}
+	return a
+}
+
+func (s *Stats) group(u *bonusly.UserInfoResponse) *accumulator {
+	if known, ok := s.directory[UserKey(u)]; ok {
+		u = &known
+	}
+	key := s.opts.GroupBy(u)
+	if key == "" {
+		key = NoGroup
+	}
+	a, ok := s.groups[key]
+	if !ok {
+		a = newAccumulator(key)
+		s.groups[key] = a
+	}
+	return a
+}
+
+// Report returns the statistics of the bonuses added so far. People and
+// groups are sorted by the amount they received, least first, so that those
+// who are recognized the least stand out. Hashtags are sorted by the number
+// of bonuses, most first, and the time series is in chronological order.
+func (s *Stats) Report() *Report {
+	r := &Report{
+		Totals:     s.totals.result(),
+		Users:      summaries(s.users),
+		Hashtags:   make([]HashtagCount, 0, len(s.hashtags)),
+		TimeSeries: make([]Point, 0, len(s.series)),
+	}
+	if s.opts.GroupBy != nil {
+		r.Groups = summaries(s.groups)
+	}
+
+	for _, hc := range s.hashtags {
+		r.Hashtags = append(r.Hashtags, *hc)
+	}
+	sort.Slice(r.Hashtags, func(i, j int) bool {
+		if r.Hashtags[i].Count != r.Hashtags[j].Count {
+			return r.Hashtags[i].Count > r.Hashtags[j].Count
+		}
+		return r.Hashtags[i].Hashtag < r.Hashtags[j].Hashtag
+	})
+
+	for _, p := range s.series {
+		r.TimeSeries = append(r.TimeSeries, *p)
+	}
+	sort.Slice(r.TimeSeries, func(i, j int) bool {
+		return r.TimeSeries[i].Start.Before(r.TimeSeries[j].Start)
+	})
+
+	return r
+}
+
+// Unrecognized returns the people in the report who did not receive any
+// bonuses.
+func (r *Report) Unrecognized() []string {
+	var keys []string
+	for _, u := range r.Users {
+		if u.ReceivedCount == 0 {
+			keys = append(keys, u.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func summaries(accs map[string]*accumulator) []Summary {
+	res := make([]Summary, 0, len(accs))
+	for _, a := range accs {
+		res = append(res, a.result())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Received != res[j].Received {
+			return res[i].Received < res[j].Received
+		}
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
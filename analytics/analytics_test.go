@@ -0,0 +1,164 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func user(email, department string) *bonusly.UserInfoResponse {
+	return &bonusly.UserInfoResponse{
+		Email:            ptr.NewString(email),
+		Department:       ptr.NewString(department),
+		CustomProperties: map[string]interface{}{"team": department + "-team"},
+	}
+}
+
+func bonus(giver, receiver *bonusly.UserInfoResponse, amount int, reason string, createdAt time.Time) bonusly.BonusResponse {
+	return bonusly.BonusResponse{
+		Giver:     giver,
+		Receiver:  receiver,
+		Amount:    ptr.NewInt(amount),
+		Reason:    ptr.NewString(reason),
+		CreatedAt: &createdAt,
+	}
+}
+
+func TestStats(t *testing.T) {
+	alice := user("alice@example.com", "eng")
+	bob := user("bob@example.com", "eng")
+	carol := user("carol@example.com", "sales")
+	dave := user("dave@example.com", "sales")
+	jan := time.Date(2021, time.January, 31, 23, 0, 0, 0, time.UTC)
+	feb := time.Date(2021, time.February, 15, 12, 0, 0, 0, time.UTC)
+
+	parent := bonus(alice, bob, 5, "+5 @bob for the release #ownership", jan)
+	parent.ChildBonuses = []bonusly.BonusResponse{bonus(carol, bob, 2, "+2 agreed #Ownership #teamwork", feb)}
+	bonuses := []bonusly.BonusResponse{
+		parent,
+		bonus(bob, alice, 3, "+3 @alice for the review #teamwork", feb),
+		bonus(alice, carol, 1, "+1 @carol for the demo", feb),
+	}
+
+	t.Run("ComputesPerUserStats", func(t *testing.T) {
+		s, err := New(Options{})
+		require.NoError(t, err)
+		for _, b := range bonuses {
+			s.Add(b)
+		}
+		s.AddUser(*dave)
+		r := s.Report()
+
+		assert.Equal(t, 11, r.Totals.Given)
+		assert.Equal(t, 11, r.Totals.Received)
+		assert.Equal(t, 4, r.Totals.GivenCount)
+		assert.Equal(t, 4, r.Totals.Members)
+
+		require.Len(t, r.Users, 4)
+		assert.Equal(t, "dave@example.com", r.Users[0].Key, "least recognized user should be first")
+		assert.Equal(t, []string{"dave@example.com"}, r.Unrecognized())
+
+		byKey := map[string]Summary{}
+		for _, u := range r.Users {
+			byKey[u.Key] = u
+		}
+		assert.Equal(t, Summary{
+			Key:             "bob@example.com",
+			Members:         1,
+			Given:           3,
+			Received:        7,
+			GivenCount:      1,
+			ReceivedCount:   2,
+			UniqueGivers:    2,
+			UniqueReceivers: 1,
+			Hashtags:        map[string]int{"ownership": 2, "teamwork": 1},
+		}, byKey["bob@example.com"])
+		assert.Equal(t, 2, byKey["alice@example.com"].UniqueReceivers)
+		assert.Nil(t, r.Groups)
+
+		assert.Equal(t, []HashtagCount{
+			{Hashtag: "ownership", Count: 2, Amount: 7},
+			{Hashtag: "teamwork", Count: 2, Amount: 5},
+		}, r.Hashtags)
+	})
+	t.Run("ComputesPerGroupStats", func(t *testing.T) {
+		s, err := New(Options{GroupBy: GroupByDepartment})
+		require.NoError(t, err)
+		for _, b := range bonuses {
+			s.Add(b)
+		}
+		s.AddUser(bonusly.UserInfoResponse{Email: ptr.NewString("erin@example.com")})
+		r := s.Report()
+
+		require.Len(t, r.Groups, 3)
+		assert.Equal(t, NoGroup, r.Groups[0].Key)
+		assert.Equal(t, "sales", r.Groups[1].Key)
+		assert.Equal(t, 1, r.Groups[1].Received)
+		assert.Equal(t, 2, r.Groups[1].Given)
+		assert.Equal(t, "eng", r.Groups[2].Key)
+		assert.Equal(t, 2, r.Groups[2].Members)
+		assert.Equal(t, 10, r.Groups[2].Received)
+		assert.Equal(t, 9, r.Groups[2].Given)
+		assert.Equal(t, 3, r.Groups[2].UniqueGivers, "should count givers from other groups")
+	})
+	t.Run("GroupsByDirectoryAttributes", func(t *testing.T) {
+		s, err := New(Options{GroupBy: GroupByDepartment})
+		require.NoError(t, err)
+		s.AddUser(*user("carol@example.com", "eng"))
+		for _, b := range bonuses {
+			s.Add(b)
+		}
+		r := s.Report()
+
+		require.Len(t, r.Groups, 1, "should group carol by her directory department")
+		assert.Equal(t, "eng", r.Groups[0].Key)
+		assert.Equal(t, 3, r.Groups[0].Members)
+	})
+	t.Run("ComputesTimeSeriesInLocation", func(t *testing.T) {
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		require.NoError(t, err)
+		s, err := New(Options{Interval: Month, Location: tokyo})
+		require.NoError(t, err)
+		for _, b := range bonuses {
+			s.Add(b)
+		}
+		r := s.Report()
+
+		assert.Equal(t, []Point{
+			{Start: time.Date(2021, time.February, 1, 0, 0, 0, 0, tokyo), Count: 4, Amount: 11},
+		}, r.TimeSeries, "January 31 23:00 UTC is in February in Tokyo")
+	})
+	t.Run("FailsWithInvalidInterval", func(t *testing.T) {
+		_, err := New(Options{Interval: "fortnight"})
+		assert.Error(t, err)
+	})
+}
+
+func TestIntervalBucket(t *testing.T) {
+	ts := time.Date(2021, time.August, 19, 15, 4, 5, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, time.August, 19, 0, 0, 0, 0, time.UTC), Day.bucket(ts))
+	assert.Equal(t, time.Date(2021, time.August, 16, 0, 0, 0, 0, time.UTC), Week.bucket(ts))
+	assert.Equal(t, time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC), Month.bucket(ts))
+	assert.Equal(t, time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC), Quarter.bucket(ts))
+}
+
+func TestParseGroupBy(t *testing.T) {
+	u := user("alice@example.com", "eng")
+	for spec, expected := range map[string]string{
+		"department":  "eng",
+		"custom:team": "eng-team",
+		"location":    "",
+	} {
+		groupBy, err := ParseGroupBy(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, groupBy(u), spec)
+	}
+	_, err := ParseGroupBy("custom:")
+	assert.Error(t, err)
+	_, err = ParseGroupBy("favorite_color")
+	assert.Error(t, err)
+}
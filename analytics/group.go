@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// NoGroup is the group of users who do not have the grouped attribute.
+const NoGroup = "(none)"
+
+// GroupBy returns the group that a user belongs to, or an empty string if the
+// user does not have the grouped attribute.
+type GroupBy func(u *bonusly.UserInfoResponse) string
+
+// GroupByDepartment groups users by their department.
+func GroupByDepartment(u *bonusly.UserInfoResponse) string {
+	return ptr.String(u.Department)
+}
+
+// GroupByLocation groups users by their location.
+func GroupByLocation(u *bonusly.UserInfoResponse) string {
+	return ptr.String(u.Location)
+}
+
+// GroupByManagerEmail groups users by their manager's email.
+func GroupByManagerEmail(u *bonusly.UserInfoResponse) string {
+	return ptr.String(u.ManagerEmail)
+}
+
+// GroupByCustomProperty groups users by the value of one of their custom
+// properties.
+func GroupByCustomProperty(name string) GroupBy {
+	return func(u *bonusly.UserInfoResponse) string {
+		v, ok := u.CustomProperties[name]
+		if !ok || v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// customPropertyPrefix is the prefix of a custom property to group by when
+// parsing a grouping.
+const customPropertyPrefix = "custom:"
+
+// ParseGroupBy parses a grouping, which is one of "department", "location",
+// "manager_email" or "custom:<property name>".
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch s {
+	case "department":
+		return GroupByDepartment, nil
+	case "location":
+		return GroupByLocation, nil
+	case "manager_email":
+		return GroupByManagerEmail, nil
+	}
+	if strings.HasPrefix(s, customPropertyPrefix) {
+		name := strings.TrimPrefix(s, customPropertyPrefix)
+		if name == "" {
+			return nil, errors.New("must specify a custom property name")
+		}
+		return GroupByCustomProperty(name), nil
+	}
+	return nil, errors.Errorf("unknown grouping '%s'", s)
+}
+
+// UserKey returns the key that identifies a user in statistics, which is
+// their email, falling back to their username or ID if it is not known.
+func UserKey(u *bonusly.UserInfoResponse) string {
+	if u == nil {
+		return ""
+	}
+	for _, key := range []*string{u.Email, u.UserName, u.ID} {
+		if key != nil && *key != "" {
+			return *key
+		}
+	}
+	return ""
+}
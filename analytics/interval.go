@@ -0,0 +1,45 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Interval is the length of the buckets of a time series.
+type Interval string
+
+// Supported intervals.
+const (
+	Day     Interval = "day"
+	Week    Interval = "week"
+	Month   Interval = "month"
+	Quarter Interval = "quarter"
+)
+
+// Validate checks that the interval is supported.
+func (i Interval) Validate() error {
+	switch i {
+	case Day, Week, Month, Quarter:
+		return nil
+	default:
+		return errors.Errorf("unsupported interval '%s'", i)
+	}
+}
+
+// bucket returns the start of the interval containing the time, in the time's
+// location. Weeks start on Monday.
+func (i Interval) bucket(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch i {
+	case Day:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case Week:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case Quarter:
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+}
@@ -0,0 +1,526 @@
+// Package anomaly detects patterns of recognition that suggest points are
+// being gamed, such as people repeatedly giving to each other, and produces a
+// report of the findings scored by severity.
+package anomaly
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Kind is a kind of anomaly.
+type Kind string
+
+// Kinds of anomalies.
+const (
+	// KindReciprocalPair is two people who both gave each other a lot.
+	KindReciprocalPair Kind = "reciprocal_pair"
+	// KindCycle is three or more people who each gave to the next, with the
+	// last giving back to the first.
+	KindCycle Kind = "cycle"
+	// KindBalanceResetBurst is a giver who gave most of their bonuses in a
+	// period just before their giving balance reset.
+	KindBalanceResetBurst Kind = "balance_reset_burst"
+	// KindRepeatedReason is a giver who gave many bonuses with the same
+	// reason.
+	KindRepeatedReason Kind = "repeated_reason"
+	// KindSelfServingAddOn is a giver who added on to bonuses that they gave
+	// or received themselves.
+	KindSelfServingAddOn Kind = "self_serving_add_on"
+)
+
+// maxEvidence is the maximum number of bonus IDs kept as evidence for each
+// finding.
+const maxEvidence = 20
+
+// Options represent options to detect anomalies. Every threshold is the
+// point at which a finding is reported, where it has a score of 1.
+type Options struct {
+	// ReciprocalMinAmount is the amount that each of a pair of people must
+	// have given the other. Defaults to 20.
+	ReciprocalMinAmount int
+	// CycleMinAmount is the amount that each person in a cycle must have
+	// given the next. Defaults to 5.
+	CycleMinAmount int
+	// MaxCycleLength is the maximum number of people in a cycle. Defaults
+	// to 4.
+	MaxCycleLength int
+	// ResetDay is the day of the month that giving balances reset. Defaults
+	// to 1.
+	ResetDay int
+	// BurstWindow is how long before a balance reset bonuses count towards a
+	// burst. Defaults to 48 hours.
+	BurstWindow time.Duration
+	// BurstFraction is the fraction of a giver's amount in a period that
+	// they must have given during the burst window. Defaults to 0.8.
+	BurstFraction float64
+	// BurstMinAmount is the amount that a giver must have given during the
+	// burst window. Defaults to 20.
+	BurstMinAmount int
+	// RepeatedReasonMin is the number of bonuses that a giver must have given
+	// with the same reason, ignoring amounts, mentions and case. Defaults to
+	// 3.
+	RepeatedReasonMin int
+	// SelfServingAddOnMin is the number of self-serving add-ons that a giver
+	// must have given. Defaults to 1.
+	SelfServingAddOnMin int
+	// MinScore is the minimum score of reported findings.
+	MinScore float64
+	// Location is the time zone of balance resets. Defaults to UTC.
+	Location *time.Location
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	setDefault := func(v *int, def int) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	setDefault(&o.ReciprocalMinAmount, 20)
+	setDefault(&o.CycleMinAmount, 5)
+	setDefault(&o.MaxCycleLength, 4)
+	setDefault(&o.ResetDay, 1)
+	setDefault(&o.BurstMinAmount, 20)
+	setDefault(&o.RepeatedReasonMin, 3)
+	setDefault(&o.SelfServingAddOnMin, 1)
+	if o.BurstWindow == 0 {
+		o.BurstWindow = 48 * time.Hour
+	}
+	if o.BurstFraction == 0 {
+		o.BurstFraction = 0.8
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+
+	if o.ReciprocalMinAmount < 0 || o.CycleMinAmount < 0 || o.BurstMinAmount < 0 ||
+		o.RepeatedReasonMin < 0 || o.SelfServingAddOnMin < 0 || o.BurstWindow < 0 || o.MinScore < 0 {
+		return errors.New("thresholds cannot be negative")
+	}
+	if o.MaxCycleLength < 3 {
+		return errors.New("max cycle length must be at least 3")
+	}
+	if o.ResetDay < 1 || o.ResetDay > 28 {
+		return errors.New("reset day must be between 1 and 28")
+	}
+	if o.BurstFraction < 0 || o.BurstFraction > 1 {
+		return errors.New("burst fraction must be between 0 and 1")
+	}
+	return nil
+}
+
+// Finding is a detected anomaly.
+type Finding struct {
+	Kind Kind `json:"kind"`
+	// Score is how far the anomaly exceeds its threshold, where 1 is at the
+	// threshold.
+	Score       float64  `json:"score"`
+	People      []string `json:"people"`
+	Description string   `json:"description"`
+	// BonusIDs are the IDs of some of the bonuses involved.
+	BonusIDs []string `json:"bonus_ids,omitempty"`
+}
+
+// PersonScore is the total score of the findings involving a person.
+type PersonScore struct {
+	Person   string  `json:"person"`
+	Score    float64 `json:"score"`
+	Findings int     `json:"findings"`
+}
+
+// Report is the anomalies detected in the bonuses.
+type Report struct {
+	// Findings are sorted by score, highest first.
+	Findings []Finding `json:"findings"`
+	// People are the people involved in findings, sorted by score, highest
+	// first.
+	People []PersonScore `json:"people"`
+}
+
+// evidence is an amount and the bonuses that make it up.
+type evidence struct {
+	amount   int
+	count    int
+	bonusIDs []string
+}
+
+func (e *evidence) add(amount int, id string) {
+	e.amount += amount
+	e.count++
+	if id != "" && len(e.bonusIDs) < maxEvidence {
+		e.bonusIDs = append(e.bonusIDs, id)
+	}
+}
+
+type pair struct {
+	from, to string
+}
+
+type periodKey struct {
+	giver string
+	start time.Time
+}
+
+type period struct {
+	total evidence
+	burst evidence
+}
+
+type reasonKey struct {
+	giver  string
+	reason string
+}
+
+// Detector accumulates bonuses to detect anomalies in.
+type Detector struct {
+	opts    Options
+	edges   map[pair]*evidence
+	periods map[periodKey]*period
+	reasons map[reasonKey]*evidence
+	addOns  map[string]*evidence
+}
+
+// NewDetector returns a detector with no bonuses added.
+func NewDetector(opts Options) (*Detector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Detector{
+		opts:    opts,
+		edges:   map[pair]*evidence{},
+		periods: map[periodKey]*period{},
+		reasons: map[reasonKey]*evidence{},
+		addOns:  map[string]*evidence{},
+	}, nil
+}
+
+// Add adds a bonus and its child bonuses (add-ons).
+func (d *Detector) Add(b bonusly.BonusResponse) {
+	d.add(b, nil)
+}
+
+func (d *Detector) add(b bonusly.BonusResponse, parent *bonusly.BonusResponse) {
+	giver := analytics.UserKey(b.Giver)
+	receiver := analytics.UserKey(b.Receiver)
+	id := ptr.String(b.ID)
+	amount := ptr.Int(b.Amount)
+
+	if giver != "" && receiver != "" && giver != receiver {
+		e, ok := d.edges[pair{from: giver, to: receiver}]
+		if !ok {
+			e = &evidence{}
+			d.edges[pair{from: giver, to: receiver}] = e
+		}
+		e.add(amount, id)
+	}
+
+	if giver != "" && b.CreatedAt != nil {
+		createdAt := b.CreatedAt.In(d.opts.Location)
+		start, end := d.balancePeriod(createdAt)
+		key := periodKey{giver: giver, start: start}
+		p, ok := d.periods[key]
+		if !ok {
+			p = &period{}
+			d.periods[key] = p
+		}
+		p.total.add(amount, id)
+		if end.Sub(createdAt) <= d.opts.BurstWindow {
+			p.burst.add(amount, id)
+		}
+	}
+
+	if reason := normalizeReason(ptr.String(b.Reason)); giver != "" && reason != "" {
+		key := reasonKey{giver: giver, reason: reason}
+		e, ok := d.reasons[key]
+		if !ok {
+			e = &evidence{}
+			d.reasons[key] = e
+		}
+		e.add(amount, id)
+	}
+
+	if parent != nil && giver != "" {
+		parentGiver := analytics.UserKey(parent.Giver)
+		parentReceiver := analytics.UserKey(parent.Receiver)
+		if giver == parentGiver || giver == parentReceiver {
+			e, ok := d.addOns[giver]
+			if !ok {
+				e = &evidence{}
+				d.addOns[giver] = e
+			}
+			e.add(amount, id)
+		}
+	}
+
+	for _, child := range b.ChildBonuses {
+		d.add(child, &b)
+	}
+}
+
+// balancePeriod returns the start and end of the giving balance period that
+// contains the time.
+func (d *Detector) balancePeriod(t time.Time) (time.Time, time.Time) {
+	y, m, day := t.Date()
+	if day < d.opts.ResetDay {
+		m--
+	}
+	start := time.Date(y, m, d.opts.ResetDay, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+var (
+	reasonAmountRegexp  = regexp.MustCompile(`(^|\s)\+\d+\b`)
+	reasonMentionRegexp = regexp.MustCompile(`(^|\s)@[\w.-]+`)
+)
+
+// normalizeReason returns the reason without amounts and mentions, in lower
+// case and with whitespace collapsed, so that the same message given to
+// different people matches.
+func normalizeReason(reason string) string {
+	reason = reasonAmountRegexp.ReplaceAllString(reason, " ")
+	reason = reasonMentionRegexp.ReplaceAllString(reason, " ")
+	return strings.Join(strings.Fields(strings.ToLower(reason)), " ")
+}
+
+// Report returns the anomalies detected in the bonuses added so far.
+func (d *Detector) Report() *Report {
+	var findings []Finding
+	findings = append(findings, d.reciprocalPairs()...)
+	findings = append(findings, d.cycles()...)
+	findings = append(findings, d.bursts()...)
+	findings = append(findings, d.repeatedReasons()...)
+	findings = append(findings, d.selfServingAddOns()...)
+	if d.opts.MinScore > 0 {
+		kept := findings[:0]
+		for _, f := range findings {
+			if f.Score >= d.opts.MinScore {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Score != findings[j].Score {
+			return findings[i].Score > findings[j].Score
+		}
+		return findings[i].Description < findings[j].Description
+	})
+
+	scores := map[string]*PersonScore{}
+	for _, f := range findings {
+		for _, person := range f.People {
+			s, ok := scores[person]
+			if !ok {
+				s = &PersonScore{Person: person}
+				scores[person] = s
+			}
+			s.Score += f.Score
+			s.Findings++
+		}
+	}
+	people := make([]PersonScore, 0, len(scores))
+	for _, s := range scores {
+		people = append(people, *s)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].Score != people[j].Score {
+			return people[i].Score > people[j].Score
+		}
+		return people[i].Person < people[j].Person
+	})
+
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return &Report{Findings: findings, People: people}
+}
+
+func (d *Detector) reciprocalPairs() []Finding {
+	var findings []Finding
+	for p, forward := range d.edges {
+		if p.from > p.to {
+			continue
+		}
+		backward, ok := d.edges[pair{from: p.to, to: p.from}]
+		if !ok {
+			continue
+		}
+		least := minInt(forward.amount, backward.amount)
+		if least < d.opts.ReciprocalMinAmount {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:   KindReciprocalPair,
+			Score:  score(least, d.opts.ReciprocalMinAmount),
+			People: []string{p.from, p.to},
+			Description: fmt.Sprintf("%s gave %s %d in %d bonuses and received %d in %d bonuses back",
+				p.from, p.to, forward.amount, forward.count, backward.amount, backward.count),
+			BonusIDs: concatIDs(forward.bonusIDs, backward.bonusIDs),
+		})
+	}
+	return findings
+}
+
+func (d *Detector) cycles() []Finding {
+	out := map[string][]string{}
+	for p, e := range d.edges {
+		if e.amount >= d.opts.CycleMinAmount {
+			out[p.from] = append(out[p.from], p.to)
+		}
+	}
+	for from := range out {
+		sort.Strings(out[from])
+	}
+
+	var findings []Finding
+	for _, cycle := range findCycles(out, d.opts.MaxCycleLength) {
+		least := -1
+		var ids []string
+		var steps []string
+		for i, from := range cycle {
+			to := cycle[(i+1)%len(cycle)]
+			e := d.edges[pair{from: from, to: to}]
+			if least < 0 || e.amount < least {
+				least = e.amount
+			}
+			ids = concatIDs(ids, e.bonusIDs)
+			steps = append(steps, fmt.Sprintf("%s gave %s %d", from, to, e.amount))
+		}
+		findings = append(findings, Finding{
+			Kind:        KindCycle,
+			Score:       score(least, d.opts.CycleMinAmount),
+			People:      cycle,
+			Description: "giving cycle: " + strings.Join(steps, ", "),
+			BonusIDs:    ids,
+		})
+	}
+	return findings
+}
+
+// findCycles returns the simple cycles of at least 3 and at most maxLength
+// nodes. Each cycle is returned once, starting at its least node.
+func findCycles(out map[string][]string, maxLength int) [][]string {
+	nodes := make([]string, 0, len(out))
+	for n := range out {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	var cycles [][]string
+	for _, start := range nodes {
+		path := []string{start}
+		onPath := map[string]bool{start: true}
+		var visit func(n string)
+		visit = func(n string) {
+			for _, next := range out[n] {
+				if next == start && len(path) >= 3 {
+					cycles = append(cycles, append([]string(nil), path...))
+					continue
+				}
+				// Only visit nodes after the start so that each cycle is only
+				// found from its least node.
+				if next <= start || onPath[next] || len(path) >= maxLength {
+					continue
+				}
+				path = append(path, next)
+				onPath[next] = true
+				visit(next)
+				onPath[next] = false
+				path = path[:len(path)-1]
+			}
+		}
+		visit(start)
+	}
+	return cycles
+}
+
+func (d *Detector) bursts() []Finding {
+	var findings []Finding
+	for key, p := range d.periods {
+		if p.burst.amount < d.opts.BurstMinAmount || p.total.amount == 0 {
+			continue
+		}
+		fraction := float64(p.burst.amount) / float64(p.total.amount)
+		if fraction < d.opts.BurstFraction {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:   KindBalanceResetBurst,
+			Score:  fraction / d.opts.BurstFraction * score(p.burst.amount, d.opts.BurstMinAmount),
+			People: []string{key.giver},
+			Description: fmt.Sprintf("%s gave %d of %d (%.0f%%) in the %s before the balance reset on %s",
+				key.giver, p.burst.amount, p.total.amount, 100*fraction, d.opts.BurstWindow,
+				key.start.AddDate(0, 1, 0).Format("2006-01-02")),
+			BonusIDs: p.burst.bonusIDs,
+		})
+	}
+	return findings
+}
+
+func (d *Detector) repeatedReasons() []Finding {
+	var findings []Finding
+	for key, e := range d.reasons {
+		if e.count < d.opts.RepeatedReasonMin {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:        KindRepeatedReason,
+			Score:       score(e.count, d.opts.RepeatedReasonMin),
+			People:      []string{key.giver},
+			Description: fmt.Sprintf("%s gave %d bonuses with the reason %q", key.giver, e.count, key.reason),
+			BonusIDs:    e.bonusIDs,
+		})
+	}
+	return findings
+}
+
+func (d *Detector) selfServingAddOns() []Finding {
+	var findings []Finding
+	for giver, e := range d.addOns {
+		if e.count < d.opts.SelfServingAddOnMin {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:        KindSelfServingAddOn,
+			Score:       score(e.count, d.opts.SelfServingAddOnMin),
+			People:      []string{giver},
+			Description: fmt.Sprintf("%s gave %d add-ons worth %d to bonuses they gave or received", giver, e.count, e.amount),
+			BonusIDs:    e.bonusIDs,
+		})
+	}
+	return findings
+}
+
+// score returns how far the value exceeds the threshold, where 1 is at the
+// threshold.
+func score(value, threshold int) float64 {
+	if threshold <= 0 {
+		return float64(value)
+	}
+	return float64(value) / float64(threshold)
+}
+
+func concatIDs(a, b []string) []string {
+	ids := append(append([]string(nil), a...), b...)
+	if len(ids) > maxEvidence {
+		ids = ids[:maxEvidence]
+	}
+	return ids
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,214 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func user(email string) *bonusly.UserInfoResponse {
+	return &bonusly.UserInfoResponse{Email: ptr.NewString(email)}
+}
+
+var midMonth = time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+func bonus(id, giver, receiver string, amount int, reason string, createdAt time.Time) bonusly.BonusResponse {
+	return bonusly.BonusResponse{
+		ID:        ptr.NewString(id),
+		Giver:     user(giver),
+		Receiver:  user(receiver),
+		Amount:    ptr.NewInt(amount),
+		Reason:    ptr.NewString(reason),
+		CreatedAt: &createdAt,
+	}
+}
+
+func findingsOfKind(r *Report, kind Kind) []Finding {
+	var found []Finding
+	for _, f := range r.Findings {
+		if f.Kind == kind {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+func TestOptionsValidate(t *testing.T) {
+	t.Run("SetsDefaults", func(t *testing.T) {
+		var opts Options
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, 20, opts.ReciprocalMinAmount)
+		assert.Equal(t, 4, opts.MaxCycleLength)
+		assert.Equal(t, 1, opts.ResetDay)
+		assert.Equal(t, 48*time.Hour, opts.BurstWindow)
+		assert.Equal(t, 0.8, opts.BurstFraction)
+		assert.Equal(t, time.UTC, opts.Location)
+	})
+	t.Run("FailsWithShortCycles", func(t *testing.T) {
+		opts := Options{MaxCycleLength: 2}
+		assert.Error(t, opts.Validate())
+	})
+	t.Run("FailsWithInvalidResetDay", func(t *testing.T) {
+		opts := Options{ResetDay: 31}
+		assert.Error(t, opts.Validate())
+	})
+	t.Run("FailsWithInvalidBurstFraction", func(t *testing.T) {
+		opts := Options{BurstFraction: 1.5}
+		assert.Error(t, opts.Validate())
+	})
+}
+
+func TestDetector(t *testing.T) {
+	t.Run("ReciprocalPair", func(t *testing.T) {
+		d, err := NewDetector(Options{ReciprocalMinAmount: 10})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 10, "thanks for the review", midMonth))
+		d.Add(bonus("2", "bob", "alice", 5, "thanks for the fix", midMonth))
+		d.Add(bonus("3", "bob", "alice", 15, "thanks for the docs", midMonth))
+		d.Add(bonus("4", "alice", "carol", 50, "thanks for lunch", midMonth))
+		d.Add(bonus("5", "carol", "alice", 5, "thanks for help", midMonth))
+
+		found := findingsOfKind(d.Report(), KindReciprocalPair)
+		require.Len(t, found, 1, "should only flag pairs where both directions exceed the threshold")
+		assert.Equal(t, []string{"alice", "bob"}, found[0].People)
+		assert.Equal(t, 1.0, found[0].Score)
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, found[0].BonusIDs)
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		d, err := NewDetector(Options{CycleMinAmount: 5})
+		require.NoError(t, err)
+		d.Add(bonus("1", "bob", "carol", 10, "a", midMonth))
+		d.Add(bonus("2", "carol", "alice", 5, "b", midMonth))
+		d.Add(bonus("3", "alice", "bob", 20, "c", midMonth))
+		d.Add(bonus("4", "alice", "dave", 20, "d", midMonth))
+		d.Add(bonus("5", "dave", "erin", 1, "e", midMonth))
+		d.Add(bonus("6", "erin", "alice", 20, "f", midMonth))
+
+		found := findingsOfKind(d.Report(), KindCycle)
+		require.Len(t, found, 1, "should find each cycle once and ignore cycles with small edges")
+		assert.Equal(t, []string{"alice", "bob", "carol"}, found[0].People)
+		assert.Equal(t, 1.0, found[0].Score)
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, found[0].BonusIDs)
+	})
+	t.Run("CycleLongerThanMax", func(t *testing.T) {
+		d, err := NewDetector(Options{MaxCycleLength: 3})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 10, "a", midMonth))
+		d.Add(bonus("2", "bob", "carol", 10, "b", midMonth))
+		d.Add(bonus("3", "carol", "dave", 10, "c", midMonth))
+		d.Add(bonus("4", "dave", "alice", 10, "d", midMonth))
+
+		assert.Empty(t, findingsOfKind(d.Report(), KindCycle))
+	})
+	t.Run("BalanceResetBurst", func(t *testing.T) {
+		d, err := NewDetector(Options{BurstMinAmount: 10, ResetDay: 1})
+		require.NoError(t, err)
+		beforeReset := time.Date(2021, time.March, 31, 20, 0, 0, 0, time.UTC)
+		d.Add(bonus("1", "alice", "bob", 2, "a", midMonth))
+		d.Add(bonus("2", "alice", "bob", 10, "b", beforeReset))
+		d.Add(bonus("3", "alice", "carol", 10, "c", beforeReset))
+		d.Add(bonus("4", "bob", "carol", 10, "d", midMonth))
+		d.Add(bonus("5", "bob", "carol", 10, "e", beforeReset))
+		d.Add(bonus("6", "carol", "alice", 20, "f", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)))
+
+		found := findingsOfKind(d.Report(), KindBalanceResetBurst)
+		require.Len(t, found, 1, "should only flag givers who gave most of their points just before the reset")
+		assert.Equal(t, []string{"alice"}, found[0].People)
+		assert.InDelta(t, (20.0/22.0)/0.8*2, found[0].Score, 0.0001)
+		assert.ElementsMatch(t, []string{"2", "3"}, found[0].BonusIDs)
+		assert.Contains(t, found[0].Description, "2021-04-01")
+	})
+	t.Run("BalanceResetBurstRespectsLocation", func(t *testing.T) {
+		loc := time.FixedZone("UTC-10", -10*60*60)
+		d, err := NewDetector(Options{BurstMinAmount: 10, Location: loc})
+		require.NoError(t, err)
+		// This is April 1 in UTC but still March 31 in the location.
+		d.Add(bonus("1", "alice", "bob", 10, "a", time.Date(2021, time.April, 1, 8, 0, 0, 0, time.UTC)))
+
+		found := findingsOfKind(d.Report(), KindBalanceResetBurst)
+		require.Len(t, found, 1)
+		assert.Contains(t, found[0].Description, "2021-04-01")
+	})
+	t.Run("RepeatedReason", func(t *testing.T) {
+		d, err := NewDetector(Options{RepeatedReasonMin: 3})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 1, "+1 @bob Great  job #teamwork", midMonth))
+		d.Add(bonus("2", "alice", "carol", 5, "@carol +5 great job #teamwork", midMonth))
+		d.Add(bonus("3", "alice", "dave", 2, "+2 @dave.smith great job #TeamWork", midMonth))
+		d.Add(bonus("4", "alice", "dave", 2, "+2 @dave.smith great job #ownership", midMonth))
+		d.Add(bonus("5", "bob", "dave", 2, "+2 @dave.smith great job #teamwork", midMonth))
+
+		found := findingsOfKind(d.Report(), KindRepeatedReason)
+		require.Len(t, found, 1)
+		assert.Equal(t, []string{"alice"}, found[0].People)
+		assert.Equal(t, 1.0, found[0].Score)
+		assert.Contains(t, found[0].Description, `"great job #teamwork"`)
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, found[0].BonusIDs)
+	})
+	t.Run("SelfServingAddOn", func(t *testing.T) {
+		d, err := NewDetector(Options{})
+		require.NoError(t, err)
+		parent := bonus("1", "alice", "bob", 5, "a", midMonth)
+		parent.ChildBonuses = []bonusly.BonusResponse{
+			bonus("2", "alice", "bob", 5, "topping up my own bonus", midMonth),
+			bonus("3", "bob", "bob", 5, "adding on to my own bonus", midMonth),
+			bonus("4", "carol", "bob", 5, "+1", midMonth),
+		}
+		d.Add(parent)
+
+		found := findingsOfKind(d.Report(), KindSelfServingAddOn)
+		require.Len(t, found, 2)
+		var people []string
+		for _, f := range found {
+			people = append(people, f.People...)
+			assert.Equal(t, 1.0, f.Score)
+		}
+		assert.ElementsMatch(t, []string{"alice", "bob"}, people)
+	})
+	t.Run("ReportIsSortedByScore", func(t *testing.T) {
+		d, err := NewDetector(Options{ReciprocalMinAmount: 10, RepeatedReasonMin: 2})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 30, "thanks", midMonth))
+		d.Add(bonus("2", "bob", "alice", 30, "thanks", midMonth))
+		d.Add(bonus("3", "carol", "dave", 1, "thanks", midMonth))
+		d.Add(bonus("4", "carol", "erin", 1, "thanks", midMonth))
+
+		r := d.Report()
+		require.Len(t, r.Findings, 2)
+		assert.Equal(t, KindReciprocalPair, r.Findings[0].Kind)
+		assert.Equal(t, 3.0, r.Findings[0].Score)
+		assert.Equal(t, KindRepeatedReason, r.Findings[1].Kind)
+
+		require.Len(t, r.People, 3)
+		assert.Equal(t, PersonScore{Person: "alice", Score: 3, Findings: 1}, r.People[0])
+		assert.Equal(t, PersonScore{Person: "bob", Score: 3, Findings: 1}, r.People[1])
+		assert.Equal(t, PersonScore{Person: "carol", Score: 1, Findings: 1}, r.People[2])
+	})
+	t.Run("MinScore", func(t *testing.T) {
+		d, err := NewDetector(Options{ReciprocalMinAmount: 10, RepeatedReasonMin: 2, MinScore: 2})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 30, "thanks", midMonth))
+		d.Add(bonus("2", "bob", "alice", 30, "thanks", midMonth))
+		d.Add(bonus("3", "carol", "dave", 1, "thanks", midMonth))
+		d.Add(bonus("4", "carol", "erin", 1, "thanks", midMonth))
+
+		r := d.Report()
+		require.Len(t, r.Findings, 1)
+		assert.Equal(t, KindReciprocalPair, r.Findings[0].Kind)
+		require.Len(t, r.People, 2, "should only score people in reported findings")
+	})
+	t.Run("NoFindings", func(t *testing.T) {
+		d, err := NewDetector(Options{})
+		require.NoError(t, err)
+		d.Add(bonus("1", "alice", "bob", 1, "thanks", midMonth))
+
+		r := d.Report()
+		assert.Empty(t, r.Findings)
+		assert.NotNil(t, r.Findings)
+		assert.Empty(t, r.People)
+	})
+}
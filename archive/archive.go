@@ -0,0 +1,443 @@
+// Package archive keeps a local SQLite archive of bonuses that is synced
+// incrementally from Bonusly, so that they can be queried without the API.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+
+	// Register the SQLite driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// timeFormat is how times are stored. It has a fixed width so that times
+// sort chronologically as text.
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// lastCreatedAtKey is the sync state key of the creation time of the most
+// recent archived bonus.
+const lastCreatedAtKey = "last_created_at"
+
+// Archive is a SQLite database of bonuses.
+type Archive struct {
+	db *sql.DB
+}
+
+// Open opens the archive in the SQLite database at the given path, creating
+// it if it does not exist.
+func Open(path string) (*Archive, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=off&_busy_timeout=5000")
+	if err != nil {
+		return nil, errors.Wrap(err, "opening database")
+	}
+	// SQLite only allows one writer at a time.
+	db.SetMaxOpenConns(1)
+
+	a := &Archive{db: db}
+	if err := a.migrate(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "migrating database")
+	}
+	return a, nil
+}
+
+func (a *Archive) migrate() error {
+	var version int
+	if err := a.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return errors.Wrap(err, "getting schema version")
+	}
+	if version > schemaVersion {
+		return errors.Errorf("database schema version %d is newer than supported version %d", version, schemaVersion)
+	}
+	if _, err := a.db.Exec(schema); err != nil {
+		return errors.Wrap(err, "creating tables")
+	}
+	_, err := a.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return errors.Wrap(err, "setting schema version")
+}
+
+// DB returns the underlying database so that it can be queried directly.
+func (a *Archive) DB() *sql.DB {
+	return a.db
+}
+
+// Close closes the archive.
+func (a *Archive) Close() error {
+	return errors.WithStack(a.db.Close())
+}
+
+// SyncOptions represent options to sync the archive.
+type SyncOptions struct {
+	// Full syncs all bonuses instead of only recent ones, and marks every
+	// archived bonus that no longer exists as deleted.
+	Full bool
+	// Overlap is how long before the most recently archived bonus an
+	// incremental sync starts, so that recent edits and deletions are picked
+	// up. Defaults to 7 days.
+	Overlap time.Duration
+	// PageSize is the number of bonuses to get per request. Defaults to 100.
+	PageSize uint
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *SyncOptions) Validate() error {
+	if o.Overlap < 0 {
+		return errors.New("overlap cannot be negative")
+	}
+	if o.Overlap == 0 {
+		o.Overlap = 7 * 24 * time.Hour
+	}
+	return nil
+}
+
+// SyncResult summarizes the changes made to the archive by a sync.
+type SyncResult struct {
+	// Since is when the synced bonuses start, which is zero for a full sync.
+	Since     time.Time
+	Added     int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// Sync pulls bonuses, including their child bonuses, from Bonusly into the
+// archive. Unless it is a full sync, only bonuses created since shortly
+// before the most recently archived bonus are pulled. Archived bonuses that
+// are edited are updated and their previous content is kept as a revision.
+// Archived bonuses in the synced period that no longer exist are marked as
+// deleted.
+func (a *Archive) Sync(ctx context.Context, c bonusly.Client, opts SyncOptions) (*SyncResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	res := &SyncResult{}
+	if !opts.Full {
+		lastCreatedAt, err := a.lastCreatedAt()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting last sync state")
+		}
+		if !lastCreatedAt.IsZero() {
+			res.Since = lastCreatedAt.Add(-opts.Overlap)
+		}
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	s := &syncer{
+		tx:   tx,
+		now:  time.Now().UTC(),
+		seen: map[string]bool{},
+		res:  res,
+	}
+	req := bonusly.ListBonusesRequest{
+		Limit:           opts.PageSize,
+		StartTime:       res.Since,
+		IncludeChildren: true,
+	}
+	if err := bonusly.EachBonus(ctx, c, req, func(b bonusly.BonusResponse) error {
+		return s.archiveBonus(b, "")
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.markDeleted(res.Since, opts.Full); err != nil {
+		return nil, errors.Wrap(err, "marking deleted bonuses")
+	}
+	if !s.lastCreatedAt.IsZero() {
+		if err := setSyncState(tx, lastCreatedAtKey, s.lastCreatedAt.Format(timeFormat)); err != nil {
+			return nil, errors.Wrap(err, "saving sync state")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing transaction")
+	}
+	return res, nil
+}
+
+func (a *Archive) lastCreatedAt() (time.Time, error) {
+	var value string
+	err := a.db.QueryRow("SELECT value FROM sync_state WHERE key = ?", lastCreatedAtKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+	t, err := time.Parse(timeFormat, value)
+	return t, errors.Wrapf(err, "parsing time '%s'", value)
+}
+
+func setSyncState(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(`INSERT INTO sync_state (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return errors.WithStack(err)
+}
+
+// syncer archives the bonuses for a single sync.
+type syncer struct {
+	tx  *sql.Tx
+	now time.Time
+	// seen are the IDs of the bonuses that were synced, mapped to whether
+	// they are top-level bonuses.
+	seen          map[string]bool
+	lastCreatedAt time.Time
+	res           *SyncResult
+}
+
+// content is the part of a bonus that changes when it is edited.
+type content struct {
+	Reason     string `json:"reason"`
+	Amount     int    `json:"amount"`
+	Value      string `json:"value"`
+	GiverID    string `json:"giver_id"`
+	ReceiverID string `json:"receiver_id"`
+}
+
+func (c content) hash() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// archiveBonus adds or updates the bonus and its child bonuses.
+func (s *syncer) archiveBonus(b bonusly.BonusResponse, parentID string) error {
+	id := ptr.String(b.ID)
+	if id == "" {
+		return errors.New("bonus has no ID")
+	}
+	if s.seen[id] {
+		return nil
+	}
+	s.seen[id] = parentID == ""
+
+	var createdAt time.Time
+	if b.CreatedAt != nil {
+		createdAt = b.CreatedAt.UTC()
+	}
+	if parentID == "" && createdAt.After(s.lastCreatedAt) {
+		s.lastCreatedAt = createdAt
+	}
+
+	giverID, err := s.archiveUser(b.Giver)
+	if err != nil {
+		return errors.Wrapf(err, "archiving giver of bonus '%s'", id)
+	}
+	receiverID, err := s.archiveUser(b.Receiver)
+	if err != nil {
+		return errors.Wrapf(err, "archiving receiver of bonus '%s'", id)
+	}
+
+	c := content{
+		Reason:     ptr.String(b.Reason),
+		Amount:     ptr.Int(b.Amount),
+		Value:      b.Value,
+		GiverID:    giverID,
+		ReceiverID: receiverID,
+	}
+	hash, err := c.hash()
+	if err != nil {
+		return errors.Wrap(err, "hashing bonus content")
+	}
+	children := b.ChildBonuses
+	b.ChildBonuses = nil
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err, "marshalling bonus")
+	}
+
+	var (
+		oldHash, oldReason, oldRaw string
+		oldAmount                  int
+		deletedAt                  sql.NullString
+	)
+	err = s.tx.QueryRow("SELECT content_hash, reason, amount, raw, deleted_at FROM bonuses WHERE id = ?", id).
+		Scan(&oldHash, &oldReason, &oldAmount, &oldRaw, &deletedAt)
+	now := s.now.Format(timeFormat)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := s.tx.Exec(`INSERT INTO bonuses (
+			id, parent_id, created_at, giver_id, reason, reason_html, amount, amount_with_currency, value, via,
+			child_count, family_amount, content_hash, raw, first_seen_at, last_seen_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, nullString(parentID), createdAt.Format(timeFormat), nullString(giverID), c.Reason, b.ReasonHTML,
+			c.Amount, b.AmountWithCurrency, c.Value, b.Via, b.ChildCount, b.FamilyAmount, hash, string(raw),
+			now, now, now); err != nil {
+			return errors.Wrapf(err, "inserting bonus '%s'", id)
+		}
+		s.res.Added++
+	case err != nil:
+		return errors.Wrapf(err, "getting archived bonus '%s'", id)
+	case oldHash != hash || deletedAt.Valid:
+		if oldHash != hash {
+			if _, err := s.tx.Exec(`INSERT INTO bonus_revisions (bonus_id, reason, amount, content_hash, raw, replaced_at)
+				VALUES (?, ?, ?, ?, ?, ?)`, id, oldReason, oldAmount, oldHash, oldRaw, now); err != nil {
+				return errors.Wrapf(err, "recording revision of bonus '%s'", id)
+			}
+		}
+		if _, err := s.tx.Exec(`UPDATE bonuses SET
+			parent_id = COALESCE(?, parent_id), giver_id = ?, reason = ?, reason_html = ?, amount = ?,
+			amount_with_currency = ?, value = ?, via = ?, child_count = ?, family_amount = ?, content_hash = ?,
+			raw = ?, last_seen_at = ?, updated_at = ?, deleted_at = NULL
+			WHERE id = ?`,
+			nullString(parentID), nullString(giverID), c.Reason, b.ReasonHTML, c.Amount, b.AmountWithCurrency,
+			c.Value, b.Via, b.ChildCount, b.FamilyAmount, hash, string(raw), now, now, id); err != nil {
+			return errors.Wrapf(err, "updating bonus '%s'", id)
+		}
+		s.res.Updated++
+	default:
+		// The child count and family amount change when add-ons are given,
+		// which is not an edit of the bonus itself.
+		if _, err := s.tx.Exec(`UPDATE bonuses SET
+			parent_id = COALESCE(?, parent_id), child_count = ?, family_amount = ?, raw = ?, last_seen_at = ?
+			WHERE id = ?`,
+			nullString(parentID), b.ChildCount, b.FamilyAmount, string(raw), now, id); err != nil {
+			return errors.Wrapf(err, "updating bonus '%s'", id)
+		}
+		s.res.Unchanged++
+	}
+
+	if err := s.archiveRelations(id, receiverID, c); err != nil {
+		return errors.Wrapf(err, "archiving receivers and hashtags of bonus '%s'", id)
+	}
+
+	for _, child := range children {
+		if err := s.archiveBonus(child, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveRelations replaces the bonus's receivers and hashtags.
+func (s *syncer) archiveRelations(id, receiverID string, c content) error {
+	if _, err := s.tx.Exec("DELETE FROM bonus_receivers WHERE bonus_id = ?", id); err != nil {
+		return errors.WithStack(err)
+	}
+	if receiverID != "" {
+		if _, err := s.tx.Exec("INSERT INTO bonus_receivers (bonus_id, user_id, amount) VALUES (?, ?, ?)",
+			id, receiverID, c.Amount); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := s.tx.Exec("DELETE FROM bonus_hashtags WHERE bonus_id = ?", id); err != nil {
+		return errors.WithStack(err)
+	}
+	hashtags := bonusly.ReasonHashtags(c.Reason)
+	if c.Value != "" {
+		hashtags = append(hashtags, c.Value)
+	}
+	for _, hashtag := range hashtags {
+		if _, err := s.tx.Exec("INSERT OR IGNORE INTO bonus_hashtags (bonus_id, hashtag) VALUES (?, ?)",
+			id, hashtag); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// archiveUser adds or updates the user and returns their ID, or an empty
+// string if there is no user. Fields that the user info does not include are
+// left unchanged.
+func (s *syncer) archiveUser(u *bonusly.UserInfoResponse) (string, error) {
+	id := userID(u)
+	if id == "" {
+		return "", nil
+	}
+	_, err := s.tx.Exec(`INSERT INTO users (id, username, email, display_name, department, location, manager_email, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			username = COALESCE(excluded.username, username),
+			email = COALESCE(excluded.email, email),
+			display_name = COALESCE(excluded.display_name, display_name),
+			department = COALESCE(excluded.department, department),
+			location = COALESCE(excluded.location, location),
+			manager_email = COALESCE(excluded.manager_email, manager_email),
+			updated_at = excluded.updated_at`,
+		id, u.UserName, u.Email, u.DisplayName, u.Department, u.Location, u.ManagerEmail, s.now.Format(timeFormat))
+	return id, errors.WithStack(err)
+}
+
+// markDeleted marks the archived bonuses in the synced period that were not
+// seen as deleted. In an incremental sync, a child bonus is only checked if
+// its parent was seen, since its parent may have been created before the
+// synced period.
+func (s *syncer) markDeleted(since time.Time, full bool) error {
+	rows, err := s.tx.Query("SELECT id, parent_id, created_at FROM bonuses WHERE deleted_at IS NULL")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var deleted []string
+	for rows.Next() {
+		var (
+			id, createdAt string
+			parentID      sql.NullString
+		)
+		if err := rows.Scan(&id, &parentID, &createdAt); err != nil {
+			rows.Close()
+			return errors.WithStack(err)
+		}
+		if _, ok := s.seen[id]; ok {
+			continue
+		}
+		inPeriod := createdAt >= since.UTC().Format(timeFormat)
+		if parentID.Valid {
+			_, parentSeen := s.seen[parentID.String]
+			inPeriod = parentSeen
+		}
+		if full || inPeriod {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := s.now.Format(timeFormat)
+	for _, id := range deleted {
+		if _, err := s.tx.Exec("UPDATE bonuses SET deleted_at = ?, updated_at = ? WHERE id = ?", now, now, id); err != nil {
+			return errors.Wrapf(err, "marking bonus '%s' as deleted", id)
+		}
+	}
+	s.res.Deleted += len(deleted)
+	return nil
+}
+
+// userID returns the ID of the user, falling back to their email or username
+// if the user info does not include it.
+func userID(u *bonusly.UserInfoResponse) string {
+	if u == nil {
+		return ""
+	}
+	for _, id := range []*string{u.ID, u.Email, u.UserName} {
+		if id != nil && *id != "" {
+			return *id
+		}
+	}
+	return ""
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient lists its bonuses a page at a time, filtered by start time.
+type fakeClient struct {
+	*bonusly.MockClient
+	bonuses []bonusly.BonusResponse
+}
+
+func (c *fakeClient) ListBonuses(_ context.Context, req bonusly.ListBonusesRequest) ([]bonusly.BonusResponse, error) {
+	var matching []bonusly.BonusResponse
+	for _, b := range c.bonuses {
+		if !req.StartTime.IsZero() && b.CreatedAt.Before(req.StartTime) {
+			continue
+		}
+		matching = append(matching, b)
+	}
+	if int(req.Skip) >= len(matching) {
+		return nil, nil
+	}
+	end := int(req.Skip + req.Limit)
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[req.Skip:end], nil
+}
+
+func (c *fakeClient) remove(id string) {
+	for i, b := range c.bonuses {
+		if *b.ID == id {
+			c.bonuses = append(c.bonuses[:i], c.bonuses[i+1:]...)
+			return
+		}
+	}
+}
+
+func makeBonus(id string, createdAt time.Time, giver, receiver, reason string, amount int) bonusly.BonusResponse {
+	return bonusly.BonusResponse{
+		ID:        &id,
+		CreatedAt: &createdAt,
+		Reason:    &reason,
+		Amount:    &amount,
+		Giver:     &bonusly.UserInfoResponse{ID: &giver, Email: ptr.NewString(giver + "@example.com")},
+		Receiver:  &bonusly.UserInfoResponse{ID: &receiver, Email: ptr.NewString(receiver + "@example.com")},
+	}
+}
+
+func count(t *testing.T, a *Archive, query string, args ...interface{}) int {
+	var n int
+	require.NoError(t, a.DB().QueryRow(query, args...).Scan(&n))
+	return n
+}
+
+func TestSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, err := Open(filepath.Join(dir, "bonuses.db"))
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	old := makeBonus("old", now.Add(-30*24*time.Hour), "alice", "bob", "+1 @bob for the old times #history", 1)
+	parent := makeBonus("parent", now.Add(-2*time.Hour), "alice", "bob", "+5 @bob for the release #Ownership", 5)
+	parent.ChildBonuses = []bonusly.BonusResponse{
+		makeBonus("child", now.Add(-time.Hour), "carol", "bob", "+2 @bob agreed #ownership #teamwork", 2),
+	}
+	recent := makeBonus("recent", now.Add(-time.Hour), "bob", "alice", "+3 @alice for the review", 3)
+	recent.Value = "teamwork"
+	c := &fakeClient{
+		MockClient: &bonusly.MockClient{},
+		bonuses:    []bonusly.BonusResponse{old, parent, recent},
+	}
+
+	t.Run("InitialSyncAddsAllBonuses", func(t *testing.T) {
+		res, err := a.Sync(ctx, c, SyncOptions{PageSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, SyncResult{Added: 4}, *res)
+
+		assert.Equal(t, 3, count(t, a, "SELECT COUNT(*) FROM users"))
+		assert.Equal(t, 4, count(t, a, "SELECT COUNT(*) FROM bonus_receivers"))
+		assert.Equal(t, 3, count(t, a, "SELECT COUNT(*) FROM bonus_receivers WHERE user_id = 'bob'"))
+		assert.Equal(t, 1, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE parent_id = 'parent' AND id = 'child'"))
+		assert.Equal(t, 2, count(t, a, "SELECT COUNT(*) FROM bonus_hashtags WHERE hashtag = 'ownership'"))
+		assert.Equal(t, 2, count(t, a, "SELECT COUNT(*) FROM bonus_hashtags WHERE hashtag = 'teamwork'"))
+		assert.Equal(t, 8, count(t, a, "SELECT SUM(amount) FROM bonus_receivers WHERE user_id = 'bob'"))
+	})
+	t.Run("IncrementalSyncTracksEditsAndDeletions", func(t *testing.T) {
+		c.bonuses[1].ChildBonuses = nil
+		reason := "+3 @alice for the thorough review #teamwork"
+		c.bonuses[2].Reason = &reason
+		c.bonuses = append(c.bonuses, makeBonus("new", now, "carol", "alice", "+1 @alice welcome", 1))
+
+		res, err := a.Sync(ctx, c, SyncOptions{Overlap: 24 * time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(-25*time.Hour), res.Since, "should start the overlap before the most recent bonus")
+		assert.Equal(t, 1, res.Added)
+		assert.Equal(t, 1, res.Updated)
+		assert.Equal(t, 1, res.Deleted)
+		assert.Equal(t, 1, res.Unchanged)
+
+		assert.Equal(t, 1, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE id = 'child' AND deleted_at IS NOT NULL"))
+		assert.Equal(t, 1, count(t, a, "SELECT COUNT(*) FROM bonus_revisions WHERE bonus_id = 'recent' AND reason = '+3 @alice for the review'"))
+		assert.Equal(t, 1, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE id = 'recent' AND reason = ?", reason))
+	})
+	t.Run("IncrementalSyncIgnoresBonusesBeforeOverlap", func(t *testing.T) {
+		c.remove("old")
+
+		res, err := a.Sync(ctx, c, SyncOptions{Overlap: 24 * time.Hour})
+		require.NoError(t, err)
+		assert.Zero(t, res.Deleted)
+		assert.Equal(t, 0, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE id = 'old' AND deleted_at IS NOT NULL"))
+	})
+	t.Run("FullSyncReconcilesDeletions", func(t *testing.T) {
+		res, err := a.Sync(ctx, c, SyncOptions{Full: true})
+		require.NoError(t, err)
+		assert.True(t, res.Since.IsZero())
+		assert.Equal(t, 1, res.Deleted)
+		assert.Equal(t, 3, res.Unchanged)
+		assert.Equal(t, 1, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE id = 'old' AND deleted_at IS NOT NULL"))
+	})
+	t.Run("SyncRestoresReappearingBonuses", func(t *testing.T) {
+		c.bonuses = append(c.bonuses, old)
+
+		res, err := a.Sync(ctx, c, SyncOptions{Full: true})
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Updated)
+		assert.Equal(t, 0, count(t, a, "SELECT COUNT(*) FROM bonuses WHERE id = 'old' AND deleted_at IS NOT NULL"))
+	})
+}
@@ -0,0 +1,75 @@
+package archive
+
+// schemaVersion is the version of the schema, which is stored in the
+// database's user_version.
+const schemaVersion = 1
+
+// schema creates the archive's tables. Times are stored as text in timeFormat
+// so that they sort chronologically.
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id            TEXT PRIMARY KEY,
+	username      TEXT,
+	email         TEXT,
+	display_name  TEXT,
+	department    TEXT,
+	location      TEXT,
+	manager_email TEXT,
+	updated_at    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS bonuses (
+	id                   TEXT PRIMARY KEY,
+	parent_id            TEXT,
+	created_at           TEXT NOT NULL,
+	giver_id             TEXT,
+	reason               TEXT,
+	reason_html          TEXT,
+	amount               INTEGER NOT NULL,
+	amount_with_currency TEXT,
+	value                TEXT,
+	via                  TEXT,
+	child_count          INTEGER,
+	family_amount        INTEGER,
+	content_hash         TEXT NOT NULL,
+	raw                  TEXT NOT NULL,
+	first_seen_at        TEXT NOT NULL,
+	last_seen_at         TEXT NOT NULL,
+	updated_at           TEXT NOT NULL,
+	deleted_at           TEXT
+);
+CREATE INDEX IF NOT EXISTS bonuses_created_at ON bonuses (created_at);
+CREATE INDEX IF NOT EXISTS bonuses_giver_id ON bonuses (giver_id);
+CREATE INDEX IF NOT EXISTS bonuses_parent_id ON bonuses (parent_id);
+
+CREATE TABLE IF NOT EXISTS bonus_receivers (
+	bonus_id TEXT NOT NULL,
+	user_id  TEXT NOT NULL,
+	amount   INTEGER NOT NULL,
+	PRIMARY KEY (bonus_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS bonus_receivers_user_id ON bonus_receivers (user_id);
+
+CREATE TABLE IF NOT EXISTS bonus_hashtags (
+	bonus_id TEXT NOT NULL,
+	hashtag  TEXT NOT NULL,
+	PRIMARY KEY (bonus_id, hashtag)
+);
+CREATE INDEX IF NOT EXISTS bonus_hashtags_hashtag ON bonus_hashtags (hashtag);
+
+CREATE TABLE IF NOT EXISTS bonus_revisions (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	bonus_id     TEXT NOT NULL,
+	reason       TEXT,
+	amount       INTEGER NOT NULL,
+	content_hash TEXT NOT NULL,
+	raw          TEXT NOT NULL,
+	replaced_at  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bonus_revisions_bonus_id ON bonus_revisions (bonus_id);
+
+CREATE TABLE IF NOT EXISTS sync_state (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
@@ -0,0 +1,88 @@
+package bonusly
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/rehttp"
+)
+
+type attemptCounterKey struct{}
+
+// attemptCounter counts the number of times a request is sent.
+type attemptCounter struct {
+	n int64
+}
+
+func (c *attemptCounter) inc() int {
+	return int(atomic.AddInt64(&c.n, 1))
+}
+
+func (c *attemptCounter) get() int {
+	return int(atomic.LoadInt64(&c.n))
+}
+
+func withAttemptCounter(ctx context.Context, c *attemptCounter) context.Context {
+	return context.WithValue(ctx, attemptCounterKey{}, c)
+}
+
+func attemptCounterFromContext(ctx context.Context) *attemptCounter {
+	c, _ := ctx.Value(attemptCounterKey{}).(*attemptCounter)
+	return c
+}
+
+// AttemptNumber returns the number of the current attempt to send a request,
+// starting at 1 for the first attempt. It is available in the request context
+// of the HTTP transports wrapped by AttemptMiddleware. It returns 0 if the
+// request is not being sent by a client.
+func AttemptNumber(ctx context.Context) int {
+	if c := attemptCounterFromContext(ctx); c != nil {
+		return c.get()
+	}
+	return 0
+}
+
+// TransportMiddleware wraps an HTTP transport.
+type TransportMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// attemptTransport counts every request it sends using the counter in the
+// request context, if there is one.
+type attemptTransport struct {
+	next http.RoundTripper
+}
+
+func (t *attemptTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if c := attemptCounterFromContext(r.Context()); c != nil {
+		c.inc()
+	}
+	return t.next.RoundTrip(r)
+}
+
+// instrumentAttempts returns a copy of the HTTP client that counts the number
+// of times each request is sent and wraps the transport for each attempt in
+// the middleware. If the client retries requests using rehttp, each retry is
+// counted as a separate attempt.
+func instrumentAttempts(hc *http.Client, middleware []TransportMiddleware) *http.Client {
+	wrap := func(next http.RoundTripper) http.RoundTripper {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return &attemptTransport{next: next}
+	}
+
+	instrumented := *hc
+	next := hc.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	switch transport := next.(type) {
+	case *rehttp.Transport:
+		retrying := *transport
+		retrying.RoundTripper = wrap(transport.RoundTripper)
+		instrumented.Transport = &retrying
+	default:
+		instrumented.Transport = wrap(transport)
+	}
+	return &instrumented
+}
@@ -0,0 +1,361 @@
+// Package bot serves a chat integration that gives bonuses from
+// slash-command webhooks, such as "/give +5 @bob great review #ownership",
+// on behalf of the chat user who sent them.
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// ErrorCode identifies the kind of error replied to a command.
+type ErrorCode string
+
+// Error codes.
+const (
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	CodeUnauthorized   ErrorCode = "unauthorized"
+	CodeUnknownCommand ErrorCode = "unknown_command"
+	CodeInvalidCommand ErrorCode = "invalid_command"
+	CodeUnknownUser    ErrorCode = "unknown_user"
+	CodeBonusly        ErrorCode = "bonusly_error"
+	CodeInternal       ErrorCode = "internal_error"
+)
+
+// Error is an error replied to a command.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Options represent options for the bot.
+type Options struct {
+	// Mapping maps chat user IDs to the emails of Bonusly users.
+	Mapping Mapping
+	// Token, if set, must match the token field of every request, to verify
+	// that requests come from the chat service.
+	Token string
+	// Commands are the slash commands that give bonuses. Defaults to
+	// "/give".
+	Commands []string
+	// Timeout is how long to wait for a bonus to be given before replying
+	// to a command that has no response_url to reply to later. Defaults to
+	// 2.5 seconds, just under the 3 seconds that chat services such as Slack
+	// wait for a reply.
+	Timeout time.Duration
+	// Logger, if set, logs failures to post replies to a response_url.
+	Logger bonusly.Logger
+	// HTTPClient posts replies to a response_url. Defaults to a client with a
+	// 10 second timeout.
+	HTTPClient *http.Client
+}
+
+const (
+	defaultTimeout = 2500 * time.Millisecond
+	// backgroundTimeout is how long to wait for a bonus to be given for a
+	// command that is replied to later through its response_url.
+	backgroundTimeout = time.Minute
+)
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if len(o.Mapping) == 0 {
+		return errors.New("mapping must have at least one user")
+	}
+	if o.Timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+	if len(o.Commands) == 0 {
+		o.Commands = []string{"/give"}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return nil
+}
+
+// Request is a slash command sent by the chat service.
+type Request struct {
+	Command string
+	UserID  string
+	Text    string
+	// TriggerID, if set, uniquely identifies the command, so that its bonus
+	// is given at most once even if it is handled again.
+	TriggerID string
+	// ResponseURL, if set, accepts replies to the command posted to it
+	// after the command is acknowledged.
+	ResponseURL string
+}
+
+// idempotencyKey returns the idempotency key of the bonus that the command
+// gives, if the command can be identified.
+func (r Request) idempotencyKey() string {
+	if r.TriggerID == "" {
+		return ""
+	}
+	return "bot:" + r.TriggerID
+}
+
+// Reply is the response to a command. Error replies are only shown to the
+// sender.
+type Reply struct {
+	ResponseType string                 `json:"response_type"`
+	Text         string                 `json:"text"`
+	Bonus        *bonusly.BonusResponse `json:"bonus,omitempty"`
+	Error        *Error                 `json:"error,omitempty"`
+}
+
+// Response types of replies.
+const (
+	InChannel = "in_channel"
+	Ephemeral = "ephemeral"
+)
+
+// Bot gives bonuses from chat commands.
+type Bot struct {
+	client bonusly.Client
+	opts   Options
+	// background tracks commands that are replied to later.
+	background sync.WaitGroup
+}
+
+// New returns a bot that gives bonuses with the client, which must be
+// authorized to give bonuses on behalf of other users.
+func New(client bonusly.Client, opts Options) (*Bot, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Bot{client: client, opts: opts}, nil
+}
+
+// Give gives the bonus of the command text on behalf of the chat user.
+// Errors are returned as *Error.
+func (b *Bot) Give(ctx context.Context, req Request) (*bonusly.BonusResponse, error) {
+	giver, ok := b.opts.Mapping[req.UserID]
+	if !ok {
+		return nil, &Error{Code: CodeUnknownUser, Message: fmt.Sprintf("your chat user '%s' is not mapped to a Bonusly user", req.UserID)}
+	}
+	cmd, err := ParseCommand(req.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := map[string]string{}
+	for _, id := range cmd.ChatMentions {
+		if usernames[id], err = b.username(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	bonus, err := b.client.CreateBonus(ctx, bonusly.CreateBonusRequest{
+		GiverEmail:     giver,
+		Reason:         cmd.Reason(usernames),
+		IdempotencyKey: req.idempotencyKey(),
+	})
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &Error{Code: CodeBonusly, Message: "timed out giving the bonus, so it may or may not have been given"}
+		}
+		if respErr, ok := errors.Cause(err).(*bonusly.ResponseError); ok && respErr.Message != "" {
+			return nil, &Error{Code: CodeBonusly, Message: respErr.Message}
+		}
+		return nil, &Error{Code: CodeBonusly, Message: err.Error()}
+	}
+	return bonus, nil
+}
+
+// username returns the Bonusly username of the chat user.
+func (b *Bot) username(ctx context.Context, userID string) (string, error) {
+	email, ok := b.opts.Mapping[userID]
+	if !ok {
+		return "", &Error{Code: CodeUnknownUser, Message: fmt.Sprintf("the chat user '%s' is not mapped to a Bonusly user", userID)}
+	}
+	users, err := b.client.ListUsers(ctx, bonusly.ListUsersRequest{Email: email, Limit: 1})
+	if err != nil {
+		return "", &Error{Code: CodeBonusly, Message: fmt.Sprintf("finding user '%s': %s", email, err)}
+	}
+	if len(users) == 0 || users[0].UserName == nil || *users[0].UserName == "" {
+		return "", &Error{Code: CodeUnknownUser, Message: fmt.Sprintf("there is no Bonusly user with email '%s'", email)}
+	}
+	return *users[0].UserName, nil
+}
+
+// ServeHTTP handles slash-command form posts with the command, text,
+// user_id, token, trigger_id and response_url fields, and replies with JSON.
+// Commands with a response_url are acknowledged immediately and replied to
+// there once the bonus is given; otherwise the reply waits for the bonus for
+// up to the timeout.
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeReply(w, http.StatusMethodNotAllowed, errorReply(&Error{Code: CodeInvalidRequest, Message: "only POST is allowed"}))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := r.ParseForm(); err != nil {
+		writeReply(w, http.StatusBadRequest, errorReply(&Error{Code: CodeInvalidRequest, Message: err.Error()}))
+		return
+	}
+	if b.opts.Token != "" && subtle.ConstantTimeCompare([]byte(r.PostForm.Get("token")), []byte(b.opts.Token)) != 1 {
+		writeReply(w, http.StatusUnauthorized, errorReply(&Error{Code: CodeUnauthorized, Message: "invalid token"}))
+		return
+	}
+	req := Request{
+		Command:     r.PostForm.Get("command"),
+		UserID:      r.PostForm.Get("user_id"),
+		Text:        r.PostForm.Get("text"),
+		TriggerID:   r.PostForm.Get("trigger_id"),
+		ResponseURL: r.PostForm.Get("response_url"),
+	}
+	if req.ResponseURL != "" {
+		if u, err := url.Parse(req.ResponseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeReply(w, http.StatusBadRequest, errorReply(&Error{Code: CodeInvalidRequest, Message: "response_url must be an http(s) URL"}))
+			return
+		}
+	}
+
+	// Chat services show replies to commands that fail with a successful
+	// status, so errors from here on are only described in the reply.
+	if reply, ok := b.immediateReply(req); ok {
+		writeReply(w, http.StatusOK, reply)
+		return
+	}
+	if req.ResponseURL == "" {
+		ctx, cancel := context.WithTimeout(r.Context(), b.opts.Timeout)
+		defer cancel()
+		writeReply(w, http.StatusOK, b.Handle(ctx, req))
+		return
+	}
+
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		b.postReply(ctx, req.ResponseURL, b.Handle(ctx, req))
+	}()
+	writeReply(w, http.StatusOK, Reply{ResponseType: Ephemeral, Text: "Giving bonus..."})
+}
+
+// Wait waits for the commands that are being handled in the background to
+// post their replies.
+func (b *Bot) Wait() {
+	b.background.Wait()
+}
+
+// Handle runs the command on behalf of the chat user and returns the reply.
+func (b *Bot) Handle(ctx context.Context, req Request) Reply {
+	if reply, ok := b.immediateReply(req); ok {
+		return reply
+	}
+
+	bonus, err := b.Give(ctx, req)
+	if err != nil {
+		botErr, ok := errors.Cause(err).(*Error)
+		if !ok {
+			botErr = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+		return errorReply(botErr)
+	}
+	return Reply{ResponseType: InChannel, Text: formatBonus(bonus, strings.TrimSpace(req.Text)), Bonus: bonus}
+}
+
+// immediateReply returns the reply to a command that does not give a bonus,
+// such as an unknown command or a request for help.
+func (b *Bot) immediateReply(req Request) (Reply, bool) {
+	if !b.known(req.Command) {
+		return errorReply(&Error{Code: CodeUnknownCommand, Message: fmt.Sprintf("unknown command '%s'", req.Command)}), true
+	}
+	if text := strings.TrimSpace(req.Text); text == "" || text == "help" {
+		return Reply{
+			ResponseType: Ephemeral,
+			Text:         fmt.Sprintf("Usage: %s +<amount> @<recipient> <reason> #<hashtag>", req.Command),
+		}, true
+	}
+	return Reply{}, false
+}
+
+// postReply posts the reply to the command's response_url.
+func (b *Bot) postReply(ctx context.Context, responseURL string, reply Reply) {
+	err := func() error {
+		body, err := json.Marshal(reply)
+		if err != nil {
+			return errors.Wrap(err, "marshalling reply")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "creating request")
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := b.opts.HTTPClient.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "posting reply")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return errors.Errorf("posting reply: unexpected status %s", resp.Status)
+		}
+		return nil
+	}()
+	if err != nil && b.opts.Logger != nil && b.opts.Logger.Enabled(bonusly.LevelError) {
+		b.opts.Logger.Log(bonusly.LevelError, "bot reply failed",
+			bonusly.LogField{Key: "error", Value: err.Error()},
+			bonusly.LogField{Key: "bonus_given", Value: reply.Bonus != nil},
+		)
+	}
+}
+
+func (b *Bot) known(command string) bool {
+	for _, c := range b.opts.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBonus describes the given bonus.
+func formatBonus(bonus *bonusly.BonusResponse, text string) string {
+	reason := text
+	if bonus != nil && ptr.String(bonus.Reason) != "" {
+		reason = ptr.String(bonus.Reason)
+	}
+	if bonus != nil && bonus.Giver != nil && ptr.String(bonus.Giver.UserName) != "" {
+		return fmt.Sprintf("@%s gave a bonus: %s", ptr.String(bonus.Giver.UserName), reason)
+	}
+	return fmt.Sprintf("Bonus given: %s", reason)
+}
+
+func errorReply(err *Error) Reply {
+	return Reply{
+		ResponseType: Ephemeral,
+		Text:         fmt.Sprintf("Could not give bonus (%s): %s", err.Code, err.Message),
+		Error:        err,
+	}
+}
+
+func writeReply(w http.ResponseWriter, status int, reply Reply) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(reply)
+}
@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	*bonusly.MockClient
+}
+
+func (c *fakeClient) ListUsers(_ context.Context, req bonusly.ListUsersRequest) ([]bonusly.UserInfoResponse, error) {
+	switch req.Email {
+	case "bob@example.com":
+		return []bonusly.UserInfoResponse{{UserName: ptr.NewString("bob"), Email: ptr.NewString(req.Email)}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// slowClient waits for the context to be done before creating bonuses.
+type slowClient struct {
+	*fakeClient
+}
+
+func (c *slowClient) CreateBonus(ctx context.Context, req bonusly.CreateBonusRequest) (*bonusly.BonusResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+var mapping = Mapping{
+	"U1": "alice@example.com",
+	"U2": "bob@example.com",
+	"U3": "carol@example.com",
+}
+
+func TestParseCommand(t *testing.T) {
+	cmd, err := ParseCommand(" +5 @bob and <@U3|carol> great review #ownership ")
+	require.NoError(t, err)
+	assert.Equal(t, 5, cmd.Amount)
+	assert.Equal(t, []string{"bob"}, cmd.Mentions)
+	assert.Equal(t, []string{"U3"}, cmd.ChatMentions)
+	assert.Equal(t, "+5 @bob and @carol great review #ownership", cmd.Reason(map[string]string{"U3": "carol"}))
+
+	for name, text := range map[string]string{
+		"NoAmount":      "@bob great review",
+		"TwoAmounts":    "+5 +3 @bob great review",
+		"ZeroAmount":    "+0 @bob great review",
+		"NoRecipients":  "+5 great review",
+		"EmailNotUser":  "+5 bob@example.com great review",
+		"NoReason":      "+5 @bob",
+		"NoReasonInner": "+5 <@U2>",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCommand(text)
+			require.Error(t, err)
+			botErr, ok := err.(*Error)
+			require.True(t, ok)
+			assert.Equal(t, CodeInvalidCommand, botErr.Code)
+		})
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mapping.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("U1: alice@example.com\nU2: bob@example.com\n"), 0600))
+	m, err := LoadMapping(path)
+	require.NoError(t, err)
+	assert.Equal(t, Mapping{"U1": "alice@example.com", "U2": "bob@example.com"}, m)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"U1": ""}`), 0600))
+	_, err = LoadMapping(path)
+	assert.Error(t, err)
+
+	_, err = LoadMapping(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestBot(t *testing.T) {
+	newBot := func(t *testing.T, client bonusly.Client) *Bot {
+		b, err := New(client, Options{Mapping: mapping, Token: "secret"})
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("GivesOnBehalfOfSender", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{CreateBonusResponse: bonusly.BonusResponse{
+			ID:     ptr.NewString("bonus"),
+			Reason: ptr.NewString("+5 @bob great review #ownership"),
+			Giver:  &bonusly.UserInfoResponse{UserName: ptr.NewString("alice")},
+		}}}
+		reply := newBot(t, client).Handle(context.Background(), Request{
+			Command:   "/give",
+			UserID:    "U1",
+			Text:      "+5 <@U2> great review #ownership",
+			TriggerID: "T1",
+		})
+		assert.Nil(t, reply.Error)
+		assert.Equal(t, InChannel, reply.ResponseType)
+		assert.Equal(t, "@alice gave a bonus: +5 @bob great review #ownership", reply.Text)
+		assert.Equal(t, []bonusly.CreateBonusRequest{{
+			GiverEmail:     "alice@example.com",
+			Reason:         "+5 @bob great review #ownership",
+			IdempotencyKey: "bot:T1",
+		}}, client.CreateBonusRequests, "should give the bonus at most once per trigger")
+	})
+	t.Run("ReturnsTypedErrors", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			command, userID, text string
+			err                   error
+			code                  ErrorCode
+		}{
+			"UnknownCommand":   {command: "/take", userID: "U1", text: "+5 @bob x", code: CodeUnknownCommand},
+			"UnknownSender":    {command: "/give", userID: "U9", text: "+5 @bob x", code: CodeUnknownUser},
+			"UnknownRecipient": {command: "/give", userID: "U1", text: "+5 <@U9> x", code: CodeUnknownUser},
+			"UnmatchedEmail":   {command: "/give", userID: "U1", text: "+5 <@U3> x", code: CodeUnknownUser},
+			"InvalidCommand":   {command: "/give", userID: "U1", text: "@bob x", code: CodeInvalidCommand},
+			"Bonusly": {command: "/give", userID: "U1", text: "+5 @bob x", code: CodeBonusly,
+				err: errors.Wrap(&bonusly.ResponseError{StatusCode: 400, Status: "400 Bad Request", Message: "insufficient balance"}, "creating bonus")},
+		} {
+			t.Run(name, func(t *testing.T) {
+				client := &fakeClient{MockClient: &bonusly.MockClient{CreateBonusError: tc.err}}
+				reply := newBot(t, client).Handle(context.Background(), Request{Command: tc.command, UserID: tc.userID, Text: tc.text})
+				require.NotNil(t, reply.Error)
+				assert.Equal(t, tc.code, reply.Error.Code)
+				assert.Equal(t, Ephemeral, reply.ResponseType)
+				if tc.err != nil {
+					assert.Equal(t, "insufficient balance", reply.Error.Message)
+				}
+			})
+		}
+	})
+	t.Run("RepliesWithUsage", func(t *testing.T) {
+		reply := newBot(t, &fakeClient{MockClient: &bonusly.MockClient{}}).Handle(context.Background(), Request{Command: "/give", UserID: "U1", Text: "help"})
+		assert.Nil(t, reply.Error)
+		assert.Contains(t, reply.Text, "Usage: /give")
+	})
+	t.Run("ServesHTTP", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}}
+		srv := httptest.NewServer(newBot(t, client))
+		defer srv.Close()
+
+		post := func(t *testing.T, form url.Values) (int, Reply) {
+			resp, err := http.PostForm(srv.URL, form)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			var reply Reply
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&reply))
+			return resp.StatusCode, reply
+		}
+
+		status, reply := post(t, url.Values{"token": {"secret"}, "command": {"/give"}, "user_id": {"U1"}, "text": {"+5 @bob great review #ownership"}})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Nil(t, reply.Error)
+		require.NotNil(t, reply.Bonus)
+		assert.Len(t, client.CreateBonusRequests, 1)
+
+		status, reply = post(t, url.Values{"token": {"secret"}, "command": {"/give"}, "user_id": {"U9"}, "text": {"+5 @bob x"}})
+		assert.Equal(t, http.StatusOK, status)
+		require.NotNil(t, reply.Error)
+		assert.Equal(t, CodeUnknownUser, reply.Error.Code)
+
+		status, reply = post(t, url.Values{"token": {"wrong"}, "command": {"/give"}, "user_id": {"U1"}, "text": {"+5 @bob x"}})
+		assert.Equal(t, http.StatusUnauthorized, status)
+		require.NotNil(t, reply.Error)
+		assert.Equal(t, CodeUnauthorized, reply.Error.Code)
+		assert.Len(t, client.CreateBonusRequests, 1)
+
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+	t.Run("RepliesLaterToResponseURL", func(t *testing.T) {
+		replies := make(chan Reply, 1)
+		responses := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reply Reply
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&reply))
+			replies <- reply
+		}))
+		defer responses.Close()
+
+		client := &fakeClient{MockClient: &bonusly.MockClient{}}
+		b := newBot(t, client)
+		srv := httptest.NewServer(b)
+		defer srv.Close()
+
+		resp, err := http.PostForm(srv.URL, url.Values{"token": {"secret"}, "command": {"/give"}, "user_id": {"U1"},
+			"text": {"+5 @bob great review #ownership"}, "trigger_id": {"T2"}, "response_url": {responses.URL}})
+		require.NoError(t, err)
+		var ack Reply
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&ack))
+		resp.Body.Close()
+		assert.Equal(t, Ephemeral, ack.ResponseType)
+		assert.Nil(t, ack.Bonus)
+
+		b.Wait()
+		reply := <-replies
+		assert.Nil(t, reply.Error)
+		assert.Equal(t, InChannel, reply.ResponseType)
+		require.NotNil(t, reply.Bonus)
+		require.Len(t, client.CreateBonusRequests, 1)
+		assert.Equal(t, "bot:T2", client.CreateBonusRequests[0].IdempotencyKey)
+
+		resp, err = http.PostForm(srv.URL, url.Values{"token": {"secret"}, "command": {"/give"}, "user_id": {"U1"},
+			"text": {"+5 @bob x"}, "response_url": {"file:///etc/passwd"}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("TimesOutWithoutResponseURL", func(t *testing.T) {
+		client := &slowClient{fakeClient: &fakeClient{MockClient: &bonusly.MockClient{}}}
+		b, err := New(client, Options{Mapping: mapping, Timeout: 10 * time.Millisecond})
+		require.NoError(t, err)
+		srv := httptest.NewServer(b)
+		defer srv.Close()
+
+		resp, err := http.PostForm(srv.URL, url.Values{"command": {"/give"}, "user_id": {"U1"}, "text": {"+5 @bob x"}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var reply Reply
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&reply))
+		require.NotNil(t, reply.Error)
+		assert.Equal(t, CodeBonusly, reply.Error.Code)
+		assert.Contains(t, reply.Error.Message, "timed out")
+	})
+	t.Run("RequiresMapping", func(t *testing.T) {
+		_, err := New(&fakeClient{MockClient: &bonusly.MockClient{}}, Options{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping maps chat user IDs to the emails of Bonusly users.
+type Mapping map[string]string
+
+// LoadMapping reads a mapping from a YAML or JSON file of chat user IDs to
+// emails.
+func LoadMapping(path string) (Mapping, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading mapping '%s'", path)
+	}
+	var m Mapping
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "parsing mapping '%s'", path)
+	}
+	for id, email := range m {
+		if id == "" || email == "" {
+			return nil, errors.Errorf("mapping '%s' has an empty user ID or email", path)
+		}
+	}
+	return m, nil
+}
+
+// Command is a parsed give command, such as
+// "+5 @bob great review #ownership".
+type Command struct {
+	Amount int
+	// Mentions are the usernames of the recipients. Chat mentions of the
+	// form <@ID> or <@ID|name> are kept as chat user IDs in ChatMentions
+	// until they are resolved.
+	Mentions     []string
+	ChatMentions []string
+	// Text is the command text, which becomes the bonus reason once chat
+	// mentions are replaced by usernames.
+	Text string
+}
+
+var (
+	amountPattern      = regexp.MustCompile(`(?:^|\s)\+(\d+)\b`)
+	mentionPattern     = regexp.MustCompile(`(?:^|\s)@([\w.\-]+)`)
+	chatMentionPattern = regexp.MustCompile(`<@([\w.\-]+)(?:\|[^>]*)?>`)
+)
+
+// ParseCommand parses the text of a give command. The text must contain one
+// amount and at least one mention.
+func ParseCommand(text string) (*Command, error) {
+	text = strings.TrimSpace(text)
+	cmd := &Command{Text: text}
+
+	amounts := amountPattern.FindAllStringSubmatch(text, -1)
+	if len(amounts) != 1 {
+		return nil, &Error{Code: CodeInvalidCommand, Message: "give exactly one amount, like +5"}
+	}
+	amount, err := strconv.Atoi(amounts[0][1])
+	if err != nil || amount <= 0 {
+		return nil, &Error{Code: CodeInvalidCommand, Message: "the amount must be a positive number"}
+	}
+	cmd.Amount = amount
+
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		cmd.Mentions = append(cmd.Mentions, m[1])
+	}
+	for _, m := range chatMentionPattern.FindAllStringSubmatch(text, -1) {
+		cmd.ChatMentions = append(cmd.ChatMentions, m[1])
+	}
+	if len(cmd.Mentions)+len(cmd.ChatMentions) == 0 {
+		return nil, &Error{Code: CodeInvalidCommand, Message: "mention at least one recipient, like @bob"}
+	}
+	if strings.TrimSpace(chatMentionPattern.ReplaceAllString(mentionPattern.ReplaceAllString(amountPattern.ReplaceAllString(text, ""), ""), "")) == "" {
+		return nil, &Error{Code: CodeInvalidCommand, Message: "give a reason for the bonus"}
+	}
+	return cmd, nil
+}
+
+// Reason returns the command text with chat mentions replaced by the
+// mentions of the usernames they resolve to.
+func (c *Command) Reason(usernames map[string]string) string {
+	return chatMentionPattern.ReplaceAllStringFunc(c.Text, func(s string) string {
+		id := chatMentionPattern.FindStringSubmatch(s)[1]
+		return "@" + usernames[id]
+	})
+}
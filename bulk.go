@@ -0,0 +1,244 @@
+package bonusly
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+const defaultBulkConcurrency = 4
+
+// BulkOptions represent options to create many bonuses at once.
+type BulkOptions struct {
+	// Concurrency is the maximum number of bonuses to create at the same
+	// time. Defaults to 4.
+	Concurrency int
+	// Journal, if set, is written one JSON line per bonus that was attempted
+	// recording its BulkResult. Results carried over from Completed are
+	// written first, so that the journal alone records every bonus that was
+	// created even if it is not the journal they were read from.
+	Journal io.Writer
+	// Completed are the results from a previous attempt to create the same
+	// batch of bonuses (e.g. read from a journal with ReadBulkJournal). Any
+	// request that already succeeded is not created again. If a request has
+	// multiple results, the last one takes precedence.
+	Completed []BulkResult
+	// CompletedJournaled is whether the Completed results are already in the
+	// Journal, such as when it appends to the journal they were read from, so
+	// they are not written to it again.
+	CompletedJournaled bool
+	// SkipBalanceCheck skips checking that the giving balance is sufficient to
+	// create all the bonuses before creating any of them.
+	SkipBalanceCheck bool
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *BulkOptions) Validate() error {
+	catcher := newBasicCatcher()
+	catcher.NewWhen(o.Concurrency < 0, "concurrency cannot be negative")
+	if o.Concurrency == 0 {
+		o.Concurrency = defaultBulkConcurrency
+	}
+	return catcher.Resolve()
+}
+
+// BulkResult is the outcome of creating a single bonus in a batch.
+type BulkResult struct {
+	// Index is the position of the request in the batch.
+	Index    int                `json:"index"`
+	Request  CreateBonusRequest `json:"request"`
+	Response *BonusResponse     `json:"response,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// Succeeded returns whether the bonus was successfully created.
+func (r *BulkResult) Succeeded() bool {
+	return r.Error == "" && r.Response != nil
+}
+
+// ReadBulkJournal reads the results from a journal written by CreateBonuses in
+// the order they were written.
+func ReadBulkJournal(r io.Reader) ([]BulkResult, error) {
+	var results []BulkResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var res BulkResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return nil, errors.Wrapf(err, "parsing journal line %d", line)
+		}
+		results = append(results, res)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading journal")
+	}
+	return results, nil
+}
+
+// createBonuses creates all the requested bonuses using the client's
+// CreateBonus with bounded concurrency. It returns the result of every
+// request in the batch, including ones completed in a previous attempt.
+func createBonuses(ctx context.Context, c Client, reqs []CreateBonusRequest, opts BulkOptions) ([]BulkResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid bulk options")
+	}
+
+	results := make([]BulkResult, len(reqs))
+	completed := map[int]BulkResult{}
+	for _, res := range opts.Completed {
+		if res.Index < 0 || res.Index >= len(reqs) || !sameBonusRequest(res.Request, reqs[res.Index]) {
+			continue
+		}
+		if res.Succeeded() {
+			completed[res.Index] = res
+		} else {
+			delete(completed, res.Index)
+		}
+	}
+
+	var pending []int
+	for i := range reqs {
+		if res, ok := completed[i]; ok {
+			results[i] = res
+			if !opts.CompletedJournaled {
+				if err := writeJournal(opts.Journal, res); err != nil {
+					return nil, errors.Wrapf(err, "carrying over result for bonus %d", i)
+				}
+			}
+			continue
+		}
+		results[i] = BulkResult{Index: i, Request: reqs[i]}
+		pending = append(pending, i)
+	}
+
+	if !opts.SkipBalanceCheck && len(pending) > 0 {
+		if err := checkGivingBalance(ctx, c, reqs, pending); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	catcher := newBasicCatcher()
+	var journalMu sync.Mutex
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, i := range pending {
+		if err := ctx.Err(); err != nil {
+			catcher.Wrap(err, "creating remaining bonuses")
+			break
+		}
+		sem <- struct{}{}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res := BulkResult{Index: i, Request: reqs[i]}
+			resp, err := c.CreateBonus(ctx, reqs[i])
+			if err != nil {
+				res.Error = err.Error()
+				catcher.Wrapf(err, "creating bonus %d", i)
+			} else {
+				res.Response = resp
+			}
+			results[i] = res
+
+			journalMu.Lock()
+			defer journalMu.Unlock()
+			catcher.Wrapf(writeJournal(opts.Journal, res), "journaling result for bonus %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	return results, catcher.Resolve()
+}
+
+// writeJournal writes the result to the journal as a JSON line, if there is
+// a journal.
+func writeJournal(journal io.Writer, res BulkResult) error {
+	if journal == nil {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return errors.Wrap(err, "marshalling result")
+	}
+	_, err = journal.Write(append(b, '\n'))
+	return errors.Wrap(err, "writing result")
+}
+
+// checkGivingBalance checks that the user's giving balance covers the total
+// cost of the pending requests. Requests given on behalf of another giver do
+// not count against the user's balance.
+func checkGivingBalance(ctx context.Context, c Client, reqs []CreateBonusRequest, pending []int) error {
+	var total int
+	for _, i := range pending {
+		if reqs[i].GiverEmail != "" {
+			continue
+		}
+		cost, err := BonusCost(reqs[i].Reason)
+		if err != nil {
+			return errors.Wrapf(err, "calculating cost of bonus %d", i)
+		}
+		total += cost
+	}
+	if total == 0 {
+		return nil
+	}
+
+	info, err := c.MyUserInfo(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting giving balance")
+	}
+	if balance := ptr.Int(info.GivingBalance); total > balance {
+		return errors.Errorf("total cost of bonuses is %d, which exceeds the giving balance of %d", total, balance)
+	}
+	return nil
+}
+
+var (
+	reasonAmountRegexp  = regexp.MustCompile(`(?:^|\s)\+(\d+)\b`)
+	reasonMentionRegexp = regexp.MustCompile(`(?:^|\s)@[\w.\-]+`)
+)
+
+// BonusCost returns the total amount that a bonus with the given reason costs
+// the giver, which is the amount given to each receiver multiplied by the
+// number of receivers. A reason with no mentions (e.g. an add-on to an
+// existing bonus) is counted as one receiver.
+func BonusCost(reason string) (int, error) {
+	amount, err := reasonAmount(reason)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	receivers := len(reasonMentionRegexp.FindAllString(reason, -1))
+	if receivers == 0 {
+		receivers = 1
+	}
+	return amount * receivers, nil
+}
+
+// reasonAmount returns the amount given to each receiver in the bonus reason.
+func reasonAmount(reason string) (int, error) {
+	match := reasonAmountRegexp.FindStringSubmatch(reason)
+	if match == nil {
+		return 0, errors.New("reason does not specify an amount")
+	}
+	amount, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing amount")
+	}
+	return amount, nil
+}
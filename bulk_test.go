@@ -0,0 +1,181 @@
+package bonusly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateBonuses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var created int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users/me":
+			fmt.Fprint(w, `{"success": true, "result": {"giving_balance": 100}}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/bonuses":
+			var req CreateBonusRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if strings.Contains(req.Reason, "fail") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"success": false, "message": "bad bonus"}`)
+				return
+			}
+			n := atomic.AddInt32(&created, 1)
+			fmt.Fprintf(w, `{"success": true, "result": {"id": "bonus%d", "reason": %q}}`, n, req.Reason)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	httpClient := getHTTPClient()
+	defer putHTTPClient(httpClient)
+
+	c, err := NewClient(ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  httpClient,
+		BaseURL:     srv.URL,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, c.Close(ctx))
+	}()
+
+	t.Run("CreatesAllBonuses", func(t *testing.T) {
+		atomic.StoreInt32(&created, 0)
+		reqs := []CreateBonusRequest{
+			{Reason: "+1 @alice thanks #teamwork"},
+			{Reason: "+2 @bob @carol thanks #teamwork"},
+			{Reason: "+3 @dave thanks #teamwork"},
+		}
+		var journal bytes.Buffer
+		results, err := c.CreateBonuses(ctx, reqs, BulkOptions{Concurrency: 2, Journal: &journal})
+		require.NoError(t, err)
+		require.Len(t, results, len(reqs))
+		for i, res := range results {
+			assert.Equal(t, i, res.Index)
+			assert.True(t, res.Succeeded())
+			assert.Equal(t, reqs[i].Reason, ptr.String(res.Response.Reason))
+		}
+		assert.EqualValues(t, len(reqs), atomic.LoadInt32(&created))
+
+		journaled, err := ReadBulkJournal(&journal)
+		require.NoError(t, err)
+		assert.Len(t, journaled, len(reqs))
+	})
+	t.Run("FailsWithInsufficientBalance", func(t *testing.T) {
+		atomic.StoreInt32(&created, 0)
+		reqs := []CreateBonusRequest{
+			{Reason: "+60 @alice thanks #teamwork"},
+			{Reason: "+50 @bob thanks #teamwork"},
+		}
+		results, err := c.CreateBonuses(ctx, reqs, BulkOptions{})
+		assert.Error(t, err)
+		assert.Empty(t, results)
+		assert.Zero(t, atomic.LoadInt32(&created))
+	})
+	t.Run("ResumesWithoutRecreatingCompletedBonuses", func(t *testing.T) {
+		atomic.StoreInt32(&created, 0)
+		reqs := []CreateBonusRequest{
+			{Reason: "+1 @alice thanks #teamwork"},
+			{Reason: "+1 @bob fail #teamwork"},
+		}
+		var journal bytes.Buffer
+		results, err := c.CreateBonuses(ctx, reqs, BulkOptions{Journal: &journal})
+		assert.Error(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Succeeded())
+		assert.False(t, results[1].Succeeded())
+		assert.NotEmpty(t, results[1].Error)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&created))
+
+		completed, err := ReadBulkJournal(&journal)
+		require.NoError(t, err)
+		reqs[1].Reason = "+1 @bob thanks #teamwork"
+		var resumed bytes.Buffer
+		results, err = c.CreateBonuses(ctx, reqs, BulkOptions{Completed: completed, Journal: &resumed})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Succeeded())
+		assert.True(t, results[1].Succeeded())
+		assert.EqualValues(t, 2, atomic.LoadInt32(&created))
+
+		journaled, err := ReadBulkJournal(&resumed)
+		require.NoError(t, err)
+		require.Len(t, journaled, 2, "should carry over completed results to the new journal")
+		assert.Equal(t, results[0], journaled[0])
+	})
+	t.Run("AppendsOnlyNewResultsToJournal", func(t *testing.T) {
+		reqs := []CreateBonusRequest{
+			{Reason: "+1 @alice thanks #teamwork"},
+			{Reason: "+1 @bob fail #teamwork"},
+		}
+		var journal bytes.Buffer
+		_, err := c.CreateBonuses(ctx, reqs, BulkOptions{Journal: &journal})
+		assert.Error(t, err)
+
+		completed, err := ReadBulkJournal(bytes.NewReader(journal.Bytes()))
+		require.NoError(t, err)
+		reqs[1].Reason = "+1 @bob thanks #teamwork"
+		_, err = c.CreateBonuses(ctx, reqs, BulkOptions{Completed: completed, CompletedJournaled: true, Journal: &journal})
+		require.NoError(t, err)
+
+		journaled, err := ReadBulkJournal(&journal)
+		require.NoError(t, err)
+		require.Len(t, journaled, 3, "should only append the result that was not journaled yet")
+		assert.Equal(t, 1, journaled[2].Index)
+		assert.True(t, journaled[2].Succeeded())
+	})
+}
+
+func TestBonusCost(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		reason   string
+		expected int
+		err      bool
+	}{
+		"SingleReceiver": {
+			reason:   "+10 @alice for the great review #teamwork",
+			expected: 10,
+		},
+		"MultipleReceivers": {
+			reason:   "+5 @alice @bob.smith thanks #teamwork",
+			expected: 10,
+		},
+		"AddOn": {
+			reason:   "+3 me too",
+			expected: 3,
+		},
+		"IgnoresEmailAddresses": {
+			reason:   "+2 @alice thanks for emailing support@example.com",
+			expected: 2,
+		},
+		"MissingAmount": {
+			reason: "@alice thanks",
+			err:    true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cost, err := BonusCost(testCase.reason)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, cost)
+		})
+	}
+}
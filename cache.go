@@ -0,0 +1,317 @@
+package bonusly
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/internal/fileutil"
+	"github.com/pkg/errors"
+)
+
+// DefaultCacheTTLs are how long responses are cached for each client method
+// when caching is enabled without explicit TTLs.
+var DefaultCacheTTLs = map[string]time.Duration{
+	"ListRewards": time.Hour,
+	"MyUserInfo":  time.Minute,
+}
+
+// Cache statuses of a call.
+const (
+	// CacheHit means the result was served from the cache without sending a
+	// request.
+	CacheHit = "hit"
+	// CacheMiss means the result was not cached or had expired, so a request
+	// was sent and its result was cached.
+	CacheMiss = "miss"
+	// CacheRevalidated means the cached result had expired, but the server
+	// confirmed that it has not changed.
+	CacheRevalidated = "revalidated"
+)
+
+// cachedRoute is a route whose result is cached by a client method.
+type cachedRoute struct {
+	operation string
+	route     string
+}
+
+var myUserInfoRoute = cachedRoute{operation: "MyUserInfo", route: "/users/me"}
+
+// cacheInvalidations are the cached results that are invalidated when a call
+// to a client method succeeds. Giving, editing or deleting a bonus changes the
+// user's balances.
+var cacheInvalidations = map[string][]cachedRoute{
+	"CreateBonus": {myUserInfoRoute},
+	"UpdateBonus": {myUserInfoRoute},
+	"DeleteBonus": {myUserInfoRoute},
+}
+
+// CachedResponse is a cached response body.
+type CachedResponse struct {
+	Body []byte `json:"body"`
+	// ETag is the entity tag of the response, if the server sent one, which
+	// is used to revalidate the response once it expires.
+	ETag      string    `json:"etag,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (r *CachedResponse) expired() bool {
+	return !time.Now().Before(r.ExpiresAt)
+}
+
+// ResponseCache stores response bodies. Expired responses are kept so that
+// they can be revalidated.
+type ResponseCache interface {
+	// Get returns the response for the key, or nil if there is none.
+	Get(key string) (*CachedResponse, error)
+	// Put stores the response for the key.
+	Put(key string, resp CachedResponse) error
+	// Delete removes the response for the key, if there is one.
+	Delete(key string) error
+}
+
+// defaultLRUCacheCapacity is the capacity of an LRU cache if none is given.
+const defaultLRUCacheCapacity = 128
+
+type lruCacheEntry struct {
+	key  string
+	resp CachedResponse
+}
+
+type lruResponseCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	mu       sync.Mutex
+}
+
+// NewLRUResponseCache returns a response cache that keeps up to the given
+// number of responses in memory, evicting the least recently used response
+// when it is full.
+func NewLRUResponseCache(capacity int) ResponseCache {
+	if capacity <= 0 {
+		capacity = defaultLRUCacheCapacity
+	}
+	return &lruResponseCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (c *lruResponseCache) Get(key string) (*CachedResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	c.order.MoveToFront(elem)
+	resp := elem.Value.(*lruCacheEntry).resp
+	return &resp, nil
+}
+
+func (c *lruResponseCache) Put(key string, resp CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruCacheEntry).resp = resp
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruCacheEntry{key: key, resp: resp})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruCacheEntry).key)
+	}
+	return nil
+}
+
+func (c *lruResponseCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+type diskResponseCache struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewDiskResponseCache returns a response cache that stores each response as
+// a JSON file in the given directory, so that they are kept across processes.
+// The directory is created if it does not exist.
+func NewDiskResponseCache(dir string) (ResponseCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "creating cache directory")
+	}
+	return &diskResponseCache{dir: dir}, nil
+}
+
+func (c *diskResponseCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *diskResponseCache) Get(key string) (*CachedResponse, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, err := ioutil.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading cache file")
+	}
+	var resp CachedResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, errors.Wrap(err, "parsing cache file")
+	}
+	return &resp, nil
+}
+
+func (c *diskResponseCache) Put(key string, resp CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrap(err, "marshalling cached response")
+	}
+	return errors.Wrap(fileutil.WriteAtomic(c.path(key), b), "writing cache file")
+}
+
+func (c *diskResponseCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing cache file")
+	}
+	return nil
+}
+
+// cacheKey returns the key of the cached response for a call to the client
+// method with the URL. It includes a hash of the access token so that clients
+// for different users can share a cache.
+func (c *client) cacheKey(op, url string) string {
+	sum := sha256.Sum256([]byte(c.opts.AccessToken))
+	return fmt.Sprintf("%s %s %s", op, url, hex.EncodeToString(sum[:8]))
+}
+
+// cacheTTL returns how long to cache the result of the call, or 0 if it
+// should not be cached.
+func (c *client) cacheTTL(call *Call) time.Duration {
+	if c.opts.Cache == nil || call.Request.Method != http.MethodGet {
+		return 0
+	}
+	return c.opts.CacheTTLs[call.Operation]
+}
+
+// sendCached returns the cached response for the call if it is fresh.
+// Otherwise, it sends the request, revalidating the expired cached response if
+// possible, and caches the response.
+func (c *client) sendCached(call *Call, ttl time.Duration) (*http.Response, error) {
+	r := call.Request
+	key := c.cacheKey(call.Operation, r.URL.String())
+	cached, err := c.opts.Cache.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting cached response")
+	}
+	if cached != nil && !cached.expired() {
+		call.CacheStatus = CacheHit
+		return cachedHTTPResponse(r, http.Header{}, cached.Body), nil
+	}
+	if cached != nil && cached.ETag != "" {
+		r.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := c.send(call)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		call.CacheStatus = CacheRevalidated
+		cached.ExpiresAt = time.Now().Add(ttl)
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			cached.ETag = etag
+		}
+		c.putCached(call, key, *cached)
+		return cachedHTTPResponse(r, resp.Header, cached.Body), nil
+	case resp.StatusCode == http.StatusOK:
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading response body")
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		call.CacheStatus = CacheMiss
+		c.putCached(call, key, CachedResponse{
+			Body:      b,
+			ETag:      resp.Header.Get("ETag"),
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	}
+	return resp, nil
+}
+
+// putCached caches the response for the call. The response was already
+// received, so failures are only logged rather than failing the call.
+func (c *client) putCached(call *Call, key string, cached CachedResponse) {
+	if err := c.opts.Cache.Put(key, cached); err != nil && c.opts.Logger != nil && c.opts.Logger.Enabled(LevelWarn) {
+		c.opts.Logger.Log(LevelWarn, "could not cache result",
+			LogField{Key: "operation", Value: call.Operation},
+			LogField{Key: "error", Value: err.Error()})
+	}
+}
+
+// cachedHTTPResponse returns a successful response with the cached body.
+func cachedHTTPResponse(r *http.Request, header http.Header, body []byte) *http.Response {
+	header = header.Clone()
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    r,
+	}
+}
+
+// invalidateCache removes the cached results that the successful call may
+// have made stale. The call already succeeded on the server, so failures are
+// only logged rather than failing the call, which callers might retry.
+func (c *client) invalidateCache(call *Call) {
+	if c.opts.Cache == nil || c.opts.DryRun {
+		return
+	}
+	for _, cr := range cacheInvalidations[call.Operation] {
+		if err := c.opts.Cache.Delete(c.cacheKey(cr.operation, c.urlRoute(cr.route))); err != nil && c.opts.Logger != nil && c.opts.Logger.Enabled(LevelWarn) {
+			c.opts.Logger.Log(LevelWarn, "could not invalidate cached result",
+				LogField{Key: "operation", Value: call.Operation},
+				LogField{Key: "cached_operation", Value: cr.operation},
+				LogField{Key: "error", Value: err.Error()})
+		}
+	}
+}
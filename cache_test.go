@@ -0,0 +1,244 @@
+package bonusly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheTestServer serves the user's info with an ETag that changes whenever
+// a bonus is created.
+type cacheTestServer struct {
+	*httptest.Server
+	balance     int
+	userInfo    int
+	notModified int
+	etags       bool
+	mu          sync.Mutex
+}
+
+func newCacheTestServer(t *testing.T, etags bool) *cacheTestServer {
+	srv := &cacheTestServer{balance: 100, etags: etags}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users/me":
+			srv.userInfo++
+			etag := fmt.Sprintf(`"%d"`, srv.balance)
+			if srv.etags {
+				if r.Header.Get("If-None-Match") == etag {
+					srv.notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+			}
+			fmt.Fprintf(w, `{"success": true, "result": {"giving_balance": %d}}`, srv.balance)
+		case r.Method == http.MethodPost && r.URL.Path == "/bonuses":
+			srv.balance--
+			fmt.Fprint(w, `{"success": true, "result": {"id": "bonus"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "message": "not found"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (s *cacheTestServer) counts() (userInfo, notModified int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userInfo, s.notModified
+}
+
+func TestResponseCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newClient := func(t *testing.T, srv *cacheTestServer, cache ResponseCache, ttl time.Duration, calls *[]*Call) Client {
+		c, err := NewClient(ClientOptions{
+			AccessToken: "access_token",
+			HTTPClient:  &http.Client{},
+			BaseURL:     srv.URL,
+			Cache:       cache,
+			CacheTTLs:   map[string]time.Duration{"MyUserInfo": ttl},
+			Middleware: []Middleware{func(next Doer) Doer {
+				return DoerFunc(func(call *Call) error {
+					*calls = append(*calls, call)
+					return next.Do(call)
+				})
+			}},
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("ServesFreshResultsFromCache", func(t *testing.T) {
+		srv := newCacheTestServer(t, false)
+		var calls []*Call
+		c := newClient(t, srv, NewLRUResponseCache(0), time.Hour, &calls)
+
+		for i := 0; i < 3; i++ {
+			info, err := c.MyUserInfo(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 100, *info.GivingBalance)
+		}
+		userInfo, _ := srv.counts()
+		assert.Equal(t, 1, userInfo)
+		require.Len(t, calls, 3)
+		assert.Equal(t, CacheMiss, calls[0].CacheStatus)
+		assert.Equal(t, CacheHit, calls[1].CacheStatus)
+		assert.Equal(t, CacheHit, calls[2].CacheStatus)
+		assert.Equal(t, 0, calls[1].Attempts)
+	})
+	t.Run("RevalidatesExpiredResultsWithETag", func(t *testing.T) {
+		srv := newCacheTestServer(t, true)
+		var calls []*Call
+		c := newClient(t, srv, NewLRUResponseCache(0), time.Nanosecond, &calls)
+
+		for i := 0; i < 2; i++ {
+			info, err := c.MyUserInfo(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 100, *info.GivingBalance)
+		}
+		userInfo, notModified := srv.counts()
+		assert.Equal(t, 2, userInfo)
+		assert.Equal(t, 1, notModified)
+		require.Len(t, calls, 2)
+		assert.Equal(t, CacheRevalidated, calls[1].CacheStatus)
+	})
+	t.Run("InvalidatesUserInfoAfterCreateBonus", func(t *testing.T) {
+		srv := newCacheTestServer(t, false)
+		var calls []*Call
+		c := newClient(t, srv, NewLRUResponseCache(0), time.Hour, &calls)
+
+		info, err := c.MyUserInfo(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 100, *info.GivingBalance)
+
+		_, err = c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @someone for testing #test"})
+		require.NoError(t, err)
+
+		info, err = c.MyUserInfo(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 99, *info.GivingBalance)
+		userInfo, _ := srv.counts()
+		assert.Equal(t, 2, userInfo)
+	})
+	t.Run("DoesNotFailMutationsWhenInvalidationFails", func(t *testing.T) {
+		srv := newCacheTestServer(t, false)
+		var calls []*Call
+		c := newClient(t, srv, &failingDeleteCache{ResponseCache: NewLRUResponseCache(0)}, time.Hour, &calls)
+
+		resp, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @someone for testing #test"})
+		require.NoError(t, err, "should not fail a bonus that the server created")
+		assert.NotNil(t, resp)
+	})
+	t.Run("DoesNotFailReadsWhenCachingFails", func(t *testing.T) {
+		srv := newCacheTestServer(t, false)
+		var calls []*Call
+		c := newClient(t, srv, &failingPutCache{ResponseCache: NewLRUResponseCache(0)}, time.Hour, &calls)
+
+		for i := 0; i < 2; i++ {
+			info, err := c.MyUserInfo(ctx)
+			require.NoError(t, err, "should not fail a result that the server returned")
+			assert.Equal(t, 100, *info.GivingBalance)
+		}
+		userInfo, _ := srv.counts()
+		assert.Equal(t, 2, userInfo)
+	})
+	t.Run("DoesNotShareResultsBetweenUsers", func(t *testing.T) {
+		srv := newCacheTestServer(t, false)
+		cache := NewLRUResponseCache(0)
+		var calls []*Call
+		c := newClient(t, srv, cache, time.Hour, &calls)
+		_, err := c.MyUserInfo(ctx)
+		require.NoError(t, err)
+
+		other, err := NewClient(ClientOptions{
+			AccessToken: "other_access_token",
+			HTTPClient:  &http.Client{},
+			BaseURL:     srv.URL,
+			Cache:       cache,
+		})
+		require.NoError(t, err)
+		_, err = other.MyUserInfo(ctx)
+		require.NoError(t, err)
+
+		userInfo, _ := srv.counts()
+		assert.Equal(t, 2, userInfo)
+	})
+	t.Run("DiskCachePersistsAcrossClients", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cache")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		srv := newCacheTestServer(t, false)
+		for i := 0; i < 2; i++ {
+			cache, err := NewDiskResponseCache(dir)
+			require.NoError(t, err)
+			var calls []*Call
+			c := newClient(t, srv, cache, time.Hour, &calls)
+			info, err := c.MyUserInfo(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 100, *info.GivingBalance)
+		}
+		userInfo, _ := srv.counts()
+		assert.Equal(t, 1, userInfo)
+	})
+}
+
+func TestLRUResponseCache(t *testing.T) {
+	cache := NewLRUResponseCache(2)
+	require.NoError(t, cache.Put("a", CachedResponse{Body: []byte("a")}))
+	require.NoError(t, cache.Put("b", CachedResponse{Body: []byte("b")}))
+
+	resp, err := cache.Get("a")
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "a", string(resp.Body))
+
+	require.NoError(t, cache.Put("c", CachedResponse{Body: []byte("c")}))
+	resp, err = cache.Get("b")
+	require.NoError(t, err)
+	assert.Nil(t, resp, "least recently used response should be evicted")
+	resp, err = cache.Get("a")
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	require.NoError(t, cache.Delete("a"))
+	resp, err = cache.Get("a")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+// failingDeleteCache is a cache that cannot delete results.
+type failingDeleteCache struct {
+	ResponseCache
+}
+
+func (c *failingDeleteCache) Delete(string) error {
+	return errors.New("disk full")
+}
+
+// failingPutCache is a cache that cannot store results.
+type failingPutCache struct {
+	ResponseCache
+}
+
+func (c *failingPutCache) Put(string, CachedResponse) error {
+	return errors.New("disk full")
+}
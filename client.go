@@ -9,18 +9,50 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/kimchelly/go-bonusly/internal/ptr"
 	"github.com/pkg/errors"
 )
 
 // ClientOptions represent options to initialize a Bonusly client authenticated
 // with a particular user's access token.
 type ClientOptions struct {
-	AccessToken       string
-	BaseURL           string
-	HTTPClient        *http.Client
+	AccessToken string
+	BaseURL     string
+	HTTPClient  *http.Client
+	// IdempotencyStore records the outcome of creating bonuses that have an
+	// idempotency key. Defaults to an in-memory store.
+	IdempotencyStore IdempotencyStore
+	// DryRun, if set, prevents requests that would modify data in Bonusly
+	// from being sent. Instead, the request is written to DryRunOutput and a
+	// synthesized response is returned. Requests that only read data are still
+	// sent.
+	DryRun bool
+	// DryRunOutput is where requests are written in dry run mode. Defaults to
+	// stderr.
+	DryRunOutput io.Writer
+	// Middleware wraps every call to the Bonusly API. The first middleware is
+	// the outermost one, so it sees the call first and its result last.
+	Middleware []Middleware
+	// AttemptMiddleware wraps the HTTP transport used to send each attempt of
+	// a request, so unlike Middleware, it sees every retry separately. The
+	// first middleware is the outermost one.
+	AttemptMiddleware []TransportMiddleware
+	// Logger, if set, records every call to the Bonusly API. At debug level,
+	// it also records the full HTTP exchange with the access token redacted.
+	Logger Logger
+	// RedactReasons, if set, redacts bonus reasons from logged HTTP exchanges.
+	RedactReasons bool
+	// Cache, if set, caches the results of the client methods in CacheTTLs.
+	Cache ResponseCache
+	// CacheTTLs are how long to cache the results of each client method by
+	// name (e.g. "ListRewards"). Results of methods that are not listed are
+	// not cached. Defaults to DefaultCacheTTLs if Cache is set.
+	CacheTTLs         map[string]time.Duration
 	defaultHTTPClient bool
 }
 
@@ -36,12 +68,24 @@ func (o *ClientOptions) Validate() error {
 	if o.BaseURL == "" {
 		o.BaseURL = productionBaseURL
 	}
+	if o.IdempotencyStore == nil {
+		o.IdempotencyStore = NewMemoryIdempotencyStore()
+	}
+	if o.Cache != nil && o.CacheTTLs == nil {
+		o.CacheTTLs = DefaultCacheTTLs
+	}
+	if o.DryRun && o.DryRunOutput == nil {
+		o.DryRunOutput = os.Stderr
+	}
 	o.BaseURL = strings.TrimSuffix(o.BaseURL, "/")
 	return catcher.Resolve()
 }
 
 type client struct {
-	opts ClientOptions
+	opts       ClientOptions
+	httpClient *http.Client
+	doer       Doer
+	keyLocks   keyedMutex
 }
 
 // NewClient returns a client to interact with the Bonusly API.
@@ -49,12 +93,28 @@ func NewClient(opts ClientOptions) (Client, error) {
 	if err := opts.Validate(); err != nil {
 		return nil, errors.Wrap(err, "invalid options")
 	}
-	return &client{
-		opts: opts,
-	}, nil
+	c := &client{
+		opts:       opts,
+		httpClient: instrumentAttempts(opts.HTTPClient, opts.AttemptMiddleware),
+	}
+	middleware := opts.Middleware
+	if opts.Logger != nil {
+		middleware = append(middleware[:len(middleware):len(middleware)], loggingMiddleware(opts.Logger, opts.RedactReasons))
+	}
+	c.doer = chainMiddleware(DoerFunc(c.do), middleware)
+	return c, nil
 }
 
 func (c *client) CreateBonus(ctx context.Context, opts CreateBonusRequest) (*BonusResponse, error) {
+	if opts.IdempotencyKey != "" && !c.opts.DryRun {
+		return c.createBonusIdempotent(ctx, opts)
+	}
+	return c.createBonus(ctx, opts)
+}
+
+func (c *client) createBonus(ctx context.Context, opts CreateBonusRequest) (*BonusResponse, error) {
+	// The idempotency key is only meaningful to this client.
+	opts.IdempotencyKey = ""
 	body, err := c.makeBody(opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating request body")
@@ -66,13 +126,17 @@ func (c *client) CreateBonus(ctx context.Context, opts CreateBonusRequest) (*Bon
 	}
 
 	var result bonusResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("CreateBonus", r, opts, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	return &result.Result, nil
 }
 
+func (c *client) CreateBonuses(ctx context.Context, reqs []CreateBonusRequest, opts BulkOptions) ([]BulkResult, error) {
+	return createBonuses(ctx, c, reqs, opts)
+}
+
 func (c *client) GetBonus(ctx context.Context, id string) (*BonusResponse, error) {
 	r, err := http.NewRequestWithContext(ctx, http.MethodGet, c.urlRoute("/bonuses", id), nil)
 	if err != nil {
@@ -80,7 +144,7 @@ func (c *client) GetBonus(ctx context.Context, id string) (*BonusResponse, error
 	}
 
 	var result bonusResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("GetBonus", r, nil, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -99,7 +163,7 @@ func (c *client) ListBonuses(ctx context.Context, req ListBonusesRequest) ([]Bon
 	r.URL.RawQuery = q.Encode()
 
 	var result bonusesResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("ListBonuses", r, req, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -121,7 +185,7 @@ func (c *client) UpdateBonus(ctx context.Context, id, reason string) (*BonusResp
 	}
 
 	var result bonusResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("UpdateBonus", r, payload, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -134,7 +198,7 @@ func (c *client) DeleteBonus(ctx context.Context, id string) error {
 		return errors.Wrap(err, "creating request")
 	}
 
-	if err := c.doRequest(r, nil); err != nil {
+	if err := c.doRequest("DeleteBonus", r, nil, nil); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -153,7 +217,7 @@ func (c *client) ListRewards(ctx context.Context, req ListRewardsRequest) ([]Rew
 	r.URL.RawQuery = q.Encode()
 
 	var result rewardsResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("ListRewards", r, req, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	return result.Result, nil
@@ -165,7 +229,56 @@ func (c *client) MyUserInfo(ctx context.Context) (*UserInfoResponse, error) {
 		return nil, errors.Wrap(err, "creating request")
 	}
 	var result userInfoResponseWrapper
-	if err := c.doRequest(r, &result); err != nil {
+	if err := c.doRequest("MyUserInfo", r, nil, &result); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &result.Result, nil
+}
+
+func (c *client) ListUsers(ctx context.Context, req ListUsersRequest) ([]UserInfoResponse, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, c.urlRoute("/users"), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	q := r.URL.Query()
+	for k, v := range req.QueryMap() {
+		q.Set(k, v)
+	}
+	r.URL.RawQuery = q.Encode()
+
+	var result usersResponseWrapper
+	if err := c.doRequest("ListUsers", r, req, &result); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return result.Result, nil
+}
+
+func (c *client) AutocompleteUsers(ctx context.Context, search string) ([]UserInfoResponse, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, c.urlRoute("/users/autocomplete"), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	q := r.URL.Query()
+	q.Set("search", search)
+	r.URL.RawQuery = q.Encode()
+
+	var result usersResponseWrapper
+	if err := c.doRequest("AutocompleteUsers", r, search, &result); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return result.Result, nil
+}
+
+func (c *client) MyCompanyInfo(ctx context.Context) (*CompanyResponse, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, c.urlRoute("/companies/show"), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	var result companyResponseWrapper
+	if err := c.doRequest("MyCompanyInfo", r, nil, &result); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -179,32 +292,69 @@ func (c *client) Close(_ context.Context) error {
 	return nil
 }
 
-func (c *client) doRequest(r *http.Request, result interface{}) error {
+func (c *client) doRequest(op string, r *http.Request, payload, result interface{}) error {
 	c.addHeaders(r)
 
-	resp, err := c.opts.HTTPClient.Do(r)
+	return c.doer.Do(&Call{
+		Operation: op,
+		Request:   r,
+		Payload:   payload,
+		result:    result,
+	})
+}
+
+// do sends the call's request and decodes the response. It is the innermost
+// Doer that the middleware wraps.
+func (c *client) do(call *Call) error {
+	var resp *http.Response
+	var err error
+	if ttl := c.cacheTTL(call); ttl > 0 {
+		resp, err = c.sendCached(call, ttl)
+	} else {
+		resp, err = c.send(call)
+	}
 	if err != nil {
 		return errors.Wrap(err, "executing request")
 	}
 	defer resp.Body.Close()
+	call.Response = resp
 
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return errors.Wrap(err, "reading response body")
 	}
+	// Replace the body so that middleware can read it again.
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
 	if resp.StatusCode != http.StatusOK {
 		return c.errorResponse(resp, b)
 	}
 
-	if result != nil {
-		if err := json.Unmarshal(b, &result); err != nil {
+	if call.result != nil {
+		if err := json.Unmarshal(b, &call.result); err != nil {
 			return errors.Wrap(err, "received unexpected response body")
 		}
+		if w, ok := call.result.(resultWrapper); ok {
+			call.Result = w.result()
+		}
 	}
 
+	c.invalidateCache(call)
 	return nil
 }
 
+// send sends the call's request, or synthesizes a response to it in dry run
+// mode.
+func (c *client) send(call *Call) (*http.Response, error) {
+	r := call.Request
+	if c.opts.DryRun && r.Method != http.MethodGet {
+		return c.dryRunResponse(r)
+	}
+	attempts := &attemptCounter{}
+	resp, err := c.httpClient.Do(r.WithContext(withAttemptCounter(r.Context(), attempts)))
+	call.Attempts = attempts.get()
+	return resp, err
+}
+
 func (c *client) urlRoute(parts ...string) string {
 	baseURL := strings.TrimSuffix(c.opts.BaseURL, "/")
 	if len(parts) == 0 {
@@ -223,18 +373,19 @@ func (c *client) makeBody(payload interface{}) (io.Reader, error) {
 }
 
 func (c *client) errorResponse(resp *http.Response, body []byte) error {
+	respErr := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
 	var errResp CommonResponse
-	statusErr := errors.Errorf("status %s", resp.Status)
 	if err := json.Unmarshal(body, &errResp); err != nil {
-		return errors.Wrap(errors.New(string(body)), statusErr.Error())
-	}
-	if errResp.Message != nil {
-		return errors.Wrap(errors.New(*errResp.Message), statusErr.Error())
-	}
-	if !fromBoolPtr(errResp.Success) {
-		return errors.Wrap(errors.New("request unsuccessful for unknown reason"), statusErr.Error())
+		respErr.Message = string(body)
+	} else if errResp.Message != nil {
+		respErr.Message = *errResp.Message
+	} else if !ptr.Bool(errResp.Success) {
+		respErr.Message = "request unsuccessful for unknown reason"
 	}
-	return errors.WithStack(statusErr)
+	return errors.WithStack(respErr)
 }
 
 func (c *client) addHeaders(r *http.Request) {
@@ -2,28 +2,82 @@ package bonusly
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/kimchelly/go-bonusly/recorder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestClient(t *testing.T) {
-	accessToken := os.Getenv("BONUSLY_TOKEN")
-	require.NotEmpty(t, accessToken, "missing access token")
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+const (
+	// tokenEnvVar is the environment variable that, when set, makes the
+	// client tests send real requests using it as the access token instead of
+	// replaying fixtures.
+	tokenEnvVar = "BONUSLY_TOKEN"
+	// recordEnvVar is the environment variable that, when set along with
+	// tokenEnvVar, makes the client tests record the real requests they send
+	// to their fixtures.
+	recordEnvVar = "BONUSLY_RECORD"
+)
 
+// newFixtureClient returns a client for the client tests. By default, its
+// requests are replayed from the fixture in testdata. The fixtures are written
+// by hand to match the documented API responses rather than recorded from the
+// real API, so they only check that the client sends the expected requests and
+// handles the expected responses. To test against the real API, set
+// tokenEnvVar; to replace a fixture with a recording, set recordEnvVar too.
+func newFixtureClient(t *testing.T, fixture string, opts ClientOptions) Client {
 	httpClient := getHTTPClient()
-	defer putHTTPClient(httpClient)
+	t.Cleanup(func() { putHTTPClient(httpClient) })
+	opts.HTTPClient = httpClient
 
-	c, err := NewClient(ClientOptions{
-		AccessToken: accessToken,
-		HTTPClient:  httpClient,
+	if token := os.Getenv(tokenEnvVar); token != "" {
+		// Only send the real access token to the real API.
+		if opts.BaseURL == "" {
+			opts.AccessToken = token
+		}
+		if os.Getenv(recordEnvVar) != "" {
+			opts.HTTPClient = recordingHTTPClient(t, fixture, recorder.ModeRecord, httpClient)
+		}
+	} else {
+		require.Empty(t, os.Getenv(recordEnvVar), "recording requires an access token in %s", tokenEnvVar)
+		opts.HTTPClient = recordingHTTPClient(t, fixture, recorder.ModeReplay, httpClient)
+	}
+
+	c, err := NewClient(opts)
+	require.NoError(t, err)
+	return c
+}
+
+// recordingHTTPClient returns an HTTP client that records or replays its
+// requests using the fixture in testdata.
+func recordingHTTPClient(t *testing.T, fixture string, mode recorder.Mode, httpClient *http.Client) *http.Client {
+	rec, err := recorder.New(recorder.Options{
+		CassettePath: filepath.Join("testdata", fixture+"_fixture.jsonl"),
+		Mode:         mode,
+		Match:        recorder.MatchStrict,
+		Transport:    httpClient.Transport,
 	})
 	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, rec.Close())
+	})
+	return &http.Client{Transport: rec, Timeout: httpClient.Timeout}
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newFixtureClient(t, "client", ClientOptions{
+		AccessToken: "access_token",
+	})
 	defer func() {
 		assert.NoError(t, c.Close(ctx))
 	}()
@@ -73,15 +127,10 @@ func TestClientWithMockServer(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	httpClient := getHTTPClient()
-	defer putHTTPClient(httpClient)
-
-	c, err := NewClient(ClientOptions{
+	c := newFixtureClient(t, "client_mock_server", ClientOptions{
 		AccessToken: "access_token",
-		HTTPClient:  httpClient,
 		BaseURL:     "https://private-anon-7c8306e7d6-bonusly.apiary-mock.com/api/v1",
 	})
-	require.NoError(t, err)
 	defer func() {
 		assert.NoError(t, c.Close(ctx))
 	}()
@@ -118,3 +167,90 @@ func TestClientWithMockServer(t *testing.T) {
 		assert.NotZero(t, info)
 	})
 }
+
+func TestAutocompleteUsers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/users/autocomplete", r.URL.Path)
+		assert.Equal(t, "Bearer access_token", r.Header.Get("Authorization"))
+		switch r.URL.Query().Get("search") {
+		case "al ice":
+			fmt.Fprint(w, `{"success": true, "result": [{"username": "alice", "display_name": "Alice A"}, {"username": "alicia"}]}`)
+		case "nobody":
+			fmt.Fprint(w, `{"success": true, "result": []}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success": false, "message": "bad search"}`)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+	})
+	require.NoError(t, err)
+
+	t.Run("ReturnsMatchingUsers", func(t *testing.T) {
+		users, err := c.AutocompleteUsers(ctx, "al ice")
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.Equal(t, "alice", ptr.String(users[0].UserName))
+		assert.Equal(t, "Alice A", ptr.String(users[0].DisplayName))
+		assert.Equal(t, "alicia", ptr.String(users[1].UserName))
+	})
+	t.Run("ReturnsNoUsers", func(t *testing.T) {
+		users, err := c.AutocompleteUsers(ctx, "nobody")
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+	t.Run("FailsWithErrorResponse", func(t *testing.T) {
+		users, err := c.AutocompleteUsers(ctx, "")
+		assert.Error(t, err)
+		assert.Nil(t, users)
+	})
+}
+
+func TestMyCompanyInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var fail bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/companies/show", r.URL.Path)
+		if fail {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"success": false, "message": "unauthorized"}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "result": {"id": "company", "name": "Example", "company_hashtags": ["#teamwork", "#ownership"]}}`)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+	})
+	require.NoError(t, err)
+
+	t.Run("Succeeds", func(t *testing.T) {
+		fail = false
+		company, err := c.MyCompanyInfo(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "Example", ptr.String(company.Name))
+		require.NotNil(t, company.CompanyHashtags)
+		assert.Equal(t, []string{"#teamwork", "#ownership"}, *company.CompanyHashtags)
+	})
+	t.Run("FailsWithErrorResponse", func(t *testing.T) {
+		fail = true
+		company, err := c.MyCompanyInfo(ctx)
+		assert.Error(t, err)
+		assert.Nil(t, company)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/archive"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func archiveCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "archive",
+		Usage: "manage a local SQLite archive of bonuses",
+		Subcommands: []*cli.Command{
+			archiveSync(),
+		},
+	}
+}
+
+func archiveSync() *cli.Command {
+	const (
+		dbFlagName      = "db"
+		fullFlagName    = "full"
+		overlapFlagName = "overlap"
+	)
+
+	return &cli.Command{
+		Name:  "sync",
+		Usage: "pull new, edited and deleted bonuses into the archive",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  dbFlagName,
+				Usage: "the path to the SQLite database, which is created if it does not exist",
+				Value: "bonuses.db",
+			},
+			&cli.BoolFlag{
+				Name:  fullFlagName,
+				Usage: "re-sync all bonuses and mark all archived bonuses that no longer exist as deleted",
+			},
+			&cli.DurationFlag{
+				Name:  overlapFlagName,
+				Usage: "how long before the most recently archived bonus to re-sync, to pick up recent edits and deletions",
+				Value: 7 * 24 * time.Hour,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			a, err := archive.Open(c.String(dbFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "opening archive '%s'", c.String(dbFlagName))
+			}
+			defer a.Close()
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				res, err := a.Sync(ctx, client, archive.SyncOptions{
+					Full:    c.Bool(fullFlagName),
+					Overlap: c.Duration(overlapFlagName),
+				})
+				if err != nil {
+					return errors.Wrap(err, "syncing archive")
+				}
+				_, err = fmt.Fprintf(os.Stdout, "Synced archive: %d added, %d updated, %d deleted, %d unchanged.\n",
+					res.Added, res.Updated, res.Deleted, res.Unchanged)
+				return err
+			})
+		},
+	}
+}
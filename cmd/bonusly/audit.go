@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/anomaly"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func audit() *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "audit recognition for misuse",
+		Subcommands: []*cli.Command{
+			auditAnomalies(),
+		},
+	}
+}
+
+func auditAnomalies() *cli.Command {
+	const (
+		startFlagName          = "start"
+		endFlagName            = "end"
+		timezoneFlagName       = "timezone"
+		reciprocalFlagName     = "reciprocal-min"
+		cycleFlagName          = "cycle-min"
+		maxCycleLengthFlagName = "max-cycle-length"
+		resetDayFlagName       = "reset-day"
+		burstWindowFlagName    = "burst-window"
+		burstFractionFlagName  = "burst-fraction"
+		burstMinFlagName       = "burst-min"
+		repeatedFlagName       = "repeated-reason-min"
+		addOnFlagName          = "add-on-min"
+		minScoreFlagName       = "min-score"
+		jsonFlagName           = "json"
+	)
+
+	return &cli.Command{
+		Name:  "anomalies",
+		Usage: "report reciprocal giving, giving cycles, bursts before balance resets, repeated reasons and self-serving add-ons",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only include bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only include bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone of balance resets and to interpret dates in",
+				Value: "UTC",
+			},
+			&cli.IntFlag{
+				Name:  reciprocalFlagName,
+				Usage: "flag pairs of people who each gave the other at least this amount",
+				Value: 20,
+			},
+			&cli.IntFlag{
+				Name:  cycleFlagName,
+				Usage: "flag cycles of people who each gave the next at least this amount",
+				Value: 5,
+			},
+			&cli.IntFlag{
+				Name:  maxCycleLengthFlagName,
+				Usage: "the maximum number of people in a cycle",
+				Value: 4,
+			},
+			&cli.IntFlag{
+				Name:  resetDayFlagName,
+				Usage: "the day of the month that giving balances reset",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  burstWindowFlagName,
+				Usage: "how long before a balance reset giving counts towards a burst",
+				Value: 48 * time.Hour,
+			},
+			&cli.Float64Flag{
+				Name:  burstFractionFlagName,
+				Usage: "flag givers who gave at least this fraction of a period's amount in the burst window",
+				Value: 0.8,
+			},
+			&cli.IntFlag{
+				Name:  burstMinFlagName,
+				Usage: "the amount that a giver must give in the burst window to be flagged",
+				Value: 20,
+			},
+			&cli.IntFlag{
+				Name:  repeatedFlagName,
+				Usage: "flag givers who gave at least this many bonuses with the same reason",
+				Value: 3,
+			},
+			&cli.IntFlag{
+				Name:  addOnFlagName,
+				Usage: "flag givers who gave at least this many add-ons to bonuses they gave or received",
+				Value: 1,
+			},
+			&cli.Float64Flag{
+				Name:  minScoreFlagName,
+				Usage: "only report findings with at least this score, where 1 is at the threshold",
+			},
+			&cli.BoolFlag{
+				Name:  jsonFlagName,
+				Usage: "output the report as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			d, err := anomaly.NewDetector(anomaly.Options{
+				ReciprocalMinAmount: c.Int(reciprocalFlagName),
+				CycleMinAmount:      c.Int(cycleFlagName),
+				MaxCycleLength:      c.Int(maxCycleLengthFlagName),
+				ResetDay:            c.Int(resetDayFlagName),
+				BurstWindow:         c.Duration(burstWindowFlagName),
+				BurstFraction:       c.Float64(burstFractionFlagName),
+				BurstMinAmount:      c.Int(burstMinFlagName),
+				RepeatedReasonMin:   c.Int(repeatedFlagName),
+				SelfServingAddOnMin: c.Int(addOnFlagName),
+				MinScore:            c.Float64(minScoreFlagName),
+				Location:            loc,
+			})
+			if err != nil {
+				return err
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				req := bonusly.ListBonusesRequest{
+					StartTime:       start,
+					EndTime:         end,
+					IncludeChildren: true,
+				}
+				if err := bonusly.EachBonus(ctx, client, req, func(b bonusly.BonusResponse) error {
+					d.Add(b)
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				report := d.Report()
+				if c.Bool(jsonFlagName) {
+					output, err := json.MarshalIndent(report, "", "\t")
+					if err != nil {
+						return err
+					}
+					_, err = fmt.Fprintln(os.Stdout, string(output))
+					return err
+				}
+				return writeAnomalyReport(os.Stdout, report)
+			})
+		},
+	}
+}
+
+// writeAnomalyReport writes the anomalies as plain text tables.
+func writeAnomalyReport(w io.Writer, r *anomaly.Report) error {
+	if len(r.Findings) == 0 {
+		_, err := fmt.Fprintln(w, "No anomalies found.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SCORE\tKIND\tPEOPLE\tDESCRIPTION\n")
+	for _, f := range r.Findings {
+		fmt.Fprintf(tw, "%.2f\t%s\t%s\t%s\n", f.Score, f.Kind, strings.Join(f.People, ", "), f.Description)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "PERSON\tSCORE\tFINDINGS\n")
+	for _, p := range r.People {
+		fmt.Fprintf(tw, "%s\t%.2f\t%d\n", p.Person, p.Score, p.Findings)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func createBatch() *cli.Command {
+	const (
+		fileFlagName        = "file"
+		journalFlagName     = "journal"
+		resumeFlagName      = "resume"
+		overwriteFlagName   = "overwrite"
+		concurrencyFlagName = "concurrency"
+	)
+
+	return &cli.Command{
+		Name:  "create-batch",
+		Usage: "create many bonuses from a JSONL or CSV file",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name: fileFlagName,
+				Usage: "the file containing the bonuses to create, either as JSON lines or as a CSV with a header " +
+					"row (columns: reason, giver_email, parent_bonus_id)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  journalFlagName,
+				Usage: "the file to record the result of each bonus as JSON lines (default: <file>.results.jsonl)",
+			},
+			&cli.BoolFlag{
+				Name:  resumeFlagName,
+				Usage: "skip bonuses that the journal shows were already created successfully",
+			},
+			&cli.BoolFlag{
+				Name:  overwriteFlagName,
+				Usage: "replace an existing journal instead of refusing to run, creating every bonus again",
+			},
+			&cli.IntFlag{
+				Name:  concurrencyFlagName,
+				Usage: "the maximum number of bonuses to create at the same time",
+				Value: 4,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			file := c.String(fileFlagName)
+			reqs, err := readBatchFile(file)
+			if err != nil {
+				return errors.Wrapf(err, "reading batch file '%s'", file)
+			}
+
+			journalPath := c.String(journalFlagName)
+			if journalPath == "" {
+				journalPath = file + ".results.jsonl"
+			}
+			if c.Bool(resumeFlagName) && c.Bool(overwriteFlagName) {
+				return errors.New("cannot both resume from and overwrite the journal")
+			}
+			opts := bonusly.BulkOptions{Concurrency: c.Int(concurrencyFlagName)}
+			if c.Bool(resumeFlagName) {
+				completed, err := readJournalFile(journalPath)
+				if err != nil {
+					return errors.Wrapf(err, "reading journal '%s'", journalPath)
+				}
+				opts.Completed = completed
+				// The journal is appended to, so it already has them.
+				opts.CompletedJournaled = true
+			}
+
+			// Dry run results are not written to the journal, since resuming
+			// from them would skip bonuses that were never created.
+			dryRun := c.Bool(dryRunFlagName)
+			if !dryRun {
+				flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+				if !c.Bool(resumeFlagName) {
+					// Truncating a journal would forget which bonuses were
+					// already created, so running the batch again would
+					// create them again.
+					if info, err := os.Stat(journalPath); err == nil && info.Size() > 0 && !c.Bool(overwriteFlagName) {
+						return errors.Errorf("journal '%s' already has results; use --%s to skip the bonuses it records or --%s to replace it",
+							journalPath, resumeFlagName, overwriteFlagName)
+					}
+					flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+				}
+				journal, err := os.OpenFile(journalPath, flags, 0644)
+				if err != nil {
+					return errors.Wrapf(err, "opening journal '%s'", journalPath)
+				}
+				defer journal.Close()
+				opts.Journal = journal
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				results, err := client.CreateBonuses(ctx, reqs, opts)
+				var succeeded int
+				for _, res := range results {
+					if res.Succeeded() {
+						succeeded++
+					}
+				}
+				if dryRun {
+					fmt.Fprintf(os.Stdout, "Would create %d of %d bonuses.\n", succeeded, len(reqs))
+				} else {
+					fmt.Fprintf(os.Stdout, "Created %d of %d bonuses. Results written to '%s'.\n", succeeded, len(reqs), journalPath)
+				}
+				return err
+			})
+		},
+	}
+}
+
+// readBatchFile reads bonus requests from a CSV file if it has a .csv
+// extension and from a JSON lines file otherwise.
+func readBatchFile(path string) ([]bonusly.CreateBonusRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readBatchCSV(f)
+	}
+	return readBatchJSONL(f)
+}
+
+func readBatchJSONL(r io.Reader) ([]bonusly.CreateBonusRequest, error) {
+	var reqs []bonusly.CreateBonusRequest
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var req bonusly.CreateBonusRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, errors.Wrapf(err, "parsing line %d", line)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, errors.WithStack(scanner.Err())
+}
+
+func readBatchCSV(r io.Reader) ([]bonusly.CreateBonusRequest, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing CSV")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["reason"]; !ok {
+		return nil, errors.New("CSV header must have a 'reason' column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	reqs := make([]bonusly.CreateBonusRequest, 0, len(records)-1)
+	for _, record := range records[1:] {
+		reqs = append(reqs, bonusly.CreateBonusRequest{
+			Reason:        field(record, "reason"),
+			GiverEmail:    field(record, "giver_email"),
+			ParentBonusID: field(record, "parent_bonus_id"),
+		})
+	}
+	return reqs, nil
+}
+
+// readJournalFile reads the results from an existing journal. A journal that
+// does not exist yet has no results.
+func readJournalFile(path string) ([]bonusly.BulkResult, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return bonusly.ReadBulkJournal(f)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/templates"
 	"github.com/pkg/errors"
 	cli "github.com/urfave/cli/v2"
 )
@@ -23,10 +24,48 @@ func app() *cli.App {
 	app := cli.NewApp()
 	app.Name = "bonusly"
 	app.Usage = "Bonusly CLI"
+	app.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:  dryRunFlagName,
+			Usage: "print requests that would modify data instead of sending them",
+		},
+		&cli.BoolFlag{
+			Name:  verboseFlagName,
+			Usage: "log a summary of every API call to stderr",
+		},
+		&cli.BoolFlag{
+			Name:  debugFlagName,
+			Usage: "log every full API request and response to stderr, with the access token redacted",
+		},
+		&cli.BoolFlag{
+			Name:  redactReasonsFlagName,
+			Usage: "redact bonus reasons from logged requests and responses",
+		},
+		&cli.StringFlag{
+			Name:    idempotencyStoreFlagName,
+			Usage:   "the path to a JSON file that records the bonuses given for idempotency keys, so that they are given at most once across runs",
+			EnvVars: []string{"BONUSLY_IDEMPOTENCY_STORE"},
+		},
+	}
 
 	app.Commands = []*cli.Command{
 		bonus(),
+		give(),
+		tui(),
+		serveMetrics(),
 		userInfo(),
+		archiveCmd(),
+		exportCmd(),
+		stats(),
+		graphCmd(),
+		audit(),
+		equityCmd(),
+		scheduleCmd(),
+		milestones(),
+		rulesCmd(),
+		gitCmd(),
+		serveBot(),
+		digestCmd(),
 	}
 
 	return app
@@ -35,6 +74,13 @@ func app() *cli.App {
 const (
 	idFlagName     = "id"
 	reasonFlagName = "reason"
+	dryRunFlagName = "dry-run"
+
+	verboseFlagName       = "verbose"
+	debugFlagName         = "debug"
+	redactReasonsFlagName = "redact-reasons"
+
+	idempotencyStoreFlagName = "idempotency-store"
 )
 
 func bonus() *cli.Command {
@@ -42,7 +88,9 @@ func bonus() *cli.Command {
 		Name: "bonus",
 		Subcommands: []*cli.Command{
 			createBonus(),
+			createBatch(),
 			getBonus(),
+			listBonuses(),
 			updateBonus(),
 			deleteBonus(),
 		},
@@ -51,7 +99,14 @@ func bonus() *cli.Command {
 
 func createBonus() *cli.Command {
 	const (
-		parentIDFlagName = "parent_id"
+		parentIDFlagName       = "parent_id"
+		idempotencyKeyFlagName = "idempotency-key"
+		templateFlagName       = "template"
+		varFlagName            = "var"
+		templateDirFlagName    = "template-dir"
+		recipientFlagName      = "recipient"
+		localeFlagName         = "locale"
+		localePropertyFlagName = "locale-property"
 	)
 
 	return &cli.Command{
@@ -59,21 +114,90 @@ func createBonus() *cli.Command {
 		Usage: "create a new bonus",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     reasonFlagName,
-				Usage:    "the reason for the bonus",
-				Required: true,
+				Name:  reasonFlagName,
+				Usage: "the reason for the bonus",
 			},
 			&cli.StringFlag{
 				Name:  parentIDFlagName,
 				Usage: "the ID of the parent bonus",
 			},
+			&cli.StringFlag{
+				Name:  idempotencyKeyFlagName,
+				Usage: "a unique key that ensures the bonus is given at most once, even if the command is retried (requires --" + idempotencyStoreFlagName + " to hold across runs)",
+			},
+			&cli.StringFlag{
+				Name:  templateFlagName,
+				Usage: "render the reason from the named template instead of setting it directly",
+			},
+			&cli.StringSliceFlag{
+				Name:  varFlagName,
+				Usage: "a template variable in the form key=value",
+			},
+			&cli.StringFlag{
+				Name:    templateDirFlagName,
+				Usage:   "the directory of templates, named <name>.tmpl or <name>.<locale>.tmpl",
+				EnvVars: []string{"BONUSLY_TEMPLATE_DIR"},
+				Value:   "templates",
+			},
+			&cli.StringFlag{
+				Name:  recipientFlagName,
+				Usage: "the email of the recipient, whose locale chooses the template variant and who is available to the template as .Recipient",
+			},
+			&cli.StringFlag{
+				Name:  localeFlagName,
+				Usage: "the locale of the template variant, overriding the recipient's locale",
+			},
+			&cli.StringFlag{
+				Name:  localePropertyFlagName,
+				Usage: "the custom property that holds users' locales",
+				Value: "locale",
+			},
 		},
 		Action: func(c *cli.Context) error {
-			return withClient(func(ctx context.Context, client bonusly.Client) error {
+			if (c.String(reasonFlagName) == "") == (c.String(templateFlagName) == "") {
+				return errors.New("exactly one of a reason or a template must be given")
+			}
+			var lib *templates.Library
+			var vars map[string]string
+			if c.String(templateFlagName) != "" {
+				var err error
+				if lib, err = templates.LoadDir(c.String(templateDirFlagName)); err != nil {
+					return err
+				}
+				if vars, err = templates.ParseVars(c.StringSlice(varFlagName)); err != nil {
+					return err
+				}
+			}
+
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
 				req := bonusly.CreateBonusRequest{
-					Reason:        c.String(reasonFlagName),
-					ParentBonusID: c.String(parentIDFlagName),
+					Reason:         c.String(reasonFlagName),
+					ParentBonusID:  c.String(parentIDFlagName),
+					IdempotencyKey: c.String(idempotencyKeyFlagName),
+				}
+				if lib != nil {
+					var recipient *bonusly.UserInfoResponse
+					if email := c.String(recipientFlagName); email != "" {
+						users, err := client.ListUsers(ctx, bonusly.ListUsersRequest{Email: email, Limit: 1})
+						if err != nil {
+							return errors.Wrap(err, "finding recipient")
+						}
+						if len(users) == 0 {
+							return errors.Errorf("no user with email '%s'", email)
+						}
+						recipient = &users[0]
+					}
+					locale := c.String(localeFlagName)
+					if locale == "" {
+						locale = templates.RecipientLocale(recipient, c.String(localePropertyFlagName))
+					}
+					reason, err := lib.Render(c.String(templateFlagName), locale, templates.Data(vars, recipient))
+					if err != nil {
+						return err
+					}
+					req.Reason = reason
 				}
+
 				resp, err := client.CreateBonus(ctx, req)
 				if err != nil {
 					return err
@@ -101,7 +225,7 @@ func getBonus() *cli.Command {
 			},
 		},
 		Action: func(c *cli.Context) error {
-			return withClient(func(ctx context.Context, client bonusly.Client) error {
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
 				resp, err := client.GetBonus(ctx, c.String(idFlagName))
 				if err != nil {
 					return err
@@ -134,7 +258,7 @@ func updateBonus() *cli.Command {
 			},
 		},
 		Action: func(c *cli.Context) error {
-			return withClient(func(ctx context.Context, client bonusly.Client) error {
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
 				resp, err := client.UpdateBonus(ctx, c.String(idFlagName), c.String(reasonFlagName))
 				if err != nil {
 					return err
@@ -162,7 +286,7 @@ func deleteBonus() *cli.Command {
 			},
 		},
 		Action: func(c *cli.Context) error {
-			return withClient(func(ctx context.Context, client bonusly.Client) error {
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
 				if err := client.DeleteBonus(ctx, c.String(idFlagName)); err != nil {
 					return err
 				}
@@ -186,7 +310,7 @@ func myUserInfo() *cli.Command {
 	return &cli.Command{
 		Name: "me",
 		Action: func(c *cli.Context) error {
-			return withClient(func(ctx context.Context, client bonusly.Client) error {
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
 				info, err := client.MyUserInfo(ctx)
 				if err != nil {
 					return err
@@ -202,24 +326,71 @@ func myUserInfo() *cli.Command {
 	}
 }
 
-func withClient(clientOp func(ctx context.Context, client bonusly.Client) error) error {
-	token, err := getBonuslyToken()
+func withClient(c *cli.Context, clientOp func(ctx context.Context, client bonusly.Client) error) error {
+	return withClientTimeout(c, time.Minute, clientOp)
+}
+
+// withClientTimeout runs the client operation with the given timeout. If the
+// timeout is zero, the operation can run indefinitely.
+func withClientTimeout(c *cli.Context, timeout time.Duration, clientOp func(ctx context.Context, client bonusly.Client) error) error {
+	opts, err := clientOptions(c)
 	if err != nil {
 		return err
 	}
+	return withClientOptions(opts, timeout, clientOp)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+// withClientOptions runs the client operation with a client created from the
+// given options.
+func withClientOptions(opts bonusly.ClientOptions, timeout time.Duration, clientOp func(ctx context.Context, client bonusly.Client) error) error {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
 	defer cancel()
 
-	c, err := bonusly.NewClient(bonusly.ClientOptions{
-		AccessToken: token,
-	})
+	client, err := bonusly.NewClient(opts)
 	if err != nil {
 		return err
 	}
-	defer c.Close(ctx)
+	defer client.Close(ctx)
+
+	return clientOp(ctx, client)
+}
+
+// clientOptions returns the client options set by the global flags.
+func clientOptions(c *cli.Context) (bonusly.ClientOptions, error) {
+	token, err := getBonuslyToken()
+	if err != nil {
+		return bonusly.ClientOptions{}, err
+	}
 
-	return clientOp(ctx, c)
+	opts := bonusly.ClientOptions{
+		AccessToken: token,
+		DryRun:      c.Bool(dryRunFlagName),
+		Middleware: []bonusly.Middleware{
+			bonusly.UserAgentMiddleware("bonusly-cli"),
+			bonusly.RequestIDMiddleware(),
+		},
+		RedactReasons: c.Bool(redactReasonsFlagName),
+	}
+	// Nothing is given in a dry run, so nothing is recorded in the store.
+	if path := c.String(idempotencyStoreFlagName); path != "" && !opts.DryRun {
+		if opts.IdempotencyStore, err = bonusly.NewFileIdempotencyStore(path); err != nil {
+			return bonusly.ClientOptions{}, err
+		}
+	}
+	if c.Bool(debugFlagName) {
+		opts.Logger = bonusly.NewJSONLogger(os.Stderr, bonusly.LevelDebug)
+	} else if c.Bool(verboseFlagName) {
+		opts.Logger = bonusly.NewJSONLogger(os.Stderr, bonusly.LevelInfo)
+	}
+	return opts, nil
 }
 
 func getBonuslyToken() (string, error) {
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/bot"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func serveBot() *cli.Command {
+	const (
+		addrFlagName     = "addr"
+		pathFlagName     = "path"
+		mappingFlagName  = "mapping"
+		tokenFlagName    = "token"
+		commandsFlagName = "commands"
+		insecureFlagName = "insecure"
+	)
+
+	return &cli.Command{
+		Name:  "serve-bot",
+		Usage: "serve a chat integration that gives bonuses from slash-command webhooks",
+		Description: "Commands like '/give +5 @bob great review #ownership' are posted as forms with the command, " +
+			"text, user_id and token fields. Bonuses are given on behalf of the sender, so the access token must " +
+			"be allowed to give bonuses as other users. If a command has a response_url, it is acknowledged " +
+			"immediately and the result is posted there, and its trigger_id ensures its bonus is given at most once.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  addrFlagName,
+				Usage: "the address to serve on",
+				Value: "localhost:8080",
+			},
+			&cli.StringFlag{
+				Name:  pathFlagName,
+				Usage: "the path that accepts commands",
+				Value: "/commands",
+			},
+			&cli.StringFlag{
+				Name:     mappingFlagName,
+				Usage:    "the path to a YAML or JSON file that maps chat user IDs to Bonusly emails",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    tokenFlagName,
+				Usage:   "the verification token that the chat service sends with every command",
+				EnvVars: []string{"BONUSLY_BOT_TOKEN"},
+			},
+			&cli.StringSliceFlag{
+				Name:  commandsFlagName,
+				Usage: "the slash commands that give bonuses",
+				Value: cli.NewStringSlice("/give"),
+			},
+			&cli.BoolFlag{
+				Name:  insecureFlagName,
+				Usage: "allow serving without a verification token, so that anyone who can reach the server can give bonuses as any mapped user",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			mapping, err := bot.LoadMapping(c.String(mappingFlagName))
+			if err != nil {
+				return err
+			}
+			if c.String(tokenFlagName) == "" {
+				if !c.Bool(insecureFlagName) {
+					return errors.Errorf("a verification token is required unless --%s is set", insecureFlagName)
+				}
+				fmt.Fprintln(os.Stderr, "Warning: no verification token is set, so anyone who can reach the server can give bonuses as any mapped user.")
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				b, err := bot.New(client, bot.Options{
+					Mapping:  mapping,
+					Token:    c.String(tokenFlagName),
+					Commands: c.StringSlice(commandsFlagName),
+					Logger:   bonusly.NewJSONLogger(os.Stderr, bonusly.LevelWarn),
+				})
+				if err != nil {
+					return err
+				}
+
+				mux := http.NewServeMux()
+				mux.Handle(c.String(pathFlagName), b)
+				srv := &http.Server{
+					Addr:              c.String(addrFlagName),
+					Handler:           mux,
+					ReadHeaderTimeout: 5 * time.Second,
+					ReadTimeout:       10 * time.Second,
+					WriteTimeout:      10 * time.Second,
+					IdleTimeout:       time.Minute,
+				}
+
+				go func() {
+					<-ctx.Done()
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					_ = srv.Shutdown(shutdownCtx)
+				}()
+
+				fmt.Fprintf(os.Stderr, "Accepting commands on http://%s%s\n", srv.Addr, c.String(pathFlagName))
+				err = srv.ListenAndServe()
+				// Let commands being handled in the background post their
+				// replies before exiting.
+				b.Wait()
+				if err != nil && err != http.ErrServerClosed {
+					return errors.Wrap(err, "serving bot")
+				}
+				return nil
+			})
+		},
+	}
+}
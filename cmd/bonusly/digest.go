@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/digest"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func digestCmd() *cli.Command {
+	const (
+		startFlagName        = "start"
+		endFlagName          = "end"
+		timezoneFlagName     = "timezone"
+		titleFlagName        = "title"
+		managerFlagName      = "manager"
+		htmlTemplateFlagName = "html-template"
+		textTemplateFlagName = "text-template"
+		outputDirFlagName    = "output-dir"
+		smtpAddrFlagName     = "smtp-addr"
+		smtpFromFlagName     = "smtp-from"
+		smtpUsernameFlagName = "smtp-username"
+		smtpPasswordFlagName = "smtp-password"
+	)
+
+	return &cli.Command{
+		Name:  "digest",
+		Usage: "send each manager a digest of the recognition their reports received",
+		Description: "Reports are found by their manager email. Digests are written to files in --output-dir " +
+			"or emailed through the SMTP server at --smtp-addr. In a dry run, digests are not written or sent.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "the start of the period as a date (YYYY-MM-DD) or time (RFC 3339), defaulting to a week before the end",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "the end of the period as a date (YYYY-MM-DD) or time (RFC 3339), defaulting to the start of today",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to interpret dates and show times in",
+				Value: "UTC",
+			},
+			&cli.StringFlag{
+				Name:  titleFlagName,
+				Usage: "the title of the digests",
+				Value: "Weekly recognition digest",
+			},
+			&cli.StringSliceFlag{
+				Name:  managerFlagName,
+				Usage: "only send digests to these manager emails",
+			},
+			&cli.StringFlag{
+				Name:  htmlTemplateFlagName,
+				Usage: "the path to an html/template template of the HTML digest, executed with the digest",
+			},
+			&cli.StringFlag{
+				Name:  textTemplateFlagName,
+				Usage: "the path to a text/template template of the text digest, executed with the digest",
+			},
+			&cli.StringFlag{
+				Name:  outputDirFlagName,
+				Usage: "write each digest to <email>.html and <email>.txt in this directory",
+			},
+			&cli.StringFlag{
+				Name:  smtpAddrFlagName,
+				Usage: "email each digest through the SMTP server at this host:port",
+			},
+			&cli.StringFlag{
+				Name:  smtpFromFlagName,
+				Usage: "the sender address of emailed digests",
+			},
+			&cli.StringFlag{
+				Name:  smtpUsernameFlagName,
+				Usage: "the username to authenticate to the SMTP server with",
+			},
+			&cli.StringFlag{
+				Name:    smtpPasswordFlagName,
+				Usage:   "the password to authenticate to the SMTP server with",
+				EnvVars: []string{"BONUSLY_SMTP_PASSWORD"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			if end.IsZero() {
+				y, m, d := time.Now().In(loc).Date()
+				end = time.Date(y, m, d, 0, 0, 0, 0, loc)
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			if start.IsZero() {
+				start = end.AddDate(0, 0, -7)
+			}
+
+			if (c.String(outputDirFlagName) == "") == (c.String(smtpAddrFlagName) == "") {
+				return errors.New("exactly one of an output directory or an SMTP address must be given")
+			}
+			var sender digest.Sender
+			if dir := c.String(outputDirFlagName); dir != "" {
+				sender = &digest.FileSender{Dir: dir}
+			} else {
+				if sender, err = digest.NewSMTPSender(digest.SMTPOptions{
+					Addr:     c.String(smtpAddrFlagName),
+					From:     c.String(smtpFromFlagName),
+					Username: c.String(smtpUsernameFlagName),
+					Password: c.String(smtpPasswordFlagName),
+				}); err != nil {
+					return err
+				}
+			}
+			renderer, err := digest.LoadRenderer(c.String(htmlTemplateFlagName), c.String(textTemplateFlagName))
+			if err != nil {
+				return err
+			}
+			builder, err := digest.New(digest.Options{
+				Title:    c.String(titleFlagName),
+				Start:    start,
+				End:      end,
+				Location: loc,
+			})
+			if err != nil {
+				return err
+			}
+			managers := map[string]bool{}
+			for _, email := range c.StringSlice(managerFlagName) {
+				managers[strings.ToLower(email)] = true
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				if err := bonusly.EachUser(ctx, client, bonusly.ListUsersRequest{}, func(u bonusly.UserInfoResponse) error {
+					builder.AddUser(u)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "listing users")
+				}
+				req := bonusly.ListBonusesRequest{
+					StartTime:       start,
+					EndTime:         end,
+					IncludeChildren: true,
+				}
+				if err := bonusly.EachBonus(ctx, client, req, func(b bonusly.BonusResponse) error {
+					builder.Add(b)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "listing bonuses")
+				}
+
+				var sent, failed int
+				for _, d := range builder.Digests() {
+					email := ptr.String(d.Manager.Email)
+					if len(managers) > 0 && !managers[strings.ToLower(email)] {
+						continue
+					}
+					m, err := renderer.Render(d)
+					if err != nil {
+						return err
+					}
+					if c.Bool(dryRunFlagName) {
+						fmt.Fprintf(os.Stdout, "%s: would send %q\n", email, m.Subject)
+						continue
+					}
+					if err := sender.Send(ctx, *m); err != nil {
+						failed++
+						fmt.Fprintf(os.Stderr, "%s: %s\n", email, err)
+						continue
+					}
+					sent++
+					fmt.Fprintf(os.Stdout, "%s: sent %q\n", email, m.Subject)
+				}
+				if failed > 0 {
+					return errors.Errorf("failed to send %d of %d digests", failed, sent+failed)
+				}
+				return nil
+			})
+		},
+	}
+}
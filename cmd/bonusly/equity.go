@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/equity"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func equityCmd() *cli.Command {
+	const (
+		startFlagName      = "start"
+		endFlagName        = "end"
+		timezoneFlagName   = "timezone"
+		dimensionsFlagName = "dimensions"
+		titleFlagName      = "title"
+		formatFlagName     = "format"
+		outputFlagName     = "output"
+	)
+
+	return &cli.Command{
+		Name:  "equity",
+		Usage: "report how evenly recognition is distributed across locations, departments and tenure",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only include bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only include bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to interpret dates in",
+				Value: "UTC",
+			},
+			&cli.StringFlag{
+				Name:  dimensionsFlagName,
+				Usage: "comma-separated attributes to compare groups by: location, department, tenure, manager_email or custom:<property name>",
+				Value: "location,department,tenure",
+			},
+			&cli.StringFlag{
+				Name:  titleFlagName,
+				Usage: "the title of the report",
+			},
+			&cli.StringFlag{
+				Name:  formatFlagName,
+				Usage: "the output format (html, markdown or json)",
+				Value: string(equity.FormatHTML),
+			},
+			&cli.StringFlag{
+				Name:  outputFlagName,
+				Usage: "the file to write to (default: stdout)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			format := equity.Format(c.String(formatFlagName))
+			if err := format.Validate(); err != nil {
+				return err
+			}
+			now := time.Now().In(loc)
+			dims, err := equity.ParseDimensions(c.String(dimensionsFlagName), now)
+			if err != nil {
+				return err
+			}
+			e, err := equity.New(equity.Options{
+				Title:      c.String(titleFlagName),
+				Dimensions: dims,
+				Now:        now,
+			})
+			if err != nil {
+				return err
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				// Load the directory first so that the headcount includes
+				// people who neither gave nor received a bonus.
+				if err := bonusly.EachUser(ctx, client, bonusly.ListUsersRequest{}, func(u bonusly.UserInfoResponse) error {
+					e.AddUser(u)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "listing users")
+				}
+				req := bonusly.ListBonusesRequest{
+					StartTime:       start,
+					EndTime:         end,
+					IncludeChildren: true,
+				}
+				if err := bonusly.EachBonus(ctx, client, req, func(b bonusly.BonusResponse) error {
+					e.Add(b)
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				var w io.Writer = os.Stdout
+				if path := c.String(outputFlagName); path != "" {
+					f, err := os.Create(path)
+					if err != nil {
+						return errors.Wrapf(err, "creating output file '%s'", path)
+					}
+					defer f.Close()
+					w = f
+				}
+				r := e.Report()
+				if err := r.Write(w, format); err != nil {
+					return errors.Wrap(err, "writing report")
+				}
+
+				fmt.Fprintf(os.Stderr, "%d people, %.0f%% recognized, Gini coefficient %.2f.\n",
+					r.Overall.Headcount, 100*r.Overall.RecognitionRate, r.Overall.Gini)
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/export"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func exportCmd() *cli.Command {
+	const (
+		formatFlagName          = "format"
+		outputFlagName          = "output"
+		startFlagName           = "start"
+		endFlagName             = "end"
+		columnsFlagName         = "columns"
+		timezoneFlagName        = "timezone"
+		includeChildrenFlagName = "include-children"
+	)
+
+	return &cli.Command{
+		Name:  "export",
+		Usage: "export bonuses to CSV, JSON lines or Parquet",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  formatFlagName,
+				Usage: "the output format (csv, jsonl or parquet)",
+				Value: string(export.FormatCSV),
+			},
+			&cli.StringFlag{
+				Name:  outputFlagName,
+				Usage: "the file to write to (default: stdout)",
+			},
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only export bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only export bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name: columnsFlagName,
+				Usage: "comma-separated columns to export, each a field optionally renamed with a colon " +
+					"(e.g. giver_email:giver,amount:points); fields: " + strings.Join(export.Fields(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to convert times to and to interpret dates in",
+				Value: "UTC",
+			},
+			&cli.BoolFlag{
+				Name:  includeChildrenFlagName,
+				Usage: "also export child bonuses (add-ons)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			opts := export.Options{
+				Format:          export.Format(c.String(formatFlagName)),
+				IncludeChildren: c.Bool(includeChildrenFlagName),
+				Location:        loc,
+			}
+			if opts.Start, err = parseDateOrTime(c.String(startFlagName), loc); err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			if opts.End, err = parseDateOrTime(c.String(endFlagName), loc); err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			if spec := c.String(columnsFlagName); spec != "" {
+				if opts.Columns, err = export.ParseColumns(spec); err != nil {
+					return errors.Wrap(err, "parsing columns")
+				}
+			}
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if path := c.String(outputFlagName); path != "" {
+				f, err := os.Create(path)
+				if err != nil {
+					return errors.Wrapf(err, "creating output file '%s'", path)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				n, err := export.Export(ctx, client, w, opts)
+				if err != nil {
+					return errors.Wrap(err, "exporting bonuses")
+				}
+				fmt.Fprintf(os.Stderr, "Exported %d bonuses.\n", n)
+				return nil
+			})
+		},
+	}
+}
+
+// parseDateOrTime parses a date, which is midnight in the given location, or
+// an RFC 3339 time. It returns the zero time for an empty string.
+func parseDateOrTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, errors.Wrapf(err, "invalid date or time '%s'", value)
+}
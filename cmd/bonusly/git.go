@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/gitcredit"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func gitCmd() *cli.Command {
+	const (
+		repoFlagName            = "repo"
+		rangeFlagName           = "range"
+		giverEmailFlagName      = "giver-email"
+		amountPerCommitFlagName = "amount-per-commit"
+		maxAmountFlagName       = "max-amount"
+		maxCommitsFlagName      = "max-commits-in-reason"
+		templateFlagName        = "template"
+		aliasFlagName           = "alias"
+		applyFlagName           = "apply"
+		jsonFlagName            = "json"
+	)
+
+	return &cli.Command{
+		Name:  "git",
+		Usage: "propose bonuses for the authors and co-authors of commits in a git repository",
+		Description: "Commit emails, including those in Co-authored-by trailers, are mapped to Bonusly users. " +
+			"Without --apply the proposed bonuses are only printed. Given bonuses are recorded in the store " +
+			"so that the same commits are never credited twice.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  repoFlagName,
+				Usage: "the path to the git repository",
+				Value: ".",
+			},
+			&cli.StringFlag{
+				Name:     rangeFlagName,
+				Usage:    "the revision range of commits to credit, such as v1.0..HEAD",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  giverEmailFlagName,
+				Usage: "the email of the account to give the bonuses from, defaulting to your own",
+			},
+			&cli.IntFlag{
+				Name:  amountPerCommitFlagName,
+				Usage: "the amount to give for each commit",
+				Value: 1,
+			},
+			&cli.IntFlag{
+				Name:  maxAmountFlagName,
+				Usage: "the most to give each person",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  maxCommitsFlagName,
+				Usage: "how many commits to reference in each reason",
+				Value: 3,
+			},
+			&cli.StringFlag{
+				Name:  templateFlagName,
+				Usage: "the Go template of bonus reasons, with .Amount, .Username, .FirstName, .DisplayName, .Email, .Commits and .Summary",
+				Value: gitcredit.DefaultTemplate,
+			},
+			&cli.StringSliceFlag{
+				Name:  aliasFlagName,
+				Usage: "map a commit email to a Bonusly email, in the form commit-email=bonusly-email",
+			},
+			&cli.StringFlag{
+				Name:  storeFlagName,
+				Usage: "the path to the file that records credited commits",
+				Value: "git-credits.json",
+			},
+			&cli.BoolFlag{
+				Name:  applyFlagName,
+				Usage: "give the proposed bonuses",
+			},
+			&cli.BoolFlag{
+				Name:  jsonFlagName,
+				Usage: "output the proposals as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			aliases := map[string]string{}
+			for _, alias := range c.StringSlice(aliasFlagName) {
+				parts := strings.SplitN(alias, "=", 2)
+				if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+					return errors.Errorf("alias '%s' must be in the form commit-email=bonusly-email", alias)
+				}
+				aliases[parts[0]] = parts[1]
+			}
+
+			// Nothing is given in a dry run, so nothing is recorded as
+			// credited.
+			store := bonusly.NewMemoryIdempotencyStore()
+			if !c.Bool(dryRunFlagName) {
+				var err error
+				if store, err = bonusly.NewFileIdempotencyStore(c.String(storeFlagName)); err != nil {
+					return err
+				}
+			}
+
+			opts, err := clientOptions(c)
+			if err != nil {
+				return err
+			}
+			opts.IdempotencyStore = store
+
+			return withClientOptions(opts, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				commits, err := gitcredit.ReadLog(ctx, c.String(repoFlagName), c.String(rangeFlagName))
+				if err != nil {
+					return err
+				}
+				creditor, err := gitcredit.New(client, gitcredit.Options{
+					GiverEmail:         c.String(giverEmailFlagName),
+					AmountPerCommit:    c.Int(amountPerCommitFlagName),
+					MaxAmount:          c.Int(maxAmountFlagName),
+					MaxCommitsInReason: c.Int(maxCommitsFlagName),
+					Template:           c.String(templateFlagName),
+					Aliases:            aliases,
+					Store:              store,
+				})
+				if err != nil {
+					return err
+				}
+				plan, err := creditor.Plan(ctx, commits)
+				if err != nil {
+					return err
+				}
+				if c.Bool(applyFlagName) {
+					creditor.Apply(ctx, plan)
+				}
+
+				if c.Bool(jsonFlagName) {
+					output, err := json.MarshalIndent(plan, "", "\t")
+					if err != nil {
+						return err
+					}
+					if _, err = fmt.Fprintln(os.Stdout, string(output)); err != nil {
+						return err
+					}
+				} else if err := writeGitPlan(os.Stdout, plan, c.Bool(applyFlagName)); err != nil {
+					return err
+				}
+
+				var failed int
+				for _, p := range plan.Proposals {
+					if p.Err != nil {
+						failed++
+						fmt.Fprintf(os.Stderr, "%s: %s\n", ptr.String(p.User.Email), p.Err)
+					}
+				}
+				if failed > 0 {
+					return errors.Errorf("failed to give %d of %d bonuses", failed, len(plan.Proposals))
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// writeGitPlan writes the proposals and unmatched people as plain text
+// tables.
+func writeGitPlan(w io.Writer, plan *gitcredit.Plan, applied bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "STATUS\tEMAIL\tCOMMITS\tAMOUNT\tREASON\n")
+	for _, p := range plan.Proposals {
+		status := "proposed"
+		switch {
+		case p.Skipped:
+			status = "already given"
+		case p.Err != nil:
+			status = "failed"
+		case applied && p.Bonus != nil:
+			status = "given"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", status, ptr.String(p.User.Email), len(p.Commits), p.Amount, p.Request.Reason)
+	}
+	if len(plan.Unmatched) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "NOT MATCHED\tCOMMITS\n")
+		for _, u := range plan.Unmatched {
+			fmt.Fprintf(tw, "%s <%s>\t%d\n", u.Person.Name, u.Person.Email, u.Commits)
+		}
+	}
+	return tw.Flush()
+}
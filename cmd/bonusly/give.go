@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+// interactiveTimeout is the maximum amount of time that an interactive
+// command can take, including the time waiting for user input.
+const interactiveTimeout = time.Hour
+
+func give() *cli.Command {
+	return &cli.Command{
+		Name:  "give",
+		Usage: "interactively give a bonus",
+		Action: func(c *cli.Context) error {
+			return withClientTimeout(c, interactiveTimeout, func(ctx context.Context, client bonusly.Client) error {
+				return giveInteractive(ctx, client, newPrompter(os.Stdin, os.Stdout))
+			})
+		},
+	}
+}
+
+func giveInteractive(ctx context.Context, client bonusly.Client, p *prompter) error {
+	info, err := client.MyUserInfo(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting user info")
+	}
+	company, err := client.MyCompanyInfo(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting company info")
+	}
+
+	recipients, err := promptRecipients(ctx, client, p)
+	if err != nil {
+		return err
+	}
+
+	var giveAmounts []int
+	if info.GiveAmounts != nil {
+		giveAmounts = *info.GiveAmounts
+	}
+	balance := ptr.Int(info.GivingBalance)
+	amount, err := promptAmount(p, giveAmounts, balance, len(recipients))
+	if err != nil {
+		return err
+	}
+
+	var hashtags []string
+	if company.CompanyHashtags != nil {
+		hashtags = *company.CompanyHashtags
+	}
+	hashtag, err := promptHashtag(p, hashtags)
+	if err != nil {
+		return err
+	}
+
+	message, err := p.askRequired("Message")
+	if err != nil {
+		return err
+	}
+
+	reason := makeReason(amount, recipients, message, hashtag)
+	p.printf("\nPreview:\n  %s\n  Total cost: %d (giving balance: %d)\n\n", reason, amount*len(recipients), balance)
+	ok, err := p.confirm("Give this bonus?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		p.printf("Cancelled.\n")
+		return nil
+	}
+
+	resp, err := client.CreateBonus(ctx, bonusly.CreateBonusRequest{Reason: reason})
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(resp, "", "\t")
+	if err != nil {
+		return err
+	}
+	p.printf("%s\n", output)
+	return nil
+}
+
+// promptRecipients repeatedly asks for recipients, using the user
+// autocomplete to resolve partial names to usernames.
+func promptRecipients(ctx context.Context, client bonusly.Client, p *prompter) ([]string, error) {
+	var recipients []string
+	for {
+		search, err := p.ask("Recipient name (leave blank when done)")
+		if err != nil {
+			return nil, err
+		}
+		if search == "" {
+			if len(recipients) == 0 {
+				p.printf("Must choose at least one recipient.\n")
+				continue
+			}
+			return recipients, nil
+		}
+
+		users, err := client.AutocompleteUsers(ctx, search)
+		if err != nil {
+			return nil, errors.Wrap(err, "looking up users")
+		}
+		if len(users) == 0 {
+			p.printf("No users found matching '%s'.\n", search)
+			continue
+		}
+
+		options := make([]string, 0, len(users))
+		for _, u := range users {
+			options = append(options, fmt.Sprintf("%s (@%s)", ptr.String(u.DisplayName), ptr.String(u.UserName)))
+		}
+		idx, err := p.choose("Select a recipient", options)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, ptr.String(users[idx].UserName))
+	}
+}
+
+// promptAmount asks for the amount to give to each recipient, limited to the
+// allowed give amounts that the user can afford for all recipients.
+func promptAmount(p *prompter, giveAmounts []int, balance, numRecipients int) (int, error) {
+	var affordable []int
+	for _, amount := range giveAmounts {
+		if amount*numRecipients <= balance {
+			affordable = append(affordable, amount)
+		}
+	}
+	if len(affordable) == 0 {
+		return 0, errors.Errorf("giving balance of %d is not enough to give to %d recipient(s)", balance, numRecipients)
+	}
+
+	options := make([]string, 0, len(affordable))
+	for _, amount := range affordable {
+		options = append(options, strconv.Itoa(amount))
+	}
+	idx, err := p.choose("Amount per recipient", options)
+	if err != nil {
+		return 0, err
+	}
+	return affordable[idx], nil
+}
+
+// promptHashtag asks for the hashtag, offering the company's values as
+// choices if there are any.
+func promptHashtag(p *prompter, hashtags []string) (string, error) {
+	if len(hashtags) == 0 {
+		hashtag, err := p.askRequired("Hashtag")
+		if err != nil {
+			return "", err
+		}
+		return "#" + strings.TrimPrefix(hashtag, "#"), nil
+	}
+
+	idx, err := p.choose("Hashtag", hashtags)
+	if err != nil {
+		return "", err
+	}
+	return "#" + strings.TrimPrefix(hashtags[idx], "#"), nil
+}
+
+// makeReason formats the bonus reason in the syntax that Bonusly expects.
+func makeReason(amount int, recipients []string, message, hashtag string) string {
+	mentions := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		mentions = append(mentions, "@"+strings.TrimPrefix(r, "@"))
+	}
+	return fmt.Sprintf("+%d %s %s %s", amount, strings.Join(mentions, " "), message, hashtag)
+}
+
+// prompter reads answers to questions from an input and writes questions to
+// an output.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+func (p *prompter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(p.out, format, args...)
+}
+
+// ask asks a question and returns the trimmed answer.
+func (p *prompter) ask(question string) (string, error) {
+	p.printf("%s: ", question)
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", errors.Wrap(err, "reading input")
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// askRequired asks a question until it gets a non-empty answer.
+func (p *prompter) askRequired(question string) (string, error) {
+	for {
+		answer, err := p.ask(question)
+		if err != nil {
+			return "", err
+		}
+		if answer != "" {
+			return answer, nil
+		}
+		p.printf("An answer is required.\n")
+	}
+}
+
+// choose asks the user to pick one of the options and returns the index of
+// the chosen option.
+func (p *prompter) choose(question string, options []string) (int, error) {
+	for i, opt := range options {
+		p.printf("  %d) %s\n", i+1, opt)
+	}
+	for {
+		answer, err := p.ask(question)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		p.printf("Please enter a number between 1 and %d.\n", len(options))
+	}
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func (p *prompter) confirm(question string) (bool, error) {
+	answer, err := p.ask(question + " [y/N]")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
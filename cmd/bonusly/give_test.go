@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeReason(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		amount     int
+		recipients []string
+		message    string
+		hashtag    string
+		expected   string
+	}{
+		"SingleRecipient": {
+			amount:     5,
+			recipients: []string{"alice"},
+			message:    "thanks for the review",
+			hashtag:    "#teamwork",
+			expected:   "+5 @alice thanks for the review #teamwork",
+		},
+		"MultipleRecipients": {
+			amount:     2,
+			recipients: []string{"alice", "bob"},
+			message:    "great demo",
+			hashtag:    "#ownership",
+			expected:   "+2 @alice @bob great demo #ownership",
+		},
+		"DoesNotDoubleMentions": {
+			amount:     1,
+			recipients: []string{"@alice"},
+			message:    "thanks",
+			hashtag:    "#x",
+			expected:   "+1 @alice thanks #x",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, makeReason(testCase.amount, testCase.recipients, testCase.message, testCase.hashtag))
+		})
+	}
+}
+
+func TestPromptAmount(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		input         string
+		giveAmounts   []int
+		balance       int
+		numRecipients int
+		expected      int
+		options       []string
+		err           bool
+	}{
+		"ChoosesAmount": {
+			input:         "2\n",
+			giveAmounts:   []int{1, 5, 10},
+			balance:       50,
+			numRecipients: 1,
+			expected:      5,
+			options:       []string{"1) 1", "2) 5", "3) 10"},
+		},
+		"OnlyOffersAffordableAmounts": {
+			input:         "2\n",
+			giveAmounts:   []int{1, 5, 10},
+			balance:       12,
+			numRecipients: 2,
+			expected:      5,
+			options:       []string{"1) 1", "2) 5"},
+		},
+		"RetriesInvalidChoices": {
+			input:         "0\nfive\n1\n",
+			giveAmounts:   []int{1, 5},
+			balance:       10,
+			numRecipients: 1,
+			expected:      1,
+		},
+		"FailsWithInsufficientBalance": {
+			giveAmounts:   []int{5, 10},
+			balance:       8,
+			numRecipients: 2,
+			err:           true,
+		},
+		"FailsWithoutInput": {
+			giveAmounts:   []int{1},
+			balance:       1,
+			numRecipients: 1,
+			err:           true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := newPrompter(strings.NewReader(testCase.input), &out)
+			amount, err := promptAmount(p, testCase.giveAmounts, testCase.balance, testCase.numRecipients)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, amount)
+			for _, opt := range testCase.options {
+				assert.Contains(t, out.String(), opt)
+			}
+			if strings.Count(testCase.input, "\n") > 1 {
+				assert.Contains(t, out.String(), "Please enter a number between 1 and")
+			}
+		})
+	}
+}
+
+func TestPromptHashtag(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		input    string
+		hashtags []string
+		expected string
+	}{
+		"ChoosesCompanyHashtag": {
+			input:    "2\n",
+			hashtags: []string{"#teamwork", "ownership"},
+			expected: "#ownership",
+		},
+		"AsksForHashtagWithoutCompanyHashtags": {
+			input:    "\nteamwork\n",
+			expected: "#teamwork",
+		},
+		"DoesNotDoubleHashes": {
+			input:    "#teamwork\n",
+			expected: "#teamwork",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := newPrompter(strings.NewReader(testCase.input), &bytes.Buffer{})
+			hashtag, err := promptHashtag(p, testCase.hashtags)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, hashtag)
+		})
+	}
+}
+
+func TestPrompter(t *testing.T) {
+	t.Run("AskTrimsAnswer", func(t *testing.T) {
+		var out bytes.Buffer
+		p := newPrompter(strings.NewReader("  alice  \n"), &out)
+		answer, err := p.ask("Name")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", answer)
+		assert.Equal(t, "Name: ", out.String())
+	})
+	t.Run("AskAcceptsLastLineWithoutNewline", func(t *testing.T) {
+		p := newPrompter(strings.NewReader("alice"), &bytes.Buffer{})
+		answer, err := p.ask("Name")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", answer)
+	})
+	t.Run("AskFailsAtEndOfInput", func(t *testing.T) {
+		p := newPrompter(strings.NewReader(""), &bytes.Buffer{})
+		_, err := p.ask("Name")
+		assert.Error(t, err)
+	})
+	t.Run("AskRequiredRetriesEmptyAnswers", func(t *testing.T) {
+		var out bytes.Buffer
+		p := newPrompter(strings.NewReader("\n \nthanks\n"), &out)
+		answer, err := p.askRequired("Message")
+		require.NoError(t, err)
+		assert.Equal(t, "thanks", answer)
+		assert.Equal(t, 2, strings.Count(out.String(), "An answer is required."))
+	})
+	t.Run("ChooseReturnsIndex", func(t *testing.T) {
+		var out bytes.Buffer
+		p := newPrompter(strings.NewReader("3\n2\n"), &out)
+		idx, err := p.choose("Pick", []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, idx)
+		assert.Contains(t, out.String(), "  1) a\n  2) b\n")
+		assert.Contains(t, out.String(), "Please enter a number between 1 and 2.")
+	})
+	t.Run("Confirm", func(t *testing.T) {
+		for input, expected := range map[string]bool{
+			"y\n":    true,
+			"YES\n":  true,
+			"n\n":    false,
+			"\n":     false,
+			"sure\n": false,
+		} {
+			p := newPrompter(strings.NewReader(input), &bytes.Buffer{})
+			ok, err := p.confirm("Continue?")
+			require.NoError(t, err, input)
+			assert.Equal(t, expected, ok, input)
+		}
+	})
+}
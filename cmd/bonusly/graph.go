@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/graph"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func graphCmd() *cli.Command {
+	const (
+		startFlagName    = "start"
+		endFlagName      = "end"
+		timezoneFlagName = "timezone"
+		teamByFlagName   = "team-by"
+		formatFlagName   = "format"
+		outputFlagName   = "output"
+	)
+
+	return &cli.Command{
+		Name:  "graph",
+		Usage: "export the graph of who recognizes whom and summarize how recognition flows between teams",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only include bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only include bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to interpret dates in",
+				Value: "UTC",
+			},
+			&cli.StringFlag{
+				Name:  teamByFlagName,
+				Usage: "what determines a person's team: department, location, manager_email or custom:<property name>",
+				Value: "department",
+			},
+			&cli.StringFlag{
+				Name:  formatFlagName,
+				Usage: "the output format (graphml, dot or json)",
+				Value: string(graph.FormatGraphML),
+			},
+			&cli.StringFlag{
+				Name:  outputFlagName,
+				Usage: "the file to write to (default: stdout)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			teamBy, err := analytics.ParseGroupBy(c.String(teamByFlagName))
+			if err != nil {
+				return err
+			}
+			format := graph.Format(c.String(formatFlagName))
+			if err := format.Validate(); err != nil {
+				return err
+			}
+			g := graph.New(teamBy)
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				// Load the directory first so that people who neither gave
+				// nor received a bonus are reported as isolated.
+				if err := bonusly.EachUser(ctx, client, bonusly.ListUsersRequest{}, func(u bonusly.UserInfoResponse) error {
+					g.AddUser(u)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "listing users")
+				}
+				req := bonusly.ListBonusesRequest{
+					StartTime:       start,
+					EndTime:         end,
+					IncludeChildren: true,
+				}
+				if err := bonusly.EachBonus(ctx, client, req, func(b bonusly.BonusResponse) error {
+					g.Add(b)
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				var w io.Writer = os.Stdout
+				if path := c.String(outputFlagName); path != "" {
+					f, err := os.Create(path)
+					if err != nil {
+						return errors.Wrapf(err, "creating output file '%s'", path)
+					}
+					defer f.Close()
+					w = f
+				}
+				if err := g.Write(w, format); err != nil {
+					return errors.Wrap(err, "writing graph")
+				}
+
+				m := g.Metrics()
+				fmt.Fprintf(os.Stderr, "%d people, %d edges, %.0f%% reciprocated, %.0f%% of edges (%.0f%% of points) cross teams, %d isolated.\n",
+					m.Nodes, m.Edges, 100*m.Reciprocity, 100*m.CrossTeamEdgeRatio, 100*m.CrossTeamWeightRatio, len(m.Isolated))
+				return nil
+			})
+		},
+	}
+}
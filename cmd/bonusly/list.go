@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+func listBonuses() *cli.Command {
+	const (
+		startFlagName    = "start"
+		endFlagName      = "end"
+		timezoneFlagName = "timezone"
+		giverFlagName    = "giver"
+		receiverFlagName = "receiver"
+		hashtagFlagName  = "hashtag"
+		limitFlagName    = "limit"
+		formatFlagName   = "format"
+		noColorFlagName  = "no-color"
+	)
+
+	return &cli.Command{
+		Name:  "list",
+		Usage: "list recent bonuses",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only list bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only list bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to interpret dates and show times in",
+				Value: "Local",
+			},
+			&cli.StringFlag{
+				Name:  giverFlagName,
+				Usage: "only list bonuses given by this email",
+			},
+			&cli.StringFlag{
+				Name:  receiverFlagName,
+				Usage: "only list bonuses received by this email",
+			},
+			&cli.StringFlag{
+				Name:  hashtagFlagName,
+				Usage: "only list bonuses with this hashtag",
+			},
+			&cli.UintFlag{
+				Name:  limitFlagName,
+				Usage: "the maximum number of bonuses to list",
+				Value: 20,
+			},
+			&cli.StringFlag{
+				Name:  formatFlagName,
+				Usage: "the output format (table, markdown or json)",
+				Value: "table",
+			},
+			&cli.BoolFlag{
+				Name:  noColorFlagName,
+				Usage: "do not color reasons in table output, which is otherwise colored in terminals unless NO_COLOR is set",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			format := c.String(formatFlagName)
+			if format != "table" && format != "markdown" && format != "json" {
+				return errors.Errorf("unknown format '%s'", format)
+			}
+
+			return withClient(c, func(ctx context.Context, client bonusly.Client) error {
+				bonuses, err := client.ListBonuses(ctx, bonusly.ListBonusesRequest{
+					Limit:         c.Uint(limitFlagName),
+					StartTime:     start,
+					EndTime:       end,
+					GiverEmail:    c.String(giverFlagName),
+					ReceiverEmail: c.String(receiverFlagName),
+					HashTag:       c.String(hashtagFlagName),
+				})
+				if err != nil {
+					return err
+				}
+
+				switch format {
+				case "json":
+					output, err := json.MarshalIndent(bonuses, "", "\t")
+					if err != nil {
+						return err
+					}
+					_, err = fmt.Fprintln(os.Stdout, string(output))
+					return err
+				case "markdown":
+					return writeBonusesMarkdown(os.Stdout, bonuses, loc)
+				default:
+					color := !c.Bool(noColorFlagName) && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+					return writeBonusesTable(os.Stdout, bonuses, loc, color)
+				}
+			})
+		},
+	}
+}
+
+// writeBonusesTable writes the bonuses as a plain text table. Reasons are
+// rendered from their HTML, colored with ANSI escape codes if color is set.
+// Reasons are the last column so that escape codes do not misalign it.
+func writeBonusesTable(w io.Writer, bonuses []bonusly.BonusResponse, loc *time.Location, color bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CREATED\tGIVER\tRECEIVER\tAMOUNT\tREASON\n")
+	for i := range bonuses {
+		b := &bonuses[i]
+		var reason string
+		if color {
+			ansi, err := b.ReasonANSI()
+			if err != nil {
+				return err
+			}
+			reason = ansi
+		} else {
+			text, err := b.ReasonText()
+			if err != nil {
+				return err
+			}
+			reason = text.Text
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", bonusCreated(b, loc), bonusUsername(b.Giver), bonusUsername(b.Receiver),
+			intPtrString(b.Amount), strings.Join(strings.Fields(reason), " "))
+	}
+	return tw.Flush()
+}
+
+// writeBonusesMarkdown writes the bonuses as a Markdown table.
+func writeBonusesMarkdown(w io.Writer, bonuses []bonusly.BonusResponse, loc *time.Location) error {
+	if _, err := fmt.Fprintf(w, "| Created | Giver | Receiver | Amount | Reason |\n| --- | --- | --- | ---: | --- |\n"); err != nil {
+		return err
+	}
+	for i := range bonuses {
+		b := &bonuses[i]
+		reason, err := b.ReasonMarkdown()
+		if err != nil {
+			return err
+		}
+		reason = strings.ReplaceAll(strings.Join(strings.Fields(reason), " "), "|", `\|`)
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", bonusCreated(b, loc), bonusUsername(b.Giver),
+			bonusUsername(b.Receiver), intPtrString(b.Amount), reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bonusCreated(b *bonusly.BonusResponse, loc *time.Location) string {
+	if b.CreatedAt == nil {
+		return ""
+	}
+	return b.CreatedAt.In(loc).Format("2006-01-02 15:04")
+}
+
+func bonusUsername(u *bonusly.UserInfoResponse) string {
+	if u == nil {
+		return ""
+	}
+	return ptr.String(u.UserName)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/metrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	cli "github.com/urfave/cli/v2"
+)
+
+func serveMetrics() *cli.Command {
+	const (
+		addrFlagName     = "addr"
+		intervalFlagName = "interval"
+	)
+
+	return &cli.Command{
+		Name:  "serve-metrics",
+		Usage: "serve Prometheus metrics for the Bonusly client, polling the giving balance periodically",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  addrFlagName,
+				Usage: "the address to serve metrics on",
+				Value: "localhost:9090",
+			},
+			&cli.DurationFlag{
+				Name:  intervalFlagName,
+				Usage: "how often to poll the giving balance",
+				Value: time.Minute,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Duration(intervalFlagName) <= 0 {
+				return errors.Errorf("--%s must be positive", intervalFlagName)
+			}
+			opts, err := clientOptions(c)
+			if err != nil {
+				return err
+			}
+			collector := metrics.NewCollector()
+			opts.Middleware = append(opts.Middleware, collector.Middleware())
+
+			reg := prometheus.NewRegistry()
+			if err := reg.Register(collector); err != nil {
+				return errors.Wrap(err, "registering metrics")
+			}
+
+			return withClientOptions(opts, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+				srv := &http.Server{Addr: c.String(addrFlagName), Handler: mux}
+
+				go pollGivingBalance(ctx, client, c.Duration(intervalFlagName))
+				go func() {
+					<-ctx.Done()
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					_ = srv.Shutdown(shutdownCtx)
+				}()
+
+				fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", srv.Addr)
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					return errors.Wrap(err, "serving metrics")
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// pollGivingBalance gets the user info periodically so that the giving
+// balance metric stays up to date.
+func pollGivingBalance(ctx context.Context, client bonusly.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Errors are already recorded by the metrics.
+		_, _ = client.MyUserInfo(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notifyOnSignal returns a context that is cancelled when the process is
+// interrupted or terminated.
+func notifyOnSignal(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
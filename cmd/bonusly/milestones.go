@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/kimchelly/go-bonusly/milestone"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func milestones() *cli.Command {
+	const (
+		giverEmailFlagName          = "giver-email"
+		kindsFlagName               = "kinds"
+		birthdayPropertyFlagName    = "birthday-property"
+		anniversaryTemplateFlagName = "anniversary-template"
+		birthdayTemplateFlagName    = "birthday-template"
+		anniversaryAmountFlagName   = "anniversary-amount"
+		birthdayAmountFlagName      = "birthday-amount"
+		timezoneFlagName            = "default-timezone"
+	)
+
+	return &cli.Command{
+		Name:  "milestones",
+		Usage: "give bonuses for today's work anniversaries and birthdays in each person's time zone",
+		Description: "Run this at least daily, such as every hour from cron. Celebrated milestones are recorded " +
+			"in the store so that each is only celebrated once.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     giverEmailFlagName,
+				Usage:    "the email of the account to give the bonuses from",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  storeFlagName,
+				Usage: "the path to the file that records celebrated milestones",
+				Value: "milestones.json",
+			},
+			&cli.StringFlag{
+				Name:  kindsFlagName,
+				Usage: "comma-separated kinds of milestones to celebrate (anniversary, birthday)",
+				Value: "anniversary,birthday",
+			},
+			&cli.StringFlag{
+				Name:  birthdayPropertyFlagName,
+				Usage: "the custom property that holds users' birthdays",
+				Value: "birthday",
+			},
+			&cli.StringFlag{
+				Name:  anniversaryTemplateFlagName,
+				Usage: "the Go template of anniversary bonus reasons, with .Amount, .Years, .Username, .FirstName, .DisplayName and .Email",
+				Value: milestone.DefaultAnniversaryTemplate,
+			},
+			&cli.StringFlag{
+				Name:  birthdayTemplateFlagName,
+				Usage: "the Go template of birthday bonus reasons, with .Amount, .Username, .FirstName, .DisplayName and .Email",
+				Value: milestone.DefaultBirthdayTemplate,
+			},
+			&cli.IntFlag{
+				Name:  anniversaryAmountFlagName,
+				Usage: "the amount of anniversary bonuses",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  birthdayAmountFlagName,
+				Usage: "the amount of birthday bonuses",
+				Value: 5,
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone of users whose time zone is not set",
+				Value: "UTC",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			var kinds []milestone.Kind
+			for _, kind := range strings.Split(c.String(kindsFlagName), ",") {
+				if kind = strings.TrimSpace(kind); kind != "" {
+					kinds = append(kinds, milestone.Kind(kind))
+				}
+			}
+
+			// Nothing is given in a dry run, so nothing is recorded as
+			// celebrated.
+			store := bonusly.NewMemoryIdempotencyStore()
+			if !c.Bool(dryRunFlagName) {
+				if store, err = bonusly.NewFileIdempotencyStore(c.String(storeFlagName)); err != nil {
+					return err
+				}
+			}
+
+			opts, err := clientOptions(c)
+			if err != nil {
+				return err
+			}
+			opts.IdempotencyStore = store
+
+			return withClientOptions(opts, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				a, err := milestone.New(client, milestone.Options{
+					GiverEmail:          c.String(giverEmailFlagName),
+					Kinds:               kinds,
+					BirthdayProperty:    c.String(birthdayPropertyFlagName),
+					AnniversaryTemplate: c.String(anniversaryTemplateFlagName),
+					BirthdayTemplate:    c.String(birthdayTemplateFlagName),
+					AnniversaryAmount:   c.Int(anniversaryAmountFlagName),
+					BirthdayAmount:      c.Int(birthdayAmountFlagName),
+					DefaultLocation:     loc,
+					Store:               store,
+				})
+				if err != nil {
+					return err
+				}
+
+				results, err := a.Run(ctx, time.Now())
+				var failed int
+				for _, res := range results {
+					who := fmt.Sprintf("%s of %s", res.Milestone.Kind, ptr.String(res.Milestone.User.Email))
+					switch {
+					case res.Err != nil:
+						failed++
+						fmt.Fprintf(os.Stderr, "%s: %s\n", who, res.Err)
+					case res.Skipped:
+						fmt.Fprintf(os.Stdout, "%s: already celebrated\n", who)
+					default:
+						fmt.Fprintf(os.Stdout, "%s: %s\n", who, res.Request.Reason)
+					}
+				}
+				if err != nil {
+					return err
+				}
+				if failed > 0 {
+					return errors.Errorf("failed to celebrate %d of %d milestones", failed, len(results))
+				}
+				return nil
+			})
+		},
+	}
+}
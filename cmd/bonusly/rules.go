@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/fileutil"
+	"github.com/kimchelly/go-bonusly/rules"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func rulesCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "rules",
+		Usage: "give bonuses automatically when events match rules",
+		Subcommands: []*cli.Command{
+			rulesRun(),
+		},
+	}
+}
+
+func rulesRun() *cli.Command {
+	const (
+		configFlagName   = "config"
+		inputFlagName    = "input"
+		listenFlagName   = "listen"
+		simulateFlagName = "simulate"
+		stateFlagName    = "state"
+		tokenFlagName    = "token"
+		insecureFlagName = "insecure"
+	)
+
+	return &cli.Command{
+		Name:  "run",
+		Usage: "match JSON events against rules and give the bonuses of the rules that fire",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  configFlagName,
+				Usage: "the path to the YAML rules",
+				Value: "rules.yaml",
+			},
+			&cli.StringFlag{
+				Name:  inputFlagName,
+				Usage: "read a stream of JSON events from this file or http(s) URL, or from stdin if it is '-'",
+				Value: "-",
+			},
+			&cli.StringFlag{
+				Name:  listenFlagName,
+				Usage: "instead of reading events, serve an endpoint on this address that accepts events POSTed as JSON",
+			},
+			&cli.BoolFlag{
+				Name:  simulateFlagName,
+				Usage: "report which rules would fire without giving any bonuses",
+			},
+			&cli.StringFlag{
+				Name:  stateFlagName,
+				Usage: "the path to a JSON file of past firings, used to enforce caps and budgets across runs",
+			},
+			&cli.StringFlag{
+				Name:    tokenFlagName,
+				Usage:   "with --listen, the token that every request must send as a bearer token or the token query parameter",
+				EnvVars: []string{"BONUSLY_RULES_TOKEN"},
+			},
+			&cli.BoolFlag{
+				Name:  insecureFlagName,
+				Usage: "with --listen, allow serving without a token, so that anyone who can reach the server can make the rules give bonuses",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := rules.LoadFile(c.String(configFlagName))
+			if err != nil {
+				return err
+			}
+			opts := rules.Options{Simulate: c.Bool(simulateFlagName)}
+			if path := c.String(stateFlagName); path != "" {
+				if opts.History, err = loadRulesState(path); err != nil {
+					return err
+				}
+				if !opts.Simulate {
+					opts.SaveHistory = func(history []rules.Firing) error {
+						return saveRulesState(path, history)
+					}
+				}
+			}
+			if c.String(listenFlagName) != "" && c.String(tokenFlagName) == "" {
+				if !c.Bool(insecureFlagName) {
+					return errors.Errorf("a token is required with --%s unless --%s is set", listenFlagName, insecureFlagName)
+				}
+				fmt.Fprintln(os.Stderr, "Warning: no token is set, so anyone who can reach the server can make the rules give bonuses.")
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				e, err := rules.New(config, client, opts)
+				if err != nil {
+					return err
+				}
+
+				if addr := c.String(listenFlagName); addr != "" {
+					err = serveRules(ctx, e, addr, c.String(tokenFlagName))
+				} else {
+					err = readRules(ctx, e, c.String(inputFlagName))
+				}
+
+				if path := c.String(stateFlagName); path != "" && !opts.Simulate {
+					if saveErr := saveRulesState(path, e.History()); saveErr != nil && err == nil {
+						err = saveErr
+					}
+				}
+				return err
+			})
+		},
+	}
+}
+
+// readRules handles every event read from the input and prints the outcomes.
+func readRules(ctx context.Context, e *rules.Engine, input string) error {
+	var r io.Reader
+	switch {
+	case input == "-" || input == "":
+		r = os.Stdin
+	case strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, input, nil)
+		if err != nil {
+			return errors.Wrap(err, "creating request for events")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return errors.Wrapf(err, "getting events from '%s'", input)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("getting events from '%s': unexpected status %s", input, resp.Status)
+		}
+		r = resp.Body
+	default:
+		f, err := os.Open(input)
+		if err != nil {
+			return errors.Wrapf(err, "opening events file '%s'", input)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return rules.ReadEvents(ctx, r, func(event map[string]interface{}) error {
+		outcomes, err := e.Handle(ctx, event)
+		if err != nil {
+			return err
+		}
+		return writeRuleOutcomes(os.Stdout, outcomes)
+	})
+}
+
+// serveRules serves the rules engine's event endpoint until the context is
+// done.
+func serveRules(ctx context.Context, e *rules.Engine, addr, token string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/events", rules.Handler(e, token))
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Accepting events on http://%s/events\n", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "serving events endpoint")
+	}
+	return nil
+}
+
+// writeRuleOutcomes writes one line per outcome of an event.
+func writeRuleOutcomes(w io.Writer, outcomes []rules.Outcome) error {
+	for _, o := range outcomes {
+		line := fmt.Sprintf("%s\t%s\t%s", o.Status, o.Rule, o.Request.Reason)
+		if o.Detail != "" {
+			line += fmt.Sprintf(" (%s)", o.Detail)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRulesState reads past firings from the state file. A missing file has
+// no firings.
+func loadRulesState(path string) ([]rules.Firing, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading rules state '%s'", path)
+	}
+	var history []rules.Firing
+	if err := json.Unmarshal(b, &history); err != nil {
+		return nil, errors.Wrapf(err, "parsing rules state '%s'", path)
+	}
+	return history, nil
+}
+
+// saveRulesState writes the firings to the state file.
+func saveRulesState(path string, history []rules.Firing) error {
+	b, err := json.MarshalIndent(history, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "encoding rules state")
+	}
+	return errors.Wrapf(fileutil.WriteAtomic(path, b), "writing rules state '%s'", path)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/kimchelly/go-bonusly/schedule"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+const storeFlagName = "store"
+
+func storeFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  storeFlagName,
+		Usage: "the path to the file that stores scheduled bonuses",
+		Value: "schedules.json",
+	}
+}
+
+func scheduleCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "schedule",
+		Usage: "schedule bonuses to give once or repeatedly",
+		Subcommands: []*cli.Command{
+			scheduleAdd(),
+			scheduleList(),
+			scheduleRemove(),
+			scheduleRun(),
+		},
+	}
+}
+
+func scheduleAdd() *cli.Command {
+	const (
+		giverEmailFlagName = "giver-email"
+		parentIDFlagName   = "parent_id"
+		cronFlagName       = "cron"
+		atFlagName         = "at"
+		timezoneFlagName   = "timezone"
+	)
+
+	return &cli.Command{
+		Name:  "add",
+		Usage: "schedule a bonus",
+		Flags: []cli.Flag{
+			storeFlag(),
+			&cli.StringFlag{
+				Name:     reasonFlagName,
+				Usage:    "the reason for the bonus",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  giverEmailFlagName,
+				Usage: "the email of the user to give the bonus from, if not the user making requests",
+			},
+			&cli.StringFlag{
+				Name:  parentIDFlagName,
+				Usage: "the ID of the parent bonus",
+			},
+			&cli.StringFlag{
+				Name:  cronFlagName,
+				Usage: "give the bonus repeatedly on this cron schedule, such as '0 9 * * mon'",
+			},
+			&cli.StringFlag{
+				Name:  atFlagName,
+				Usage: "give the bonus once at this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone to evaluate the cron schedule and interpret dates in",
+				Value: "UTC",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			at, err := parseDateOrTime(c.String(atFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing time")
+			}
+
+			e, err := schedule.NewStore(c.String(storeFlagName)).Add(schedule.Entry{
+				Request: bonusly.CreateBonusRequest{
+					GiverEmail:    c.String(giverEmailFlagName),
+					Reason:        c.String(reasonFlagName),
+					ParentBonusID: c.String(parentIDFlagName),
+				},
+				Cron:     c.String(cronFlagName),
+				At:       at,
+				TimeZone: loc.String(),
+			}, time.Now())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "Scheduled %s, next due %s.\n", e.ID, e.NextRun.In(loc).Format(time.RFC3339))
+			return nil
+		},
+	}
+}
+
+func scheduleList() *cli.Command {
+	const jsonFlagName = "json"
+
+	return &cli.Command{
+		Name:  "list",
+		Usage: "list scheduled bonuses",
+		Flags: []cli.Flag{
+			storeFlag(),
+			&cli.BoolFlag{
+				Name:  jsonFlagName,
+				Usage: "output the scheduled bonuses as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			entries, err := schedule.NewStore(c.String(storeFlagName)).List()
+			if err != nil {
+				return err
+			}
+			if c.Bool(jsonFlagName) {
+				output, err := json.MarshalIndent(entries, "", "\t")
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintln(os.Stdout, string(output))
+				return err
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "ID\tSCHEDULE\tNEXT RUN\tRUNS\tLAST ERROR\tREASON\n")
+			for _, e := range entries {
+				when := e.Cron + " (" + e.TimeZone + ")"
+				if e.Cron == "" {
+					when = "once"
+				}
+				next := "never"
+				if !e.Done() {
+					next = e.NextRun.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, when, next, e.Runs, e.LastError, e.Request.Reason)
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func scheduleRemove() *cli.Command {
+	return &cli.Command{
+		Name:  "remove",
+		Usage: "remove a scheduled bonus",
+		Flags: []cli.Flag{
+			storeFlag(),
+			&cli.StringFlag{
+				Name:     idFlagName,
+				Usage:    "the scheduled bonus ID",
+				Required: true,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return schedule.NewStore(c.String(storeFlagName)).Remove(c.String(idFlagName))
+		},
+	}
+}
+
+func scheduleRun() *cli.Command {
+	const (
+		onceFlagName     = "once"
+		intervalFlagName = "interval"
+	)
+
+	return &cli.Command{
+		Name:  "run",
+		Usage: "give scheduled bonuses when they are due, until interrupted",
+		Flags: []cli.Flag{
+			storeFlag(),
+			&cli.BoolFlag{
+				Name:  onceFlagName,
+				Usage: "give the bonuses that are due now and exit",
+			},
+			&cli.DurationFlag{
+				Name:  intervalFlagName,
+				Usage: "how often to check for due bonuses",
+				Value: time.Minute,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				r, err := schedule.NewRunner(schedule.NewStore(c.String(storeFlagName)), client, schedule.RunnerOptions{
+					Interval: c.Duration(intervalFlagName),
+					OnResult: func(res schedule.Result) {
+						if res.Err != nil {
+							fmt.Fprintf(os.Stderr, "%s: failed to give bonus due %s: %s\n", res.EntryID, res.RunAt.Format(time.RFC3339), res.Err)
+							return
+						}
+						var id string
+						if res.Bonus != nil {
+							id = ptr.String(res.Bonus.ID)
+						}
+						fmt.Fprintf(os.Stdout, "%s: gave bonus %s due %s\n", res.EntryID, id, res.RunAt.Format(time.RFC3339))
+					},
+				})
+				if err != nil {
+					return err
+				}
+				if c.Bool(onceFlagName) {
+					_, err := r.RunDue(ctx)
+					return err
+				}
+				return r.Run(ctx)
+			})
+		},
+	}
+}
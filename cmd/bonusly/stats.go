@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+func stats() *cli.Command {
+	const (
+		startFlagName    = "start"
+		endFlagName      = "end"
+		groupByFlagName  = "group-by"
+		intervalFlagName = "interval"
+		timezoneFlagName = "timezone"
+		jsonFlagName     = "json"
+	)
+
+	return &cli.Command{
+		Name:  "stats",
+		Usage: "show recognition statistics per person, group, hashtag and period",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  startFlagName,
+				Usage: "only include bonuses created at or after this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  endFlagName,
+				Usage: "only include bonuses created before this date (YYYY-MM-DD) or time (RFC 3339)",
+			},
+			&cli.StringFlag{
+				Name:  groupByFlagName,
+				Usage: "also group people by department, location, manager_email or custom:<property name>",
+			},
+			&cli.StringFlag{
+				Name:  intervalFlagName,
+				Usage: "the period of the time series (day, week, month or quarter)",
+				Value: string(analytics.Month),
+			},
+			&cli.StringFlag{
+				Name:  timezoneFlagName,
+				Usage: "the IANA time zone of the time series and to interpret dates in",
+				Value: "UTC",
+			},
+			&cli.BoolFlag{
+				Name:  jsonFlagName,
+				Usage: "output the statistics as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			loc, err := time.LoadLocation(c.String(timezoneFlagName))
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone '%s'", c.String(timezoneFlagName))
+			}
+			start, err := parseDateOrTime(c.String(startFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing start")
+			}
+			end, err := parseDateOrTime(c.String(endFlagName), loc)
+			if err != nil {
+				return errors.Wrap(err, "parsing end")
+			}
+			opts := analytics.Options{
+				Interval: analytics.Interval(c.String(intervalFlagName)),
+				Location: loc,
+			}
+			if groupBy := c.String(groupByFlagName); groupBy != "" {
+				if opts.GroupBy, err = analytics.ParseGroupBy(groupBy); err != nil {
+					return err
+				}
+			}
+			s, err := analytics.New(opts)
+			if err != nil {
+				return err
+			}
+
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				ctx, stop := notifyOnSignal(ctx)
+				defer stop()
+
+				// Load everyone first so that people who were not
+				// recognized at all are reported, and are grouped by their
+				// directory attributes.
+				if err := bonusly.EachUser(ctx, client, bonusly.ListUsersRequest{}, func(u bonusly.UserInfoResponse) error {
+					s.AddUser(u)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "listing users")
+				}
+
+				req := bonusly.ListBonusesRequest{
+					StartTime:       start,
+					EndTime:         end,
+					IncludeChildren: true,
+				}
+				if err := bonusly.EachBonus(ctx, client, req, func(b bonusly.BonusResponse) error {
+					s.Add(b)
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				report := s.Report()
+				if c.Bool(jsonFlagName) {
+					output, err := json.MarshalIndent(report, "", "\t")
+					if err != nil {
+						return err
+					}
+					_, err = fmt.Fprintln(os.Stdout, string(output))
+					return err
+				}
+				return writeStatsReport(os.Stdout, report, loc)
+			})
+		},
+	}
+}
+
+// writeStatsReport writes the statistics as plain text tables.
+func writeStatsReport(w io.Writer, r *analytics.Report, loc *time.Location) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	writeSummaries := func(title string, summaries []analytics.Summary) {
+		fmt.Fprintf(tw, "%s\n", title)
+		fmt.Fprintf(tw, "\tRECEIVED\tBONUSES\tFROM\tGIVEN\tBONUSES\tTO\tTOP HASHTAGS\n")
+		for _, s := range summaries {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", s.Key, s.Received, s.ReceivedCount, s.UniqueGivers,
+				s.Given, s.GivenCount, s.UniqueReceivers, topHashtags(s.Hashtags, 3))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	writeSummaries("TOTAL", []analytics.Summary{r.Totals})
+	if r.Groups != nil {
+		writeSummaries("GROUPS", r.Groups)
+	}
+	writeSummaries("PEOPLE", r.Users)
+
+	fmt.Fprintf(tw, "HASHTAGS\tBONUSES\tAMOUNT\n")
+	for _, h := range r.Hashtags {
+		fmt.Fprintf(tw, "#%s\t%d\t%d\n", h.Hashtag, h.Count, h.Amount)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "PERIOD\tBONUSES\tAMOUNT\n")
+	for _, p := range r.TimeSeries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", p.Start.In(loc).Format("2006-01-02"), p.Count, p.Amount)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "NOT RECOGNIZED\n")
+	for _, key := range r.Unrecognized() {
+		fmt.Fprintf(tw, "%s\n", key)
+	}
+	return tw.Flush()
+}
+
+// topHashtags returns the n most used hashtags.
+func topHashtags(counts map[string]int, n int) string {
+	hashtags := make([]string, 0, len(counts))
+	for hashtag := range counts {
+		hashtags = append(hashtags, hashtag)
+	}
+	sort.Slice(hashtags, func(i, j int) bool {
+		if counts[hashtags[i]] != counts[hashtags[j]] {
+			return counts[hashtags[i]] > counts[hashtags[j]]
+		}
+		return hashtags[i] < hashtags[j]
+	})
+	if len(hashtags) > n {
+		hashtags = hashtags[:n]
+	}
+	for i := range hashtags {
+		hashtags[i] = fmt.Sprintf("#%s (%d)", hashtags[i], counts[hashtags[i]])
+	}
+	return strings.Join(hashtags, ", ")
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+func tui() *cli.Command {
+	const (
+		intervalFlagName = "interval"
+		limitFlagName    = "limit"
+		plainFlagName    = "plain"
+	)
+
+	return &cli.Command{
+		Name:  "tui",
+		Usage: "show a live dashboard of the bonus feed",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  intervalFlagName,
+				Usage: "how often to poll for new bonuses",
+				Value: 30 * time.Second,
+			},
+			&cli.UintFlag{
+				Name:  limitFlagName,
+				Usage: "the number of recent bonuses to show in the feed",
+				Value: 20,
+			},
+			&cli.BoolFlag{
+				Name: plainFlagName,
+				Usage: "read line-buffered input and redraw without terminal control sequences, which works " +
+					"in sessions without a TTY (e.g. over SSH without -t); implied if stdin is not a terminal",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Duration(intervalFlagName) <= 0 {
+				return errors.Errorf("--%s must be positive", intervalFlagName)
+			}
+			return withClientTimeout(c, 0, func(ctx context.Context, client bonusly.Client) error {
+				d := newDashboard(client, c.Uint(limitFlagName))
+				plain := c.Bool(plainFlagName) || !term.IsTerminal(int(os.Stdin.Fd()))
+				return d.run(ctx, c.Duration(intervalFlagName), plain)
+			})
+		},
+	}
+}
+
+type dashboardMode int
+
+const (
+	modeBrowse dashboardMode = iota
+	modeGive
+	modeAddOn
+)
+
+type key struct {
+	r    rune
+	up   bool
+	down bool
+}
+
+const (
+	keyCtrlC     = '\x03'
+	keyEscape    = '\x1b'
+	keyBackspace = '\x7f'
+)
+
+// feedUpdate is the result of polling Bonusly for the latest dashboard data.
+type feedUpdate struct {
+	bonuses []bonusly.BonusResponse
+	info    *bonusly.UserInfoResponse
+	// status, if set, replaces the status line once the update is applied.
+	status string
+	err    error
+}
+
+// dashboard is a full-screen terminal view of the bonus feed, the user's
+// balances and a leaderboard of the feed's receivers.
+type dashboard struct {
+	client bonusly.Client
+	limit  uint
+
+	bonuses  []bonusly.BonusResponse
+	info     *bonusly.UserInfoResponse
+	updated  time.Time
+	selected int
+	mode     dashboardMode
+	composer []rune
+	// parentID is the ID of the bonus to add on to, which is chosen when
+	// composing the add-on starts so that refreshes cannot change it.
+	parentID string
+	status   string
+
+	out   io.Writer
+	plain bool
+
+	// refresh and give fetch the latest data and give a bonus in the
+	// background, reporting back through the updates channel so that slow
+	// requests do not block input.
+	refresh func()
+	give    func(bonusly.CreateBonusRequest)
+}
+
+func newDashboard(client bonusly.Client, limit uint) *dashboard {
+	return &dashboard{
+		client: client,
+		limit:  limit,
+		out:    os.Stdout,
+	}
+}
+
+func (d *dashboard) run(ctx context.Context, interval time.Duration, plain bool) error {
+	d.plain = plain
+	if !plain {
+		fd := int(os.Stdin.Fd())
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return errors.Wrap(err, "putting terminal into raw mode")
+		}
+		defer func() {
+			_ = term.Restore(fd, oldState)
+		}()
+		// Switch to the alternate screen and hide the cursor.
+		fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+		defer fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// In plain mode, the input is line-buffered, so each line is read as a
+	// whole and the dashboard is redrawn once per line rather than per key.
+	var (
+		keys  chan key
+		lines chan string
+	)
+	if plain {
+		lines = make(chan string)
+		go readLines(ctx, os.Stdin, lines)
+	} else {
+		keys = make(chan key)
+		go readKeys(ctx, os.Stdin, keys)
+	}
+
+	updates := make(chan feedUpdate, 1)
+	go d.poll(ctx, interval, updates)
+	background := func(f func() feedUpdate) {
+		go func() {
+			select {
+			case updates <- f():
+			case <-ctx.Done():
+			}
+		}()
+	}
+	d.refresh = func() {
+		background(func() feedUpdate { return d.fetch(ctx) })
+	}
+	d.give = func(req bonusly.CreateBonusRequest) {
+		background(func() feedUpdate { return d.createBonus(ctx, req) })
+	}
+
+	d.status = "Loading..."
+	d.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case u := <-updates:
+			d.applyUpdate(u)
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := d.handleKey(k); quit {
+				return nil
+			}
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if quit := d.handleLine(line); quit {
+				return nil
+			}
+		}
+		d.draw()
+	}
+}
+
+// poll periodically fetches the latest dashboard data until the context is
+// done.
+func (d *dashboard) poll(ctx context.Context, interval time.Duration, updates chan<- feedUpdate) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case updates <- d.fetch(ctx):
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *dashboard) fetch(ctx context.Context) feedUpdate {
+	bonuses, err := d.client.ListBonuses(ctx, bonusly.ListBonusesRequest{Limit: d.limit})
+	if err != nil {
+		return feedUpdate{err: errors.Wrap(err, "listing bonuses")}
+	}
+	info, err := d.client.MyUserInfo(ctx)
+	if err != nil {
+		return feedUpdate{err: errors.Wrap(err, "getting user info")}
+	}
+	return feedUpdate{bonuses: bonuses, info: info}
+}
+
+// createBonus gives the bonus and then fetches the latest dashboard data so
+// that the feed includes it.
+func (d *dashboard) createBonus(ctx context.Context, req bonusly.CreateBonusRequest) feedUpdate {
+	if _, err := d.client.CreateBonus(ctx, req); err != nil {
+		return feedUpdate{err: errors.Wrap(err, "giving bonus")}
+	}
+	u := d.fetch(ctx)
+	if u.err != nil {
+		u.err = errors.Wrap(u.err, "bonus given, but refreshing")
+		return u
+	}
+	u.status = "Bonus given."
+	return u
+}
+
+func (d *dashboard) applyUpdate(u feedUpdate) {
+	if u.err != nil {
+		d.status = "Error: " + u.err.Error()
+		return
+	}
+	var selectedID string
+	if d.selected < len(d.bonuses) {
+		selectedID = ptr.String(d.bonuses[d.selected].ID)
+	}
+	d.bonuses = u.bonuses
+	d.info = u.info
+	d.updated = time.Now()
+	d.status = u.status
+
+	// Keep the same bonus selected as new bonuses arrive.
+	d.selected = 0
+	for i, b := range d.bonuses {
+		if selectedID != "" && ptr.String(b.ID) == selectedID {
+			d.selected = i
+			break
+		}
+	}
+}
+
+// handleKey updates the dashboard state in response to a key press. It
+// returns whether the dashboard should exit.
+func (d *dashboard) handleKey(k key) bool {
+	if k.r == keyCtrlC {
+		return true
+	}
+
+	if d.mode != modeBrowse {
+		d.handleComposerKey(k)
+		return false
+	}
+
+	switch {
+	case k.up || k.r == 'k':
+		if d.selected > 0 {
+			d.selected--
+		}
+	case k.down || k.r == 'j':
+		if d.selected < len(d.bonuses)-1 {
+			d.selected++
+		}
+	case k.r == 'g':
+		d.mode = modeGive
+		d.composer = nil
+		d.status = "Give a bonus, e.g. +10 @someone thanks for the help #teamwork"
+	case k.r == 'a':
+		if len(d.bonuses) == 0 {
+			d.status = "No bonus selected to add on to."
+			break
+		}
+		d.mode = modeAddOn
+		d.parentID = ptr.String(d.bonuses[d.selected].ID)
+		d.composer = nil
+		if !d.plain {
+			d.composer = []rune("+")
+		}
+		d.status = "Add on to the selected bonus, e.g. +5 me too!"
+	case k.r == 'r':
+		d.status = "Refreshing..."
+		d.refresh()
+	case k.r == 'q':
+		return true
+	}
+	return false
+}
+
+// handleLine updates the dashboard state in response to a line of input in
+// plain mode. While browsing, the line is a single command key; while giving a
+// bonus, it is the reason, and an empty line cancels. It returns whether the
+// dashboard should exit.
+func (d *dashboard) handleLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if d.mode != modeBrowse {
+		d.submit(line)
+		return false
+	}
+	switch utf8.RuneCountInString(line) {
+	case 0:
+		return false
+	case 1:
+		r, _ := utf8.DecodeRuneInString(line)
+		return d.handleKey(key{r: r})
+	default:
+		d.status = fmt.Sprintf("Unknown command '%s'.", line)
+		return false
+	}
+}
+
+func (d *dashboard) handleComposerKey(k key) {
+	switch {
+	case k.r == keyEscape:
+		d.mode = modeBrowse
+		d.composer = nil
+		d.parentID = ""
+		d.status = "Cancelled."
+	case k.r == keyBackspace || k.r == '\b':
+		if len(d.composer) > 0 {
+			d.composer = d.composer[:len(d.composer)-1]
+		}
+	case k.r == '\r' || k.r == '\n':
+		d.submit(string(d.composer))
+	case k.r >= ' ' && !k.up && !k.down:
+		d.composer = append(d.composer, k.r)
+	}
+}
+
+// submit gives the composed bonus in the background and returns to browsing.
+// An empty reason cancels.
+func (d *dashboard) submit(reason string) {
+	req := bonusly.CreateBonusRequest{Reason: strings.TrimSpace(reason)}
+	if d.mode == modeAddOn {
+		req.ParentBonusID = d.parentID
+	}
+	d.mode = modeBrowse
+	d.composer = nil
+	d.parentID = ""
+	if req.Reason == "" {
+		d.status = "Cancelled."
+		return
+	}
+	d.status = "Giving bonus..."
+	d.give(req)
+}
+
+func (d *dashboard) draw() {
+	width, height := 80, 24
+	if !d.plain {
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			width, height = w, h
+		}
+	}
+
+	lines := d.render(width, height)
+	if d.plain {
+		fmt.Fprintf(d.out, "%s\n%s\n", strings.Repeat("=", width), strings.Join(lines, "\n"))
+		return
+	}
+	// Move the cursor to the top left and clear the screen before drawing.
+	fmt.Fprintf(d.out, "\x1b[H\x1b[2J%s", strings.Join(lines, "\r\n"))
+}
+
+const leaderboardSize = 5
+
+// render lays out the dashboard panes to fit in the given terminal
+// dimensions.
+func (d *dashboard) render(width, height int) []string {
+	var lines []string
+
+	header := "Bonusly"
+	if d.info != nil {
+		header += fmt.Sprintf(" | Giving balance: %s | Earning balance: %s",
+			fromStringPtrOr(d.info.GivingBalanceWithCurrency, intPtrString(d.info.GivingBalance)),
+			fromStringPtrOr(d.info.EarningBalanceWithCurrency, intPtrString(d.info.EarningBalance)))
+	}
+	if !d.updated.IsZero() {
+		header += " | Updated " + d.updated.Format("15:04:05")
+	}
+	lines = append(lines, d.highlight(truncate(header, width)), "")
+
+	leaders := leaderboard(d.bonuses, leaderboardSize)
+	// Reserve room for the header, leaderboard, composer, status and help.
+	feedHeight := height - len(lines) - (len(leaders) + 3) - 4
+	if feedHeight < 1 {
+		feedHeight = 1
+	}
+
+	lines = append(lines, "Feed")
+	start := 0
+	if d.selected >= feedHeight {
+		start = d.selected - feedHeight + 1
+	}
+	for i := start; i < len(d.bonuses) && i < start+feedHeight; i++ {
+		line := truncate(formatFeedBonus(d.bonuses[i]), width-2)
+		if i == d.selected {
+			lines = append(lines, d.highlight("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if len(d.bonuses) == 0 {
+		lines = append(lines, "  (no bonuses)")
+	}
+
+	lines = append(lines, "", "Leaderboard")
+	for i, l := range leaders {
+		lines = append(lines, truncate(fmt.Sprintf("  %d. %-20s %d", i+1, l.name, l.amount), width))
+	}
+
+	lines = append(lines, "")
+	switch d.mode {
+	case modeGive:
+		lines = append(lines, truncate("give> "+string(d.composer), width))
+	case modeAddOn:
+		lines = append(lines, truncate("add-on> "+string(d.composer), width))
+	default:
+		lines = append(lines, "")
+	}
+	lines = append(lines, truncate(d.status, width))
+	help := "j/k: move  g: give  a: add on  r: refresh  q: quit"
+	switch {
+	case d.plain && d.mode != modeBrowse:
+		help = "type the reason and press enter, or an empty line to cancel"
+	case d.mode != modeBrowse:
+		help = "enter: send  esc: cancel"
+	case d.plain:
+		help += "  (then press enter)"
+	}
+	lines = append(lines, truncate(help, width))
+
+	return lines
+}
+
+func (d *dashboard) highlight(s string) string {
+	if d.plain {
+		return s
+	}
+	return "\x1b[7m" + s + "\x1b[0m"
+}
+
+func formatFeedBonus(b bonusly.BonusResponse) string {
+	var created string
+	if b.CreatedAt != nil {
+		created = b.CreatedAt.Local().Format("Jan 02 15:04")
+	}
+	var giver string
+	if b.Giver != nil {
+		giver = ptr.String(b.Giver.UserName)
+	}
+	reason := ptr.String(b.Reason)
+	if text, err := b.ReasonText(); err == nil {
+		reason = strings.Join(strings.Fields(text.Text), " ")
+	}
+	if b.ChildCount != nil && *b.ChildCount > 0 {
+		reason += fmt.Sprintf(" (+%d add-ons)", *b.ChildCount)
+	}
+	return fmt.Sprintf("%s  %s: %s", created, giver, reason)
+}
+
+type leader struct {
+	name   string
+	amount int
+}
+
+// leaderboard ranks the receivers of the given bonuses by the total amount
+// they received.
+func leaderboard(bonuses []bonusly.BonusResponse, n int) []leader {
+	totals := map[string]int{}
+	for _, b := range bonuses {
+		if b.Receiver == nil || b.Amount == nil {
+			continue
+		}
+		totals[ptr.String(b.Receiver.UserName)] += *b.Amount
+	}
+
+	leaders := make([]leader, 0, len(totals))
+	for name, amount := range totals {
+		leaders = append(leaders, leader{name: name, amount: amount})
+	}
+	sort.Slice(leaders, func(i, j int) bool {
+		if leaders[i].amount != leaders[j].amount {
+			return leaders[i].amount > leaders[j].amount
+		}
+		return leaders[i].name < leaders[j].name
+	})
+	if len(leaders) > n {
+		leaders = leaders[:n]
+	}
+	return leaders
+}
+
+// readKeys decodes key presses from the input and sends them to the keys
+// channel until the input is exhausted or the context is done.
+func readKeys(ctx context.Context, in io.Reader, keys chan<- key) {
+	defer close(keys)
+	r := bufio.NewReader(in)
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return
+		}
+		k := key{r: c}
+		// Arrow keys are sent as escape sequences, which arrive all at once,
+		// whereas a lone escape key press does not have anything following
+		// it.
+		if c == keyEscape && r.Buffered() >= 2 {
+			if next, _ := r.Peek(2); next[0] == '[' {
+				_, _ = r.Discard(2)
+				k = key{up: next[1] == 'A', down: next[1] == 'B'}
+			}
+		}
+		select {
+		case keys <- k:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readLines sends each line of the input to the lines channel until the
+// input is exhausted or the context is done.
+func readLines(ctx context.Context, in io.Reader, lines chan<- string) {
+	defer close(lines)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width == 1 {
+		return string(runes[:1])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+func fromStringPtrOr(s *string, fallback string) string {
+	if s == nil {
+		return fallback
+	}
+	return *s
+}
+
+func intPtrString(i *int) string {
+	if i == nil {
+		return "?"
+	}
+	return fmt.Sprint(*i)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func feedBonus(id, giver, receiver string, amount int, reason string) bonusly.BonusResponse {
+	return bonusly.BonusResponse{
+		ID:       ptr.NewString(id),
+		Giver:    &bonusly.UserInfoResponse{UserName: ptr.NewString(giver)},
+		Receiver: &bonusly.UserInfoResponse{UserName: ptr.NewString(receiver)},
+		Amount:   ptr.NewInt(amount),
+		Reason:   ptr.NewString(reason),
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	bonuses := []bonusly.BonusResponse{
+		feedBonus("1", "alice", "bob", 5, "+5 @bob thanks"),
+		feedBonus("2", "bob", "carol", 3, "+3 @carol thanks"),
+		feedBonus("3", "carol", "bob", 2, "+2 @bob thanks"),
+		feedBonus("4", "bob", "alice", 3, "+3 @alice thanks"),
+		{Reason: ptr.NewString("no receiver")},
+	}
+	for name, testCase := range map[string]struct {
+		n        int
+		expected []leader
+	}{
+		"RanksByAmountThenName": {
+			n:        5,
+			expected: []leader{{name: "bob", amount: 7}, {name: "alice", amount: 3}, {name: "carol", amount: 3}},
+		},
+		"LimitsToN": {
+			n:        1,
+			expected: []leader{{name: "bob", amount: 7}},
+		},
+		"Empty": {
+			n:        0,
+			expected: []leader{},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, leaderboard(bonuses, testCase.n))
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		s        string
+		width    int
+		expected string
+	}{
+		"FitsWidth": {
+			s:        "hello",
+			width:    5,
+			expected: "hello",
+		},
+		"AddsEllipsis": {
+			s:        "hello world",
+			width:    6,
+			expected: "hello…",
+		},
+		"CountsRunesNotBytes": {
+			s:        "héllo",
+			width:    5,
+			expected: "héllo",
+		},
+		"WidthOne": {
+			s:        "hello",
+			width:    1,
+			expected: "h",
+		},
+		"NonPositiveWidth": {
+			s:        "hello",
+			width:    0,
+			expected: "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, truncate(testCase.s, testCase.width))
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	bonuses := []bonusly.BonusResponse{
+		feedBonus("1", "alice", "bob", 5, "+5 @bob thanks"),
+		feedBonus("2", "bob", "carol", 3, "+3 @carol thanks"),
+		feedBonus("3", "carol", "alice", 2, "+2 @alice thanks"),
+	}
+	for name, testCase := range map[string]struct {
+		d        dashboard
+		height   int
+		contains []string
+		excludes []string
+	}{
+		"ShowsBalancesFeedAndLeaderboard": {
+			d: dashboard{
+				bonuses: bonuses,
+				info:    &bonusly.UserInfoResponse{GivingBalance: ptr.NewInt(10), EarningBalanceWithCurrency: ptr.NewString("20 points")},
+				plain:   true,
+			},
+			height: 24,
+			contains: []string{
+				"Bonusly | Giving balance: 10 | Earning balance: 20 points",
+				">   alice: +5 @bob thanks",
+				"    bob: +3 @carol thanks",
+				"  1. bob                  5",
+				"j/k: move  g: give  a: add on  r: refresh  q: quit  (then press enter)",
+			},
+		},
+		"ScrollsToSelectedBonus": {
+			d:        dashboard{bonuses: bonuses, selected: 2, plain: true},
+			height:   1,
+			contains: []string{">   carol: +2 @alice thanks"},
+			excludes: []string{"alice: +5 @bob thanks"},
+		},
+		"ShowsComposer": {
+			d:        dashboard{mode: modeGive, composer: []rune("+1 @bob"), status: "Give a bonus", plain: true},
+			height:   24,
+			contains: []string{"  (no bonuses)", "give> +1 @bob", "Give a bonus", "type the reason and press enter, or an empty line to cancel"},
+		},
+		"HighlightsInTerminal": {
+			d:        dashboard{bonuses: bonuses},
+			height:   24,
+			contains: []string{"\x1b[7mBonusly\x1b[0m", "\x1b[7m>   alice: +5 @bob thanks\x1b[0m"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			lines := testCase.d.render(80, testCase.height)
+			for _, line := range lines {
+				assert.LessOrEqual(t, len([]rune(strings.NewReplacer("\x1b[7m", "", "\x1b[0m", "").Replace(line))), 80)
+			}
+			for _, expected := range testCase.contains {
+				assert.Contains(t, lines, expected)
+			}
+			for _, excluded := range testCase.excludes {
+				assert.NotContains(t, strings.Join(lines, "\n"), excluded)
+			}
+		})
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	bonuses := []bonusly.BonusResponse{
+		feedBonus("1", "alice", "bob", 5, "+5 @bob thanks"),
+		feedBonus("2", "bob", "carol", 3, "+3 @carol thanks"),
+	}
+	for name, testCase := range map[string]struct {
+		d         dashboard
+		keys      []key
+		quit      bool
+		mode      dashboardMode
+		selected  int
+		composer  string
+		refreshed bool
+		given     []bonusly.CreateBonusRequest
+	}{
+		"MovesSelectionWithinFeed": {
+			d:        dashboard{bonuses: bonuses},
+			keys:     []key{{r: 'j'}, {down: true}, {r: 'k'}},
+			selected: 0,
+		},
+		"StopsAtEndOfFeed": {
+			d:        dashboard{bonuses: bonuses},
+			keys:     []key{{r: 'j'}, {r: 'j'}, {r: 'j'}},
+			selected: 1,
+		},
+		"Quits": {
+			d:    dashboard{},
+			keys: []key{{r: 'q'}},
+			quit: true,
+		},
+		"QuitsOnCtrlCWhileComposing": {
+			d:    dashboard{mode: modeGive},
+			keys: []key{{r: keyCtrlC}},
+			mode: modeGive,
+			quit: true,
+		},
+		"Refreshes": {
+			d:         dashboard{},
+			keys:      []key{{r: 'r'}},
+			refreshed: true,
+		},
+		"ComposesAndGivesBonus": {
+			d:     dashboard{},
+			keys:  append([]key{{r: 'g'}}, append(runeKeys("+1 @bobb"), key{r: keyBackspace}, key{r: '\r'})...),
+			given: []bonusly.CreateBonusRequest{{Reason: "+1 @bob"}},
+		},
+		"AddsOnToSelectedBonus": {
+			d:        dashboard{bonuses: bonuses},
+			keys:     append([]key{{r: 'j'}, {r: 'a'}}, append(runeKeys("5 me too"), key{r: '\n'})...),
+			selected: 1,
+			given:    []bonusly.CreateBonusRequest{{Reason: "+5 me too", ParentBonusID: "2"}},
+		},
+		"DoesNotAddOnWithoutBonuses": {
+			d:    dashboard{},
+			keys: []key{{r: 'a'}},
+		},
+		"CancelsWithEscape": {
+			d:    dashboard{},
+			keys: append([]key{{r: 'g'}}, append(runeKeys("+1"), key{r: keyEscape})...),
+		},
+		"CancelsEmptyReason": {
+			d:    dashboard{},
+			keys: []key{{r: 'g'}, {r: ' '}, {r: '\r'}},
+		},
+		"IgnoresArrowsWhileComposing": {
+			d:        dashboard{},
+			keys:     []key{{r: 'g'}, {r: 'x'}, {up: true}},
+			mode:     modeGive,
+			composer: "x",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := testCase.d
+			var refreshed bool
+			var given []bonusly.CreateBonusRequest
+			d.refresh = func() { refreshed = true }
+			d.give = func(req bonusly.CreateBonusRequest) { given = append(given, req) }
+
+			var quit bool
+			for _, k := range testCase.keys {
+				if quit = d.handleKey(k); quit {
+					break
+				}
+			}
+			assert.Equal(t, testCase.quit, quit)
+			assert.Equal(t, testCase.mode, d.mode)
+			assert.Equal(t, testCase.selected, d.selected)
+			assert.Equal(t, testCase.composer, string(d.composer))
+			assert.Equal(t, testCase.refreshed, refreshed)
+			assert.Equal(t, testCase.given, given)
+		})
+	}
+}
+
+func TestHandleLine(t *testing.T) {
+	bonuses := []bonusly.BonusResponse{
+		feedBonus("1", "alice", "bob", 5, "+5 @bob thanks"),
+		feedBonus("2", "bob", "carol", 3, "+3 @carol thanks"),
+	}
+	for name, testCase := range map[string]struct {
+		lines    []string
+		quit     bool
+		selected int
+		status   string
+		given    []bonusly.CreateBonusRequest
+	}{
+		"RunsCommands": {
+			lines:    []string{"j", " ", "q"},
+			selected: 1,
+			quit:     true,
+		},
+		"RejectsUnknownCommands": {
+			lines:  []string{"jj"},
+			status: "Unknown command 'jj'.",
+		},
+		"GivesWholeLineAsReason": {
+			lines:  []string{"g", "+1 @bob thanks for the help #teamwork"},
+			status: "Giving bonus...",
+			given:  []bonusly.CreateBonusRequest{{Reason: "+1 @bob thanks for the help #teamwork"}},
+		},
+		"AddsOnWithWholeLine": {
+			lines:  []string{"a", "+5 me too"},
+			status: "Giving bonus...",
+			given:  []bonusly.CreateBonusRequest{{Reason: "+5 me too", ParentBonusID: "1"}},
+		},
+		"CancelsWithEmptyLine": {
+			lines:  []string{"g", ""},
+			status: "Cancelled.",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := dashboard{bonuses: bonuses, plain: true}
+			var given []bonusly.CreateBonusRequest
+			d.give = func(req bonusly.CreateBonusRequest) { given = append(given, req) }
+
+			var quit bool
+			for _, line := range testCase.lines {
+				if quit = d.handleLine(line); quit {
+					break
+				}
+			}
+			assert.Equal(t, testCase.quit, quit)
+			assert.Equal(t, testCase.selected, d.selected)
+			if testCase.status != "" {
+				assert.Equal(t, testCase.status, d.status)
+			}
+			assert.Equal(t, testCase.given, given)
+		})
+	}
+}
+
+func TestAddOnKeepsParentAcrossRefreshes(t *testing.T) {
+	d := dashboard{bonuses: []bonusly.BonusResponse{
+		feedBonus("1", "alice", "bob", 5, ""),
+		feedBonus("2", "bob", "carol", 3, ""),
+	}}
+	var given []bonusly.CreateBonusRequest
+	d.give = func(req bonusly.CreateBonusRequest) { given = append(given, req) }
+
+	d.handleKey(key{r: 'j'})
+	d.handleKey(key{r: 'a'})
+	d.applyUpdate(feedUpdate{bonuses: []bonusly.BonusResponse{feedBonus("3", "carol", "alice", 1, ""), feedBonus("1", "alice", "bob", 5, "")}})
+	for _, k := range append(runeKeys("5 me too"), key{r: '\r'}) {
+		d.handleKey(k)
+	}
+	assert.Equal(t, []bonusly.CreateBonusRequest{{Reason: "+5 me too", ParentBonusID: "2"}}, given)
+}
+
+func TestApplyUpdate(t *testing.T) {
+	d := dashboard{bonuses: []bonusly.BonusResponse{feedBonus("1", "alice", "bob", 5, "")}}
+	d.applyUpdate(feedUpdate{
+		bonuses: []bonusly.BonusResponse{feedBonus("2", "bob", "carol", 3, ""), feedBonus("1", "alice", "bob", 5, "")},
+		status:  "Bonus given.",
+	})
+	require.Len(t, d.bonuses, 2)
+	assert.Equal(t, 1, d.selected, "should keep the same bonus selected")
+	assert.Equal(t, "Bonus given.", d.status)
+}
+
+func runeKeys(s string) []key {
+	var keys []key
+	for _, r := range s {
+		keys = append(keys, key{r: r})
+	}
+	return keys
+}
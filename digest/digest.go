@@ -0,0 +1,262 @@
+// Package digest builds periodic recognition digests for managers, summarizing
+// the bonuses that their reports received, and renders and sends them.
+package digest
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Options represent options to build digests.
+type Options struct {
+	// Title is the title of the digests. Defaults to "Weekly recognition
+	// digest".
+	Title string
+	// Start and End are the period of the digests. Bonuses created outside
+	// of the period are ignored.
+	Start time.Time
+	End   time.Time
+	// Location is the time zone to show times in. Defaults to UTC.
+	Location *time.Location
+	// TopHashtags is the number of most used hashtags in each digest.
+	// Defaults to 5.
+	TopHashtags int
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.Title == "" {
+		o.Title = "Weekly recognition digest"
+	}
+	if o.Start.IsZero() || o.End.IsZero() {
+		return errors.New("start and end must be set")
+	}
+	if !o.End.After(o.Start) {
+		return errors.New("end must be after start")
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+	if o.TopHashtags == 0 {
+		o.TopHashtags = 5
+	}
+	if o.TopHashtags < 0 {
+		return errors.New("top hashtags cannot be negative")
+	}
+	return nil
+}
+
+// Bonus is a bonus received by a report.
+type Bonus struct {
+	Giver     string    `json:"giver"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	// Reason is the bonus reason as plain text.
+	Reason string `json:"reason"`
+}
+
+// Member is a report of a manager.
+type Member struct {
+	User bonusly.UserInfoResponse `json:"user"`
+	// Name is the display name of the member, falling back to their
+	// username or email.
+	Name    string  `json:"name"`
+	Amount  int     `json:"amount"`
+	Bonuses []Bonus `json:"bonuses"`
+}
+
+// HashtagCount is the number of bonuses that a hashtag was used in.
+type HashtagCount struct {
+	Hashtag string `json:"hashtag"`
+	Count   int    `json:"count"`
+}
+
+// Digest summarizes the recognition that a manager's reports received.
+type Digest struct {
+	Title string `json:"title"`
+	// Manager is the manager, who only has an email if they are not a
+	// known user.
+	Manager bonusly.UserInfoResponse `json:"manager"`
+	// ManagerName is the display name of the manager, falling back to their
+	// email.
+	ManagerName string    `json:"manager_name"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// LastDay is the last day of the period, which ends before End.
+	LastDay time.Time `json:"last_day"`
+	// Members are the manager's reports, ordered by the amount they
+	// received.
+	Members  []Member       `json:"members"`
+	Amount   int            `json:"amount"`
+	Bonuses  int            `json:"bonuses"`
+	Hashtags []HashtagCount `json:"hashtags"`
+	// Unrecognized are the names of the reports who received no bonuses.
+	Unrecognized []string `json:"unrecognized"`
+}
+
+// Builder accumulates users and bonuses into digests.
+type Builder struct {
+	opts    Options
+	users   map[string]bonusly.UserInfoResponse
+	bonuses map[string][]Bonus
+}
+
+// New returns a digest builder with no users or bonuses.
+func New(opts Options) (*Builder, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Builder{
+		opts:    opts,
+		users:   map[string]bonusly.UserInfoResponse{},
+		bonuses: map[string][]Bonus{},
+	}, nil
+}
+
+// AddUser adds a user, who is in the digest of their manager.
+func (b *Builder) AddUser(u bonusly.UserInfoResponse) {
+	if key := analytics.UserKey(&u); key != "" {
+		b.users[key] = u
+	}
+}
+
+// Add adds a bonus and its child bonuses to the digest of the receiver's
+// manager, if they were created in the period.
+func (b *Builder) Add(bonus bonusly.BonusResponse) {
+	for _, child := range bonus.ChildBonuses {
+		b.Add(child)
+	}
+	if bonus.CreatedAt == nil || bonus.CreatedAt.Before(b.opts.Start) || !bonus.CreatedAt.Before(b.opts.End) {
+		return
+	}
+	key := analytics.UserKey(bonus.Receiver)
+	if key == "" {
+		return
+	}
+	reason := ptr.String(bonus.Reason)
+	if text, err := bonus.ReasonText(); err == nil {
+		reason = strings.Join(strings.Fields(text.Text), " ")
+	}
+	b.bonuses[key] = append(b.bonuses[key], Bonus{
+		Giver:     displayName(bonus.Giver),
+		Amount:    ptr.Int(bonus.Amount),
+		CreatedAt: bonus.CreatedAt.In(b.opts.Location),
+		Reason:    reason,
+	})
+}
+
+// Digests returns a digest for each manager with at least one active
+// report, ordered by manager email.
+func (b *Builder) Digests() []Digest {
+	byManager := map[string]*Digest{}
+	for key, u := range b.users {
+		managerEmail := strings.ToLower(ptr.String(u.ManagerEmail))
+		if managerEmail == "" {
+			continue
+		}
+		if status := ptr.String(u.Status); status != "" && status != "active" {
+			continue
+		}
+		d, ok := byManager[managerEmail]
+		if !ok {
+			d = &Digest{
+				Title:   b.opts.Title,
+				Manager: b.manager(managerEmail),
+				Start:   b.opts.Start.In(b.opts.Location),
+				End:     b.opts.End.In(b.opts.Location),
+				LastDay: b.opts.End.Add(-time.Nanosecond).In(b.opts.Location),
+			}
+			d.ManagerName = displayName(&d.Manager)
+			byManager[managerEmail] = d
+		}
+
+		m := Member{User: u, Name: displayName(&u), Bonuses: b.bonuses[key]}
+		sort.Slice(m.Bonuses, func(i, j int) bool { return m.Bonuses[i].CreatedAt.Before(m.Bonuses[j].CreatedAt) })
+		for _, bonus := range m.Bonuses {
+			m.Amount += bonus.Amount
+		}
+		d.Members = append(d.Members, m)
+	}
+
+	digests := make([]Digest, 0, len(byManager))
+	for _, d := range byManager {
+		b.summarize(d)
+		digests = append(digests, *d)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return strings.ToLower(ptr.String(digests[i].Manager.Email)) < strings.ToLower(ptr.String(digests[j].Manager.Email))
+	})
+	return digests
+}
+
+// summarize orders the members and totals the digest.
+func (b *Builder) summarize(d *Digest) {
+	sort.Slice(d.Members, func(i, j int) bool {
+		if d.Members[i].Amount != d.Members[j].Amount {
+			return d.Members[i].Amount > d.Members[j].Amount
+		}
+		return d.Members[i].Name < d.Members[j].Name
+	})
+
+	counts := map[string]int{}
+	for _, m := range d.Members {
+		if len(m.Bonuses) == 0 {
+			d.Unrecognized = append(d.Unrecognized, m.Name)
+		}
+		d.Amount += m.Amount
+		d.Bonuses += len(m.Bonuses)
+		for _, bonus := range m.Bonuses {
+			for _, h := range bonusly.ReasonHashtags(bonus.Reason) {
+				counts[h]++
+			}
+		}
+	}
+	for h, n := range counts {
+		d.Hashtags = append(d.Hashtags, HashtagCount{Hashtag: h, Count: n})
+	}
+	sort.Slice(d.Hashtags, func(i, j int) bool {
+		if d.Hashtags[i].Count != d.Hashtags[j].Count {
+			return d.Hashtags[i].Count > d.Hashtags[j].Count
+		}
+		return d.Hashtags[i].Hashtag < d.Hashtags[j].Hashtag
+	})
+	if len(d.Hashtags) > b.opts.TopHashtags {
+		d.Hashtags = d.Hashtags[:b.opts.TopHashtags]
+	}
+}
+
+// manager returns the user with the email, or a user with only the email if
+// they are not known.
+func (b *Builder) manager(email string) bonusly.UserInfoResponse {
+	for _, u := range b.users {
+		if strings.ToLower(ptr.String(u.Email)) == email {
+			return u
+		}
+	}
+	return bonusly.UserInfoResponse{Email: &email}
+}
+
+// displayName returns the user's display name, falling back to their full
+// name, username or email.
+func displayName(u *bonusly.UserInfoResponse) string {
+	if u == nil {
+		return ""
+	}
+	if name := ptr.String(u.DisplayName); name != "" {
+		return name
+	}
+	if name := strings.TrimSpace(ptr.String(u.FirstName) + " " + ptr.String(u.LastName)); name != "" {
+		return name
+	}
+	if name := ptr.String(u.UserName); name != "" {
+		return name
+	}
+	return ptr.String(u.Email)
+}
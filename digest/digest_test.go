@@ -0,0 +1,146 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	start = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end   = start.AddDate(0, 0, 7)
+)
+
+func user(username, manager string) bonusly.UserInfoResponse {
+	u := bonusly.UserInfoResponse{
+		UserName:    ptr.NewString(username),
+		Email:       ptr.NewString(username + "@example.com"),
+		DisplayName: ptr.NewString(username + " Smith"),
+	}
+	if manager != "" {
+		u.ManagerEmail = ptr.NewString(manager + "@example.com")
+	}
+	return u
+}
+
+func bonus(giver, receiver string, amount int, at time.Time, reasonHTML string) bonusly.BonusResponse {
+	g, r := user(giver, ""), user(receiver, "")
+	return bonusly.BonusResponse{
+		Giver:      &g,
+		Receiver:   &r,
+		Amount:     ptr.NewInt(amount),
+		CreatedAt:  &at,
+		ReasonHTML: ptr.NewString(reasonHTML),
+	}
+}
+
+func testDigests(t *testing.T) []Digest {
+	b, err := New(Options{Start: start, End: end})
+	require.NoError(t, err)
+
+	archived := user("dave", "mia")
+	archived.Status = ptr.NewString("archived")
+	for _, u := range []bonusly.UserInfoResponse{
+		user("mia", ""), user("alice", "mia"), user("bob", "mia"), user("carol", "mia"), archived,
+		user("erin", "noah"),
+	} {
+		b.AddUser(u)
+	}
+
+	parent := bonus("erin", "alice", 5, start.Add(time.Hour),
+		`+5 <a href="/company/users/alice">@alice</a> great <strong>review</strong> <a href="/company/hashtags/teamwork">#teamwork</a>`)
+	parent.ChildBonuses = []bonusly.BonusResponse{bonus("mia", "alice", 2, start.Add(2*time.Hour), "+2 @alice agreed #teamwork")}
+	b.Add(parent)
+	b.Add(bonus("alice", "bob", 3, start.Add(48*time.Hour), "+3 @bob thanks #ownership"))
+	b.Add(bonus("alice", "bob", 10, end, "+10 @bob too late #ownership"))
+	b.Add(bonus("alice", "erin", 1, start.Add(time.Hour), "+1 @erin thanks #teamwork"))
+	b.Add(bonus("alice", "dave", 1, start.Add(time.Hour), "+1 @dave thanks #teamwork"))
+
+	return b.Digests()
+}
+
+func TestBuilder(t *testing.T) {
+	digests := testDigests(t)
+	require.Len(t, digests, 2)
+
+	d := digests[0]
+	assert.Equal(t, "mia@example.com", *d.Manager.Email)
+	assert.Equal(t, "mia Smith", d.ManagerName)
+	assert.Equal(t, "Weekly recognition digest", d.Title)
+	assert.Equal(t, time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC), d.LastDay.Truncate(24*time.Hour))
+	assert.Equal(t, 10, d.Amount, "should ignore bonuses outside the period")
+	assert.Equal(t, 3, d.Bonuses)
+	require.Len(t, d.Members, 3, "should exclude inactive reports")
+	assert.Equal(t, "alice Smith", d.Members[0].Name)
+	assert.Equal(t, 7, d.Members[0].Amount)
+	assert.Equal(t, []Bonus{
+		{Giver: "erin Smith", Amount: 5, CreatedAt: start.Add(time.Hour), Reason: "+5 @alice great review #teamwork"},
+		{Giver: "mia Smith", Amount: 2, CreatedAt: start.Add(2 * time.Hour), Reason: "+2 @alice agreed #teamwork"},
+	}, d.Members[0].Bonuses)
+	assert.Equal(t, "bob Smith", d.Members[1].Name)
+	assert.Equal(t, []string{"carol Smith"}, d.Unrecognized)
+	assert.Equal(t, []HashtagCount{{Hashtag: "teamwork", Count: 2}, {Hashtag: "ownership", Count: 1}}, d.Hashtags)
+
+	assert.Equal(t, "noah@example.com", *digests[1].Manager.Email, "should include managers who are not known users")
+	assert.Equal(t, "noah@example.com", digests[1].ManagerName)
+	assert.Equal(t, 1, digests[1].Amount)
+
+	t.Run("RejectsInvalidOptions", func(t *testing.T) {
+		_, err := New(Options{})
+		assert.Error(t, err)
+		_, err = New(Options{Start: end, End: start})
+		assert.Error(t, err)
+	})
+}
+
+func TestRenderer(t *testing.T) {
+	d := testDigests(t)[0]
+
+	t.Run("RendersDefaultTemplates", func(t *testing.T) {
+		r, err := NewRenderer("", "")
+		require.NoError(t, err)
+		m, err := r.Render(d)
+		require.NoError(t, err)
+
+		assert.Equal(t, "mia@example.com", m.To)
+		assert.Equal(t, "Weekly recognition digest: Mar 1 to Mar 7", m.Subject)
+		assert.Contains(t, m.Text, "Hi mia Smith, here is the recognition your team received from Mon Mar 1 to Sun Mar 7.")
+		assert.Contains(t, m.Text, "3 bonuses worth 10 in total. Top hashtags: #teamwork (2), #ownership (1).")
+		assert.Contains(t, m.Text, "alice Smith (+7)\n  - erin Smith on Mon Mar 1: +5 @alice great review #teamwork\n")
+		assert.Contains(t, m.Text, "Not recognized this period: carol Smith.")
+		assert.NotContains(t, m.Text, "too late")
+
+		assert.Contains(t, m.HTML, "<li><strong>erin Smith</strong> on Mon Mar 1: &#43;5 @alice great review #teamwork</li>")
+		assert.Contains(t, m.HTML, "Not recognized this period: carol Smith.")
+	})
+	t.Run("EscapesHTML", func(t *testing.T) {
+		r, err := NewRenderer("", "")
+		require.NoError(t, err)
+		d := d
+		d.ManagerName = "<script>alert(1)</script>"
+		m, err := r.Render(d)
+		require.NoError(t, err)
+		assert.NotContains(t, m.HTML, "<script>")
+		assert.Contains(t, m.Text, "<script>")
+	})
+	t.Run("RendersCustomTemplates", func(t *testing.T) {
+		r, err := NewRenderer(`<p>{{.Amount}}</p>`, `{{plural .Bonuses "bonus" "bonuses"}} for {{len .Members}} people`)
+		require.NoError(t, err)
+		m, err := r.Render(d)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>10</p>", m.HTML)
+		assert.Equal(t, "3 bonuses for 3 people", m.Text)
+	})
+	t.Run("RejectsInvalidTemplates", func(t *testing.T) {
+		_, err := NewRenderer("{{", "")
+		assert.Error(t, err)
+		r, err := NewRenderer("", "{{.Missing}}")
+		require.NoError(t, err)
+		_, err = r.Render(d)
+		assert.Error(t, err)
+	})
+}
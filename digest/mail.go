@@ -0,0 +1,210 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sender delivers rendered digests.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// FileSender writes each digest to an HTML and a text file in a directory,
+// named after the recipient's email.
+type FileSender struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\w.@+-]`)
+
+// Send writes the message to <dir>/<email>.html and <dir>/<email>.txt.
+func (s *FileSender) Send(_ context.Context, m Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory '%s'", s.Dir)
+	}
+	name := unsafeFileChars.ReplaceAllString(m.To, "_")
+	if name == "" {
+		return errors.New("message has no recipient")
+	}
+	for ext, content := range map[string]string{".html": m.HTML, ".txt": m.Text} {
+		path := filepath.Join(s.Dir, name+ext)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return errors.Wrapf(err, "writing digest '%s'", path)
+		}
+	}
+	return nil
+}
+
+// SMTPOptions represent options to send digests by SMTP.
+type SMTPOptions struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// From is the sender's email address.
+	From string
+	// Username and Password, if set, authenticate with PLAIN
+	// authentication, which requires TLS unless the server is local.
+	Username string
+	Password string
+	// TLSConfig configures STARTTLS, which is used if the server supports
+	// it. Defaults to verifying the server's host name.
+	TLSConfig *tls.Config
+	// Timeout bounds sending each message. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *SMTPOptions) Validate() error {
+	host, _, err := net.SplitHostPort(o.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid SMTP address '%s'", o.Addr)
+	}
+	if o.From == "" {
+		return errors.New("from address must be set")
+	}
+	if o.TLSConfig == nil {
+		o.TLSConfig = &tls.Config{ServerName: host}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+	return nil
+}
+
+// SMTPSender sends digests as multipart emails with HTML and text
+// alternatives.
+type SMTPSender struct {
+	opts SMTPOptions
+}
+
+// NewSMTPSender returns a sender that sends digests through the SMTP server.
+func NewSMTPSender(opts SMTPOptions) (*SMTPSender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &SMTPSender{opts: opts}, nil
+}
+
+// Send sends the message.
+func (s *SMTPSender) Send(ctx context.Context, m Message) error {
+	if m.To == "" {
+		return errors.New("message has no recipient")
+	}
+	body, err := s.compose(m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.opts.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "connecting to SMTP server '%s'", s.opts.Addr)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(err, "setting deadline")
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(s.opts.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return errors.Wrap(err, "starting SMTP session")
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(s.opts.TLSConfig); err != nil {
+			return errors.Wrap(err, "starting TLS")
+		}
+	}
+	if s.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.opts.Username, s.opts.Password, host)); err != nil {
+			return errors.Wrap(err, "authenticating")
+		}
+	}
+	if err := c.Mail(s.opts.From); err != nil {
+		return errors.Wrapf(err, "setting sender '%s'", s.opts.From)
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return errors.Wrapf(err, "setting recipient '%s'", m.To)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err, "starting message data")
+	}
+	if _, err := w.Write(body); err != nil {
+		return errors.Wrap(err, "writing message")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "sending message")
+	}
+	return errors.Wrap(c.Quit(), "ending SMTP session")
+}
+
+// compose returns the MIME message with text and HTML alternatives.
+func (s *SMTPSender) compose(m Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	headers := []string{
+		"From: " + s.opts.From,
+		"To: " + m.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + now.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", mw.Boundary()),
+	}
+	for _, h := range headers {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, errors.Errorf("header '%s' contains a line break", h)
+		}
+	}
+	var msg bytes.Buffer
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "creating message part")
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, errors.Wrap(err, "writing message part")
+		}
+		if err := qw.Close(); err != nil {
+			return nil, errors.Wrap(err, "writing message part")
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, errors.Wrap(err, "closing message")
+	}
+	msg.Write(buf.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,231 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer is a minimal SMTP server that records the messages it
+// receives.
+type fakeSMTPServer struct {
+	ln       net.Listener
+	auth     string
+	rejectTo string
+
+	mu       sync.Mutex
+	messages []receivedMessage
+	wg       sync.WaitGroup
+}
+
+type receivedMessage struct {
+	from, to, auth, data string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{ln: ln}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var msg receivedMessage
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case cmd == "AUTH":
+			creds, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			if err != nil {
+				reply("501 invalid credentials")
+				continue
+			}
+			msg.auth = string(creds)
+			if s.auth != "" && msg.auth != s.auth {
+				reply("535 authentication failed")
+				continue
+			}
+			reply("235 authenticated")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			msg.to = strings.Trim(line[len("RCPT TO:"):], "<> ")
+			if msg.to == s.rejectTo {
+				reply("550 no such user")
+				continue
+			}
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() []receivedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedMessage(nil), s.messages...)
+}
+
+var testMessage = Message{
+	To:      "mia@example.com",
+	Subject: "Weekly recognition digest: Mar 1 to Mar 7 🎉",
+	HTML:    "<p>3 bonuses worth <strong>10</strong> — well done!</p>",
+	Text:    "3 bonuses worth 10 — well done!\n",
+}
+
+func TestSMTPSender(t *testing.T) {
+	t.Run("SendsMultipartMessage", func(t *testing.T) {
+		srv := newFakeSMTPServer(t)
+		srv.auth = "\x00digest\x00secret"
+		s, err := NewSMTPSender(SMTPOptions{
+			Addr:     srv.ln.Addr().String(),
+			From:     "bonusly@example.com",
+			Username: "digest",
+			Password: "secret",
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Send(context.Background(), testMessage))
+
+		received := srv.received()
+		require.Len(t, received, 1)
+		assert.Equal(t, "bonusly@example.com", received[0].from)
+		assert.Equal(t, "mia@example.com", received[0].to)
+
+		msg, err := mail.ReadMessage(strings.NewReader(received[0].data))
+		require.NoError(t, err)
+		assert.Equal(t, "mia@example.com", msg.Header.Get("To"))
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, testMessage.Subject, subject)
+
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/alternative", mediaType)
+		parts := map[string]string{}
+		mr := multipart.NewReader(msg.Body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, err := ioutil.ReadAll(quotedprintable.NewReader(p))
+			require.NoError(t, err)
+			parts[p.Header.Get("Content-Type")] = strings.ReplaceAll(string(b), "\r\n", "\n")
+		}
+		assert.Equal(t, map[string]string{
+			"text/plain; charset=utf-8": testMessage.Text,
+			"text/html; charset=utf-8":  testMessage.HTML,
+		}, parts)
+	})
+	t.Run("ReturnsServerErrors", func(t *testing.T) {
+		srv := newFakeSMTPServer(t)
+		srv.rejectTo = "gone@example.com"
+		s, err := NewSMTPSender(SMTPOptions{Addr: srv.ln.Addr().String(), From: "bonusly@example.com"})
+		require.NoError(t, err)
+
+		m := testMessage
+		m.To = "gone@example.com"
+		err = s.Send(context.Background(), m)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no such user")
+		assert.Empty(t, srv.received())
+
+		srv.auth = "\x00digest\x00secret"
+		s, err = NewSMTPSender(SMTPOptions{Addr: srv.ln.Addr().String(), From: "bonusly@example.com", Username: "digest", Password: "wrong"})
+		require.NoError(t, err)
+		assert.Error(t, s.Send(context.Background(), testMessage))
+	})
+	t.Run("RejectsInvalidOptions", func(t *testing.T) {
+		_, err := NewSMTPSender(SMTPOptions{Addr: "localhost", From: "bonusly@example.com"})
+		assert.Error(t, err)
+		_, err = NewSMTPSender(SMTPOptions{Addr: "localhost:25"})
+		assert.Error(t, err)
+	})
+}
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &FileSender{Dir: filepath.Join(dir, "digests")}
+	require.NoError(t, s.Send(context.Background(), testMessage))
+
+	html, err := ioutil.ReadFile(filepath.Join(dir, "digests", "mia@example.com.html"))
+	require.NoError(t, err)
+	assert.Equal(t, testMessage.HTML, string(html))
+	text, err := ioutil.ReadFile(filepath.Join(dir, "digests", "mia@example.com.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, testMessage.Text, string(text))
+
+	assert.Error(t, s.Send(context.Background(), Message{}))
+}
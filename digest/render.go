@@ -0,0 +1,132 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/kimchelly/go-bonusly/templates"
+	"github.com/pkg/errors"
+)
+
+// DefaultHTMLTemplate is the default html/template template of digests,
+// which is executed with a Digest.
+const DefaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; color: #222; max-width: 640px;">
+<h1 style="font-size: 20px;">{{.Title}}</h1>
+<p>Hi {{.ManagerName}}, here is the recognition your team received from {{date .Start}} to {{date .LastDay}}.</p>
+<p><strong>{{plural .Bonuses "bonus" "bonuses"}}</strong> worth <strong>{{.Amount}}</strong> in total.{{if .Hashtags}} Top hashtags: {{range $i, $h := .Hashtags}}{{if $i}}, {{end}}#{{$h.Hashtag}} ({{$h.Count}}){{end}}.{{end}}</p>
+{{range .Members}}{{if .Bonuses}}<h2 style="font-size: 16px;">{{.Name}} <span style="color: #666; font-weight: normal;">{{amount .Amount}}</span></h2>
+<ul>
+{{range .Bonuses}}<li><strong>{{.Giver}}</strong> on {{date .CreatedAt}}: {{.Reason}}</li>
+{{end}}</ul>
+{{end}}{{end}}{{if .Unrecognized}}<p style="color: #666;">Not recognized this period: {{join .Unrecognized ", "}}. A few words of thanks could go a long way.</p>
+{{end}}</body>
+</html>
+`
+
+// DefaultTextTemplate is the default text/template template of digests,
+// which is executed with a Digest.
+const DefaultTextTemplate = `{{.Title}}
+
+Hi {{.ManagerName}}, here is the recognition your team received from {{date .Start}} to {{date .LastDay}}.
+
+{{plural .Bonuses "bonus" "bonuses"}} worth {{.Amount}} in total.{{if .Hashtags}} Top hashtags: {{range $i, $h := .Hashtags}}{{if $i}}, {{end}}#{{$h.Hashtag}} ({{$h.Count}}){{end}}.{{end}}
+{{range .Members}}{{if .Bonuses}}
+{{.Name}} ({{amount .Amount}})
+{{range .Bonuses}}  - {{.Giver}} on {{date .CreatedAt}}: {{.Reason}}
+{{end}}{{end}}{{end}}{{if .Unrecognized}}
+Not recognized this period: {{join .Unrecognized ", "}}. A few words of thanks could go a long way.
+{{end}}`
+
+// Message is a rendered digest addressed to its manager.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Renderer renders digests from HTML and text templates.
+type Renderer struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// NewRenderer returns a renderer of the html/template and text/template
+// templates, which are executed with a Digest. Empty templates default to
+// DefaultHTMLTemplate and DefaultTextTemplate. In addition to the helpers of
+// the templates package, templates can format times with date and join
+// strings with join.
+func NewRenderer(htmlText, textText string) (*Renderer, error) {
+	if htmlText == "" {
+		htmlText = DefaultHTMLTemplate
+	}
+	if textText == "" {
+		textText = DefaultTextTemplate
+	}
+	funcs := templates.Funcs()
+	funcs["date"] = func(t interface{}) (string, error) {
+		switch t := t.(type) {
+		case interface{ Format(string) string }:
+			return t.Format("Mon Jan 2"), nil
+		default:
+			return "", errors.Errorf("cannot format %T as a date", t)
+		}
+	}
+	funcs["join"] = strings.Join
+
+	html, err := htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Option("missingkey=error").Parse(htmlText)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing HTML template")
+	}
+	text, err := texttemplate.New("text").Funcs(funcs).Option("missingkey=error").Parse(textText)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing text template")
+	}
+	return &Renderer{html: html, text: text}, nil
+}
+
+// LoadRenderer returns a renderer of the templates in the files. Empty paths
+// use the default templates.
+func LoadRenderer(htmlPath, textPath string) (*Renderer, error) {
+	var htmlText, textText string
+	if htmlPath != "" {
+		b, err := ioutil.ReadFile(htmlPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading HTML template '%s'", htmlPath)
+		}
+		htmlText = string(b)
+	}
+	if textPath != "" {
+		b, err := ioutil.ReadFile(textPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading text template '%s'", textPath)
+		}
+		textText = string(b)
+	}
+	return NewRenderer(htmlText, textText)
+}
+
+// Render renders the digest into a message to its manager.
+func (r *Renderer) Render(d Digest) (*Message, error) {
+	var html, text bytes.Buffer
+	if err := r.html.Execute(&html, d); err != nil {
+		return nil, errors.Wrapf(err, "executing HTML template for '%s'", ptr.String(d.Manager.Email))
+	}
+	if err := r.text.Execute(&text, d); err != nil {
+		return nil, errors.Wrapf(err, "executing text template for '%s'", ptr.String(d.Manager.Email))
+	}
+	return &Message{
+		To:      ptr.String(d.Manager.Email),
+		Subject: fmt.Sprintf("%s: %s to %s", d.Title, d.Start.Format("Jan 2"), d.LastDay.Format("Jan 2")),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
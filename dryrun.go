@@ -0,0 +1,142 @@
+package bonusly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// dryRunBonusID is the ID of bonuses synthesized in dry run mode.
+const dryRunBonusID = "dry-run"
+
+// dryRunResponse writes out the request that would be sent and returns a
+// synthesized response to it without sending it.
+func (c *client) dryRunResponse(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading request body")
+		}
+		r.Body.Close()
+	}
+
+	if err := c.writeDryRunRequest(r, body); err != nil {
+		return nil, errors.Wrap(err, "writing dry run request")
+	}
+
+	status, payload := c.synthesizeDryRunResult(r, body)
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling dry run response")
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		Request:    r,
+	}, nil
+}
+
+// writeDryRunRequest writes the request in HTTP/1.1 wire format with the
+// access token redacted.
+func (c *client) writeDryRunRequest(r *http.Request, body []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[dry run] %s %s %s\n", r.Method, r.URL.String(), r.Proto)
+
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range r.Header[k] {
+			if k == "Authorization" {
+				v = "[REDACTED]"
+			}
+			fmt.Fprintf(&buf, "%s: %s\n", k, v)
+		}
+	}
+	buf.WriteString("\n")
+	if len(body) > 0 {
+		buf.Write(body)
+		buf.WriteString("\n")
+	}
+
+	_, err := c.opts.DryRunOutput.Write(buf.Bytes())
+	return err
+}
+
+// synthesizeDryRunResult validates the request and returns the status and
+// response payload that Bonusly would be expected to return for it.
+func (c *client) synthesizeDryRunResult(r *http.Request, body []byte) (int, interface{}) {
+	invalid := func(msg string) (int, interface{}) {
+		return http.StatusBadRequest, CommonResponse{
+			Success: ptr.NewBool(false),
+			Message: ptr.NewString("dry run: " + msg),
+		}
+	}
+	success := CommonResponse{Success: ptr.NewBool(true)}
+
+	route := c.relativeRoute(r.URL)
+	switch {
+	case r.Method == http.MethodPost && route == "/bonuses":
+		var req CreateBonusRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return invalid("request body is not a valid bonus")
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			return invalid("bonus must have a reason")
+		}
+		amount, err := reasonAmount(req.Reason)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		return http.StatusOK, bonusResponseWrapper{
+			CommonResponse: success,
+			Result: BonusResponse{
+				ID:        ptr.NewString(dryRunBonusID),
+				CreatedAt: ptr.NewTime(time.Now()),
+				Reason:    ptr.NewString(req.Reason),
+				Amount:    ptr.NewInt(amount),
+			},
+		}
+	case r.Method == http.MethodPut && strings.HasPrefix(route, "/bonuses/"):
+		var req CreateBonusRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return invalid("request body is not a valid bonus")
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			return invalid("bonus must have a reason")
+		}
+		return http.StatusOK, bonusResponseWrapper{
+			CommonResponse: success,
+			Result: BonusResponse{
+				ID:     ptr.NewString(strings.TrimPrefix(route, "/bonuses/")),
+				Reason: ptr.NewString(req.Reason),
+			},
+		}
+	default:
+		return http.StatusOK, success
+	}
+}
+
+// relativeRoute returns the URL's path relative to the client's base URL.
+func (c *client) relativeRoute(u *url.URL) string {
+	base, err := url.Parse(c.opts.BaseURL)
+	if err != nil {
+		return u.Path
+	}
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, base.Path), "/")
+}
@@ -0,0 +1,86 @@
+package bonusly
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected %s request to %s in dry run mode", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "result": {"username": "me"}}`)
+	}))
+	defer srv.Close()
+
+	httpClient := getHTTPClient()
+	defer putHTTPClient(httpClient)
+
+	var output bytes.Buffer
+	c, err := NewClient(ClientOptions{
+		AccessToken:  "access_token",
+		HTTPClient:   httpClient,
+		BaseURL:      srv.URL + "/api/v1",
+		DryRun:       true,
+		DryRunOutput: &output,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, c.Close(ctx))
+	}()
+
+	t.Run("CreateBonus", func(t *testing.T) {
+		t.Run("ReturnsSynthesizedBonus", func(t *testing.T) {
+			output.Reset()
+			resp, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+10 @alice thanks #teamwork"})
+			require.NoError(t, err)
+			assert.Equal(t, dryRunBonusID, ptr.String(resp.ID))
+			assert.Equal(t, "+10 @alice thanks #teamwork", ptr.String(resp.Reason))
+			assert.Equal(t, 10, ptr.Int(resp.Amount))
+
+			assert.Contains(t, output.String(), "POST "+srv.URL+"/api/v1/bonuses")
+			assert.Contains(t, output.String(), `"reason":"+10 @alice thanks #teamwork"`)
+			assert.Contains(t, output.String(), "Authorization: [REDACTED]")
+			assert.NotContains(t, output.String(), "access_token")
+		})
+		t.Run("FailsWithInvalidReason", func(t *testing.T) {
+			resp, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "@alice thanks"})
+			assert.Error(t, err)
+			assert.Zero(t, resp)
+		})
+	})
+	t.Run("UpdateBonus", func(t *testing.T) {
+		output.Reset()
+		resp, err := c.UpdateBonus(ctx, "bonus_id", "+10 @alice thanks again #teamwork")
+		require.NoError(t, err)
+		assert.Equal(t, "bonus_id", ptr.String(resp.ID))
+		assert.Equal(t, "+10 @alice thanks again #teamwork", ptr.String(resp.Reason))
+		assert.Contains(t, output.String(), "PUT "+srv.URL+"/api/v1/bonuses/bonus_id")
+	})
+	t.Run("DeleteBonus", func(t *testing.T) {
+		output.Reset()
+		require.NoError(t, c.DeleteBonus(ctx, "bonus_id"))
+		assert.Contains(t, output.String(), "DELETE "+srv.URL+"/api/v1/bonuses/bonus_id")
+	})
+	t.Run("MyUserInfoIsSent", func(t *testing.T) {
+		output.Reset()
+		info, err := c.MyUserInfo(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "me", ptr.String(info.UserName))
+		assert.Empty(t, output.String())
+	})
+}
@@ -0,0 +1,315 @@
+// Package equity reports how evenly recognition is distributed across people
+// and across groups of people, such as locations, departments and tenure.
+package equity
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Dimension is an attribute that people are grouped by to compare how much
+// recognition each group receives.
+type Dimension struct {
+	Name    string
+	GroupBy analytics.GroupBy
+}
+
+// GroupByTenure groups users by how long they have worked at the company at
+// the given time, based on their hire date.
+func GroupByTenure(now time.Time) analytics.GroupBy {
+	return func(u *bonusly.UserInfoResponse) string {
+		if u.HiredOne == nil {
+			return ""
+		}
+		years := now.Sub(*u.HiredOne).Hours() / 24 / 365.25
+		switch {
+		case years < 1:
+			return "less than 1 year"
+		case years < 2:
+			return "1-2 years"
+		case years < 5:
+			return "2-5 years"
+		default:
+			return "5+ years"
+		}
+	}
+}
+
+// ParseDimension parses a dimension, which is "tenure" or any grouping
+// supported by analytics.ParseGroupBy. Tenure is calculated at the given
+// time.
+func ParseDimension(s string, now time.Time) (Dimension, error) {
+	if s == "tenure" {
+		return Dimension{Name: s, GroupBy: GroupByTenure(now)}, nil
+	}
+	groupBy, err := analytics.ParseGroupBy(s)
+	if err != nil {
+		return Dimension{}, err
+	}
+	return Dimension{Name: s, GroupBy: groupBy}, nil
+}
+
+// ParseDimensions parses a comma-separated list of dimensions.
+func ParseDimensions(s string, now time.Time) ([]Dimension, error) {
+	var dims []Dimension
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		dim, err := ParseDimension(name, now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing dimension '%s'", name)
+		}
+		dims = append(dims, dim)
+	}
+	return dims, nil
+}
+
+// Options represent options to build an equity report.
+type Options struct {
+	// Title is the title of the report. Defaults to "Recognition equity
+	// report".
+	Title string
+	// Dimensions are the attributes to compare groups by. Defaults to
+	// location, department and tenure.
+	Dimensions []Dimension
+	// Now is the time that tenure is calculated at and the report is
+	// generated at. Defaults to the current time.
+	Now time.Time
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.Title == "" {
+		o.Title = "Recognition equity report"
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if len(o.Dimensions) == 0 {
+		o.Dimensions = []Dimension{
+			{Name: "location", GroupBy: analytics.GroupByLocation},
+			{Name: "department", GroupBy: analytics.GroupByDepartment},
+			{Name: "tenure", GroupBy: GroupByTenure(o.Now)},
+		}
+	}
+	for i, dim := range o.Dimensions {
+		if dim.Name == "" {
+			return errors.Errorf("dimension %d must have a name", i)
+		}
+		if dim.GroupBy == nil {
+			return errors.Errorf("dimension '%s' must have a grouping", dim.Name)
+		}
+	}
+	return nil
+}
+
+// Distribution is the distribution of the amount received by a set of
+// people.
+type Distribution struct {
+	// Headcount is the number of people.
+	Headcount int `json:"headcount"`
+	// Recognized is the number of people who received at least one bonus.
+	Recognized int `json:"recognized"`
+	// RecognitionRate is the fraction of people who received at least one
+	// bonus.
+	RecognitionRate float64 `json:"recognition_rate"`
+	// Bonuses is the number of bonuses received.
+	Bonuses int `json:"bonuses"`
+	// Amount is the total amount received.
+	Amount int `json:"amount"`
+	// AmountPerHead is the amount received divided by the headcount.
+	AmountPerHead float64 `json:"amount_per_head"`
+	// Median is the median amount received per person.
+	Median float64 `json:"median"`
+	// Gini is the Gini coefficient of the amount received per person, where
+	// 0 is perfectly equal and 1 is one person receiving everything.
+	Gini float64 `json:"gini"`
+}
+
+// Group is the distribution of recognition within a group.
+type Group struct {
+	Name string `json:"name"`
+	Distribution
+	// Share is the fraction of the total amount that the group received.
+	Share float64 `json:"share"`
+}
+
+// DimensionReport compares the groups of a dimension.
+type DimensionReport struct {
+	Name string `json:"name"`
+	// Groups are sorted by amount per head, least first.
+	Groups []Group `json:"groups"`
+	// Gini is the Gini coefficient of the amount per head of the groups.
+	Gini float64 `json:"gini"`
+}
+
+// Report is an equity report.
+type Report struct {
+	Title       string            `json:"title"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Overall     Distribution      `json:"overall"`
+	Dimensions  []DimensionReport `json:"dimensions"`
+}
+
+type person struct {
+	user     bonusly.UserInfoResponse
+	amount   int
+	received int
+}
+
+// Equity accumulates people and bonuses to report on.
+type Equity struct {
+	opts   Options
+	people map[string]*person
+}
+
+// New returns an equity report builder with no people or bonuses.
+func New(opts Options) (*Equity, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Equity{opts: opts, people: map[string]*person{}}, nil
+}
+
+// AddUser adds a person to the headcount even if they do not give or receive
+// any bonuses. Their attributes replace any previously seen for them.
+func (e *Equity) AddUser(u bonusly.UserInfoResponse) {
+	if p := e.person(&u); p != nil {
+		p.user = u
+	}
+}
+
+// Add adds a bonus and its child bonuses. The giver and receiver are added to
+// the headcount if they have not been added already.
+func (e *Equity) Add(b bonusly.BonusResponse) {
+	e.person(b.Giver)
+	if p := e.person(b.Receiver); p != nil {
+		p.amount += ptr.Int(b.Amount)
+		p.received++
+	}
+	for _, child := range b.ChildBonuses {
+		e.Add(child)
+	}
+}
+
+func (e *Equity) person(u *bonusly.UserInfoResponse) *person {
+	key := analytics.UserKey(u)
+	if key == "" {
+		return nil
+	}
+	p, ok := e.people[key]
+	if !ok {
+		p = &person{user: *u}
+		e.people[key] = p
+	}
+	return p
+}
+
+// Report returns the report of the people and bonuses added so far.
+func (e *Equity) Report() *Report {
+	all := make([]*person, 0, len(e.people))
+	for _, p := range e.people {
+		all = append(all, p)
+	}
+	r := &Report{
+		Title:       e.opts.Title,
+		GeneratedAt: e.opts.Now,
+		Overall:     distribution(all),
+		Dimensions:  make([]DimensionReport, 0, len(e.opts.Dimensions)),
+	}
+
+	for _, dim := range e.opts.Dimensions {
+		members := map[string][]*person{}
+		for _, p := range all {
+			name := dim.GroupBy(&p.user)
+			if name == "" {
+				name = analytics.NoGroup
+			}
+			members[name] = append(members[name], p)
+		}
+
+		dr := DimensionReport{Name: dim.Name, Groups: make([]Group, 0, len(members))}
+		perHead := make([]float64, 0, len(members))
+		for name, people := range members {
+			g := Group{Name: name, Distribution: distribution(people)}
+			if r.Overall.Amount > 0 {
+				g.Share = float64(g.Amount) / float64(r.Overall.Amount)
+			}
+			dr.Groups = append(dr.Groups, g)
+			perHead = append(perHead, g.AmountPerHead)
+		}
+		sort.Slice(dr.Groups, func(i, j int) bool {
+			if dr.Groups[i].AmountPerHead != dr.Groups[j].AmountPerHead {
+				return dr.Groups[i].AmountPerHead < dr.Groups[j].AmountPerHead
+			}
+			return dr.Groups[i].Name < dr.Groups[j].Name
+		})
+		dr.Gini = Gini(perHead)
+		r.Dimensions = append(r.Dimensions, dr)
+	}
+	return r
+}
+
+func distribution(people []*person) Distribution {
+	d := Distribution{Headcount: len(people)}
+	amounts := make([]float64, 0, len(people))
+	for _, p := range people {
+		if p.received > 0 {
+			d.Recognized++
+		}
+		d.Bonuses += p.received
+		d.Amount += p.amount
+		amounts = append(amounts, float64(p.amount))
+	}
+	if d.Headcount > 0 {
+		d.RecognitionRate = float64(d.Recognized) / float64(d.Headcount)
+		d.AmountPerHead = float64(d.Amount) / float64(d.Headcount)
+	}
+	d.Median = Median(amounts)
+	d.Gini = Gini(amounts)
+	return d
+}
+
+// Median returns the median of the values, or 0 if there are none.
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Gini returns the Gini coefficient of the non-negative values, which is 0 if
+// they are all equal and approaches 1 as one value holds the whole total. It
+// returns 0 if there are no values or they are all 0.
+func Gini(values []float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var total, weighted float64
+	for i, v := range sorted {
+		total += v
+		weighted += float64(i+1) * v
+	}
+	if total == 0 {
+		return 0
+	}
+	return (2*weighted)/(float64(n)*total) - float64(n+1)/float64(n)
+}
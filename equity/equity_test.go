@@ -0,0 +1,151 @@
+package equity
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"regexp"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func user(email, location string, hired time.Time) *bonusly.UserInfoResponse {
+	return &bonusly.UserInfoResponse{Email: ptr.NewString(email), Location: ptr.NewString(location), HiredOne: &hired}
+}
+
+func bonus(giver, receiver *bonusly.UserInfoResponse, amount int) bonusly.BonusResponse {
+	return bonusly.BonusResponse{Giver: giver, Receiver: receiver, Amount: ptr.NewInt(amount)}
+}
+
+func newTestReport(t *testing.T) *Report {
+	alice := user("alice", "London", now.AddDate(-3, 0, 0))
+	bob := user("bob", "London", now.AddDate(0, -6, 0))
+	carol := user("carol", "Paris <HQ>", now.AddDate(-6, 0, 0))
+	dave := user("dave", "Paris <HQ>", now.AddDate(-1, -1, 0))
+
+	e, err := New(Options{
+		Now: now,
+		Dimensions: []Dimension{
+			{Name: "location", GroupBy: analytics.GroupByLocation},
+			{Name: "tenure", GroupBy: GroupByTenure(now)},
+		},
+	})
+	require.NoError(t, err)
+	parent := bonus(alice, bob, 10)
+	parent.ChildBonuses = []bonusly.BonusResponse{bonus(carol, bob, 10)}
+	e.Add(parent)
+	e.Add(bonus(bob, carol, 20))
+	e.AddUser(*dave)
+	e.AddUser(bonusly.UserInfoResponse{Email: ptr.NewString("erin")})
+	return e.Report()
+}
+
+func TestGini(t *testing.T) {
+	assert.Equal(t, 0.0, Gini(nil))
+	assert.Equal(t, 0.0, Gini([]float64{0, 0}))
+	assert.Equal(t, 0.0, Gini([]float64{5, 5, 5}))
+	assert.InDelta(t, 0.75, Gini([]float64{0, 0, 0, 8}), 0.0001)
+	assert.InDelta(t, 0.25, Gini([]float64{1, 3}), 0.0001)
+}
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 0.0, Median(nil))
+	assert.Equal(t, 2.0, Median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, Median([]float64{4, 1, 3, 2}))
+}
+
+func TestParseDimensions(t *testing.T) {
+	dims, err := ParseDimensions("location, tenure,custom:team", now)
+	require.NoError(t, err)
+	require.Len(t, dims, 3)
+	assert.Equal(t, "tenure", dims[1].Name)
+	assert.Equal(t, "2-5 years", dims[1].GroupBy(user("a", "", now.AddDate(-3, 0, 0))))
+	assert.Equal(t, "", dims[1].GroupBy(&bonusly.UserInfoResponse{}))
+
+	_, err = ParseDimensions("location,age", now)
+	assert.Error(t, err)
+}
+
+func TestReport(t *testing.T) {
+	r := newTestReport(t)
+
+	assert.Equal(t, "Recognition equity report", r.Title)
+	assert.Equal(t, now, r.GeneratedAt)
+	assert.Equal(t, 5, r.Overall.Headcount)
+	assert.Equal(t, 2, r.Overall.Recognized)
+	assert.Equal(t, 0.4, r.Overall.RecognitionRate)
+	assert.Equal(t, 3, r.Overall.Bonuses)
+	assert.Equal(t, 40, r.Overall.Amount)
+	assert.Equal(t, 8.0, r.Overall.AmountPerHead)
+	assert.Equal(t, 0.0, r.Overall.Median)
+	assert.InDelta(t, 0.6, r.Overall.Gini, 0.0001)
+
+	require.Len(t, r.Dimensions, 2)
+	location := r.Dimensions[0]
+	assert.Equal(t, "location", location.Name)
+	require.Len(t, location.Groups, 3)
+	assert.Equal(t, analytics.NoGroup, location.Groups[0].Name, "should sort groups by amount per head")
+	assert.Equal(t, 1, location.Groups[0].Headcount)
+	assert.Equal(t, "London", location.Groups[1].Name, "should sort groups with the same amount per head by name")
+	assert.Equal(t, 10.0, location.Groups[1].Median)
+	assert.Equal(t, "Paris <HQ>", location.Groups[2].Name)
+	assert.Equal(t, 10.0, location.Groups[2].AmountPerHead)
+	assert.Equal(t, 0.5, location.Groups[2].RecognitionRate)
+	assert.Equal(t, 0.5, location.Groups[2].Share)
+	assert.InDelta(t, Gini([]float64{0, 10, 10}), location.Gini, 0.0001)
+
+	tenure := r.Dimensions[1]
+	var names []string
+	for _, g := range tenure.Groups {
+		names = append(names, g.Name)
+	}
+	assert.ElementsMatch(t, []string{analytics.NoGroup, "less than 1 year", "1-2 years", "2-5 years", "5+ years"}, names)
+}
+
+func TestWrite(t *testing.T) {
+	r := newTestReport(t)
+
+	t.Run("HTML", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, r.Write(&buf, FormatHTML))
+		out := buf.String()
+		assert.Contains(t, out, "<h2>By location</h2>")
+		assert.Contains(t, out, "<svg")
+		assert.Contains(t, out, "Paris &lt;HQ&gt;")
+		assert.NotContains(t, out, "Paris <HQ>")
+	})
+	t.Run("Markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, r.Write(&buf, FormatMarkdown))
+		out := buf.String()
+		assert.Contains(t, out, "## By tenure")
+		assert.Contains(t, out, "| London | 2 | 1 (50%) | 2 | 20 | 50% | 10.0 | 10.0 | 0.50 |")
+
+		match := regexp.MustCompile(`data:image/svg\+xml;base64,([A-Za-z0-9+/=]+)`).FindStringSubmatch(out)
+		require.Len(t, match, 2)
+		svg, err := base64.StdEncoding.DecodeString(match[1])
+		require.NoError(t, err)
+		var doc struct {
+			XMLName xml.Name
+		}
+		require.NoError(t, xml.Unmarshal(svg, &doc), "chart should be valid XML")
+		assert.Equal(t, "svg", doc.XMLName.Local)
+	})
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, r.Write(&buf, FormatJSON))
+		assert.Contains(t, buf.String(), `"recognition_rate": 0.4`)
+	})
+	t.Run("UnsupportedFormat", func(t *testing.T) {
+		assert.Error(t, Format("pdf").Validate())
+		assert.Error(t, r.Write(&bytes.Buffer{}, "pdf"))
+	})
+}
@@ -0,0 +1,193 @@
+package equity
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Format is a file format to write the report in.
+type Format string
+
+const (
+	// FormatHTML is a standalone HTML page with inline SVG charts.
+	FormatHTML Format = "html"
+	// FormatMarkdown is Markdown with SVG charts embedded as data URI images.
+	FormatMarkdown Format = "markdown"
+	// FormatJSON is the report as JSON, without charts.
+	FormatJSON Format = "json"
+)
+
+// Validate checks that the format is supported.
+func (f Format) Validate() error {
+	switch f {
+	case FormatHTML, FormatMarkdown, FormatJSON:
+		return nil
+	default:
+		return errors.Errorf("unsupported format '%s'", f)
+	}
+}
+
+// Write writes the report in the format.
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatHTML:
+		return r.WriteHTML(w)
+	case FormatMarkdown:
+		return r.WriteMarkdown(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return errors.Wrap(enc.Encode(r), "encoding report")
+	default:
+		return errors.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// Chart dimensions, in pixels.
+const (
+	chartWidth       = 640
+	chartLabelWidth  = 200
+	chartValueWidth  = 120
+	chartBarHeight   = 22
+	chartBarGap      = 6
+	chartTitleHeight = 28
+)
+
+// barChart returns an SVG horizontal bar chart of each group's amount per
+// head, annotated with its recognition rate.
+func barChart(title string, groups []Group) string {
+	var maxValue float64
+	for _, g := range groups {
+		if g.AmountPerHead > maxValue {
+			maxValue = g.AmountPerHead
+		}
+	}
+	barSpace := float64(chartWidth - chartLabelWidth - chartValueWidth)
+	height := chartTitleHeight + len(groups)*(chartBarHeight+chartBarGap) + chartBarGap
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		chartWidth, height, chartWidth, height)
+	fmt.Fprintf(&b, `<text x="0" y="18" font-size="14" font-weight="bold">%s</text>`, escapeXML(title))
+	for i, g := range groups {
+		y := chartTitleHeight + i*(chartBarHeight+chartBarGap)
+		var width float64
+		if maxValue > 0 {
+			width = barSpace * g.AmountPerHead / maxValue
+		}
+		textY := y + chartBarHeight/2 + 4
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartLabelWidth-8, textY, escapeXML(g.Name))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#4c78a8"/>`, chartLabelWidth, y, width, chartBarHeight)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%.1f (%s recognized)</text>`,
+			float64(chartLabelWidth)+width+6, textY, g.AmountPerHead, percent(g.RecognitionRate))
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// percent formats a fraction as a percentage.
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", 100*f)
+}
+
+func escapeXML(s string) string {
+	return htmltemplate.HTMLEscapeString(s)
+}
+
+func chartTitle(d DimensionReport) string {
+	return fmt.Sprintf("Amount received per head by %s", d.Name)
+}
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"percent": percent,
+	"chart": func(d DimensionReport) htmltemplate.HTML {
+		return htmltemplate.HTML(barChart(chartTitle(d), d.Groups))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}.</p>
+<h2>Overall</h2>
+<table>
+<tr><th>Headcount</th><th>Recognized</th><th>Bonuses</th><th>Amount</th><th>Amount per head</th><th>Median</th><th>Gini</th></tr>
+{{with .Overall}}<tr><td>{{.Headcount}}</td><td>{{.Recognized}} ({{percent .RecognitionRate}})</td><td>{{.Bonuses}}</td><td>{{.Amount}}</td><td>{{printf "%.1f" .AmountPerHead}}</td><td>{{printf "%.1f" .Median}}</td><td>{{printf "%.2f" .Gini}}</td></tr>{{end}}
+</table>
+{{range .Dimensions}}
+<h2>By {{.Name}}</h2>
+<p>Gini coefficient of amount per head between groups: {{printf "%.2f" .Gini}}</p>
+{{chart .}}
+<table>
+<tr><th>Group</th><th>Headcount</th><th>Recognized</th><th>Bonuses</th><th>Amount</th><th>Share</th><th>Amount per head</th><th>Median</th><th>Gini</th></tr>
+{{range .Groups}}<tr><td>{{.Name}}</td><td>{{.Headcount}}</td><td>{{.Recognized}} ({{percent .RecognitionRate}})</td><td>{{.Bonuses}}</td><td>{{.Amount}}</td><td>{{percent .Share}}</td><td>{{printf "%.1f" .AmountPerHead}}</td><td>{{printf "%.1f" .Median}}</td><td>{{printf "%.2f" .Gini}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return errors.Wrap(htmlTemplate.Execute(w, r), "rendering HTML")
+}
+
+var markdownTemplate = texttemplate.Must(texttemplate.New("markdown").Funcs(texttemplate.FuncMap{
+	"percent": percent,
+	"cell":    markdownCell,
+	"chart": func(d DimensionReport) string {
+		svg := base64.StdEncoding.EncodeToString([]byte(barChart(chartTitle(d), d.Groups)))
+		return fmt.Sprintf("![%s](data:image/svg+xml;base64,%s)", chartTitle(d), svg)
+	},
+}).Parse(`# {{cell .Title}}
+
+Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}.
+
+## Overall
+
+| Headcount | Recognized | Bonuses | Amount | Amount per head | Median | Gini |
+| ---: | ---: | ---: | ---: | ---: | ---: | ---: |
+{{with .Overall}}| {{.Headcount}} | {{.Recognized}} ({{percent .RecognitionRate}}) | {{.Bonuses}} | {{.Amount}} | {{printf "%.1f" .AmountPerHead}} | {{printf "%.1f" .Median}} | {{printf "%.2f" .Gini}} |{{end}}
+{{range .Dimensions}}
+## By {{cell .Name}}
+
+Gini coefficient of amount per head between groups: {{printf "%.2f" .Gini}}
+
+{{chart .}}
+
+| Group | Headcount | Recognized | Bonuses | Amount | Share | Amount per head | Median | Gini |
+| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: |
+{{range .Groups}}| {{cell .Name}} | {{.Headcount}} | {{.Recognized}} ({{percent .RecognitionRate}}) | {{.Bonuses}} | {{.Amount}} | {{percent .Share}} | {{printf "%.1f" .AmountPerHead}} | {{printf "%.1f" .Median}} | {{printf "%.2f" .Gini}} |
+{{end}}{{end}}`))
+
+// markdownCell escapes text so that it can be used in a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// WriteMarkdown writes the report as Markdown.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := markdownTemplate.Execute(&buf, r); err != nil {
+		return errors.Wrap(err, "rendering Markdown")
+	}
+	_, err := w.Write(buf.Bytes())
+	return errors.WithStack(err)
+}
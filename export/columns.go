@@ -0,0 +1,192 @@
+package export
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/pkg/errors"
+)
+
+// fieldKind is the type of a field's values.
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	intField
+)
+
+// row is a bonus being exported.
+type row struct {
+	bonus    bonusly.BonusResponse
+	parentID string
+}
+
+// field is a value that can be exported from a bonus.
+type field struct {
+	kind fieldKind
+	// get returns the field's value for the row, which is a string or an int
+	// depending on the kind, or nil if the bonus does not have it.
+	get func(r *row, opts *Options) interface{}
+}
+
+func stringValue(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func intValue(i *int) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+// userFields returns the fields of a user in the bonus, with the given
+// prefix.
+func userFields(prefix string, user func(b *bonusly.BonusResponse) *bonusly.UserInfoResponse) map[string]field {
+	userString := func(get func(u *bonusly.UserInfoResponse) *string) field {
+		return field{kind: stringField, get: func(r *row, _ *Options) interface{} {
+			u := user(&r.bonus)
+			if u == nil {
+				return nil
+			}
+			return stringValue(get(u))
+		}}
+	}
+	return map[string]field{
+		prefix + "_id":            userString(func(u *bonusly.UserInfoResponse) *string { return u.ID }),
+		prefix + "_username":      userString(func(u *bonusly.UserInfoResponse) *string { return u.UserName }),
+		prefix + "_email":         userString(func(u *bonusly.UserInfoResponse) *string { return u.Email }),
+		prefix + "_display_name":  userString(func(u *bonusly.UserInfoResponse) *string { return u.DisplayName }),
+		prefix + "_department":    userString(func(u *bonusly.UserInfoResponse) *string { return u.Department }),
+		prefix + "_location":      userString(func(u *bonusly.UserInfoResponse) *string { return u.Location }),
+		prefix + "_manager_email": userString(func(u *bonusly.UserInfoResponse) *string { return u.ManagerEmail }),
+	}
+}
+
+// fields are all the fields that can be exported, by name.
+var fields = func() map[string]field {
+	fs := map[string]field{
+		"id": {kind: stringField, get: func(r *row, _ *Options) interface{} { return stringValue(r.bonus.ID) }},
+		"parent_id": {kind: stringField, get: func(r *row, _ *Options) interface{} {
+			if r.parentID == "" {
+				return nil
+			}
+			return r.parentID
+		}},
+		"created_at": {kind: stringField, get: func(r *row, opts *Options) interface{} {
+			if r.bonus.CreatedAt == nil {
+				return nil
+			}
+			return r.bonus.CreatedAt.In(opts.Location).Format(opts.TimeFormat)
+		}},
+		"reason":               {kind: stringField, get: func(r *row, _ *Options) interface{} { return stringValue(r.bonus.Reason) }},
+		"reason_html":          {kind: stringField, get: func(r *row, _ *Options) interface{} { return stringValue(r.bonus.ReasonHTML) }},
+		"amount":               {kind: intField, get: func(r *row, _ *Options) interface{} { return intValue(r.bonus.Amount) }},
+		"amount_with_currency": {kind: stringField, get: func(r *row, _ *Options) interface{} { return stringValue(r.bonus.AmountWithCurrency) }},
+		"hashtag": {kind: stringField, get: func(r *row, _ *Options) interface{} {
+			if r.bonus.Value == "" {
+				return nil
+			}
+			return r.bonus.Value
+		}},
+		"via":           {kind: stringField, get: func(r *row, _ *Options) interface{} { return stringValue(r.bonus.Via) }},
+		"child_count":   {kind: intField, get: func(r *row, _ *Options) interface{} { return intValue(r.bonus.ChildCount) }},
+		"family_amount": {kind: intField, get: func(r *row, _ *Options) interface{} { return intValue(r.bonus.FamilyAmount) }},
+	}
+	for name, f := range userFields("giver", func(b *bonusly.BonusResponse) *bonusly.UserInfoResponse { return b.Giver }) {
+		fs[name] = f
+	}
+	for name, f := range userFields("receiver", func(b *bonusly.BonusResponse) *bonusly.UserInfoResponse { return b.Receiver }) {
+		fs[name] = f
+	}
+	return fs
+}()
+
+// Column is a column of the export.
+type Column struct {
+	// Field is the name of the bonus field in the column, such as
+	// "giver_email".
+	Field string
+	// Name is the name of the column in the export. Defaults to the field
+	// name.
+	Name string
+}
+
+// DefaultColumns are the columns that are exported if none are given.
+var DefaultColumns = []Column{
+	{Field: "id"},
+	{Field: "parent_id"},
+	{Field: "created_at"},
+	{Field: "giver_id"},
+	{Field: "giver_username"},
+	{Field: "giver_email"},
+	{Field: "giver_display_name"},
+	{Field: "receiver_id"},
+	{Field: "receiver_username"},
+	{Field: "receiver_email"},
+	{Field: "receiver_display_name"},
+	{Field: "amount"},
+	{Field: "amount_with_currency"},
+	{Field: "hashtag"},
+	{Field: "reason"},
+	{Field: "via"},
+	{Field: "child_count"},
+	{Field: "family_amount"},
+}
+
+// Fields returns the names of all the fields that can be exported.
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseColumns parses a comma-separated list of columns, where each column is
+// a field name optionally followed by a colon and the column name (e.g.
+// "giver_email:giver,amount:points").
+func ParseColumns(spec string) ([]Column, error) {
+	var cols []Column
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		col := Column{Field: part}
+		if i := strings.Index(part, ":"); i >= 0 {
+			col = Column{Field: strings.TrimSpace(part[:i]), Name: strings.TrimSpace(part[i+1:])}
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("must specify at least one column")
+	}
+	return cols, nil
+}
+
+func validateColumns(cols []Column) error {
+	names := map[string]bool{}
+	for i := range cols {
+		if _, ok := fields[cols[i].Field]; !ok {
+			return errors.Errorf("unknown field '%s'", cols[i].Field)
+		}
+		if cols[i].Name == "" {
+			cols[i].Name = cols[i].Field
+		}
+		if names[cols[i].Name] {
+			return errors.Errorf("duplicate column name '%s'", cols[i].Name)
+		}
+		names[cols[i].Name] = true
+	}
+	return nil
+}
+
+// defaultTimeFormat is the format of exported times if none is given.
+const defaultTimeFormat = time.RFC3339
@@ -0,0 +1,155 @@
+// Package export streams bonuses from Bonusly into CSV, JSON lines or Parquet
+// files.
+package export
+
+import (
+	"context"
+	"io"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Format is the file format of an export.
+type Format string
+
+const (
+	// FormatCSV is CSV with a header row.
+	FormatCSV Format = "csv"
+	// FormatJSONL is one JSON object per line, whose keys are the column names.
+	FormatJSONL Format = "jsonl"
+	// FormatParquet is Apache Parquet.
+	FormatParquet Format = "parquet"
+)
+
+// Validate checks that the format is supported.
+func (f Format) Validate() error {
+	switch f {
+	case FormatCSV, FormatJSONL, FormatParquet:
+		return nil
+	default:
+		return errors.Errorf("unsupported format '%s'", f)
+	}
+}
+
+// Options represent options to export bonuses.
+type Options struct {
+	Format Format
+	// Columns are the columns to export, in order. Defaults to
+	// DefaultColumns.
+	Columns []Column
+	// Start and End limit the export to bonuses created in the period. A
+	// zero time leaves that end of the period unbounded.
+	Start time.Time
+	End   time.Time
+	// IncludeChildren, if set, exports child bonuses (add-ons) after their
+	// parent bonus.
+	IncludeChildren bool
+	// Location is the time zone that times are converted to. Defaults to UTC.
+	Location *time.Location
+	// TimeFormat is the layout of exported times. Defaults to RFC 3339.
+	TimeFormat string
+	// PageSize is the number of bonuses to get per request. Defaults to 100.
+	PageSize uint
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if err := o.Format.Validate(); err != nil {
+		return err
+	}
+	if len(o.Columns) == 0 {
+		o.Columns = append([]Column(nil), DefaultColumns...)
+	}
+	if err := validateColumns(o.Columns); err != nil {
+		return errors.Wrap(err, "invalid columns")
+	}
+	if !o.Start.IsZero() && !o.End.IsZero() && o.End.Before(o.Start) {
+		return errors.New("end cannot be before start")
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+	if o.TimeFormat == "" {
+		o.TimeFormat = defaultTimeFormat
+	}
+	return nil
+}
+
+// rowWriter writes rows of values in a file format.
+type rowWriter interface {
+	// Write writes a row of values, one per column, which are each a string,
+	// an int or nil.
+	Write(values []interface{}) error
+	// Close finishes writing the file. It does not close the underlying
+	// writer.
+	Close() error
+}
+
+func newRowWriter(w io.Writer, format Format, cols []Column) (rowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, cols)
+	case FormatJSONL:
+		return newJSONLWriter(w, cols), nil
+	case FormatParquet:
+		return newParquetWriter(w, cols)
+	default:
+		return nil, errors.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// Export writes the bonuses to w in the format given by the options and
+// returns the number of exported bonuses. Bonuses are written as they are
+// listed, so memory use does not grow with the number of bonuses.
+func Export(ctx context.Context, c bonusly.Client, w io.Writer, opts Options) (int, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, errors.Wrap(err, "invalid options")
+	}
+
+	rw, err := newRowWriter(w, opts.Format, opts.Columns)
+	if err != nil {
+		return 0, errors.Wrap(err, "creating writer")
+	}
+
+	var n int
+	values := make([]interface{}, len(opts.Columns))
+	write := func(r *row) error {
+		for i, col := range opts.Columns {
+			values[i] = fields[col.Field].get(r, &opts)
+		}
+		if err := rw.Write(values); err != nil {
+			return errors.Wrapf(err, "writing bonus '%s'", ptr.String(r.bonus.ID))
+		}
+		n++
+		return nil
+	}
+
+	req := bonusly.ListBonusesRequest{
+		Limit:           opts.PageSize,
+		StartTime:       opts.Start,
+		EndTime:         opts.End,
+		IncludeChildren: opts.IncludeChildren,
+	}
+	if err := bonusly.EachBonus(ctx, c, req, func(b bonusly.BonusResponse) error {
+		if err := write(&row{bonus: b}); err != nil {
+			return err
+		}
+		if !opts.IncludeChildren {
+			return nil
+		}
+		for _, child := range b.ChildBonuses {
+			if err := write(&row{bonus: child, parentID: ptr.String(b.ID)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return n, err
+	}
+
+	return n, errors.Wrap(rw.Close(), "finishing export")
+}
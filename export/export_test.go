@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// fakeClient lists its bonuses a page at a time.
+type fakeClient struct {
+	*bonusly.MockClient
+	bonuses  []bonusly.BonusResponse
+	requests []bonusly.ListBonusesRequest
+}
+
+func (c *fakeClient) ListBonuses(_ context.Context, req bonusly.ListBonusesRequest) ([]bonusly.BonusResponse, error) {
+	c.requests = append(c.requests, req)
+	if int(req.Skip) >= len(c.bonuses) {
+		return nil, nil
+	}
+	end := int(req.Skip + req.Limit)
+	if end > len(c.bonuses) {
+		end = len(c.bonuses)
+	}
+	return c.bonuses[req.Skip:end], nil
+}
+
+func newFakeClient() *fakeClient {
+	createdAt := time.Date(2021, time.March, 31, 23, 30, 0, 0, time.UTC)
+	return &fakeClient{
+		MockClient: &bonusly.MockClient{},
+		bonuses: []bonusly.BonusResponse{
+			{
+				ID:        ptr.NewString("parent"),
+				CreatedAt: &createdAt,
+				Reason:    ptr.NewString(`+5 @bob for the "release", thanks #ownership`),
+				Amount:    ptr.NewInt(5),
+				Value:     "ownership",
+				Giver:     &bonusly.UserInfoResponse{Email: ptr.NewString("alice@example.com"), DisplayName: ptr.NewString("Alice")},
+				Receiver:  &bonusly.UserInfoResponse{Email: ptr.NewString("bob@example.com"), DisplayName: ptr.NewString("Bob")},
+				ChildBonuses: []bonusly.BonusResponse{{
+					ID:       ptr.NewString("child"),
+					Amount:   ptr.NewInt(1),
+					Giver:    &bonusly.UserInfoResponse{Email: ptr.NewString("carol@example.com")},
+					Receiver: &bonusly.UserInfoResponse{Email: ptr.NewString("bob@example.com")},
+				}},
+			},
+			{
+				ID:       ptr.NewString("other"),
+				Amount:   ptr.NewInt(2),
+				Giver:    &bonusly.UserInfoResponse{Email: ptr.NewString("bob@example.com")},
+				Receiver: &bonusly.UserInfoResponse{Email: ptr.NewString("alice@example.com")},
+			},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cols := []Column{
+		{Field: "id"},
+		{Field: "parent_id"},
+		{Field: "created_at", Name: "date"},
+		{Field: "giver_email", Name: "giver"},
+		{Field: "receiver_email", Name: "receiver"},
+		{Field: "amount"},
+		{Field: "reason"},
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	t.Run("CSV", func(t *testing.T) {
+		c := newFakeClient()
+		start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+		var buf bytes.Buffer
+		n, err := Export(ctx, c, &buf, Options{
+			Format:          FormatCSV,
+			Columns:         cols,
+			Start:           start,
+			End:             end,
+			IncludeChildren: true,
+			Location:        newYork,
+			PageSize:        1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		require.NotEmpty(t, c.requests)
+		assert.Equal(t, start, c.requests[0].StartTime)
+		assert.Equal(t, end, c.requests[0].EndTime)
+		assert.True(t, c.requests[0].IncludeChildren)
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"id", "parent_id", "date", "giver", "receiver", "amount", "reason"},
+			{"parent", "", "2021-03-31T19:30:00-04:00", "alice@example.com", "bob@example.com", "5", `+5 @bob for the "release", thanks #ownership`},
+			{"child", "parent", "", "carol@example.com", "bob@example.com", "1", ""},
+			{"other", "", "", "bob@example.com", "alice@example.com", "2", ""},
+		}, records)
+	})
+	t.Run("JSONL", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(ctx, newFakeClient(), &buf, Options{
+			Format:  FormatJSONL,
+			Columns: cols,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, `{"id":"parent","parent_id":null,"date":"2021-03-31T23:30:00Z","giver":"alice@example.com","receiver":"bob@example.com","amount":5,"reason":"+5 @bob for the \"release\", thanks #ownership"}`, lines[0])
+		assert.Equal(t, `{"id":"other","parent_id":null,"date":null,"giver":"bob@example.com","receiver":"alice@example.com","amount":2,"reason":null}`, lines[1])
+	})
+	t.Run("Parquet", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(ctx, newFakeClient(), &buf, Options{
+			Format:          FormatParquet,
+			Columns:         cols,
+			IncludeChildren: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		f, err := buffer.NewBufferFile(buf.Bytes())
+		require.NoError(t, err)
+		pr, err := reader.NewParquetColumnReader(f, 1)
+		require.NoError(t, err)
+		defer pr.ReadStop()
+		assert.EqualValues(t, 3, pr.GetNumRows())
+
+		ids, _, _, err := pr.ReadColumnByIndex(0, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"parent", "child", "other"}, ids)
+		parentIDs, _, _, err := pr.ReadColumnByIndex(1, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{nil, "parent", nil}, parentIDs)
+		amounts, _, _, err := pr.ReadColumnByIndex(5, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{int64(5), int64(1), int64(2)}, amounts)
+	})
+	t.Run("FailsWithUnknownField", func(t *testing.T) {
+		_, err := Export(ctx, newFakeClient(), &bytes.Buffer{}, Options{
+			Format:  FormatCSV,
+			Columns: []Column{{Field: "nonexistent"}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestParseColumns(t *testing.T) {
+	cols, err := ParseColumns("id, giver_email:giver ,amount:points")
+	require.NoError(t, err)
+	assert.Equal(t, []Column{
+		{Field: "id"},
+		{Field: "giver_email", Name: "giver"},
+		{Field: "amount", Name: "points"},
+	}, cols)
+
+	_, err = ParseColumns(" , ")
+	assert.Error(t, err)
+}
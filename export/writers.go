@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, cols []Column) (*csvWriter, error) {
+	cw := &csvWriter{
+		w:      csv.NewWriter(w),
+		record: make([]string, len(cols)),
+	}
+	for i, col := range cols {
+		cw.record[i] = col.Name
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return nil, errors.Wrap(err, "writing header")
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			w.record[i] = ""
+		case string:
+			w.record[i] = v
+		case int:
+			w.record[i] = strconv.Itoa(v)
+		default:
+			w.record[i] = fmt.Sprint(v)
+		}
+	}
+	return errors.WithStack(w.w.Write(w.record))
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return errors.WithStack(w.w.Error())
+}
+
+type jsonlWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func newJSONLWriter(w io.Writer, cols []Column) *jsonlWriter {
+	jw := &jsonlWriter{w: bufio.NewWriter(w)}
+	for _, col := range cols {
+		key, _ := json.Marshal(col.Name)
+		jw.keys = append(jw.keys, key)
+	}
+	return jw
+}
+
+// Write writes the values as a JSON object with the keys in column order,
+// which encoding/json does not preserve for maps.
+func (w *jsonlWriter) Write(values []interface{}) error {
+	w.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		w.w.Write(w.keys[i])
+		w.w.WriteByte(':')
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "marshalling column %d", i)
+		}
+		w.w.Write(b)
+	}
+	w.w.WriteString("}\n")
+	// Flushing each line keeps the output streaming even if it is piped.
+	return errors.WithStack(w.w.Flush())
+}
+
+func (w *jsonlWriter) Close() error {
+	return errors.WithStack(w.w.Flush())
+}
+
+const (
+	// parquetRowGroupSize bounds the memory used to buffer rows before they
+	// are written out as a row group.
+	parquetRowGroupSize = 16 * 1024 * 1024
+	// parquetParallelism is the number of goroutines used to encode pages.
+	parquetParallelism = 1
+)
+
+type parquetWriter struct {
+	pw *writer.CSVWriter
+}
+
+func newParquetWriter(w io.Writer, cols []Column) (*parquetWriter, error) {
+	md := make([]string, 0, len(cols))
+	for _, col := range cols {
+		// The Parquet writer's schema metadata is a comma-separated list of
+		// key=value pairs.
+		if strings.ContainsAny(col.Name, ",=") {
+			return nil, errors.Errorf("Parquet column name '%s' cannot contain ',' or '='", col.Name)
+		}
+		switch fields[col.Field].kind {
+		case intField:
+			md = append(md, fmt.Sprintf("name=%s, type=INT64, repetitiontype=OPTIONAL", col.Name))
+		default:
+			md = append(md, fmt.Sprintf("name=%s, type=UTF8, repetitiontype=OPTIONAL", col.Name))
+		}
+	}
+	pw, err := writer.NewCSVWriterFromWriter(md, w, parquetParallelism)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating Parquet writer")
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetWriter{pw: pw}, nil
+}
+
+func (w *parquetWriter) Write(values []interface{}) error {
+	// The Parquet writer keeps the row until the row group is flushed, so it
+	// needs its own copy.
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		if n, ok := v.(int); ok {
+			row[i] = int64(n)
+			continue
+		}
+		row[i] = v
+	}
+	return errors.WithStack(w.pw.Write(row))
+}
+
+func (w *parquetWriter) Close() error {
+	return errors.WithStack(w.pw.WriteStop())
+}
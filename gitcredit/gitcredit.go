@@ -0,0 +1,382 @@
+// Package gitcredit proposes and gives bonuses to the authors and co-authors
+// of commits in a git repository.
+package gitcredit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// DefaultTemplate is the default reason template.
+const DefaultTemplate = `+{{.Amount}} @{{.Username}} thanks for your {{len .Commits}} {{if eq (len .Commits) 1}}commit{{else}}commits{{end}}: {{.Summary}} #shipit`
+
+// Options represent options to propose bonuses for commits.
+type Options struct {
+	// GiverEmail is the email of the account that gives the bonuses, who is
+	// never proposed a bonus. Defaults to the account of the client.
+	GiverEmail string
+	// AmountPerCommit is the amount given for each commit a person
+	// authored or co-authored. Defaults to 1.
+	AmountPerCommit int
+	// MaxAmount caps the amount given to each person. Defaults to 10.
+	MaxAmount int
+	// MaxCommitsInReason is the number of commits that are referenced in
+	// each reason, after which the rest are counted. Defaults to 3.
+	MaxCommitsInReason int
+	// Template is a text/template template of the bonus reasons, which is
+	// executed with TemplateData. Defaults to DefaultTemplate.
+	Template string
+	// Aliases maps commit emails to the emails of Bonusly users, for people
+	// who commit with another email.
+	Aliases map[string]string
+	// Store records each commit that was credited to each person, so that
+	// the same commit is never credited to them twice, even when planning
+	// over an overlapping range of commits. To also prevent
+	// duplicates when the outcome of creating a bonus is unknown, give the
+	// client the same store. Defaults to an in-memory store.
+	Store bonusly.IdempotencyStore
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.AmountPerCommit == 0 {
+		o.AmountPerCommit = 1
+	}
+	if o.MaxAmount == 0 {
+		o.MaxAmount = 10
+	}
+	if o.AmountPerCommit < 0 || o.MaxAmount < 0 {
+		return errors.New("amounts cannot be negative")
+	}
+	if o.MaxCommitsInReason == 0 {
+		o.MaxCommitsInReason = 3
+	}
+	if o.MaxCommitsInReason < 0 {
+		return errors.New("max commits in reason cannot be negative")
+	}
+	if o.Template == "" {
+		o.Template = DefaultTemplate
+	}
+	if o.Store == nil {
+		o.Store = bonusly.NewMemoryIdempotencyStore()
+	}
+	return nil
+}
+
+// TemplateData is the data that reason templates are executed with.
+type TemplateData struct {
+	Amount      int
+	Username    string
+	FirstName   string
+	DisplayName string
+	Email       string
+	Commits     []Commit
+	// Summary references the first commits by their short hashes and
+	// subjects, and counts the rest.
+	Summary string
+}
+
+// Proposal is a proposed bonus for a person's commits.
+type Proposal struct {
+	User bonusly.UserInfoResponse `json:"user"`
+	// Commits are the commits to credit the person for.
+	Commits []Commit `json:"commits"`
+	// Credited are the person's commits that were already credited, which
+	// are not credited again.
+	Credited []Commit                   `json:"credited,omitempty"`
+	Amount   int                        `json:"amount"`
+	Request  bonusly.CreateBonusRequest `json:"request"`
+	// Key uniquely identifies the person and commits, and is the idempotency
+	// key of the request.
+	Key   string                 `json:"key"`
+	Bonus *bonusly.BonusResponse `json:"bonus,omitempty"`
+	// Skipped is whether all of the person's commits were already credited,
+	// so there is nothing to give.
+	Skipped bool  `json:"skipped,omitempty"`
+	Err     error `json:"-"`
+}
+
+// Unmatched is a commit author or co-author who is not a Bonusly user who
+// can receive bonuses.
+type Unmatched struct {
+	Person  Person `json:"person"`
+	Commits int    `json:"commits"`
+}
+
+// Plan is the proposed bonuses for a set of commits.
+type Plan struct {
+	Proposals []Proposal  `json:"proposals"`
+	Unmatched []Unmatched `json:"unmatched,omitempty"`
+}
+
+// Creditor proposes and gives bonuses for commits.
+type Creditor struct {
+	client bonusly.Client
+	opts   Options
+	tmpl   *template.Template
+	users  map[string]*bonusly.UserInfoResponse
+}
+
+// New returns a creditor that finds users and gives bonuses with the client.
+func New(client bonusly.Client, opts Options) (*Creditor, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	tmpl, err := template.New("reason").Option("missingkey=error").Parse(opts.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing template")
+	}
+	aliases := map[string]string{}
+	for from, to := range opts.Aliases {
+		aliases[strings.ToLower(from)] = to
+	}
+	opts.Aliases = aliases
+	return &Creditor{
+		client: client,
+		opts:   opts,
+		tmpl:   tmpl,
+		users:  map[string]*bonusly.UserInfoResponse{},
+	}, nil
+}
+
+// Plan maps the authors and co-authors of the commits to Bonusly users and
+// proposes a bonus for each user, capped at the maximum amount. Proposals
+// for commits that were already credited are skipped.
+func (c *Creditor) Plan(ctx context.Context, commits []Commit) (*Plan, error) {
+	giver := strings.ToLower(c.opts.GiverEmail)
+	if giver == "" {
+		me, err := c.client.MyUserInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting giver")
+		}
+		giver = strings.ToLower(ptr.String(me.Email))
+	}
+
+	byKey := map[string]*Proposal{}
+	unmatched := map[string]*Unmatched{}
+	for _, commit := range commits {
+		credited := map[string]bool{}
+		for _, p := range commit.People() {
+			u, err := c.findUser(ctx, p.Email)
+			if err != nil {
+				return nil, err
+			}
+			if u == nil {
+				email := strings.ToLower(p.Email)
+				if unmatched[email] == nil {
+					unmatched[email] = &Unmatched{Person: p}
+				}
+				unmatched[email].Commits++
+				continue
+			}
+			key := analytics.UserKey(u)
+			if credited[key] || strings.ToLower(ptr.String(u.Email)) == giver {
+				continue
+			}
+			credited[key] = true
+			if byKey[key] == nil {
+				byKey[key] = &Proposal{User: *u}
+			}
+			byKey[key].Commits = append(byKey[key].Commits, commit)
+		}
+	}
+
+	plan := &Plan{}
+	for key, p := range byKey {
+		var err error
+		if p.Commits, p.Credited, err = c.uncredited(key, p.Commits); err != nil {
+			return nil, err
+		}
+		if len(p.Commits) == 0 {
+			p.Skipped = true
+			p.Key = proposalKey(key, p.Credited)
+			plan.Proposals = append(plan.Proposals, *p)
+			continue
+		}
+		p.Amount = len(p.Commits) * c.opts.AmountPerCommit
+		if p.Amount > c.opts.MaxAmount {
+			p.Amount = c.opts.MaxAmount
+		}
+		p.Key = proposalKey(key, p.Commits)
+		if p.Request, err = c.request(*p); err != nil {
+			return nil, err
+		}
+		plan.Proposals = append(plan.Proposals, *p)
+	}
+	sort.Slice(plan.Proposals, func(i, j int) bool {
+		if plan.Proposals[i].Amount != plan.Proposals[j].Amount {
+			return plan.Proposals[i].Amount > plan.Proposals[j].Amount
+		}
+		return plan.Proposals[i].Key < plan.Proposals[j].Key
+	})
+	for _, u := range unmatched {
+		plan.Unmatched = append(plan.Unmatched, *u)
+	}
+	sort.Slice(plan.Unmatched, func(i, j int) bool {
+		return plan.Unmatched[i].Person.Email < plan.Unmatched[j].Person.Email
+	})
+	return plan, nil
+}
+
+// Apply gives the proposed bonuses that were not skipped, recording each of
+// their commits in the store. Errors giving individual bonuses are set on
+// their proposals, including those that were not given because the context
+// was done.
+func (c *Creditor) Apply(ctx context.Context, plan *Plan) {
+	for i := range plan.Proposals {
+		p := &plan.Proposals[i]
+		if p.Skipped {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			p.Err = err
+			continue
+		}
+		userKey := analytics.UserKey(&p.User)
+		_, credited, err := c.uncredited(userKey, p.Commits)
+		if err != nil {
+			p.Err = err
+			continue
+		}
+		if len(credited) > 0 {
+			p.Err = errors.Errorf("%d of the commits were credited since planning, so plan again", len(credited))
+			continue
+		}
+		if p.Bonus, err = c.client.CreateBonus(ctx, p.Request); err != nil {
+			p.Err = errors.Wrap(err, "creating bonus")
+			continue
+		}
+		rec := bonusly.IdempotencyRecord{Request: p.Request, Response: *p.Bonus, CreatedAt: time.Now()}
+		for _, commit := range p.Commits {
+			if err := c.opts.Store.Put(commitKey(userKey, commit), rec); err != nil {
+				p.Err = errors.Wrapf(err, "bonus was created but could not record commit %s", commit.ShortHash())
+				break
+			}
+		}
+	}
+}
+
+// uncredited splits the user's commits into those that were not credited to
+// them yet and those that were.
+func (c *Creditor) uncredited(userKey string, commits []Commit) (uncredited, credited []Commit, err error) {
+	for _, commit := range commits {
+		rec, err := c.opts.Store.Get(commitKey(userKey, commit))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "checking whether commits were credited")
+		}
+		if rec != nil {
+			credited = append(credited, commit)
+		} else {
+			uncredited = append(uncredited, commit)
+		}
+	}
+	return uncredited, credited, nil
+}
+
+// findUser returns the Bonusly user with the commit email, or nil if there
+// is no such user who can receive bonuses. Users are looked up by email and,
+// failing that, by searching for the email.
+func (c *Creditor) findUser(ctx context.Context, email string) (*bonusly.UserInfoResponse, error) {
+	email = strings.ToLower(email)
+	if alias, ok := c.opts.Aliases[email]; ok {
+		email = strings.ToLower(alias)
+	}
+	if u, ok := c.users[email]; ok {
+		return u, nil
+	}
+
+	users, err := c.client.ListUsers(ctx, bonusly.ListUsersRequest{Email: email, Limit: 1})
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding user with email '%s'", email)
+	}
+	if len(users) == 0 {
+		if users, err = c.client.AutocompleteUsers(ctx, email); err != nil {
+			return nil, errors.Wrapf(err, "searching for user with email '%s'", email)
+		}
+	}
+	var found *bonusly.UserInfoResponse
+	for i := range users {
+		u := users[i]
+		if strings.ToLower(ptr.String(u.Email)) != email {
+			continue
+		}
+		if u.CanReceive != nil && !*u.CanReceive {
+			continue
+		}
+		if status := ptr.String(u.Status); status != "" && status != "active" {
+			continue
+		}
+		found = &u
+		break
+	}
+	c.users[email] = found
+	return found, nil
+}
+
+// request returns the request to give the proposed bonus.
+func (c *Creditor) request(p Proposal) (bonusly.CreateBonusRequest, error) {
+	username := ptr.String(p.User.UserName)
+	if username == "" {
+		return bonusly.CreateBonusRequest{}, errors.Errorf("user '%s' has no username to mention", analytics.UserKey(&p.User))
+	}
+	data := TemplateData{
+		Amount:      p.Amount,
+		Username:    username,
+		FirstName:   ptr.String(p.User.FirstName),
+		DisplayName: ptr.String(p.User.DisplayName),
+		Email:       ptr.String(p.User.Email),
+		Commits:     p.Commits,
+		Summary:     summary(p.Commits, c.opts.MaxCommitsInReason),
+	}
+	var buf bytes.Buffer
+	if err := c.tmpl.Execute(&buf, data); err != nil {
+		return bonusly.CreateBonusRequest{}, errors.Wrapf(err, "executing template for '%s'", username)
+	}
+	return bonusly.CreateBonusRequest{
+		GiverEmail:     c.opts.GiverEmail,
+		Reason:         strings.TrimSpace(buf.String()),
+		IdempotencyKey: p.Key,
+	}, nil
+}
+
+// summary references the first max commits and counts the rest.
+func summary(commits []Commit, max int) string {
+	var refs []string
+	for i, commit := range commits {
+		if i == max {
+			refs = append(refs, fmt.Sprintf("and %d more", len(commits)-max))
+			break
+		}
+		refs = append(refs, fmt.Sprintf("%s %s", commit.ShortHash(), commit.Subject))
+	}
+	return strings.Join(refs, "; ")
+}
+
+// commitKey identifies a commit credited to the user.
+func commitKey(userKey string, commit Commit) string {
+	return fmt.Sprintf("git:%s:commit:%s", userKey, commit.Hash)
+}
+
+// proposalKey identifies the user and the set of commits.
+func proposalKey(userKey string, commits []Commit) string {
+	hashes := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		hashes = append(hashes, commit.Hash)
+	}
+	sort.Strings(hashes)
+	sum := sha256.Sum256([]byte(strings.Join(hashes, ",")))
+	return fmt.Sprintf("git:%s:%s", userKey, hex.EncodeToString(sum[:8]))
+}
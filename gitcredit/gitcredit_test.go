@@ -0,0 +1,274 @@
+package gitcredit
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	*bonusly.MockClient
+	users    []bonusly.UserInfoResponse
+	searches []string
+}
+
+func (c *fakeClient) ListUsers(_ context.Context, req bonusly.ListUsersRequest) ([]bonusly.UserInfoResponse, error) {
+	for _, u := range c.users {
+		if *u.Email == req.Email {
+			return []bonusly.UserInfoResponse{u}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeClient) AutocompleteUsers(_ context.Context, search string) ([]bonusly.UserInfoResponse, error) {
+	c.searches = append(c.searches, search)
+	var users []bonusly.UserInfoResponse
+	for _, u := range c.users {
+		if strings.Contains(strings.ToLower(*u.Email), search) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (c *fakeClient) MyUserInfo(context.Context) (*bonusly.UserInfoResponse, error) {
+	return &bonusly.UserInfoResponse{Email: ptr.NewString("me@example.com")}, nil
+}
+
+func user(username string) bonusly.UserInfoResponse {
+	return bonusly.UserInfoResponse{
+		UserName: ptr.NewString(username),
+		Email:    ptr.NewString(username + "@example.com"),
+	}
+}
+
+func commit(hash, subject string, author Person, coAuthors ...Person) Commit {
+	return Commit{Hash: hash, Author: author, CoAuthors: coAuthors, Subject: subject}
+}
+
+var (
+	alice = Person{Name: "Alice", Email: "alice@example.com"}
+	bob   = Person{Name: "Bob", Email: "Bob@Example.com"}
+	carol = Person{Name: "Carol", Email: "carol@users.noreply.github.com"}
+	me    = Person{Name: "Me", Email: "me@example.com"}
+	eve   = Person{Name: "Eve", Email: "eve@elsewhere.com"}
+)
+
+func TestParseLog(t *testing.T) {
+	log := "\x1eaaaaaaaaaa\x1fAlice\x1falice@example.com\x1fAdd feature\n\nLonger description.\n\n" +
+		"Co-authored-by: Bob <bob@example.com>\nco-authored-by: Carol Smith <carol@example.com>\n" +
+		"\x1ebbbbbbbbbb\x1fBob\x1fbob@example.com\x1fFix bug\n"
+	commits, err := ParseLog(strings.NewReader(log))
+	require.NoError(t, err)
+	assert.Equal(t, []Commit{
+		{
+			Hash:      "aaaaaaaaaa",
+			Author:    alice,
+			CoAuthors: []Person{{Name: "Bob", Email: "bob@example.com"}, {Name: "Carol Smith", Email: "carol@example.com"}},
+			Subject:   "Add feature",
+		},
+		{Hash: "bbbbbbbbbb", Author: Person{Name: "Bob", Email: "bob@example.com"}, Subject: "Fix bug"},
+	}, commits)
+	assert.Equal(t, "aaaaaaa", commits[0].ShortHash())
+
+	_, err = ParseLog(strings.NewReader("\x1enot a commit"))
+	assert.Error(t, err)
+}
+
+func TestReadLog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitcredit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Alice", "GIT_AUTHOR_EMAIL=alice@example.com",
+			"GIT_COMMITTER_NAME=Alice", "GIT_COMMITTER_EMAIL=alice@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "First")
+	git("tag", "v1")
+	git("commit", "-q", "--allow-empty", "-m", "Second\n\nCo-authored-by: Bob <bob@example.com>")
+
+	commits, err := ReadLog(context.Background(), dir, "v1..HEAD")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "Second", commits[0].Subject)
+	assert.Equal(t, alice, commits[0].Author)
+	assert.Equal(t, []Person{{Name: "Bob", Email: "bob@example.com"}}, commits[0].CoAuthors)
+
+	commits, err = ReadLog(context.Background(), dir, "")
+	require.NoError(t, err)
+	assert.Len(t, commits, 2)
+
+	_, err = ReadLog(context.Background(), dir, "nonexistent..HEAD")
+	assert.Error(t, err)
+}
+
+func TestCreditor(t *testing.T) {
+	users := func() []bonusly.UserInfoResponse {
+		inactive := user("dave")
+		inactive.Status = ptr.NewString("archived")
+		noReceive := user("eve")
+		noReceive.CanReceive = ptr.NewBool(false)
+		return []bonusly.UserInfoResponse{user("alice"), user("bob"), user("carol"), user("me"), inactive, noReceive}
+	}
+	commits := []Commit{
+		commit("1111111111", "Add feature", alice, bob, alice),
+		commit("2222222222", "Fix bug", bob, me),
+		commit("3333333333", "Write docs", carol, eve, Person{Name: "Dave", Email: "dave@example.com"}),
+		commit("4444444444", "Refactor", alice),
+		commit("5555555555", "Test", alice),
+		commit("6666666666", "Release", alice),
+	}
+
+	t.Run("ProposesCappedBonusesPerPerson", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: users()}
+		c, err := New(client, Options{
+			AmountPerCommit: 2,
+			MaxAmount:       6,
+			Aliases:         map[string]string{"Carol@users.noreply.github.com": "carol@example.com"},
+		})
+		require.NoError(t, err)
+
+		plan, err := c.Plan(context.Background(), commits)
+		require.NoError(t, err)
+		require.Len(t, plan.Proposals, 3)
+
+		assert.Equal(t, "alice@example.com", *plan.Proposals[0].User.Email)
+		assert.Equal(t, 6, plan.Proposals[0].Amount, "should cap the amount")
+		assert.Len(t, plan.Proposals[0].Commits, 4)
+		assert.Equal(t, "+6 @alice thanks for your 4 commits: 1111111 Add feature; 4444444 Refactor; 5555555 Test; and 1 more #shipit",
+			plan.Proposals[0].Request.Reason)
+		assert.Equal(t, plan.Proposals[0].Key, plan.Proposals[0].Request.IdempotencyKey)
+
+		assert.Equal(t, "bob@example.com", *plan.Proposals[1].User.Email)
+		assert.Equal(t, 4, plan.Proposals[1].Amount)
+		assert.Equal(t, "carol@example.com", *plan.Proposals[2].User.Email)
+		assert.Equal(t, "+2 @carol thanks for your 1 commit: 3333333 Write docs #shipit", plan.Proposals[2].Request.Reason)
+
+		assert.Equal(t, []Unmatched{
+			{Person: Person{Name: "Dave", Email: "dave@example.com"}, Commits: 1},
+			{Person: eve, Commits: 1},
+		}, plan.Unmatched)
+		assert.Contains(t, client.searches, "eve@elsewhere.com", "should search for emails that are not found")
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+	t.Run("AppliesProposalsOnce", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: users()}
+		store := bonusly.NewMemoryIdempotencyStore()
+		c, err := New(client, Options{GiverEmail: "alice@example.com", Store: store})
+		require.NoError(t, err)
+
+		plan, err := c.Plan(context.Background(), commits)
+		require.NoError(t, err)
+		require.Len(t, plan.Proposals, 2, "should not propose bonuses to the giver")
+		for _, p := range plan.Proposals {
+			assert.NotEqual(t, "alice@example.com", *p.User.Email)
+			assert.Equal(t, "alice@example.com", p.Request.GiverEmail)
+		}
+		c.Apply(context.Background(), plan)
+		for _, p := range plan.Proposals {
+			assert.NoError(t, p.Err)
+			assert.NotNil(t, p.Bonus)
+		}
+		assert.Len(t, client.CreateBonusRequests, 2)
+
+		plan, err = c.Plan(context.Background(), commits)
+		require.NoError(t, err)
+		for _, p := range plan.Proposals {
+			assert.True(t, p.Skipped)
+		}
+		c.Apply(context.Background(), plan)
+		assert.Len(t, client.CreateBonusRequests, 2, "should not credit the same commits twice")
+	})
+	t.Run("DoesNotCreditCommitsAgainInOverlappingRanges", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: users()}
+		c, err := New(client, Options{
+			GiverEmail: "me@example.com",
+			Aliases:    map[string]string{"carol@users.noreply.github.com": "carol@example.com"},
+		})
+		require.NoError(t, err)
+
+		plan, err := c.Plan(context.Background(), commits[:2])
+		require.NoError(t, err)
+		c.Apply(context.Background(), plan)
+		require.Len(t, client.CreateBonusRequests, 2)
+
+		plan, err = c.Plan(context.Background(), commits)
+		require.NoError(t, err)
+		byEmail := map[string]Proposal{}
+		for _, p := range plan.Proposals {
+			byEmail[*p.User.Email] = p
+		}
+		require.Len(t, byEmail, 3)
+
+		alice := byEmail["alice@example.com"]
+		assert.False(t, alice.Skipped)
+		assert.Equal(t, 3, alice.Amount, "should only credit new commits")
+		assert.Len(t, alice.Commits, 3)
+		require.Len(t, alice.Credited, 1)
+		assert.Equal(t, "1111111111", alice.Credited[0].Hash)
+		assert.True(t, byEmail["bob@example.com"].Skipped, "should skip people whose commits were all credited")
+		assert.Len(t, byEmail["bob@example.com"].Credited, 2)
+		assert.Equal(t, 1, byEmail["carol@example.com"].Amount)
+
+		c.Apply(context.Background(), plan)
+		assert.Len(t, client.CreateBonusRequests, 4)
+		for _, req := range client.CreateBonusRequests[2:] {
+			assert.NotContains(t, req.Reason, "@bob")
+			assert.NotContains(t, req.Reason, "Add feature")
+		}
+	})
+	t.Run("ReportsFailures", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{CreateBonusError: errors.New("insufficient balance")}, users: users()}
+		c, err := New(client, Options{})
+		require.NoError(t, err)
+
+		plan, err := c.Plan(context.Background(), commits[:1])
+		require.NoError(t, err)
+		c.Apply(context.Background(), plan)
+		require.Len(t, plan.Proposals, 2)
+		for _, p := range plan.Proposals {
+			assert.Error(t, p.Err)
+		}
+	})
+	t.Run("ReportsProposalsNotGivenWhenCancelled", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: users()}
+		c, err := New(client, Options{})
+		require.NoError(t, err)
+
+		plan, err := c.Plan(context.Background(), commits[:1])
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c.Apply(ctx, plan)
+		require.Len(t, plan.Proposals, 2)
+		for _, p := range plan.Proposals {
+			assert.Equal(t, context.Canceled, p.Err)
+			assert.Nil(t, p.Bonus)
+		}
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+	t.Run("RejectsInvalidOptions", func(t *testing.T) {
+		_, err := New(&fakeClient{MockClient: &bonusly.MockClient{}}, Options{MaxAmount: -1})
+		assert.Error(t, err)
+		_, err = New(&fakeClient{MockClient: &bonusly.MockClient{}}, Options{Template: "{{"})
+		assert.Error(t, err)
+	})
+}
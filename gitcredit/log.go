@@ -0,0 +1,117 @@
+package gitcredit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Person is a commit author or co-author.
+type Person struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Commit is a commit read from the git log.
+type Commit struct {
+	Hash      string   `json:"hash"`
+	Author    Person   `json:"author"`
+	CoAuthors []Person `json:"co_authors,omitempty"`
+	Subject   string   `json:"subject"`
+}
+
+// ShortHash returns the abbreviated commit hash.
+func (c Commit) ShortHash() string {
+	if len(c.Hash) > 7 {
+		return c.Hash[:7]
+	}
+	return c.Hash
+}
+
+// People returns the author and co-authors of the commit, without duplicate
+// emails.
+func (c Commit) People() []Person {
+	seen := map[string]bool{}
+	var people []Person
+	for _, p := range append([]Person{c.Author}, c.CoAuthors...) {
+		email := strings.ToLower(p.Email)
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		people = append(people, p)
+	}
+	return people
+}
+
+const (
+	recordSeparator = "\x1e"
+	fieldSeparator  = "\x1f"
+	logFormat       = "--format=" + recordSeparator + "%H" + fieldSeparator + "%an" + fieldSeparator + "%ae" + fieldSeparator + "%B"
+)
+
+// ReadLog reads the non-merge commits of the revision range, such as
+// "v1.0..HEAD", from the git repository in the directory. An empty range
+// reads the history of HEAD.
+func ReadLog(ctx context.Context, dir, revRange string) ([]Commit, error) {
+	args := []string{"-C", dir, "log", "--no-merges", logFormat}
+	if revRange != "" {
+		args = append(args, revRange, "--")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running git log: %s", strings.TrimSpace(stderr.String()))
+	}
+	return ParseLog(bytes.NewReader(out))
+}
+
+// ParseLog parses the output of git log in the format used by ReadLog.
+func ParseLog(r io.Reader) ([]Commit, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading git log")
+	}
+	var commits []Commit
+	for _, record := range strings.Split(string(b), recordSeparator) {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		fields := strings.SplitN(record, fieldSeparator, 4)
+		if len(fields) != 4 {
+			return nil, errors.Errorf("malformed git log record '%s'", strings.TrimSpace(record))
+		}
+		message := strings.TrimSpace(fields[3])
+		subject := message
+		if i := strings.IndexByte(message, '\n'); i >= 0 {
+			subject = message[:i]
+		}
+		commits = append(commits, Commit{
+			Hash:      strings.TrimSpace(fields[0]),
+			Author:    Person{Name: fields[1], Email: fields[2]},
+			CoAuthors: coAuthors(message),
+			Subject:   strings.TrimSpace(subject),
+		})
+	}
+	return commits, nil
+}
+
+var coAuthorTrailer = regexp.MustCompile(`(?im)^co-authored-by:\s*(.*?)\s*<([^<>\s]+)>\s*$`)
+
+// coAuthors returns the people in the Co-authored-by trailers of the commit
+// message.
+func coAuthors(message string) []Person {
+	var people []Person
+	for _, m := range coAuthorTrailer.FindAllStringSubmatch(message, -1) {
+		people = append(people, Person{Name: m[1], Email: m[2]})
+	}
+	return people
+}
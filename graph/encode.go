@@ -0,0 +1,187 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is a file format to write the graph in.
+type Format string
+
+const (
+	// FormatGraphML is GraphML, which can be opened by tools such as Gephi
+	// and yEd.
+	FormatGraphML Format = "graphml"
+	// FormatDOT is the Graphviz DOT language.
+	FormatDOT Format = "dot"
+	// FormatJSON is JSON containing the nodes, edges and metrics.
+	FormatJSON Format = "json"
+)
+
+// Validate checks that the format is supported.
+func (f Format) Validate() error {
+	switch f {
+	case FormatGraphML, FormatDOT, FormatJSON:
+		return nil
+	default:
+		return errors.Errorf("unsupported format '%s'", f)
+	}
+}
+
+// Write writes the graph in the format.
+func (g *Graph) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatJSON:
+		return g.WriteJSON(w)
+	default:
+		return errors.Errorf("unsupported format '%s'", format)
+	}
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph as GraphML, with the label and team of each
+// node and the weight and count of each edge as attributes.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "team", For: "node", Name: "team", Type: "string"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "int"},
+			{ID: "count", For: "edge", Name: "count", Type: "int"},
+		},
+		Graph: graphMLGraph{ID: "recognition", EdgeDefault: "directed"},
+	}
+	for _, n := range g.Nodes() {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{{Key: "label", Value: n.Label}}}
+		if n.Team != "" {
+			node.Data = append(node.Data, graphMLData{Key: "team", Value: n.Team})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range g.Edges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.From,
+			Target: e.To,
+			Data: []graphMLData{
+				{Key: "weight", Value: strconv.Itoa(e.Weight)},
+				{Key: "count", Value: strconv.Itoa(e.Count)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.WithStack(err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return errors.Wrap(err, "encoding GraphML")
+	}
+	_, err := io.WriteString(w, "\n")
+	return errors.WithStack(err)
+}
+
+// WriteDOT writes the graph in the DOT language. People are clustered by team
+// and edges are labeled and sized by weight.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph recognition {")
+
+	teams := map[string][]Node{}
+	var teamOrder []string
+	for _, n := range g.Nodes() {
+		if _, ok := teams[n.Team]; !ok {
+			teamOrder = append(teamOrder, n.Team)
+		}
+		teams[n.Team] = append(teams[n.Team], n)
+	}
+	for i, team := range teamOrder {
+		indent := "  "
+		if team != "" {
+			fmt.Fprintf(bw, "  subgraph cluster_%d {\n    label=%s;\n", i, dotQuote(team))
+			indent = "    "
+		}
+		for _, n := range teams[team] {
+			fmt.Fprintf(bw, "%s%s [label=%s];\n", indent, dotQuote(n.ID), dotQuote(n.Label))
+		}
+		if team != "" {
+			fmt.Fprintln(bw, "  }")
+		}
+	}
+
+	for _, e := range g.Edges() {
+		fmt.Fprintf(bw, "  %s -> %s [weight=%d, label=\"%d\", penwidth=%.2f];\n",
+			dotQuote(e.From), dotQuote(e.To), e.Weight, e.Weight, 1+float64(e.Count)/2)
+	}
+	fmt.Fprintln(bw, "}")
+	return errors.WithStack(bw.Flush())
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+type graphJSON struct {
+	Nodes   []Node  `json:"nodes"`
+	Edges   []Edge  `json:"edges"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// WriteJSON writes the nodes, edges and metrics of the graph as JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return errors.Wrap(enc.Encode(graphJSON{
+		Nodes:   g.Nodes(),
+		Edges:   g.Edges(),
+		Metrics: g.Metrics(),
+	}), "encoding JSON")
+}
@@ -0,0 +1,128 @@
+// Package graph builds a directed graph of who recognizes whom from bonuses,
+// where each edge from a giver to a receiver is weighted by the amount given,
+// and analyzes how recognition flows between people and teams.
+package graph
+
+import (
+	"sort"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+)
+
+// Node is a person in the graph.
+type Node struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Team is the person's team, or empty if the graph does not have teams or
+	// the person's team is not known.
+	Team string `json:"team,omitempty"`
+}
+
+// Edge is the recognition given by one person to another.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Weight is the total amount given.
+	Weight int `json:"weight"`
+	// Count is the number of bonuses given.
+	Count int `json:"count"`
+}
+
+type edgeKey struct {
+	from, to string
+}
+
+// Graph is a directed weighted recognition graph.
+type Graph struct {
+	teamBy analytics.GroupBy
+	nodes  map[string]*Node
+	edges  map[edgeKey]*Edge
+}
+
+// New returns an empty graph. If teamBy is not nil, it determines the team
+// of each person.
+func New(teamBy analytics.GroupBy) *Graph {
+	return &Graph{
+		teamBy: teamBy,
+		nodes:  map[string]*Node{},
+		edges:  map[edgeKey]*Edge{},
+	}
+}
+
+// AddUser adds a person who may not have given or received any bonuses, so
+// that people without any recognition are included.
+func (g *Graph) AddUser(u bonusly.UserInfoResponse) {
+	g.node(&u)
+}
+
+// Add adds an edge for the bonus and its child bonuses. Bonuses without both a
+// giver and a receiver, or given to oneself, are ignored.
+func (g *Graph) Add(b bonusly.BonusResponse) {
+	from := g.node(b.Giver)
+	to := g.node(b.Receiver)
+	if from != "" && to != "" && from != to {
+		key := edgeKey{from: from, to: to}
+		e, ok := g.edges[key]
+		if !ok {
+			e = &Edge{From: from, To: to}
+			g.edges[key] = e
+		}
+		if b.Amount != nil {
+			e.Weight += *b.Amount
+		}
+		e.Count++
+	}
+
+	for _, child := range b.ChildBonuses {
+		g.Add(child)
+	}
+}
+
+// node adds or updates the node for the user and returns its ID, or an empty
+// string if the user cannot be identified.
+func (g *Graph) node(u *bonusly.UserInfoResponse) string {
+	id := analytics.UserKey(u)
+	if id == "" {
+		return ""
+	}
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &Node{ID: id, Label: id}
+		g.nodes[id] = n
+	}
+	if u.DisplayName != nil && *u.DisplayName != "" {
+		n.Label = *u.DisplayName
+	}
+	if g.teamBy != nil {
+		if team := g.teamBy(u); team != "" {
+			n.Team = team
+		}
+	}
+	return id
+}
+
+// Nodes returns the people in the graph sorted by ID.
+func (g *Graph) Nodes() []Node {
+	nodes := make([]Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Edges returns the edges in the graph sorted by giver and then receiver.
+func (g *Graph) Edges() []Edge {
+	edges := make([]Edge, 0, len(g.edges))
+	for _, e := range g.edges {
+		edges = append(edges, *e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
@@ -0,0 +1,127 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func user(email, department string) *bonusly.UserInfoResponse {
+	return &bonusly.UserInfoResponse{Email: ptr.NewString(email), Department: ptr.NewString(department)}
+}
+
+func bonus(giver, receiver *bonusly.UserInfoResponse, amount int) bonusly.BonusResponse {
+	return bonusly.BonusResponse{Giver: giver, Receiver: receiver, Amount: ptr.NewInt(amount)}
+}
+
+func newTestGraph() *Graph {
+	alice := user("alice", "eng")
+	alice.DisplayName = ptr.NewString("Alice")
+	bob := user("bob", "eng")
+	carol := user("carol", "sales")
+	dave := user("dave", "sales")
+
+	g := New(analytics.GroupByDepartment)
+	parent := bonus(alice, bob, 3)
+	parent.ChildBonuses = []bonusly.BonusResponse{bonus(alice, bob, 2)}
+	g.Add(parent)
+	g.Add(bonus(bob, alice, 3))
+	g.Add(bonus(alice, carol, 1))
+	g.Add(bonus(carol, dave, 2))
+	g.Add(bonus(dave, dave, 10))
+	g.AddUser(*user("erin", "support"))
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := newTestGraph()
+
+	nodes := g.Nodes()
+	require.Len(t, nodes, 5)
+	assert.Equal(t, Node{ID: "alice", Label: "Alice", Team: "eng"}, nodes[0])
+
+	assert.Equal(t, []Edge{
+		{From: "alice", To: "bob", Weight: 5, Count: 2},
+		{From: "alice", To: "carol", Weight: 1, Count: 1},
+		{From: "bob", To: "alice", Weight: 3, Count: 1},
+		{From: "carol", To: "dave", Weight: 2, Count: 1},
+	}, g.Edges(), "should merge repeated bonuses and ignore self-recognition")
+}
+
+func TestMetrics(t *testing.T) {
+	m := newTestGraph().Metrics()
+
+	assert.Equal(t, 5, m.Nodes)
+	assert.Equal(t, 4, m.Edges)
+	assert.Equal(t, 0.5, m.Reciprocity)
+	assert.Equal(t, 0.25, m.CrossTeamEdgeRatio)
+	assert.InDelta(t, 1.0/11, m.CrossTeamWeightRatio, 1e-9)
+	assert.Equal(t, []string{"erin"}, m.Isolated)
+
+	require.Len(t, m.Centrality, 5)
+	byID := map[string]Centrality{}
+	var totalRank float64
+	for _, c := range m.Centrality {
+		byID[c.ID] = c
+		totalRank += c.PageRank
+	}
+	assert.InDelta(t, 1, totalRank, 1e-6)
+	assert.Equal(t, 2, byID["alice"].OutDegree)
+	assert.Equal(t, 6, byID["alice"].OutWeight)
+	assert.Equal(t, 1, byID["alice"].InDegree)
+	assert.InDelta(t, 1.0/6, byID["alice"].Betweenness, 1e-9)
+	assert.InDelta(t, 1.0/6, byID["carol"].Betweenness, 1e-9)
+	assert.Zero(t, byID["bob"].Betweenness)
+	assert.Greater(t, byID["dave"].PageRank, byID["erin"].PageRank)
+	for i := 1; i < len(m.Centrality); i++ {
+		assert.GreaterOrEqual(t, m.Centrality[i-1].PageRank, m.Centrality[i].PageRank, "should be sorted by PageRank")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	g := newTestGraph()
+
+	t.Run("GraphML", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, g.Write(&buf, FormatGraphML))
+
+		var doc graphML
+		require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+		assert.Equal(t, "directed", doc.Graph.EdgeDefault)
+		assert.Len(t, doc.Graph.Nodes, 5)
+		require.Len(t, doc.Graph.Edges, 4)
+		assert.Equal(t, graphMLEdge{
+			Source: "alice",
+			Target: "bob",
+			Data:   []graphMLData{{Key: "weight", Value: "5"}, {Key: "count", Value: "2"}},
+		}, doc.Graph.Edges[0])
+	})
+	t.Run("DOT", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, g.Write(&buf, FormatDOT))
+		dot := buf.String()
+		assert.Contains(t, dot, "digraph recognition {")
+		assert.Contains(t, dot, `label="eng";`)
+		assert.Contains(t, dot, `"alice" [label="Alice"];`)
+		assert.Contains(t, dot, `"alice" -> "bob" [weight=5, label="5", penwidth=2.00];`)
+	})
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, g.Write(&buf, FormatJSON))
+		var doc graphJSON
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+		assert.Len(t, doc.Nodes, 5)
+		assert.Len(t, doc.Edges, 4)
+		assert.Equal(t, []string{"erin"}, doc.Metrics.Isolated)
+	})
+	t.Run("FailsWithUnsupportedFormat", func(t *testing.T) {
+		assert.Error(t, g.Write(&bytes.Buffer{}, "png"))
+	})
+}
@@ -0,0 +1,244 @@
+package graph
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// pageRankDamping is the probability of following an edge rather than
+	// jumping to a random person.
+	pageRankDamping = 0.85
+	// pageRankIterations is the maximum number of PageRank iterations.
+	pageRankIterations = 100
+	// pageRankTolerance is the total change in ranks below which PageRank has
+	// converged.
+	pageRankTolerance = 1e-9
+)
+
+// Centrality is how central a person is to the flow of recognition.
+type Centrality struct {
+	ID string `json:"id"`
+	// InDegree and OutDegree are the number of distinct people the person
+	// received from and gave to.
+	InDegree  int `json:"in_degree"`
+	OutDegree int `json:"out_degree"`
+	// InWeight and OutWeight are the total amounts received and given.
+	InWeight  int `json:"in_weight"`
+	OutWeight int `json:"out_weight"`
+	// PageRank is the weighted PageRank, which is higher for people who are
+	// recognized by people who are themselves recognized a lot. The ranks of
+	// all people sum to 1.
+	PageRank float64 `json:"page_rank"`
+	// Betweenness is the normalized betweenness centrality, which is the
+	// fraction of shortest paths between other people that go through the
+	// person.
+	Betweenness float64 `json:"betweenness"`
+}
+
+// Metrics summarizes the structure of the graph.
+type Metrics struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// Reciprocity is the fraction of edges whose receiver also gave to the
+	// giver.
+	Reciprocity float64 `json:"reciprocity"`
+	// CrossTeamEdgeRatio is the fraction of edges between people whose teams
+	// are both known that go between different teams, and
+	// CrossTeamWeightRatio is the same fraction of the total weight.
+	CrossTeamEdgeRatio   float64 `json:"cross_team_edge_ratio"`
+	CrossTeamWeightRatio float64 `json:"cross_team_weight_ratio"`
+	// Isolated are the people who neither gave nor received any bonuses.
+	Isolated []string `json:"isolated"`
+	// Centrality is the centrality of each person, most central by PageRank
+	// first.
+	Centrality []Centrality `json:"centrality"`
+}
+
+// Metrics computes the metrics of the graph.
+func (g *Graph) Metrics() Metrics {
+	nodes := g.Nodes()
+	edges := g.Edges()
+	m := Metrics{
+		Nodes:    len(nodes),
+		Edges:    len(edges),
+		Isolated: []string{},
+	}
+
+	var reciprocated, teamEdges, crossTeamEdges, teamWeight, crossTeamWeight int
+	for _, e := range edges {
+		if _, ok := g.edges[edgeKey{from: e.To, to: e.From}]; ok {
+			reciprocated++
+		}
+		fromTeam, toTeam := g.nodes[e.From].Team, g.nodes[e.To].Team
+		if fromTeam == "" || toTeam == "" {
+			continue
+		}
+		teamEdges++
+		teamWeight += e.Weight
+		if fromTeam != toTeam {
+			crossTeamEdges++
+			crossTeamWeight += e.Weight
+		}
+	}
+	m.Reciprocity = ratio(reciprocated, len(edges))
+	m.CrossTeamEdgeRatio = ratio(crossTeamEdges, teamEdges)
+	m.CrossTeamWeightRatio = ratio(crossTeamWeight, teamWeight)
+
+	index := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		index[n.ID] = i
+	}
+	centrality := make([]Centrality, len(nodes))
+	for i, n := range nodes {
+		centrality[i].ID = n.ID
+	}
+	for _, e := range edges {
+		from, to := index[e.From], index[e.To]
+		centrality[from].OutDegree++
+		centrality[from].OutWeight += e.Weight
+		centrality[to].InDegree++
+		centrality[to].InWeight += e.Weight
+	}
+	for _, c := range centrality {
+		if c.InDegree == 0 && c.OutDegree == 0 {
+			m.Isolated = append(m.Isolated, c.ID)
+		}
+	}
+
+	out := adjacency(edges, index, len(nodes))
+	for i, rank := range pageRank(out, centrality) {
+		centrality[i].PageRank = rank
+	}
+	for i, b := range betweenness(out) {
+		centrality[i].Betweenness = b
+	}
+	sort.SliceStable(centrality, func(i, j int) bool {
+		return centrality[i].PageRank > centrality[j].PageRank
+	})
+	m.Centrality = centrality
+
+	return m
+}
+
+type weightedEdge struct {
+	to     int
+	weight int
+}
+
+// adjacency returns the outgoing edges of each node by index.
+func adjacency(edges []Edge, index map[string]int, n int) [][]weightedEdge {
+	out := make([][]weightedEdge, n)
+	for _, e := range edges {
+		from := index[e.From]
+		out[from] = append(out[from], weightedEdge{to: index[e.To], weight: e.Weight})
+	}
+	return out
+}
+
+// pageRank computes the weighted PageRank of each node. The rank of nodes
+// without outgoing weight is spread evenly over all nodes.
+func pageRank(out [][]weightedEdge, centrality []Centrality) []float64 {
+	n := len(out)
+	ranks := make([]float64, n)
+	if n == 0 {
+		return ranks
+	}
+	for i := range ranks {
+		ranks[i] = 1 / float64(n)
+	}
+
+	next := make([]float64, n)
+	for iter := 0; iter < pageRankIterations; iter++ {
+		var dangling float64
+		for i := range out {
+			if centrality[i].OutWeight == 0 {
+				dangling += ranks[i]
+			}
+		}
+		base := (1-pageRankDamping)/float64(n) + pageRankDamping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, edges := range out {
+			if centrality[i].OutWeight == 0 {
+				continue
+			}
+			for _, e := range edges {
+				next[e.to] += pageRankDamping * ranks[i] * float64(e.weight) / float64(centrality[i].OutWeight)
+			}
+		}
+
+		var delta float64
+		for i := range ranks {
+			delta += math.Abs(next[i] - ranks[i])
+		}
+		ranks, next = next, ranks
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return ranks
+}
+
+// betweenness computes the normalized betweenness centrality of each node
+// using Brandes' algorithm, treating edges as unweighted.
+func betweenness(out [][]weightedEdge) []float64 {
+	n := len(out)
+	centrality := make([]float64, n)
+	for s := 0; s < n; s++ {
+		var stack []int
+		preds := make([][]int, n)
+		paths := make([]float64, n)
+		dist := make([]int, n)
+		for i := range dist {
+			dist[i] = -1
+		}
+		paths[s] = 1
+		dist[s] = 0
+
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, e := range out[v] {
+				w := e.to
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					paths[w] += paths[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		dependency := make([]float64, n)
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				dependency[v] += paths[v] / paths[w] * (1 + dependency[w])
+			}
+			if w != s {
+				centrality[w] += dependency[w]
+			}
+		}
+	}
+
+	if n > 2 {
+		norm := float64((n - 1) * (n - 2))
+		for i := range centrality {
+			centrality[i] /= norm
+		}
+	}
+	return centrality
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
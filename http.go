@@ -1,6 +1,7 @@
 package bonusly
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
@@ -160,7 +161,7 @@ func getHTTPRetryableClient(conf httpRetryConfiguration) *http.Client {
 		}))
 	}
 
-	retryFns := []rehttp.RetryFn{rehttp.RetryAny(statusRetries...)}
+	retryFns := []rehttp.RetryFn{rehttp.RetryAny(statusRetries...), retriesAllowed}
 
 	if len(conf.Methods) > 0 {
 		retryFns = append(retryFns, rehttp.RetryHTTPMethods(conf.Methods...))
@@ -177,6 +178,22 @@ func getHTTPRetryableClient(conf httpRetryConfiguration) *http.Client {
 	return client
 }
 
+type noRetriesKey struct{}
+
+// withoutRetries returns a context in which requests are not retried by
+// retryable clients. This is needed for requests that are not safe to repeat
+// blindly, such as creating a bonus with an idempotency key, which must check
+// whether a failed attempt succeeded before trying again.
+func withoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetriesKey{}, true)
+}
+
+// retriesAllowed returns whether the attempt's request may be retried.
+func retriesAllowed(attempt rehttp.Attempt) bool {
+	noRetries, _ := attempt.Request.Context().Value(noRetriesKey{}).(bool)
+	return !noRetries
+}
+
 // getDefaultHTTPRetryableClient provides a retryable client with the default
 // settings. Couple calls to getDefaultHTTPRetryableClient, with defered calls
 // to putHTTPClient.
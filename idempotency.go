@@ -0,0 +1,306 @@
+package bonusly
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/internal/fileutil"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+const (
+	// idempotentCreateAttempts is the maximum number of times to attempt to
+	// create a bonus with an idempotency key when the outcome of the previous
+	// attempt is unknown.
+	idempotentCreateAttempts = 3
+	// idempotentSearchSkew is how far before an attempt to create a bonus to
+	// search for it, to allow for clock differences with the server.
+	idempotentSearchSkew = 5 * time.Minute
+	// idempotentSearchLimit is the maximum number of recent bonuses from the
+	// giver to check for a match.
+	idempotentSearchLimit = 50
+)
+
+// IdempotencyRecord is the recorded outcome of creating a bonus with an
+// idempotency key.
+type IdempotencyRecord struct {
+	Request   CreateBonusRequest `json:"request"`
+	Response  BonusResponse      `json:"response"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// IdempotencyStore records the bonuses that were created for idempotency
+// keys.
+type IdempotencyStore interface {
+	// Get returns the record for the key, or nil if there is none.
+	Get(key string) (*IdempotencyRecord, error)
+	// Put records the outcome for the key.
+	Put(key string, rec IdempotencyRecord) error
+}
+
+type memoryIdempotencyStore struct {
+	records map[string]IdempotencyRecord
+	mu      sync.RWMutex
+}
+
+// NewMemoryIdempotencyStore returns an idempotency store that keeps records
+// in memory for the lifetime of the process.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *memoryIdempotencyStore) Put(key string, rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = rec
+	return nil
+}
+
+// idempotencyStoreLockTimeout is how long to wait for another process to
+// release the file idempotency store.
+const idempotencyStoreLockTimeout = 10 * time.Second
+
+type fileIdempotencyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileIdempotencyStore returns an idempotency store that persists records
+// as JSON in the file at the given path, so that they are kept across
+// processes. The file is read again on every lookup, and records are merged
+// into it while holding a lock file next to it, so several processes can
+// share the store without overwriting each other's records.
+func NewFileIdempotencyStore(path string) (IdempotencyStore, error) {
+	s := &fileIdempotencyStore{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	records, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *fileIdempotencyStore) Put(key string, rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := fileutil.Lock(s.path, idempotencyStoreLockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "locking idempotency store")
+	}
+	defer unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	records[key] = rec
+	b, err := json.Marshal(records)
+	if err != nil {
+		return errors.Wrap(err, "marshalling idempotency records")
+	}
+	return errors.Wrap(fileutil.WriteAtomic(s.path, b), "writing idempotency store file")
+}
+
+// load reads all the records from the file. The file is always replaced
+// atomically, so it can be read without holding the lock.
+func (s *fileIdempotencyStore) load() (map[string]IdempotencyRecord, error) {
+	records := map[string]IdempotencyRecord{}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading idempotency store file")
+	}
+	if len(b) == 0 {
+		return records, nil
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, errors.Wrap(err, "parsing idempotency store file")
+	}
+	return records, nil
+}
+
+// createBonusIdempotent creates the bonus at most once for its idempotency
+// key. If an attempt fails in a way where the bonus may or may not have been
+// created, it searches the giver's recent bonuses for it before trying again.
+func (c *client) createBonusIdempotent(ctx context.Context, req CreateBonusRequest) (*BonusResponse, error) {
+	unlock := c.keyLocks.lock(req.IdempotencyKey)
+	defer unlock()
+
+	rec, err := c.opts.IdempotencyStore.Get(req.IdempotencyKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting idempotency record")
+	}
+	if rec != nil {
+		if !sameBonusRequest(rec.Request, req) {
+			return nil, errors.Errorf("idempotency key '%s' was already used for a different bonus", req.IdempotencyKey)
+		}
+		return &rec.Response, nil
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < idempotentCreateAttempts; attempt++ {
+		start := time.Now()
+		// Retrying in the transport would create a duplicate if the failed
+		// attempt actually succeeded, so only retry after searching for it.
+		resp, err := c.createBonus(withoutRetries(ctx), req)
+		if err == nil {
+			return resp, c.putIdempotencyRecord(req, resp)
+		}
+		if !isAmbiguousError(err) || ctx.Err() != nil {
+			return nil, errors.WithStack(err)
+		}
+		lastErr = err
+
+		found, err := c.findCreatedBonus(ctx, req, start.Add(-idempotentSearchSkew))
+		if err != nil {
+			return nil, errors.Wrapf(err, "searching for bonus after failed attempt: %s", lastErr.Error())
+		}
+		if found != nil {
+			return found, c.putIdempotencyRecord(req, found)
+		}
+	}
+
+	return nil, errors.Wrapf(lastErr, "creating bonus after %d attempts", idempotentCreateAttempts)
+}
+
+func (c *client) putIdempotencyRecord(req CreateBonusRequest, resp *BonusResponse) error {
+	err := c.opts.IdempotencyStore.Put(req.IdempotencyKey, IdempotencyRecord{
+		Request:   req,
+		Response:  *resp,
+		CreatedAt: time.Now(),
+	})
+	return errors.Wrap(err, "bonus was created but could not record idempotency key")
+}
+
+// findCreatedBonus searches the giver's bonuses created since the given time
+// for one that matches the request. It returns nil if there is no match.
+func (c *client) findCreatedBonus(ctx context.Context, req CreateBonusRequest, since time.Time) (*BonusResponse, error) {
+	giverEmail := req.GiverEmail
+	if giverEmail == "" {
+		info, err := c.MyUserInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting user info")
+		}
+		giverEmail = ptr.String(info.Email)
+	}
+
+	bonuses, err := c.ListBonuses(ctx, ListBonusesRequest{
+		GiverEmail:      giverEmail,
+		StartTime:       since,
+		Limit:           idempotentSearchLimit,
+		IncludeChildren: req.ParentBonusID != "",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing recent bonuses")
+	}
+
+	for _, b := range bonuses {
+		if matchesBonusRequest(b, req) {
+			return &b, nil
+		}
+		for _, child := range b.ChildBonuses {
+			if matchesBonusRequest(child, req) {
+				return &child, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// matchesBonusRequest returns whether the bonus appears to have been created
+// from the request, based on its reason and receiver.
+func matchesBonusRequest(b BonusResponse, req CreateBonusRequest) bool {
+	if strings.TrimSpace(ptr.String(b.Reason)) != strings.TrimSpace(req.Reason) {
+		return false
+	}
+	if b.Receiver == nil || req.ParentBonusID != "" {
+		return true
+	}
+	username := ptr.String(b.Receiver.UserName)
+	return username == "" || strings.Contains(req.Reason, "@"+username)
+}
+
+// sameBonusRequest returns whether the requests would create the same bonus,
+// ignoring their idempotency keys.
+func sameBonusRequest(a, b CreateBonusRequest) bool {
+	a.IdempotencyKey = ""
+	b.IdempotencyKey = ""
+	return a == b
+}
+
+// isAmbiguousError returns whether the error from a request leaves it unknown
+// whether the request was processed by Bonusly, such as a network failure or
+// a server error.
+func isAmbiguousError(err error) bool {
+	respErr, ok := errors.Cause(err).(*ResponseError)
+	if !ok {
+		return true
+	}
+	return respErr.StatusCode >= http.StatusInternalServerError
+}
+
+// keyedMutex provides mutual exclusion for individual keys.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks the given key and returns the function to unlock it.
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = map[string]*keyLock{}
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.waiters++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package bonusly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idempotencyTestServer is a fake Bonusly server that can fail to respond
+// after creating a bonus.
+type idempotencyTestServer struct {
+	mu            sync.Mutex
+	bonuses       []BonusResponse
+	posts         int
+	keysSent      int
+	dropResponses int
+}
+
+func (s *idempotencyTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/users/me":
+		fmt.Fprint(w, `{"success": true, "result": {"email": "me@example.com"}}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/bonuses":
+		b, _ := json.Marshal(bonusesResponseWrapper{CommonResponse: CommonResponse{Success: ptr.NewBool(true)}, Result: s.bonuses})
+		_, _ = w.Write(b)
+	case r.Method == http.MethodPost && r.URL.Path == "/bonuses":
+		var req CreateBonusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.posts++
+		if req.IdempotencyKey != "" {
+			s.keysSent++
+		}
+		bonus := BonusResponse{
+			ID:       ptr.NewString(fmt.Sprintf("bonus%d", s.posts)),
+			Reason:   ptr.NewString(req.Reason),
+			Receiver: &UserInfoResponse{UserName: ptr.NewString("alice")},
+		}
+		s.bonuses = append(s.bonuses, bonus)
+		if s.dropResponses > 0 {
+			s.dropResponses--
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		b, _ := json.Marshal(bonusResponseWrapper{CommonResponse: CommonResponse{Success: ptr.NewBool(true)}, Result: bonus})
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCreateBonusIdempotency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	setup := func(t *testing.T, store IdempotencyStore) (*idempotencyTestServer, Client, func()) {
+		srv := &idempotencyTestServer{}
+		httpSrv := httptest.NewServer(srv)
+		httpClient := getHTTPClient()
+		c, err := NewClient(ClientOptions{
+			AccessToken:      "access_token",
+			HTTPClient:       httpClient,
+			BaseURL:          httpSrv.URL,
+			IdempotencyStore: store,
+		})
+		require.NoError(t, err)
+		return srv, c, func() {
+			assert.NoError(t, c.Close(ctx))
+			putHTTPClient(httpClient)
+			httpSrv.Close()
+		}
+	}
+
+	t.Run("ReturnsOriginalBonusForRepeatedKey", func(t *testing.T) {
+		srv, c, teardown := setup(t, nil)
+		defer teardown()
+
+		req := CreateBonusRequest{Reason: "+1 @alice thanks #teamwork", IdempotencyKey: "key"}
+		first, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		second, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		assert.Equal(t, 1, srv.posts)
+		assert.Zero(t, srv.keysSent, "idempotency key should not be sent to Bonusly")
+	})
+	t.Run("FailsForKeyReusedWithDifferentBonus", func(t *testing.T) {
+		srv, c, teardown := setup(t, nil)
+		defer teardown()
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks #teamwork", IdempotencyKey: "key"})
+		require.NoError(t, err)
+		_, err = c.CreateBonus(ctx, CreateBonusRequest{Reason: "+2 @alice thanks #teamwork", IdempotencyKey: "key"})
+		assert.Error(t, err)
+		assert.Equal(t, 1, srv.posts)
+	})
+	t.Run("FindsBonusCreatedDespiteFailedResponse", func(t *testing.T) {
+		srv, c, teardown := setup(t, nil)
+		defer teardown()
+		srv.dropResponses = 1
+
+		bonus, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks #teamwork", IdempotencyKey: "key"})
+		require.NoError(t, err)
+		assert.Equal(t, "bonus1", ptr.String(bonus.ID))
+		assert.Equal(t, 1, srv.posts)
+	})
+	t.Run("SearchesBeforeRetryingWithDefaultClient", func(t *testing.T) {
+		srv := &idempotencyTestServer{dropResponses: 1}
+		httpSrv := httptest.NewServer(srv)
+		defer httpSrv.Close()
+		c, err := NewClient(ClientOptions{
+			AccessToken: "access_token",
+			BaseURL:     httpSrv.URL,
+		})
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, c.Close(ctx))
+		}()
+
+		bonus, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks #teamwork", IdempotencyKey: "key"})
+		require.NoError(t, err)
+		assert.Equal(t, "bonus1", ptr.String(bonus.ID))
+		assert.Equal(t, 1, srv.posts, "transport should not retry the request before searching for the bonus")
+	})
+	t.Run("CreatesDuplicatesWithoutKey", func(t *testing.T) {
+		srv, c, teardown := setup(t, nil)
+		defer teardown()
+
+		req := CreateBonusRequest{Reason: "+1 @alice thanks #teamwork"}
+		_, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		_, err = c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, 2, srv.posts)
+	})
+	t.Run("FileStorePersistsAcrossClients", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "idempotency")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "keys.json")
+
+		req := CreateBonusRequest{Reason: "+1 @alice thanks #teamwork", IdempotencyKey: "key"}
+
+		store, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		srv, c, teardown := setup(t, store)
+		first, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, 1, srv.posts)
+		teardown()
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"idempotency_key":"key"`, "idempotency key should be recorded with the request")
+
+		store, err = NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		srv, c, teardown = setup(t, store)
+		defer teardown()
+		second, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, ptr.String(first.ID), ptr.String(second.ID))
+		assert.Zero(t, srv.posts)
+	})
+	t.Run("FileStoreMergesRecordsFromOtherProcesses", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "idempotency")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "keys.json")
+
+		first, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		second, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+
+		require.NoError(t, first.Put("first", IdempotencyRecord{Response: BonusResponse{ID: ptr.NewString("bonus1")}}))
+		require.NoError(t, second.Put("second", IdempotencyRecord{Response: BonusResponse{ID: ptr.NewString("bonus2")}}))
+
+		rec, err := second.Get("first")
+		require.NoError(t, err)
+		require.NotNil(t, rec, "should see records put by another store")
+		assert.Equal(t, "bonus1", ptr.String(rec.Response.ID))
+
+		reopened, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		for key, id := range map[string]string{"first": "bonus1", "second": "bonus2"} {
+			rec, err := reopened.Get(key)
+			require.NoError(t, err)
+			require.NotNil(t, rec, "should keep the record for '%s'", key)
+			assert.Equal(t, id, ptr.String(rec.Response.ID))
+		}
+		_, err = os.Stat(path + ".lock")
+		assert.True(t, os.IsNotExist(err), "should remove the lock file")
+	})
+}
@@ -5,6 +5,9 @@ import "context"
 type Client interface {
 	// CreateBonus creates a new bonus.
 	CreateBonus(ctx context.Context, req CreateBonusRequest) (*BonusResponse, error)
+	// CreateBonuses creates many new bonuses concurrently. Each bonus's result
+	// is returned, even if creating some of the bonuses failed.
+	CreateBonuses(ctx context.Context, reqs []CreateBonusRequest, opts BulkOptions) ([]BulkResult, error)
 	// GetBonus gets a bonus by ID.
 	GetBonus(ctx context.Context, id string) (*BonusResponse, error)
 	// ListBonuses finds all bonuses matching the given request parameters.
@@ -17,6 +20,14 @@ type Client interface {
 	ListRewards(ctx context.Context, req ListRewardsRequest) ([]RewardsResponse, error)
 	// MyUserInfo returns information about the user making requests.
 	MyUserInfo(ctx context.Context) (*UserInfoResponse, error)
+	// ListUsers finds all users matching the given request parameters.
+	ListUsers(ctx context.Context, req ListUsersRequest) ([]UserInfoResponse, error)
+	// AutocompleteUsers finds users whose names or emails match the given
+	// partial search string.
+	AutocompleteUsers(ctx context.Context, search string) ([]UserInfoResponse, error)
+	// MyCompanyInfo returns information about the company of the user making
+	// requests.
+	MyCompanyInfo(ctx context.Context) (*CompanyResponse, error)
 	// Close closes the client and cleans up resources.
 	Close(ctx context.Context) error
 }
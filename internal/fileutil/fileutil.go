@@ -0,0 +1,52 @@
+// Package fileutil provides helpers to safely write files that are shared by
+// several runs of the CLI.
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WriteAtomic writes the data to a temporary file first and then renames it
+// to the path, so the file is never left partially written.
+func WriteAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing temporary file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "closing temporary file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "replacing file")
+}
+
+// Lock creates a lock file next to the path, waiting up to the timeout for
+// another process to remove it if it already exists, and returns the function
+// to remove it.
+func Lock(path string, timeout time.Duration) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "creating lock file")
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("timed out waiting for lock file '%s' to be removed", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
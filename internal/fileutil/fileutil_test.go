@@ -0,0 +1,50 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.json")
+
+	require.NoError(t, WriteAtomic(path, []byte("first")))
+	require.NoError(t, WriteAtomic(path, []byte("second")))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(b))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "should not leave temporary files behind")
+
+	assert.Error(t, WriteAtomic(filepath.Join(dir, "missing", "file.json"), []byte("data")))
+}
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.json")
+
+	unlock, err := Lock(path, time.Second)
+	require.NoError(t, err)
+	_, err = Lock(path, 100*time.Millisecond)
+	assert.Error(t, err, "should time out while the lock is held")
+
+	unlock()
+	_, err = os.Stat(path + ".lock")
+	assert.True(t, os.IsNotExist(err), "should remove the lock file")
+	unlock, err = Lock(path, time.Second)
+	require.NoError(t, err)
+	unlock()
+}
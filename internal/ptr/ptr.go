@@ -0,0 +1,57 @@
+// Package ptr converts to and from the optional fields of Bonusly requests
+// and responses, which are pointers that are nil when the field is missing.
+package ptr
+
+import "time"
+
+// String returns the string that s points to, or an empty string if s is nil.
+func String(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Int returns the int that i points to, or zero if i is nil.
+func Int(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// Bool returns the bool that b points to, or false if b is nil.
+func Bool(b *bool) bool {
+	if b == nil {
+		return false
+	}
+	return *b
+}
+
+// Time returns the time that t points to, or the zero time if t is nil.
+func Time(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// NewString returns a pointer to a copy of s.
+func NewString(s string) *string {
+	return &s
+}
+
+// NewInt returns a pointer to a copy of i.
+func NewInt(i int) *int {
+	return &i
+}
+
+// NewBool returns a pointer to a copy of b.
+func NewBool(b bool) *bool {
+	return &b
+}
+
+// NewTime returns a pointer to a copy of t.
+func NewTime(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,88 @@
+package bonusly
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBonusesPageSize is the number of bonuses to get per request when
+// listing all bonuses, which is the most that Bonusly returns at once.
+const defaultBonusesPageSize = 100
+
+// EachBonus calls fn for every bonus matching the request, getting them one
+// page at a time so that they do not all have to be held in memory. The
+// request's Limit is the page size, which defaults to and is at most 100, and
+// its Skip is where to start. If fn returns an error, listing stops and the
+// error is returned.
+func EachBonus(ctx context.Context, c Client, req ListBonusesRequest, fn func(BonusResponse) error) error {
+	// A short page means the listing is done, so the page size cannot be more
+	// than Bonusly returns at once.
+	if req.Limit == 0 || req.Limit > defaultBonusesPageSize {
+		req.Limit = defaultBonusesPageSize
+	}
+	for {
+		page, err := c.ListBonuses(ctx, req)
+		if err != nil {
+			return errors.Wrapf(err, "listing bonuses from %d", req.Skip)
+		}
+		for _, b := range page {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		if uint(len(page)) < req.Limit {
+			return nil
+		}
+		req.Skip += uint(len(page))
+	}
+}
+
+// defaultUsersPageSize is the number of users to get per request when listing
+// all users, which is the most that Bonusly returns at once.
+const defaultUsersPageSize = 100
+
+// EachUser calls fn for every user matching the request, getting them one
+// page at a time. The request's Limit is the page size, which defaults to and
+// is at most 100, and its Skip is where to start. If fn returns an error,
+// listing stops and the error is returned.
+func EachUser(ctx context.Context, c Client, req ListUsersRequest, fn func(UserInfoResponse) error) error {
+	if req.Limit == 0 || req.Limit > defaultUsersPageSize {
+		req.Limit = defaultUsersPageSize
+	}
+	for {
+		page, err := c.ListUsers(ctx, req)
+		if err != nil {
+			return errors.Wrapf(err, "listing users from %d", req.Skip)
+		}
+		for _, u := range page {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if uint(len(page)) < req.Limit {
+			return nil
+		}
+		req.Skip += uint(len(page))
+	}
+}
+
+var reasonHashtagRegexp = regexp.MustCompile(`(?:^|\s)#([\pL\pN_-]+)`)
+
+// ReasonHashtags returns the distinct hashtags in a bonus reason, lowercased
+// and without the leading '#', in the order they first appear.
+func ReasonHashtags(reason string) []string {
+	var hashtags []string
+	seen := map[string]bool{}
+	for _, match := range reasonHashtagRegexp.FindAllStringSubmatch(reason, -1) {
+		hashtag := strings.ToLower(match[1])
+		if seen[hashtag] {
+			continue
+		}
+		seen[hashtag] = true
+		hashtags = append(hashtags, hashtag)
+	}
+	return hashtags
+}
@@ -0,0 +1,127 @@
+package bonusly
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEachBonus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	total := 7
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		// Bonusly returns at most 100 bonuses at once.
+		if limit > 100 {
+			limit = 100
+		}
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		var page []BonusResponse
+		for i := skip; i < skip+limit && i < total; i++ {
+			id := strconv.Itoa(i)
+			page = append(page, BonusResponse{ID: &id})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": page})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+	})
+	require.NoError(t, err)
+
+	t.Run("ListsAllPages", func(t *testing.T) {
+		requests = 0
+		var ids []string
+		require.NoError(t, EachBonus(ctx, c, ListBonusesRequest{Limit: 3}, func(b BonusResponse) error {
+			ids = append(ids, *b.ID)
+			return nil
+		}))
+		assert.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6"}, ids)
+		assert.Equal(t, 3, requests)
+	})
+	t.Run("LimitsPageSizeToMaximum", func(t *testing.T) {
+		total = 150
+		defer func() { total = 7 }()
+		requests = 0
+		var n int
+		require.NoError(t, EachBonus(ctx, c, ListBonusesRequest{Limit: 500}, func(b BonusResponse) error {
+			n++
+			return nil
+		}))
+		assert.Equal(t, 150, n)
+		assert.Equal(t, 2, requests)
+	})
+	t.Run("StopsOnError", func(t *testing.T) {
+		requests = 0
+		var n int
+		err := EachBonus(ctx, c, ListBonusesRequest{Limit: 3}, func(b BonusResponse) error {
+			n++
+			if *b.ID == "4" {
+				return errors.New("stop")
+			}
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 5, n)
+		assert.Equal(t, 2, requests)
+	})
+}
+
+func TestEachUser(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const total = 5
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users", r.URL.Path)
+		queries = append(queries, r.URL.RawQuery)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		var page []UserInfoResponse
+		for i := skip; i < skip+limit && i < total; i++ {
+			id := strconv.Itoa(i)
+			page = append(page, UserInfoResponse{ID: &id})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": page})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+	})
+	require.NoError(t, err)
+
+	var ids []string
+	require.NoError(t, EachUser(ctx, c, ListUsersRequest{Limit: 2, UserMode: "normal"}, func(u UserInfoResponse) error {
+		ids = append(ids, *u.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	assert.Equal(t, []string{
+		"limit=2&user_mode=normal",
+		"limit=2&skip=2&user_mode=normal",
+		"limit=2&skip=4&user_mode=normal",
+	}, queries)
+}
+
+func TestReasonHashtags(t *testing.T) {
+	assert.Equal(t, []string{"teamwork", "ownership"}, ReasonHashtags("+5 @alice #Teamwork for owning the release #ownership #teamwork"))
+	assert.Empty(t, ReasonHashtags("+5 @alice no hashtags here, not even foo#bar"))
+}
@@ -0,0 +1,367 @@
+package bonusly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+// The log levels match the levels used by log/slog.
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// LogField is a key-value pair attached to a log message.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger records structured log messages.
+type Logger interface {
+	// Enabled returns whether messages at the given level are recorded.
+	Enabled(level LogLevel) bool
+	// Log records the message with its fields.
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+type jsonLogger struct {
+	w     io.Writer
+	level LogLevel
+	mu    sync.Mutex
+}
+
+// NewJSONLogger returns a logger that writes each message at or above the
+// given level as a line of JSON, in the same format as log/slog's JSON
+// handler.
+func NewJSONLogger(w io.Writer, level LogLevel) Logger {
+	return &jsonLogger{w: w, level: level}
+}
+
+func (l *jsonLogger) Enabled(level LogLevel) bool {
+	return level >= l.level
+}
+
+func (l *jsonLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONField(&buf, "time", time.Now().Format(time.RFC3339Nano), true)
+	writeJSONField(&buf, "level", level.String(), false)
+	writeJSONField(&buf, "msg", msg, false)
+	for _, f := range fields {
+		writeJSONField(&buf, f.Key, f.Value, false)
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(buf.Bytes())
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}, first bool) {
+	if !first {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(err.Error())
+	}
+	buf.Write(v)
+}
+
+// Error classes returned by ErrorClass.
+const (
+	ErrorClassCanceled    = "canceled"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassNetwork     = "network"
+	ErrorClassRateLimited = "rate_limited"
+	ErrorClassClient      = "client_error"
+	ErrorClassServer      = "server_error"
+	ErrorClassDecode      = "decode"
+	ErrorClassUnknown     = "unknown"
+)
+
+// ErrorClass categorizes an error returned by the client, which is useful to
+// aggregate failures. It returns an empty string for a nil error.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+	}
+	switch cause {
+	case context.Canceled:
+		return ErrorClassCanceled
+	case context.DeadlineExceeded:
+		return ErrorClassTimeout
+	}
+	switch cause := cause.(type) {
+	case *ResponseError:
+		switch {
+		case cause.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimited
+		case cause.StatusCode >= http.StatusInternalServerError:
+			return ErrorClassServer
+		default:
+			return ErrorClassClient
+		}
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return ErrorClassDecode
+	case net.Error:
+		if cause.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+	return ErrorClassUnknown
+}
+
+const redacted = "[REDACTED]"
+
+// loggingMiddleware logs a summary of every call and, at debug level, the
+// full HTTP exchange.
+func loggingMiddleware(logger Logger, redactReasons bool) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(call *Call) error {
+			var reqBody []byte
+			if logger.Enabled(LevelDebug) && call.Request.Body != nil {
+				var err error
+				reqBody, err = ioutil.ReadAll(call.Request.Body)
+				if err != nil {
+					return errors.Wrap(err, "reading request body")
+				}
+				call.Request.Body.Close()
+				call.Request.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+			}
+
+			start := time.Now()
+			err := next.Do(call)
+			latency := time.Since(start)
+
+			fields := []LogField{
+				{Key: "operation", Value: call.Operation},
+				{Key: "method", Value: call.Request.Method},
+				{Key: "route", Value: call.Request.URL.Path},
+			}
+			if id := call.Request.Header.Get(RequestIDHeader); id != "" {
+				fields = append(fields, LogField{Key: "request_id", Value: id})
+			}
+			if call.Response != nil {
+				fields = append(fields, LogField{Key: "status", Value: call.Response.StatusCode})
+			}
+			fields = append(fields,
+				LogField{Key: "latency_ms", Value: float64(latency) / float64(time.Millisecond)},
+				LogField{Key: "retries", Value: retries(call.Attempts)},
+			)
+			if call.CacheStatus != "" {
+				fields = append(fields, LogField{Key: "cache", Value: call.CacheStatus})
+			}
+			if err != nil {
+				fields = append(fields,
+					LogField{Key: "error", Value: redactError(err, call, redactReasons)},
+					LogField{Key: "error_class", Value: ErrorClass(err)},
+				)
+				logger.Log(LevelError, "bonusly api call failed", fields...)
+			} else {
+				logger.Log(LevelInfo, "bonusly api call", fields...)
+			}
+
+			if logger.Enabled(LevelDebug) {
+				logger.Log(LevelDebug, "bonusly api exchange",
+					LogField{Key: "operation", Value: call.Operation},
+					LogField{Key: "request", Value: dumpRequest(call.Request, reqBody, redactReasons)},
+					LogField{Key: "response", Value: dumpResponse(call.Response, redactReasons)},
+				)
+			}
+
+			return err
+		})
+	}
+}
+
+func retries(attempts int) int {
+	if attempts <= 1 {
+		return 0
+	}
+	return attempts - 1
+}
+
+type requestDump struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   interface{}         `json:"body,omitempty"`
+}
+
+type responseDump struct {
+	Status string              `json:"status"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   interface{}         `json:"body,omitempty"`
+}
+
+func dumpRequest(r *http.Request, body []byte, redactReasons bool) requestDump {
+	return requestDump{
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Header: redactHeader(r.Header),
+		Body:   redactBody(body, redactReasons),
+	}
+}
+
+func dumpResponse(resp *http.Response, redactReasons bool) *responseDump {
+	if resp == nil {
+		return nil
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return &responseDump{
+		Status: resp.Status,
+		Header: redactHeader(resp.Header),
+		Body:   redactBody(body, redactReasons),
+	}
+}
+
+func redactHeader(h http.Header) map[string][]string {
+	redactedHeader := make(map[string][]string, len(h))
+	for k, v := range h {
+		if http.CanonicalHeaderKey(k) == "Authorization" {
+			redactedHeader[k] = []string{redacted}
+			continue
+		}
+		redactedHeader[k] = v
+	}
+	return redactedHeader
+}
+
+// redactBody returns the decoded JSON body with reasons redacted if needed.
+// If the body is not JSON, it is returned as a string.
+func redactBody(body []byte, redactReasons bool) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return string(body)
+	}
+	if redactReasons {
+		decoded = redactReasonFields(decoded)
+	}
+	return decoded
+}
+
+// redactError returns the error message with the reasons of the call's
+// request and response redacted if needed, since error messages, such as
+// validation errors, may quote them.
+func redactError(err error, call *Call, redactReasons bool) string {
+	msg := err.Error()
+	if !redactReasons {
+		return msg
+	}
+	var reasons []string
+	if call.Payload != nil {
+		if b, err := json.Marshal(call.Payload); err == nil {
+			reasons = collectReasons(redactBody(b, false), reasons)
+		}
+	}
+	if call.Response != nil && call.Response.Body != nil {
+		b, _ := ioutil.ReadAll(call.Response.Body)
+		call.Response.Body = ioutil.NopCloser(bytes.NewReader(b))
+		reasons = collectReasons(redactBody(b, false), reasons)
+	}
+	for _, reason := range reasons {
+		if reason != "" {
+			msg = strings.Replace(msg, reason, redacted, -1)
+		}
+	}
+	return msg
+}
+
+// collectReasons appends the values of the reason fields in the decoded JSON
+// to the reasons.
+func collectReasons(v interface{}, reasons []string) []string {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, fieldVal := range val {
+			if s, ok := fieldVal.(string); ok && reasonFields[k] {
+				reasons = append(reasons, s)
+				continue
+			}
+			reasons = collectReasons(fieldVal, reasons)
+		}
+	case []interface{}:
+		for _, elem := range val {
+			reasons = collectReasons(elem, reasons)
+		}
+	}
+	return reasons
+}
+
+var reasonFields = map[string]bool{
+	"reason":      true,
+	"reason_html": true,
+}
+
+func redactReasonFields(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, fieldVal := range val {
+			if reasonFields[k] {
+				val[k] = redacted
+				continue
+			}
+			val[k] = redactReasonFields(fieldVal)
+		}
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = redactReasonFields(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -0,0 +1,151 @@
+package bonusly
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bonuses":
+			var req CreateBonusRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if strings.Contains(req.Reason, "invalid") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"success": false, "message": "could not parse reason '%s'"}`, req.Reason)
+				return
+			}
+			// Fail the first attempt so that it is retried.
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"success": true, "result": {"id": "bonus_id", "reason": "+1 @alice secret thanks"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "message": "not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	conf := newDefaultHTTPRetryConf()
+	conf.BaseDelay = time.Millisecond
+	conf.MaxDelay = time.Millisecond
+	httpClient := getHTTPRetryableClient(conf)
+	defer putHTTPClient(httpClient)
+
+	readLogs := func(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+		var logs []map[string]interface{}
+		scanner := bufio.NewScanner(buf)
+		for scanner.Scan() {
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			logs = append(logs, entry)
+		}
+		return logs
+	}
+	newClient := func(t *testing.T, buf *bytes.Buffer, level LogLevel, redactReasons bool) Client {
+		c, err := NewClient(ClientOptions{
+			AccessToken:   "access_token",
+			HTTPClient:    httpClient,
+			BaseURL:       srv.URL,
+			Logger:        NewJSONLogger(buf, level),
+			RedactReasons: redactReasons,
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("LogsCallSummary", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		var buf bytes.Buffer
+		c := newClient(t, &buf, LevelInfo, false)
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice secret thanks"})
+		require.NoError(t, err)
+
+		logs := readLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "INFO", logs[0]["level"])
+		assert.Equal(t, "bonusly api call", logs[0]["msg"])
+		assert.Equal(t, "CreateBonus", logs[0]["operation"])
+		assert.Equal(t, "/bonuses", logs[0]["route"])
+		assert.EqualValues(t, http.StatusOK, logs[0]["status"])
+		assert.EqualValues(t, 1, logs[0]["retries"])
+		assert.Contains(t, logs[0], "latency_ms")
+		assert.Contains(t, logs[0], "time")
+	})
+	t.Run("LogsErrorClass", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := newClient(t, &buf, LevelInfo, false)
+
+		_, err := c.GetBonus(ctx, "nonexistent")
+		require.Error(t, err)
+
+		logs := readLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "ERROR", logs[0]["level"])
+		assert.EqualValues(t, http.StatusNotFound, logs[0]["status"])
+		assert.Equal(t, ErrorClassClient, logs[0]["error_class"])
+		assert.Contains(t, logs[0]["error"], "not found")
+	})
+	t.Run("RedactsReasonsInErrors", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := newClient(t, &buf, LevelInfo, true)
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice invalid secret"})
+		require.Error(t, err)
+
+		logs := readLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, ErrorClassClient, logs[0]["error_class"])
+		assert.Contains(t, logs[0]["error"], "could not parse reason '[REDACTED]'")
+		assert.NotContains(t, buf.String(), "secret")
+	})
+	t.Run("DebugLogsRedactedExchange", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 1)
+		var buf bytes.Buffer
+		c := newClient(t, &buf, LevelDebug, true)
+
+		resp, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice secret thanks"})
+		require.NoError(t, err)
+		assert.Equal(t, "+1 @alice secret thanks", ptr.String(resp.Reason), "redaction should not modify the result")
+
+		output := buf.String()
+		assert.Contains(t, output, "bonusly api exchange")
+		assert.NotContains(t, output, "access_token")
+		assert.NotContains(t, output, "secret")
+		assert.Contains(t, output, `"Authorization":["[REDACTED]"]`)
+		assert.Contains(t, output, `"reason":"[REDACTED]"`)
+	})
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Empty(t, ErrorClass(nil))
+	assert.Equal(t, ErrorClassClient, ErrorClass(errors.WithStack(&ResponseError{StatusCode: http.StatusBadRequest})))
+	assert.Equal(t, ErrorClassRateLimited, ErrorClass(errors.WithStack(&ResponseError{StatusCode: http.StatusTooManyRequests})))
+	assert.Equal(t, ErrorClassServer, ErrorClass(errors.WithStack(&ResponseError{StatusCode: http.StatusBadGateway})))
+	assert.Equal(t, ErrorClassCanceled, ErrorClass(errors.Wrap(context.Canceled, "executing request")))
+	assert.Equal(t, ErrorClassTimeout, ErrorClass(errors.Wrap(context.DeadlineExceeded, "executing request")))
+	assert.Equal(t, ErrorClassDecode, ErrorClass(errors.Wrap(json.Unmarshal([]byte("{"), &struct{}{}), "decoding")))
+	assert.Equal(t, ErrorClassUnknown, ErrorClass(errors.New("error")))
+}
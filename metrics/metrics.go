@@ -0,0 +1,124 @@
+// Package metrics provides Prometheus instrumentation for Bonusly clients.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "bonusly"
+
+// Collector records metrics for calls made by Bonusly clients. It implements
+// prometheus.Collector, so it can be registered on any Prometheus registry.
+type Collector struct {
+	requests      *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	retries       *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	cache         *prometheus.CounterVec
+	givingBalance prometheus.Gauge
+}
+
+// NewCollector returns a new collector with no recorded metrics.
+func NewCollector() *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "requests_total",
+			Help:      "Number of calls to the Bonusly API by client method and response status code.",
+		}, []string{"operation", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of calls to the Bonusly API by client method, including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "retries_total",
+			Help:      "Number of retried requests to the Bonusly API by client method.",
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "errors_total",
+			Help:      "Number of failed calls to the Bonusly API by client method and error class.",
+		}, []string{"operation", "class"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "cache_requests_total",
+			Help:      "Number of calls to the Bonusly API with cached results by client method and cache status (hit, miss or revalidated).",
+		}, []string{"operation", "status"}),
+		givingBalance: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "giving_balance",
+			Help:      "The most recently observed giving balance of the client's user.",
+		}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.requests, c.latency, c.retries, c.errors, c.cache, c.givingBalance}
+}
+
+// Describe sends the descriptions of all the collector's metrics.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range c.collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect sends the current values of all the collector's metrics.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, col := range c.collectors() {
+		col.Collect(ch)
+	}
+}
+
+// Middleware returns client middleware that records metrics for every call.
+// The giving balance is updated whenever the client gets the user's info.
+func (c *Collector) Middleware() bonusly.Middleware {
+	return func(next bonusly.Doer) bonusly.Doer {
+		return bonusly.DoerFunc(func(call *bonusly.Call) error {
+			start := time.Now()
+			err := next.Do(call)
+			c.latency.WithLabelValues(call.Operation).Observe(time.Since(start).Seconds())
+
+			code := "none"
+			if call.Response != nil {
+				code = strconv.Itoa(call.Response.StatusCode)
+			}
+			c.requests.WithLabelValues(call.Operation, code).Inc()
+			if call.CacheStatus != "" {
+				c.cache.WithLabelValues(call.Operation, call.CacheStatus).Inc()
+			}
+			if call.Attempts > 1 {
+				c.retries.WithLabelValues(call.Operation).Add(float64(call.Attempts - 1))
+			}
+			if err != nil {
+				c.errors.WithLabelValues(call.Operation, bonusly.ErrorClass(err)).Inc()
+				return err
+			}
+
+			if info, ok := call.Result.(*bonusly.UserInfoResponse); ok {
+				c.ObserveUserInfo(info)
+			}
+			return nil
+		})
+	}
+}
+
+// ObserveUserInfo records the giving balance from the user info.
+func (c *Collector) ObserveUserInfo(info *bonusly.UserInfoResponse) {
+	if info == nil || info.GivingBalance == nil {
+		return
+	}
+	c.givingBalance.Set(float64(*info.GivingBalance))
+}
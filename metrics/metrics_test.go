@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/me":
+			fmt.Fprint(w, `{"success": true, "result": {"giving_balance": 42}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "message": "not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	collector := NewCollector()
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(collector))
+
+	c, err := bonusly.NewClient(bonusly.ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+		Middleware:  []bonusly.Middleware{collector.Middleware()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, c.Close(ctx))
+	}()
+
+	_, err = c.MyUserInfo(ctx)
+	require.NoError(t, err)
+	_, err = c.GetBonus(ctx, "nonexistent")
+	require.Error(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.requests.WithLabelValues("MyUserInfo", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.requests.WithLabelValues("GetBonus", "404")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.errors.WithLabelValues("GetBonus", bonusly.ErrorClassClient)))
+	assert.Equal(t, float64(42), testutil.ToFloat64(collector.givingBalance))
+
+	expected := `
+# HELP bonusly_giving_balance The most recently observed giving balance of the client's user.
+# TYPE bonusly_giving_balance gauge
+bonusly_giving_balance 42
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "bonusly_giving_balance"))
+	count, err := testutil.GatherAndCount(reg, "bonusly_client_request_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestCollectorCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": true, "result": {"giving_balance": 42}}`)
+	}))
+	defer srv.Close()
+
+	collector := NewCollector()
+	c, err := bonusly.NewClient(bonusly.ClientOptions{
+		AccessToken: "access_token",
+		HTTPClient:  &http.Client{},
+		BaseURL:     srv.URL,
+		Cache:       bonusly.NewLRUResponseCache(0),
+		Middleware:  []bonusly.Middleware{collector.Middleware()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, c.Close(ctx))
+	}()
+
+	for i := 0; i < 3; i++ {
+		_, err = c.MyUserInfo(ctx)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.cache.WithLabelValues("MyUserInfo", bonusly.CacheMiss)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(collector.cache.WithLabelValues("MyUserInfo", bonusly.CacheHit)))
+}
@@ -0,0 +1,104 @@
+package bonusly
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Call is a single call to the Bonusly API made by a Client method.
+type Call struct {
+	// Operation is the name of the Client method making the call (e.g.
+	// "CreateBonus").
+	Operation string
+	// Request is the HTTP request to send. Middleware can modify it before
+	// passing the call on, for example to add headers.
+	Request *http.Request
+	// Payload is the request parameters given to the Client method (e.g. the
+	// CreateBonusRequest for CreateBonus), or nil if it has none.
+	Payload interface{}
+	// Response is the HTTP response, which is set once the request has been
+	// sent. Its body has already been read by the client, but can be read
+	// again.
+	Response *http.Response
+	// Attempts is the number of times the request was sent, including
+	// retries.
+	Attempts int
+	// CacheStatus is CacheHit, CacheMiss or CacheRevalidated if the result is
+	// cached, or empty if it is not.
+	CacheStatus string
+	// Result is a pointer to the decoded result (e.g. *BonusResponse for
+	// CreateBonus), which is set once a successful response has been decoded.
+	Result interface{}
+
+	// result is where the response body is decoded.
+	result interface{}
+}
+
+// Doer makes calls to the Bonusly API.
+type Doer interface {
+	// Do makes the call, filling in its response and result.
+	Do(call *Call) error
+}
+
+// DoerFunc is a function that implements Doer.
+type DoerFunc func(call *Call) error
+
+// Do calls the function.
+func (f DoerFunc) Do(call *Call) error { return f(call) }
+
+// Middleware wraps a Doer to add behavior to every call, such as inspecting or
+// modifying the call before passing it to the next Doer, or inspecting the
+// response and result after.
+type Middleware func(next Doer) Doer
+
+// chainMiddleware wraps the Doer in the middleware so that the first
+// middleware is the outermost one.
+func chainMiddleware(d Doer, middleware []Middleware) Doer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		d = middleware[i](d)
+	}
+	return d
+}
+
+// UserAgentMiddleware sets the User-Agent header of every request.
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(call *Call) error {
+			call.Request.Header.Set("User-Agent", userAgent)
+			return next.Do(call)
+		})
+	}
+}
+
+// RequestIDHeader is the header that RequestIDMiddleware sets.
+const RequestIDHeader = "X-Request-Id"
+
+// RequestIDMiddleware sets a unique request ID header on every request that
+// does not already have one, which helps to correlate requests with logs.
+func RequestIDMiddleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(call *Call) error {
+			if call.Request.Header.Get(RequestIDHeader) == "" {
+				call.Request.Header.Set(RequestIDHeader, newRequestID())
+			}
+			return next.Do(call)
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// LoggingMiddleware returns middleware that logs every call to the logger in
+// the same way as setting ClientOptions.Logger, which allows choosing where it
+// runs in the middleware chain. If redactReasons is set, bonus reasons are
+// redacted from the logs.
+func LoggingMiddleware(logger Logger, redactReasons bool) Middleware {
+	return loggingMiddleware(logger, redactReasons)
+}
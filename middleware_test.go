@@ -0,0 +1,129 @@
+package bonusly
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		switch r.URL.Path {
+		case "/bonuses":
+			fmt.Fprint(w, `{"success": true, "result": {"id": "bonus_id", "reason": "+1 @alice thanks"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "message": "not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	httpClient := getHTTPClient()
+	defer putHTTPClient(httpClient)
+
+	newClient := func(t *testing.T, middleware ...Middleware) Client {
+		c, err := NewClient(ClientOptions{
+			AccessToken: "access_token",
+			HTTPClient:  httpClient,
+			BaseURL:     srv.URL,
+			Middleware:  middleware,
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	t.Run("SeesOperationPayloadAndResult", func(t *testing.T) {
+		var seen []*Call
+		c := newClient(t, func(next Doer) Doer {
+			return DoerFunc(func(call *Call) error {
+				err := next.Do(call)
+				seen = append(seen, call)
+				return err
+			})
+		})
+
+		req := CreateBonusRequest{Reason: "+1 @alice thanks"}
+		_, err := c.CreateBonus(ctx, req)
+		require.NoError(t, err)
+		require.Len(t, seen, 1)
+		assert.Equal(t, "CreateBonus", seen[0].Operation)
+		assert.Equal(t, req, seen[0].Payload)
+		require.NotNil(t, seen[0].Response)
+		assert.Equal(t, http.StatusOK, seen[0].Response.StatusCode)
+		result, ok := seen[0].Result.(*BonusResponse)
+		require.True(t, ok)
+		assert.Equal(t, "bonus_id", ptr.String(result.ID))
+	})
+	t.Run("RunsInOrder", func(t *testing.T) {
+		var order []string
+		record := func(name string) Middleware {
+			return func(next Doer) Doer {
+				return DoerFunc(func(call *Call) error {
+					order = append(order, name+" before")
+					err := next.Do(call)
+					order = append(order, name+" after")
+					return err
+				})
+			}
+		}
+		c := newClient(t, record("first"), record("second"))
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, order)
+	})
+	t.Run("CanShortCircuit", func(t *testing.T) {
+		headers = nil
+		c := newClient(t, func(next Doer) Doer {
+			return DoerFunc(func(call *Call) error {
+				return fmt.Errorf("blocked %s", call.Operation)
+			})
+		})
+
+		_, err := c.GetBonus(ctx, "bonus_id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "blocked GetBonus")
+		assert.Nil(t, headers)
+	})
+	t.Run("UserAgentAndRequestID", func(t *testing.T) {
+		c := newClient(t, UserAgentMiddleware("test-agent"), RequestIDMiddleware())
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks"})
+		require.NoError(t, err)
+		assert.Equal(t, "test-agent", headers.Get("User-Agent"))
+		firstID := headers.Get(RequestIDHeader)
+		assert.NotEmpty(t, firstID)
+
+		_, err = c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks"})
+		require.NoError(t, err)
+		assert.NotEqual(t, firstID, headers.Get(RequestIDHeader))
+	})
+	t.Run("Logging", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := newClient(t, LoggingMiddleware(NewJSONLogger(&buf, LevelInfo), true))
+
+		_, err := c.CreateBonus(ctx, CreateBonusRequest{Reason: "+1 @alice thanks"})
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"operation":"CreateBonus"`)
+		assert.Contains(t, buf.String(), `"status":200`)
+
+		buf.Reset()
+		_, err = c.GetBonus(ctx, "nonexistent")
+		require.Error(t, err)
+		assert.Contains(t, buf.String(), `"operation":"GetBonus"`)
+		assert.Contains(t, buf.String(), `"status":404`)
+		assert.Contains(t, buf.String(), "not found")
+	})
+}
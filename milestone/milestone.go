@@ -0,0 +1,348 @@
+// Package milestone celebrates work anniversaries and birthdays by giving
+// bonuses on the day in each person's own time zone, never celebrating the
+// same milestone twice.
+package milestone
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/analytics"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Kind is a kind of milestone.
+type Kind string
+
+// Kinds of milestones.
+const (
+	Anniversary Kind = "anniversary"
+	Birthday    Kind = "birthday"
+)
+
+// Default reason templates.
+const (
+	DefaultAnniversaryTemplate = `+{{.Amount}} @{{.Username}} Happy {{.Years}}-year work anniversary! Thank you for everything you do. #anniversary`
+	DefaultBirthdayTemplate    = `+{{.Amount}} @{{.Username}} Happy birthday! #birthday`
+)
+
+// Options represent options to celebrate milestones.
+type Options struct {
+	// GiverEmail is the email of the account that gives the bonuses.
+	GiverEmail string
+	// Kinds are the kinds of milestones to celebrate. Defaults to
+	// anniversaries and birthdays.
+	Kinds []Kind
+	// BirthdayProperty is the name of the custom property that holds users'
+	// birthdays. Defaults to "birthday".
+	BirthdayProperty string
+	// AnniversaryTemplate and BirthdayTemplate are text/template templates
+	// of the bonus reasons, which are executed with TemplateData.
+	AnniversaryTemplate string
+	BirthdayTemplate    string
+	// AnniversaryAmount and BirthdayAmount are the amounts of the bonuses.
+	// Default to 10 and 5.
+	AnniversaryAmount int
+	BirthdayAmount    int
+	// DefaultLocation is the time zone of users whose time zone is not set
+	// or not a known IANA time zone. Defaults to UTC.
+	DefaultLocation *time.Location
+	// Store records the milestones that were celebrated, keyed by
+	// Milestone.Key. To also prevent duplicates when the outcome of creating
+	// a bonus is unknown, give the client the same store. Defaults to an
+	// in-memory store.
+	Store bonusly.IdempotencyStore
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.GiverEmail == "" {
+		return errors.New("giver email must be set")
+	}
+	if len(o.Kinds) == 0 {
+		o.Kinds = []Kind{Anniversary, Birthday}
+	}
+	for _, k := range o.Kinds {
+		if k != Anniversary && k != Birthday {
+			return errors.Errorf("unknown milestone kind '%s'", k)
+		}
+	}
+	if o.BirthdayProperty == "" {
+		o.BirthdayProperty = "birthday"
+	}
+	if o.AnniversaryTemplate == "" {
+		o.AnniversaryTemplate = DefaultAnniversaryTemplate
+	}
+	if o.BirthdayTemplate == "" {
+		o.BirthdayTemplate = DefaultBirthdayTemplate
+	}
+	if o.AnniversaryAmount == 0 {
+		o.AnniversaryAmount = 10
+	}
+	if o.BirthdayAmount == 0 {
+		o.BirthdayAmount = 5
+	}
+	if o.AnniversaryAmount < 0 || o.BirthdayAmount < 0 {
+		return errors.New("amounts cannot be negative")
+	}
+	if o.DefaultLocation == nil {
+		o.DefaultLocation = time.UTC
+	}
+	if o.Store == nil {
+		o.Store = bonusly.NewMemoryIdempotencyStore()
+	}
+	return nil
+}
+
+// Milestone is a milestone of a user that falls on the current day in their
+// time zone.
+type Milestone struct {
+	Kind Kind
+	User bonusly.UserInfoResponse
+	// Date is the day of the milestone in the user's time zone.
+	Date time.Time
+	// Years is the number of years since the user was hired, for
+	// anniversaries.
+	Years int
+	// Key uniquely identifies the milestone so that it is only celebrated
+	// once.
+	Key string
+}
+
+// TemplateData is the data that reason templates are executed with.
+type TemplateData struct {
+	Kind        Kind
+	Amount      int
+	Years       int
+	Date        time.Time
+	Username    string
+	FirstName   string
+	DisplayName string
+	Email       string
+}
+
+// Result is the outcome of celebrating a milestone.
+type Result struct {
+	Milestone Milestone
+	Request   bonusly.CreateBonusRequest
+	Bonus     *bonusly.BonusResponse
+	// Skipped is whether the milestone was already celebrated.
+	Skipped bool
+	Err     error
+}
+
+// Automation finds users' milestones and gives bonuses for them.
+type Automation struct {
+	client    bonusly.Client
+	opts      Options
+	templates map[Kind]*template.Template
+	amounts   map[Kind]int
+}
+
+// New returns an automation that gives bonuses with the client.
+func New(client bonusly.Client, opts Options) (*Automation, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	a := &Automation{
+		client:    client,
+		opts:      opts,
+		templates: map[Kind]*template.Template{},
+		amounts:   map[Kind]int{Anniversary: opts.AnniversaryAmount, Birthday: opts.BirthdayAmount},
+	}
+	for kind, text := range map[Kind]string{Anniversary: opts.AnniversaryTemplate, Birthday: opts.BirthdayTemplate} {
+		tmpl, err := template.New(string(kind)).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s template", kind)
+		}
+		a.templates[kind] = tmpl
+	}
+	return a, nil
+}
+
+// Run lists all users and celebrates their milestones that fall on the day
+// of the given time in their own time zone. Errors celebrating individual
+// milestones are returned in their results.
+func (a *Automation) Run(ctx context.Context, now time.Time) ([]Result, error) {
+	var results []Result
+	err := bonusly.EachUser(ctx, a.client, bonusly.ListUsersRequest{}, func(u bonusly.UserInfoResponse) error {
+		for _, m := range a.Find(u, now) {
+			results = append(results, a.Celebrate(ctx, m))
+		}
+		return ctx.Err()
+	})
+	return results, errors.Wrap(err, "listing users")
+}
+
+// Find returns the user's milestones that fall on the day of the given time
+// in the user's time zone. Users who cannot receive bonuses or are not active
+// have no milestones.
+func (a *Automation) Find(u bonusly.UserInfoResponse, now time.Time) []Milestone {
+	if u.CanReceive != nil && !*u.CanReceive {
+		return nil
+	}
+	if status := ptr.String(u.Status); status != "" && status != "active" {
+		return nil
+	}
+	key := analytics.UserKey(&u)
+	if key == "" {
+		return nil
+	}
+
+	today := now.In(a.location(u))
+	y, m, d := today.Date()
+	date := time.Date(y, m, d, 0, 0, 0, 0, today.Location())
+
+	var milestones []Milestone
+	for _, kind := range a.opts.Kinds {
+		switch kind {
+		case Anniversary:
+			if u.HiredOne == nil {
+				continue
+			}
+			hy, hm, hd := u.HiredOne.UTC().Date()
+			years := y - hy
+			if years < 1 || !sameDay(hm, hd, m, d, y) {
+				continue
+			}
+			milestones = append(milestones, Milestone{
+				Kind:  Anniversary,
+				User:  u,
+				Date:  date,
+				Years: years,
+				Key:   fmt.Sprintf("milestone:%s:%s:%d", Anniversary, key, years),
+			})
+		case Birthday:
+			bm, bd, ok := parseBirthday(u.CustomProperties[a.opts.BirthdayProperty])
+			if !ok || !sameDay(bm, bd, m, d, y) {
+				continue
+			}
+			milestones = append(milestones, Milestone{
+				Kind: Birthday,
+				User: u,
+				Date: date,
+				Key:  fmt.Sprintf("milestone:%s:%s:%d", Birthday, key, y),
+			})
+		}
+	}
+	return milestones
+}
+
+// Celebrate gives the bonus for the milestone, unless it was already
+// celebrated.
+func (a *Automation) Celebrate(ctx context.Context, m Milestone) Result {
+	res := Result{Milestone: m}
+	rec, err := a.opts.Store.Get(m.Key)
+	if err != nil {
+		res.Err = errors.Wrap(err, "checking whether milestone was celebrated")
+		return res
+	}
+	if rec != nil {
+		res.Skipped = true
+		res.Request = rec.Request
+		res.Bonus = &rec.Response
+		return res
+	}
+
+	if res.Request, err = a.Request(m); err != nil {
+		res.Err = err
+		return res
+	}
+	if res.Bonus, err = a.client.CreateBonus(ctx, res.Request); err != nil {
+		res.Err = errors.Wrap(err, "creating bonus")
+		return res
+	}
+	res.Err = errors.Wrap(a.opts.Store.Put(m.Key, bonusly.IdempotencyRecord{
+		Request:   res.Request,
+		Response:  *res.Bonus,
+		CreatedAt: time.Now(),
+	}), "bonus was created but could not record milestone")
+	return res
+}
+
+// Request returns the request to give the bonus for the milestone.
+func (a *Automation) Request(m Milestone) (bonusly.CreateBonusRequest, error) {
+	username := ptr.String(m.User.UserName)
+	if username == "" {
+		return bonusly.CreateBonusRequest{}, errors.Errorf("user '%s' has no username to mention", analytics.UserKey(&m.User))
+	}
+	data := TemplateData{
+		Kind:        m.Kind,
+		Amount:      a.amounts[m.Kind],
+		Years:       m.Years,
+		Date:        m.Date,
+		Username:    username,
+		FirstName:   ptr.String(m.User.FirstName),
+		DisplayName: ptr.String(m.User.DisplayName),
+		Email:       ptr.String(m.User.Email),
+	}
+	var buf bytes.Buffer
+	if err := a.templates[m.Kind].Execute(&buf, data); err != nil {
+		return bonusly.CreateBonusRequest{}, errors.Wrapf(err, "executing %s template", m.Kind)
+	}
+	return bonusly.CreateBonusRequest{
+		GiverEmail:     a.opts.GiverEmail,
+		Reason:         strings.TrimSpace(buf.String()),
+		IdempotencyKey: m.Key,
+	}, nil
+}
+
+// location returns the user's time zone, falling back to the default.
+func (a *Automation) location(u bonusly.UserInfoResponse) *time.Location {
+	if tz := ptr.String(u.TimeZone); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return a.opts.DefaultLocation
+}
+
+// sameDay returns whether the month and day of a yearly milestone fall on
+// the given day of the given year. Milestones on February 29 fall on
+// February 28 in other years.
+func sameDay(month time.Month, day int, todayMonth time.Month, today, year int) bool {
+	if month == time.February && day == 29 && !isLeapYear(year) {
+		day = 28
+	}
+	return month == todayMonth && day == today
+}
+
+func isLeapYear(y int) bool {
+	return y%4 == 0 && (y%100 != 0 || y%400 == 0)
+}
+
+// birthdayLayouts are the formats that birthdays are parsed from. Only the
+// month and day are used.
+var birthdayLayouts = []string{
+	"2006-01-02",
+	"01-02",
+	"01/02/2006",
+	"01/02",
+	"January 2, 2006",
+	"January 2",
+	"Jan 2, 2006",
+	"Jan 2",
+	time.RFC3339,
+}
+
+// parseBirthday parses the month and day of a birthday custom property.
+func parseBirthday(v interface{}) (time.Month, int, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, 0, false
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range birthdayLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Month(), t.Day(), true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,204 @@
+package milestone
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	*bonusly.MockClient
+	users []bonusly.UserInfoResponse
+}
+
+func (c *fakeClient) ListUsers(_ context.Context, req bonusly.ListUsersRequest) ([]bonusly.UserInfoResponse, error) {
+	if req.Skip >= uint(len(c.users)) {
+		return nil, nil
+	}
+	end := req.Skip + req.Limit
+	if end > uint(len(c.users)) {
+		end = uint(len(c.users))
+	}
+	return c.users[req.Skip:end], nil
+}
+
+func user(username string, hired time.Time, birthday string, tz string) bonusly.UserInfoResponse {
+	u := bonusly.UserInfoResponse{
+		UserName:  ptr.NewString(username),
+		Email:     ptr.NewString(username + "@example.com"),
+		FirstName: ptr.NewString(username),
+		HiredOne:  &hired,
+	}
+	if birthday != "" {
+		u.CustomProperties = map[string]interface{}{"birthday": birthday}
+	}
+	if tz != "" {
+		u.TimeZone = ptr.NewString(tz)
+	}
+	return u
+}
+
+func newTestAutomation(t *testing.T, client bonusly.Client, opts Options) *Automation {
+	if opts.GiverEmail == "" {
+		opts.GiverEmail = "bot@example.com"
+	}
+	a, err := New(client, opts)
+	require.NoError(t, err)
+	return a
+}
+
+// now is 2021-03-10 in UTC, but still 2021-03-09 in Los Angeles and already
+// 2021-03-11 in Tokyo.
+var now = time.Date(2021, time.March, 10, 23, 0, 0, 0, time.UTC)
+
+func TestOptionsValidate(t *testing.T) {
+	t.Run("SetsDefaults", func(t *testing.T) {
+		opts := Options{GiverEmail: "bot@example.com"}
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, []Kind{Anniversary, Birthday}, opts.Kinds)
+		assert.Equal(t, "birthday", opts.BirthdayProperty)
+		assert.Equal(t, DefaultAnniversaryTemplate, opts.AnniversaryTemplate)
+		assert.Equal(t, 10, opts.AnniversaryAmount)
+		assert.Equal(t, time.UTC, opts.DefaultLocation)
+		assert.NotNil(t, opts.Store)
+	})
+	t.Run("FailsWithoutGiver", func(t *testing.T) {
+		var opts Options
+		assert.Error(t, opts.Validate())
+	})
+	t.Run("FailsWithUnknownKind", func(t *testing.T) {
+		opts := Options{GiverEmail: "bot@example.com", Kinds: []Kind{"promotion"}}
+		assert.Error(t, opts.Validate())
+	})
+	t.Run("FailsWithInvalidTemplate", func(t *testing.T) {
+		_, err := New(&fakeClient{MockClient: &bonusly.MockClient{}}, Options{GiverEmail: "bot@example.com", BirthdayTemplate: "{{.Username"})
+		assert.Error(t, err)
+	})
+}
+
+func TestFind(t *testing.T) {
+	a := newTestAutomation(t, &fakeClient{MockClient: &bonusly.MockClient{}}, Options{})
+
+	t.Run("Anniversary", func(t *testing.T) {
+		found := a.Find(user("alice", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "", ""), now)
+		require.Len(t, found, 1)
+		assert.Equal(t, Anniversary, found[0].Kind)
+		assert.Equal(t, 3, found[0].Years)
+		assert.Equal(t, "milestone:anniversary:alice@example.com:3", found[0].Key)
+		assert.Equal(t, time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC), found[0].Date)
+	})
+	t.Run("NoAnniversaryOnHireDate", func(t *testing.T) {
+		assert.Empty(t, a.Find(user("alice", time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC), "", ""), now))
+	})
+	t.Run("Birthday", func(t *testing.T) {
+		for _, birthday := range []string{"1990-03-10", "03-10", "03/10", "March 10", "Mar 10, 1985"} {
+			found := a.Find(user("bob", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), birthday, ""), now)
+			require.Len(t, found, 1, birthday)
+			assert.Equal(t, Birthday, found[0].Kind)
+			assert.Equal(t, "milestone:birthday:bob@example.com:2021", found[0].Key)
+		}
+		assert.Empty(t, a.Find(user("bob", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), "someday", ""), now))
+	})
+	t.Run("UserTimeZone", func(t *testing.T) {
+		hired := time.Date(2019, time.March, 11, 0, 0, 0, 0, time.UTC)
+		assert.Empty(t, a.Find(user("carol", hired, "", "America/Los_Angeles"), now))
+		found := a.Find(user("carol", hired, "", "Asia/Tokyo"), now)
+		require.Len(t, found, 1)
+		assert.Equal(t, 2, found[0].Years)
+		assert.Empty(t, a.Find(user("carol", hired, "", "Not/AZone"), now), "should fall back to the default time zone")
+	})
+	t.Run("LeapDay", func(t *testing.T) {
+		feb28 := time.Date(2021, time.February, 28, 12, 0, 0, 0, time.UTC)
+		found := a.Find(user("dave", time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC), "02-29", ""), feb28)
+		assert.Len(t, found, 2)
+	})
+	t.Run("InactiveUsers", func(t *testing.T) {
+		u := user("erin", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "03-10", "")
+		u.CanReceive = ptr.NewBool(false)
+		assert.Empty(t, a.Find(u, now))
+		u = user("erin", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "03-10", "")
+		u.Status = ptr.NewString("archived")
+		assert.Empty(t, a.Find(u, now))
+	})
+	t.Run("OnlyEnabledKinds", func(t *testing.T) {
+		a := newTestAutomation(t, &fakeClient{MockClient: &bonusly.MockClient{}}, Options{Kinds: []Kind{Birthday}})
+		found := a.Find(user("frank", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "03-10", ""), now)
+		require.Len(t, found, 1)
+		assert.Equal(t, Birthday, found[0].Kind)
+	})
+}
+
+func TestRun(t *testing.T) {
+	users := []bonusly.UserInfoResponse{
+		user("alice", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "", ""),
+		user("bob", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), "03-10", ""),
+		user("carol", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), "", ""),
+	}
+
+	t.Run("CelebratesOnce", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: users}
+		a := newTestAutomation(t, client, Options{
+			BirthdayTemplate: "+{{.Amount}} @{{.Username}} happy birthday {{.FirstName}}!",
+			BirthdayAmount:   3,
+		})
+
+		results, err := a.Run(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, res := range results {
+			assert.NoError(t, res.Err)
+			assert.False(t, res.Skipped)
+		}
+		require.Len(t, client.CreateBonusRequests, 2)
+		assert.Equal(t, bonusly.CreateBonusRequest{
+			GiverEmail:     "bot@example.com",
+			Reason:         "+10 @alice Happy 3-year work anniversary! Thank you for everything you do. #anniversary",
+			IdempotencyKey: "milestone:anniversary:alice@example.com:3",
+		}, client.CreateBonusRequests[0])
+		assert.Equal(t, "+3 @bob happy birthday bob!", client.CreateBonusRequests[1].Reason)
+
+		results, err = a.Run(context.Background(), now.Add(-time.Hour))
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, res := range results {
+			assert.True(t, res.Skipped)
+			require.NotNil(t, res.Bonus)
+		}
+		assert.Len(t, client.CreateBonusRequests, 2, "should not celebrate the same milestone twice")
+	})
+	t.Run("RetriesFailures", func(t *testing.T) {
+		client := &fakeClient{MockClient: &bonusly.MockClient{CreateBonusError: errors.New("insufficient balance")}, users: users[:1]}
+		a := newTestAutomation(t, client, Options{})
+
+		results, err := a.Run(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Error(t, results[0].Err)
+
+		client.CreateBonusError = nil
+		results, err = a.Run(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.NoError(t, results[0].Err)
+		assert.False(t, results[0].Skipped)
+		assert.Len(t, client.CreateBonusRequests, 2)
+	})
+	t.Run("FailsWithoutUsername", func(t *testing.T) {
+		u := user("alice", time.Date(2018, time.March, 10, 0, 0, 0, 0, time.UTC), "", "")
+		u.UserName = nil
+		client := &fakeClient{MockClient: &bonusly.MockClient{}, users: []bonusly.UserInfoResponse{u}}
+		a := newTestAutomation(t, client, Options{})
+
+		results, err := a.Run(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Error(t, results[0].Err)
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+}
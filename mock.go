@@ -5,7 +5,13 @@ import "context"
 // MockClient is a mock Bonusly client that implements the Client interface.
 type MockClient struct {
 	CreateBonusRequest  CreateBonusRequest
+	CreateBonusRequests []CreateBonusRequest
 	CreateBonusResponse BonusResponse
+	CreateBonusError    error
+
+	CreateBonusesRequests []CreateBonusRequest
+	CreateBonusesOptions  BulkOptions
+	CreateBonusesResults  []BulkResult
 
 	GetBonusID       string
 	GetBonusResponse BonusResponse
@@ -23,15 +29,36 @@ type MockClient struct {
 	ListRewardsResponse []RewardsResponse
 
 	MyUserInfoResponse UserInfoResponse
+
+	ListUsersRequest  ListUsersRequest
+	ListUsersResponse []UserInfoResponse
+
+	AutocompleteUsersSearch   string
+	AutocompleteUsersResponse []UserInfoResponse
+
+	MyCompanyInfoResponse CompanyResponse
 }
 
-// CreateBonus records the CreateBonusRequest input and returns the mock
-// client's CreateBonusResponse.
+// CreateBonus records the CreateBonusRequest input, both as the latest
+// request and in the CreateBonusRequests, and returns the mock client's
+// CreateBonusError if it is set or its CreateBonusResponse otherwise.
 func (c *MockClient) CreateBonus(_ context.Context, req CreateBonusRequest) (*BonusResponse, error) {
 	c.CreateBonusRequest = req
+	c.CreateBonusRequests = append(c.CreateBonusRequests, req)
+	if c.CreateBonusError != nil {
+		return nil, c.CreateBonusError
+	}
 	return &c.CreateBonusResponse, nil
 }
 
+// CreateBonuses records the requests and options and returns the mock
+// client's CreateBonusesResults.
+func (c *MockClient) CreateBonuses(_ context.Context, reqs []CreateBonusRequest, opts BulkOptions) ([]BulkResult, error) {
+	c.CreateBonusesRequests = reqs
+	c.CreateBonusesOptions = opts
+	return c.CreateBonusesResults, nil
+}
+
 // GetBonus records the bonus ID input and returns the mock client's
 // GetBonusResponse.
 func (c *MockClient) GetBonus(_ context.Context, id string) (*BonusResponse, error) {
@@ -72,6 +99,25 @@ func (c *MockClient) MyUserInfo(_ context.Context) (*UserInfoResponse, error) {
 	return &c.MyUserInfoResponse, nil
 }
 
+// ListUsers records the ListUsersRequest input and returns the mock client's
+// ListUsersResponse.
+func (c *MockClient) ListUsers(_ context.Context, req ListUsersRequest) ([]UserInfoResponse, error) {
+	c.ListUsersRequest = req
+	return c.ListUsersResponse, nil
+}
+
+// AutocompleteUsers records the search input and returns the mock client's
+// AutocompleteUsersResponse.
+func (c *MockClient) AutocompleteUsers(_ context.Context, search string) ([]UserInfoResponse, error) {
+	c.AutocompleteUsersSearch = search
+	return c.AutocompleteUsersResponse, nil
+}
+
+// MyCompanyInfo returns the mock client's MyCompanyInfoResponse.
+func (c *MockClient) MyCompanyInfo(_ context.Context) (*CompanyResponse, error) {
+	return &c.MyCompanyInfoResponse, nil
+}
+
 // Close is a no-op.
 func (c *MockClient) Close(_ context.Context) error {
 	return nil
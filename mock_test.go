@@ -1,11 +1,33 @@
 package bonusly
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestMock(t *testing.T) {
 	require.Implements(t, (*Client)(nil), &MockClient{})
+
+	t.Run("RecordsEveryCreateBonusRequest", func(t *testing.T) {
+		c := &MockClient{CreateBonusResponse: BonusResponse{ID: ptr.NewString("bonus")}}
+		for _, reason := range []string{"+1 @alice thanks", "+2 @bob thanks"} {
+			resp, err := c.CreateBonus(context.Background(), CreateBonusRequest{Reason: reason})
+			require.NoError(t, err)
+			assert.Equal(t, "bonus", *resp.ID)
+		}
+		assert.Equal(t, []CreateBonusRequest{{Reason: "+1 @alice thanks"}, {Reason: "+2 @bob thanks"}}, c.CreateBonusRequests)
+		assert.Equal(t, CreateBonusRequest{Reason: "+2 @bob thanks"}, c.CreateBonusRequest)
+	})
+	t.Run("ReturnsCreateBonusError", func(t *testing.T) {
+		c := &MockClient{CreateBonusError: errors.New("insufficient balance")}
+		resp, err := c.CreateBonus(context.Background(), CreateBonusRequest{Reason: "+1 @alice thanks"})
+		assert.Error(t, err)
+		assert.Nil(t, resp)
+		assert.Len(t, c.CreateBonusRequests, 1)
+	})
 }
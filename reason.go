@@ -0,0 +1,36 @@
+package bonusly
+
+import (
+	"html"
+
+	"github.com/kimchelly/go-bonusly/render"
+)
+
+// ReasonText renders the bonus reason as plain text, annotated with the
+// positions of mentions, hashtags and links.
+func (b *BonusResponse) ReasonText() (*render.Text, error) {
+	return render.PlainText(b.reasonHTML())
+}
+
+// ReasonMarkdown renders the bonus reason as Markdown.
+func (b *BonusResponse) ReasonMarkdown() (string, error) {
+	return render.Markdown(b.reasonHTML())
+}
+
+// ReasonANSI renders the bonus reason as text colored with ANSI escape
+// codes for terminals.
+func (b *BonusResponse) ReasonANSI() (string, error) {
+	return render.ANSI(b.reasonHTML())
+}
+
+// reasonHTML returns the HTML of the reason, falling back to the escaped
+// plain reason if the response has no HTML.
+func (b *BonusResponse) reasonHTML() string {
+	if b.ReasonHTML != nil && *b.ReasonHTML != "" {
+		return *b.ReasonHTML
+	}
+	if b.Reason != nil {
+		return html.EscapeString(*b.Reason)
+	}
+	return ""
+}
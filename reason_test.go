@@ -0,0 +1,52 @@
+package bonusly
+
+import (
+	"testing"
+
+	"github.com/kimchelly/go-bonusly/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBonusResponseReason(t *testing.T) {
+	reasonHTML := `+5 <a href="/company/users/alice">@alice</a> great <strong>review</strong> <a href="/company/hashtags/teamwork">#teamwork</a>`
+	reason := "+5 @alice great review #teamwork"
+
+	t.Run("RendersHTML", func(t *testing.T) {
+		b := &BonusResponse{Reason: &reason, ReasonHTML: &reasonHTML}
+
+		text, err := b.ReasonText()
+		require.NoError(t, err)
+		assert.Equal(t, reason, text.Text)
+		assert.Equal(t, []render.Annotation{
+			{Kind: render.Mention, Value: "alice", Start: 3, End: 9},
+			{Kind: render.Hashtag, Value: "teamwork", Start: 23, End: 32},
+		}, text.Annotations)
+
+		md, err := b.ReasonMarkdown()
+		require.NoError(t, err)
+		assert.Equal(t, "+5 @alice great **review** #teamwork", md)
+
+		ansi, err := b.ReasonANSI()
+		require.NoError(t, err)
+		assert.Contains(t, ansi, "\x1b[1;36m@alice\x1b[0m")
+	})
+	t.Run("FallsBackToReason", func(t *testing.T) {
+		plain := "+1 @bob <3 *thanks* #fun"
+		b := &BonusResponse{Reason: &plain}
+
+		text, err := b.ReasonText()
+		require.NoError(t, err)
+		assert.Equal(t, plain, text.Text)
+		assert.Len(t, text.Annotations, 2)
+
+		md, err := b.ReasonMarkdown()
+		require.NoError(t, err)
+		assert.Equal(t, `+1 @bob \<3 \*thanks\* #fun`, md)
+	})
+	t.Run("HandlesMissingReason", func(t *testing.T) {
+		text, err := (&BonusResponse{}).ReasonText()
+		require.NoError(t, err)
+		assert.Empty(t, text.Text)
+	})
+}
@@ -0,0 +1,338 @@
+// Package recorder provides an HTTP transport that records HTTP interactions
+// to a cassette file and replays them later, so that tests can run
+// deterministically without network access.
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Mode is whether the recorder records or replays interactions.
+type Mode int
+
+const (
+	// ModeReplay replays interactions from the cassette without sending any
+	// requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests and records the interactions to the
+	// cassette, replacing any interactions that were already in it.
+	ModeRecord
+)
+
+// MatchMode is how requests are matched to recorded interactions when
+// replaying.
+type MatchMode int
+
+const (
+	// MatchStrict requires requests to be made in the same order as they
+	// were recorded, and each request must have the same method, URL and
+	// body as its recorded request.
+	MatchStrict MatchMode = iota
+	// MatchLenient replays the first unused interaction whose request has
+	// the same method and URL path, regardless of order, query or body. Once
+	// all matching interactions are used, the last one is replayed again.
+	MatchLenient
+)
+
+const redacted = "[REDACTED]"
+
+// Options represent options to create a recorder.
+type Options struct {
+	// CassettePath is the path to the JSON lines file containing the
+	// interactions.
+	CassettePath string
+	Mode         Mode
+	Match        MatchMode
+	// Transport sends requests in record mode. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// RedactHeaders are the request and response headers whose values are
+	// redacted when recording. The Authorization header is always redacted.
+	RedactHeaders []string
+	// RedactQueryParams are the request query parameters whose values are
+	// redacted when recording. The access_token parameter is always
+	// redacted.
+	RedactQueryParams []string
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.CassettePath == "" {
+		return errors.New("must specify a cassette path")
+	}
+	if o.Mode != ModeReplay && o.Mode != ModeRecord {
+		return errors.Errorf("invalid mode %d", o.Mode)
+	}
+	if o.Match != MatchStrict && o.Match != MatchLenient {
+		return errors.Errorf("invalid match mode %d", o.Match)
+	}
+	if o.Transport == nil {
+		o.Transport = http.DefaultTransport
+	}
+	o.RedactHeaders = append(o.RedactHeaders, "Authorization")
+	o.RedactQueryParams = append(o.RedactQueryParams, "access_token")
+	return nil
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an HTTP transport that records or replays interactions.
+type Recorder struct {
+	opts         Options
+	interactions []Interaction
+	used         []bool
+	next         int
+	cassette     *os.File
+	mu           sync.Mutex
+}
+
+// New returns a recorder with the given options. In replay mode, the cassette
+// must already exist. In record mode, the cassette is created or truncated.
+func New(opts Options) (*Recorder, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	r := &Recorder{opts: opts}
+	switch opts.Mode {
+	case ModeRecord:
+		f, err := os.Create(opts.CassettePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating cassette")
+		}
+		r.cassette = f
+	case ModeReplay:
+		interactions, err := readCassette(opts.CassettePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading cassette '%s'", opts.CassettePath)
+		}
+		r.interactions = interactions
+		r.used = make([]bool, len(interactions))
+	}
+	return r, nil
+}
+
+func readCassette(path string) ([]Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var interactions []Interaction
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var i Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return nil, errors.Wrapf(err, "parsing line %d", line)
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, errors.WithStack(scanner.Err())
+}
+
+// Client returns an HTTP client that uses the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip records or replays the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading request body")
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.opts.Mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.opts.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading response body")
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	i := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.redactURL(req.URL),
+			Header: r.redactHeader(req.Header),
+			Body:   string(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactHeader(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+	b, err := json.Marshal(i)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling interaction")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.cassette.Write(append(b, '\n')); err != nil {
+		return nil, errors.Wrap(err, "writing interaction to cassette")
+	}
+	r.interactions = append(r.interactions, i)
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx, err := r.match(req, body)
+	if err != nil {
+		return nil, err
+	}
+	r.used[idx] = true
+
+	recorded := r.interactions[idx].Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode:    recorded.StatusCode,
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// match returns the index of the recorded interaction to replay for the
+// request.
+func (r *Recorder) match(req *http.Request, body []byte) (int, error) {
+	if r.opts.Match == MatchStrict {
+		if r.next >= len(r.interactions) {
+			return 0, errors.Errorf("no recorded interaction left for request %s %s", req.Method, req.URL)
+		}
+		recorded := r.interactions[r.next].Request
+		if recorded.Method != req.Method || recorded.URL != r.redactURL(req.URL) || recorded.Body != string(body) {
+			return 0, errors.Errorf("request %s %s does not match the next recorded request %s %s", req.Method, req.URL, recorded.Method, recorded.URL)
+		}
+		r.next++
+		return r.next - 1, nil
+	}
+
+	last := -1
+	for i, interaction := range r.interactions {
+		recorded, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parsing recorded URL '%s'", interaction.Request.URL)
+		}
+		if interaction.Request.Method != req.Method || recorded.Path != req.URL.Path {
+			continue
+		}
+		if !r.used[i] {
+			return i, nil
+		}
+		last = i
+	}
+	if last == -1 {
+		return 0, errors.Errorf("no recorded interaction matches request %s %s", req.Method, req.URL)
+	}
+	return last, nil
+}
+
+// Close closes the cassette. It returns an error if not all recorded
+// interactions were replayed in strict replay mode.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cassette != nil {
+		return errors.Wrap(r.cassette.Close(), "closing cassette")
+	}
+	if r.opts.Match == MatchStrict && r.next < len(r.interactions) {
+		return errors.Errorf("%d recorded interaction(s) were not replayed", len(r.interactions)-r.next)
+	}
+	return nil
+}
+
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	redactedHeader := h.Clone()
+	for _, k := range r.opts.RedactHeaders {
+		if _, ok := redactedHeader[http.CanonicalHeaderKey(k)]; ok {
+			redactedHeader.Set(k, redacted)
+		}
+	}
+	return redactedHeader
+}
+
+func (r *Recorder) redactURL(u *url.URL) string {
+	q := u.Query()
+	var changed bool
+	for _, param := range r.opts.RedactQueryParams {
+		if _, ok := q[param]; ok {
+			q.Set(param, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = q.Encode()
+	return redactedURL.String()
+}
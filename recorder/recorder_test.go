@@ -0,0 +1,128 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// cassettePath returns a path for a cassette in a temporary directory.
+func cassettePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "recorder")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "cassette.jsonl")
+}
+
+func doRequest(t *testing.T, c *http.Client, method, url, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func record(t *testing.T, srv *httptest.Server, path string) {
+	rec, err := New(Options{CassettePath: path, Mode: ModeRecord})
+	require.NoError(t, err)
+	doRequest(t, rec.Client(), http.MethodPost, srv.URL+"/bonuses?access_token=secret", "first")
+	doRequest(t, rec.Client(), http.MethodGet, srv.URL+"/users/me", "")
+	require.NoError(t, rec.Close())
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("RecordsRedactedInteractions", func(t *testing.T) {
+		srv := newTestServer(t)
+		path := cassettePath(t)
+		record(t, srv, path)
+
+		cassette, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(cassette), "secret")
+
+		interactions, err := readCassette(path)
+		require.NoError(t, err)
+		require.Len(t, interactions, 2)
+		assert.Equal(t, http.MethodPost, interactions[0].Request.Method)
+		assert.Equal(t, srv.URL+"/bonuses?access_token=%5BREDACTED%5D", interactions[0].Request.URL)
+		assert.Equal(t, redacted, interactions[0].Request.Header.Get("Authorization"))
+		assert.Equal(t, "first", interactions[0].Request.Body)
+		assert.Equal(t, http.StatusCreated, interactions[0].Response.StatusCode)
+		assert.Equal(t, "POST /bonuses first", interactions[0].Response.Body)
+	})
+	t.Run("ReplaysStrictly", func(t *testing.T) {
+		srv := newTestServer(t)
+		path := cassettePath(t)
+		record(t, srv, path)
+		srv.Close()
+
+		rec, err := New(Options{CassettePath: path})
+		require.NoError(t, err)
+		resp, body := doRequest(t, rec.Client(), http.MethodPost, srv.URL+"/bonuses?access_token=other", "first")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "POST /bonuses first", body)
+		_, body = doRequest(t, rec.Client(), http.MethodGet, srv.URL+"/users/me", "")
+		assert.Equal(t, "GET /users/me ", body)
+		assert.NoError(t, rec.Close())
+	})
+	t.Run("StrictReplayFailsWithMismatchedRequest", func(t *testing.T) {
+		srv := newTestServer(t)
+		path := cassettePath(t)
+		record(t, srv, path)
+
+		rec, err := New(Options{CassettePath: path})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/bonuses?access_token=secret", strings.NewReader("second"))
+		require.NoError(t, err)
+		_, err = rec.Client().Do(req)
+		assert.Error(t, err)
+		assert.Error(t, rec.Close(), "should fail when interactions were not replayed")
+	})
+	t.Run("ReplaysLeniently", func(t *testing.T) {
+		srv := newTestServer(t)
+		path := cassettePath(t)
+		record(t, srv, path)
+
+		rec, err := New(Options{CassettePath: path, Match: MatchLenient})
+		require.NoError(t, err)
+		_, body := doRequest(t, rec.Client(), http.MethodGet, srv.URL+"/users/me?include=all", "")
+		assert.Equal(t, "GET /users/me ", body)
+		_, body = doRequest(t, rec.Client(), http.MethodPost, srv.URL+"/bonuses", "different")
+		assert.Equal(t, "POST /bonuses first", body)
+		_, body = doRequest(t, rec.Client(), http.MethodPost, srv.URL+"/bonuses", "again")
+		assert.Equal(t, "POST /bonuses first", body, "should replay last matching interaction")
+
+		req, err := http.NewRequest(http.MethodDelete, srv.URL+"/bonuses", nil)
+		require.NoError(t, err)
+		_, err = rec.Client().Do(req)
+		assert.Error(t, err)
+		assert.NoError(t, rec.Close())
+	})
+	t.Run("FailsWithMissingCassette", func(t *testing.T) {
+		_, err := New(Options{CassettePath: cassettePath(t)})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,477 @@
+// Package render converts the HTML of bonus reasons into Markdown, plain
+// text with mention and hashtag annotations, and colored ANSI terminal
+// output.
+package render
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Kind is a kind of annotation.
+type Kind string
+
+// Kinds of annotations.
+const (
+	Mention Kind = "mention"
+	Hashtag Kind = "hashtag"
+	Link    Kind = "link"
+)
+
+// Annotation marks a mention, hashtag or link in plain text.
+type Annotation struct {
+	Kind Kind `json:"kind"`
+	// Value is the mentioned username or hashtag, without the leading @ or
+	// #, or the URL of a link.
+	Value string `json:"value"`
+	// Start and End are the byte offsets of the annotated text.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Text is plain text with annotations.
+type Text struct {
+	Text        string       `json:"text"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Format is an output format.
+type Format string
+
+// Output formats.
+const (
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+	FormatANSI     Format = "ansi"
+)
+
+// PlainText renders the reason HTML as plain text with annotations.
+func PlainText(reasonHTML string) (*Text, error) {
+	r, err := renderHTML(reasonHTML, FormatText)
+	if err != nil {
+		return nil, err
+	}
+	return &Text{Text: r.String(), Annotations: r.annotations}, nil
+}
+
+// Markdown renders the reason HTML as Markdown.
+func Markdown(reasonHTML string) (string, error) {
+	r, err := renderHTML(reasonHTML, FormatMarkdown)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// ANSI renders the reason HTML as text colored with ANSI escape codes.
+func ANSI(reasonHTML string) (string, error) {
+	r, err := renderHTML(reasonHTML, FormatANSI)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// Render renders the reason HTML in the format.
+func Render(reasonHTML string, f Format) (string, error) {
+	switch f {
+	case FormatText:
+		t, err := PlainText(reasonHTML)
+		if err != nil {
+			return "", err
+		}
+		return t.Text, nil
+	case FormatMarkdown:
+		return Markdown(reasonHTML)
+	case FormatANSI:
+		return ANSI(reasonHTML)
+	default:
+		return "", errors.Errorf("unknown format '%s'", f)
+	}
+}
+
+// ANSI escape codes.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiMention   = "\x1b[1;36m"
+	ansiHashtag   = "\x1b[35m"
+	ansiLink      = "\x1b[4;34m"
+	ansiCode      = "\x1b[33m"
+)
+
+type renderer struct {
+	format      Format
+	buf         strings.Builder
+	annotations []Annotation
+	// last is the last visible character written, or 0 at the start.
+	last byte
+	// pendingSpace is whether whitespace was collapsed and should be
+	// written before the next visible text.
+	pendingSpace bool
+	// styles are the open ANSI styles, which are reapplied after a nested
+	// style is reset.
+	styles []string
+	// annotating is whether the text being rendered is inside a mention,
+	// hashtag or link, so it is not scanned for more.
+	annotating bool
+	// listDepth is the number of open lists.
+	listDepth int
+}
+
+func renderHTML(reasonHTML string, f Format) (*renderer, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(reasonHTML), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing reason HTML")
+	}
+	r := &renderer{format: f}
+	for _, n := range nodes {
+		r.walk(n)
+	}
+	return r, nil
+}
+
+// String returns the rendered output without trailing whitespace.
+func (r *renderer) String() string {
+	return strings.TrimRight(r.buf.String(), " \n")
+}
+
+func (r *renderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title:
+	case atom.Br:
+		r.newlines(1)
+	case atom.Img:
+		r.text(attr(n, "alt"))
+	case atom.P, atom.Div, atom.Blockquote, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Pre:
+		r.newlines(2)
+		r.children(n)
+		r.newlines(2)
+	case atom.Ul, atom.Ol:
+		r.newlines(2)
+		r.listDepth++
+		r.children(n)
+		r.listDepth--
+		r.newlines(2)
+	case atom.Li:
+		r.newlines(1)
+		r.markup(strings.Repeat("  ", maxInt(r.listDepth-1, 0)) + "- ")
+		r.children(n)
+		r.newlines(1)
+	case atom.Strong, atom.B:
+		r.styled(n, "**", ansiBold)
+	case atom.Em, atom.I:
+		r.styled(n, "_", ansiItalic)
+	case atom.U:
+		r.styled(n, "", ansiUnderline)
+	case atom.Code:
+		r.styled(n, "`", ansiCode)
+	default:
+		if kind, value, ok := annotation(n); ok {
+			r.annotated(n, kind, value)
+			return
+		}
+		r.children(n)
+	}
+}
+
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+}
+
+// styled renders the children of the node wrapped in the Markdown delimiter
+// or ANSI style.
+func (r *renderer) styled(n *html.Node, delimiter, style string) {
+	switch r.format {
+	case FormatMarkdown:
+		r.markup(delimiter)
+		r.children(n)
+		r.closeMarkup(delimiter)
+	case FormatANSI:
+		r.openStyle(style)
+		r.children(n)
+		r.closeStyle()
+	default:
+		r.children(n)
+	}
+}
+
+// annotated renders a mention, hashtag or link.
+func (r *renderer) annotated(n *html.Node, kind Kind, value string) {
+	href := safeHref(attr(n, "href"))
+	annotating := r.annotating
+	r.annotating = true
+	defer func() { r.annotating = annotating }()
+
+	switch r.format {
+	case FormatMarkdown:
+		if kind == Link || isAbsoluteURL(href) {
+			r.markup("[")
+			r.children(n)
+			r.closeMarkup("](" + markdownHref.Replace(href) + ")")
+			return
+		}
+		r.children(n)
+	case FormatANSI:
+		r.openStyle(map[Kind]string{Mention: ansiMention, Hashtag: ansiHashtag, Link: ansiLink}[kind])
+		r.children(n)
+		r.closeStyle()
+	default:
+		r.flushSpace()
+		start := r.buf.Len()
+		r.children(n)
+		end := r.buf.Len()
+		if kind == Link && href != "" && strings.TrimSpace(textContent(n)) != href {
+			r.text(" (" + href + ")")
+		}
+		if end > start {
+			r.annotations = append(r.annotations, Annotation{Kind: kind, Value: value, Start: start, End: end})
+		}
+	}
+}
+
+var inlineAnnotation = regexp.MustCompile(`(^|[^\pL\pN_@#&])([@#])([\pL\pN_][\pL\pN_.\-]*[\pL\pN_]|[\pL\pN_])`)
+
+// text writes text with collapsed whitespace and without control characters,
+// so that the reason cannot inject terminal escape sequences. Mentions and
+// hashtags in text that is not already annotated are annotated.
+func (r *renderer) text(s string) {
+	s = stripControl(s)
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			r.pendingSpace = true
+		}
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n\f") != s {
+		r.pendingSpace = true
+	}
+	for i, field := range fields {
+		if i > 0 {
+			r.pendingSpace = true
+		}
+		r.word(field)
+	}
+	if strings.TrimRight(s, " \t\r\n\f") != s {
+		r.pendingSpace = true
+	}
+}
+
+// word writes a word without whitespace.
+func (r *renderer) word(s string) {
+	if r.annotating {
+		r.visible(r.escape(s))
+		return
+	}
+	matches := inlineAnnotation.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		r.visible(r.escape(s))
+		return
+	}
+	prev := 0
+	for _, m := range matches {
+		// m[2:4] is the preceding character, m[4:6] the sigil and m[6:8]
+		// the name.
+		if m[4] > prev {
+			r.visible(r.escape(s[prev:m[4]]))
+		}
+		kind := Mention
+		if s[m[4]] == '#' {
+			kind = Hashtag
+		}
+		token := s[m[4]:m[7]]
+		switch r.format {
+		case FormatANSI:
+			r.openStyle(map[Kind]string{Mention: ansiMention, Hashtag: ansiHashtag}[kind])
+			r.visible(token)
+			r.closeStyle()
+		case FormatText:
+			r.flushSpace()
+			start := r.buf.Len()
+			r.visible(token)
+			r.annotations = append(r.annotations, Annotation{Kind: kind, Value: s[m[6]:m[7]], Start: start, End: r.buf.Len()})
+		default:
+			r.visible(r.escape(token))
+		}
+		prev = m[7]
+	}
+	if prev < len(s) {
+		r.visible(r.escape(s[prev:]))
+	}
+}
+
+// markdownHref escapes the characters that would end a Markdown link
+// destination early.
+var markdownHref = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", `\`, "%5C")
+
+var markdownSpecial = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+func (r *renderer) escape(s string) string {
+	if r.format == FormatMarkdown {
+		return markdownSpecial.Replace(s)
+	}
+	return s
+}
+
+// visible writes visible text, preceded by any pending space.
+func (r *renderer) visible(s string) {
+	if s == "" {
+		return
+	}
+	r.flushSpace()
+	r.buf.WriteString(s)
+	r.last = s[len(s)-1]
+}
+
+func (r *renderer) flushSpace() {
+	if r.pendingSpace && r.last != 0 && r.last != ' ' && r.last != '\n' {
+		r.buf.WriteByte(' ')
+		r.last = ' '
+	}
+	r.pendingSpace = false
+}
+
+// markup writes opening markup, which is preceded by any pending space.
+func (r *renderer) markup(s string) {
+	r.visible(s)
+}
+
+// closeMarkup writes closing markup, which any pending space follows.
+func (r *renderer) closeMarkup(s string) {
+	pending := r.pendingSpace
+	r.pendingSpace = false
+	r.buf.WriteString(s)
+	if s != "" {
+		r.last = s[len(s)-1]
+	}
+	r.pendingSpace = pending
+}
+
+func (r *renderer) openStyle(style string) {
+	r.flushSpace()
+	r.styles = append(r.styles, style)
+	r.buf.WriteString(style)
+}
+
+func (r *renderer) closeStyle() {
+	r.styles = r.styles[:len(r.styles)-1]
+	r.buf.WriteString(ansiReset)
+	for _, style := range r.styles {
+		r.buf.WriteString(style)
+	}
+}
+
+// newlines ends the current line and ensures that it is followed by at
+// least n-1 blank lines, unless nothing was written yet.
+func (r *renderer) newlines(n int) {
+	r.pendingSpace = false
+	if r.last == 0 {
+		return
+	}
+	s := r.buf.String()
+	trailing := len(s) - len(strings.TrimRight(s, "\n"))
+	for ; trailing < n; trailing++ {
+		r.buf.WriteByte('\n')
+	}
+	r.last = '\n'
+}
+
+// annotation returns the kind and value of the annotation that the element
+// represents, if any. Mentions and hashtags are recognized by their class,
+// their link to a user or hashtag page, or their leading @ or #.
+func annotation(n *html.Node) (Kind, string, bool) {
+	text := strings.TrimSpace(stripControl(textContent(n)))
+	class := " " + attr(n, "class") + " "
+	href := attr(n, "href")
+	switch {
+	case strings.Contains(class, " mention ") || strings.Contains(href, "/users/") && strings.HasPrefix(text, "@"):
+		return Mention, strings.TrimPrefix(text, "@"), true
+	case strings.Contains(class, " hashtag ") || strings.Contains(href, "/hashtags/") && strings.HasPrefix(text, "#"):
+		return Hashtag, strings.TrimPrefix(text, "#"), true
+	case n.DataAtom == atom.A && safeHref(href) != "":
+		return Link, safeHref(href), true
+	}
+	return "", "", false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// stripControl removes C0 and C1 control characters other than whitespace,
+// which is collapsed when rendered.
+func stripControl(s string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) && !unicode.IsSpace(c) {
+			return -1
+		}
+		return c
+	}, s)
+}
+
+// safeHref returns the href if it is an http(s) or mailto URL, or an empty
+// string otherwise, so that other links, such as javascript: and data: URLs,
+// are rendered as plain text.
+func safeHref(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return href
+	}
+	return ""
+}
+
+func isAbsoluteURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
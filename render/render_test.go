@@ -0,0 +1,130 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	bonuslyHTML = `+5 <a href="/company/users/alice">@alice</a> thanks for the thorough review <a href="/company/hashtags/teamwork">#teamwork</a>`
+	richHTML    = "<p>+10 @bob_s and <span class=\"mention\">@carol</span>\n  did <strong>great</strong> work on <a href=\"https://example.com/pr/1\">the PR</a>.</p>" +
+		"<p>Thanks! <img class=\"emoji\" alt=\"🎉\"> #team-work, email bob@example.com &amp; more</p><ul><li>one</li><li>two <em>it</em></li></ul>"
+)
+
+func TestPlainText(t *testing.T) {
+	t.Run("AnnotatesBonuslyLinks", func(t *testing.T) {
+		text, err := PlainText(bonuslyHTML)
+		require.NoError(t, err)
+		assert.Equal(t, "+5 @alice thanks for the thorough review #teamwork", text.Text)
+		assert.Equal(t, []Annotation{
+			{Kind: Mention, Value: "alice", Start: 3, End: 9},
+			{Kind: Hashtag, Value: "teamwork", Start: 41, End: 50},
+		}, text.Annotations)
+	})
+	t.Run("AnnotatesRichMarkup", func(t *testing.T) {
+		text, err := PlainText(richHTML)
+		require.NoError(t, err)
+		assert.Equal(t, "+10 @bob_s and @carol did great work on the PR (https://example.com/pr/1).\n\n"+
+			"Thanks! 🎉 #team-work, email bob@example.com & more\n\n- one\n- two it", text.Text)
+
+		var annotated []string
+		for _, a := range text.Annotations {
+			annotated = append(annotated, string(a.Kind)+":"+a.Value+":"+text.Text[a.Start:a.End])
+		}
+		assert.Equal(t, []string{
+			"mention:bob_s:@bob_s",
+			"mention:carol:@carol",
+			"link:https://example.com/pr/1:the PR",
+			"hashtag:team-work:#team-work",
+		}, annotated, "should not annotate emails")
+	})
+	t.Run("HandlesEmptyHTML", func(t *testing.T) {
+		text, err := PlainText("")
+		require.NoError(t, err)
+		assert.Empty(t, text.Text)
+		assert.Empty(t, text.Annotations)
+	})
+}
+
+func TestMarkdown(t *testing.T) {
+	md, err := Markdown(bonuslyHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "+5 @alice thanks for the thorough review #teamwork", md)
+
+	md, err = Markdown(richHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "+10 @bob\\_s and @carol did **great** work on [the PR](https://example.com/pr/1).\n\n"+
+		"Thanks! 🎉 #team-work, email bob@example.com & more\n\n- one\n- two _it_", md)
+
+	md, err = Markdown(`<a class="mention" href="https://bonus.ly/company/users/alice">@alice</a> fixed *all* the [bugs]`)
+	require.NoError(t, err)
+	assert.Equal(t, `[@alice](https://bonus.ly/company/users/alice) fixed \*all\* the \[bugs\]`, md)
+}
+
+func TestANSI(t *testing.T) {
+	out, err := ANSI(bonuslyHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "+5 \x1b[1;36m@alice\x1b[0m thanks for the thorough review \x1b[35m#teamwork\x1b[0m", out)
+
+	out, err = ANSI(`<strong>very <em>great</em> work</strong> #x`)
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[1mvery \x1b[3mgreat\x1b[0m\x1b[1m work\x1b[0m \x1b[35m#x\x1b[0m", out, "should reapply outer styles")
+}
+
+func TestRender(t *testing.T) {
+	for _, f := range []Format{FormatText, FormatMarkdown, FormatANSI} {
+		t.Run(string(f), func(t *testing.T) {
+			out, err := Render("<b>hi</b>", f)
+			require.NoError(t, err)
+			assert.Contains(t, out, "hi")
+		})
+	}
+	_, err := Render("hi", "html")
+	assert.Error(t, err)
+}
+
+func TestUntrustedInput(t *testing.T) {
+	t.Run("StripsControlCharacters", func(t *testing.T) {
+		for _, f := range []Format{FormatText, FormatMarkdown, FormatANSI} {
+			t.Run(string(f), func(t *testing.T) {
+				out, err := Render("+1 @alice \x1b]0;pwned\x07<b>thanks\x1b[2J\u009b31m</b>&#27;[31m<img alt=\"\x1b[5m\">", f)
+				require.NoError(t, err)
+				assert.NotContains(t, out, "pwned\x07")
+				for _, c := range []string{"\x07", "\u009b", "\x1b]", "\x1b[2J", "\x1b[31m", "\x1b[5m"} {
+					assert.NotContains(t, out, c)
+				}
+			})
+		}
+	})
+	t.Run("DropsUnsafeLinks", func(t *testing.T) {
+		for name, href := range map[string]string{
+			"JavaScript": "javascript:alert(1)",
+			"MixedCase":  "JaVaScRiPt:alert(1)",
+			"Data":       "data:text/html;base64,PHNjcmlwdD4=",
+			"Relative":   "/company/settings",
+		} {
+			t.Run(name, func(t *testing.T) {
+				reason := `<a href="` + href + `">click</a> me`
+				md, err := Markdown(reason)
+				require.NoError(t, err)
+				assert.Equal(t, "click me", md)
+
+				text, err := PlainText(reason)
+				require.NoError(t, err)
+				assert.Equal(t, "click me", text.Text)
+				assert.Empty(t, text.Annotations)
+			})
+		}
+	})
+	t.Run("EscapesMarkdownLinkDestinations", func(t *testing.T) {
+		md, err := Markdown(`<a href="https://example.com/a b)(<c>\d">link</a>`)
+		require.NoError(t, err)
+		assert.Equal(t, "[link](https://example.com/a%20b%29%28%3Cc%3E%5Cd)", md)
+
+		md, err = Markdown(`<a href="mailto:alice@example.com">mail</a>`)
+		require.NoError(t, err)
+		assert.Equal(t, "[mail](mailto:alice@example.com)", md)
+	})
+}
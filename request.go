@@ -15,6 +15,11 @@ type CreateBonusRequest struct {
 	GiverEmail    string `json:"giver_email,omitempty"`
 	Reason        string `json:"reason,omitempty"`
 	ParentBonusID string `json:"parent_bonus_id,omitempty"`
+	// IdempotencyKey, if set, ensures that the bonus is created at most once
+	// no matter how many times it is requested with the same key. It is
+	// recorded with the request in the idempotency store, but it is not sent
+	// to Bonusly.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 type ListBonusesRequest struct {
@@ -88,3 +93,31 @@ func (r *ListRewardsRequest) QueryMap() map[string]string {
 	}
 	return q
 }
+
+type ListUsersRequest struct {
+	Limit           uint
+	Skip            uint
+	Email           string
+	UserMode        string
+	IncludeArchived bool
+}
+
+func (r *ListUsersRequest) QueryMap() map[string]string {
+	q := map[string]string{}
+	if r.Limit != 0 {
+		q["limit"] = strconv.Itoa(int(r.Limit))
+	}
+	if r.Skip != 0 {
+		q["skip"] = strconv.Itoa(int(r.Skip))
+	}
+	if r.Email != "" {
+		q["email"] = r.Email
+	}
+	if r.UserMode != "" {
+		q["user_mode"] = r.UserMode
+	}
+	if r.IncludeArchived {
+		q["include_archived"] = strconv.FormatBool(r.IncludeArchived)
+	}
+	return q
+}
@@ -1,22 +1,50 @@
 package bonusly
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type CommonResponse struct {
 	Success *bool   `json:"success,omitempty"`
 	Message *string `json:"message,omitempty"`
 }
 
+// ResponseError is returned when the Bonusly API responds with an
+// unsuccessful status. Use errors.Cause to get it from a returned error.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status %s", e.Status)
+	}
+	return fmt.Sprintf("status %s: %s", e.Status, e.Message)
+}
+
+// resultWrapper is implemented by responses that wrap the result of a call.
+type resultWrapper interface {
+	// result returns a pointer to the wrapped result.
+	result() interface{}
+}
+
 type bonusResponseWrapper struct {
 	CommonResponse
 	Result BonusResponse `json:"result,omitempty"`
 }
 
+func (w *bonusResponseWrapper) result() interface{} { return &w.Result }
+
 type bonusesResponseWrapper struct {
 	CommonResponse
 	Result []BonusResponse `json:"result,omitempty"`
 }
 
+func (w *bonusesResponseWrapper) result() interface{} { return &w.Result }
+
 type BonusResponse struct {
 	ID                 *string           `json:"id,omitempty"`
 	CreatedAt          *time.Time        `json:"created_at,omitempty"`
@@ -39,6 +67,8 @@ type rewardsResponseWrapper struct {
 	Result []RewardsResponse `json:"result,omitempty"`
 }
 
+func (w *rewardsResponseWrapper) result() interface{} { return &w.Result }
+
 type RewardsResponse struct {
 	Type    string           `json:"type,omitempty"`
 	Name    string           `json:"name,omitempty"`
@@ -72,6 +102,15 @@ type userInfoResponseWrapper struct {
 	Result UserInfoResponse `json:"result,omitempty"`
 }
 
+func (w *userInfoResponseWrapper) result() interface{} { return &w.Result }
+
+type usersResponseWrapper struct {
+	CommonResponse
+	Result []UserInfoResponse `json:"result,omitempty"`
+}
+
+func (w *usersResponseWrapper) result() interface{} { return &w.Result }
+
 type UserInfoResponse struct {
 	ID                           *string                `json:"id,omitempty"`
 	UserName                     *string                `json:"username,omitempty"`
@@ -105,3 +144,16 @@ type UserInfoResponse struct {
 	Number                       *string                `json:"number,omitempty"`
 	CustomProperties             map[string]interface{} `json:"custom_properties,omitempty"`
 }
+
+type companyResponseWrapper struct {
+	CommonResponse
+	Result CompanyResponse `json:"result,omitempty"`
+}
+
+func (w *companyResponseWrapper) result() interface{} { return &w.Result }
+
+type CompanyResponse struct {
+	ID              *string   `json:"id,omitempty"`
+	Name            *string   `json:"name,omitempty"`
+	CompanyHashtags *[]string `json:"company_hashtags,omitempty"`
+}
@@ -0,0 +1,342 @@
+// Package rules gives bonuses automatically when events match declarative
+// rules, such as "when a pull request is merged, give its author 5 points",
+// with caps on how often each person is recognized and how much each giver
+// spends.
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/templates"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a set of rules and the budgets of the givers they give from.
+type Config struct {
+	Rules   []Rule   `yaml:"rules"`
+	Budgets []Budget `yaml:"budgets"`
+}
+
+// Rule gives a bonus when an event matches all of its conditions.
+type Rule struct {
+	Name string      `yaml:"name"`
+	When []Condition `yaml:"when"`
+	Give Give        `yaml:"give"`
+	// RecipientCap limits how many bonuses the rule gives each recipient.
+	RecipientCap *Cap `yaml:"recipient_cap"`
+}
+
+// Condition matches an event if the field at its path, such as
+// "pull_request.user.login", satisfies every operator that is set.
+type Condition struct {
+	Field     string        `yaml:"field"`
+	Equals    interface{}   `yaml:"equals"`
+	NotEquals interface{}   `yaml:"not_equals"`
+	In        []interface{} `yaml:"in"`
+	Contains  string        `yaml:"contains"`
+	Matches   string        `yaml:"matches"`
+	Exists    *bool         `yaml:"exists"`
+	GT        *float64      `yaml:"gt"`
+	GTE       *float64      `yaml:"gte"`
+	LT        *float64      `yaml:"lt"`
+	LTE       *float64      `yaml:"lte"`
+
+	matches *regexp.Regexp
+}
+
+// Give describes the bonus that a rule gives. The recipient and reason are
+// text/template templates that are executed with TemplateData, and may use
+// the helpers from the templates package.
+type Give struct {
+	// GiverEmail is the email of the giver. If it is not set, bonuses are
+	// given by the user making requests.
+	GiverEmail string `yaml:"giver_email"`
+	// Recipient is the username of the recipient, such as
+	// "{{.Event.author}}".
+	Recipient string `yaml:"recipient"`
+	Amount    int    `yaml:"amount"`
+	// Reason is the reason of the bonus, such as
+	// "{{amount .Amount}} {{mention .Recipient}} shipped {{.Event.title}}".
+	// The amount in the rendered reason is what counts towards the giver's
+	// budget.
+	Reason string `yaml:"reason"`
+
+	recipient *template.Template
+	reason    *template.Template
+}
+
+// TemplateData is the data that recipient and reason templates are executed
+// with. The recipient is only set for the reason template.
+type TemplateData struct {
+	Event     map[string]interface{}
+	Rule      string
+	Amount    int
+	Recipient string
+}
+
+// Cap is a maximum number of bonuses per period.
+type Cap struct {
+	Max    int      `yaml:"max"`
+	Period Duration `yaml:"period"`
+}
+
+// Budget is the maximum amount that a giver can give per period through the
+// rules.
+type Budget struct {
+	GiverEmail string   `yaml:"giver_email"`
+	Amount     int      `yaml:"amount"`
+	Period     Duration `yaml:"period"`
+}
+
+// Duration is a time.Duration that is given in YAML as a string such as
+// "24h". The suffix "d" is also supported for days, such as "7d".
+type Duration time.Duration
+
+// UnmarshalYAML parses the duration.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errors.Errorf("invalid duration '%s'", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	return d, errors.Wrapf(err, "invalid duration '%s'", s)
+}
+
+// LoadFile loads and validates the config from a YAML file.
+func LoadFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading rules file '%s'", path)
+	}
+	return Parse(b)
+}
+
+// Parse parses and validates the config from YAML.
+func Parse(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrap(err, "parsing rules")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid rules")
+	}
+	return &c, nil
+}
+
+// Validate checks that the config is valid and compiles its templates and
+// regular expressions.
+func (c *Config) Validate() error {
+	names := map[string]bool{}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			return errors.Errorf("rule %d must have a name", i)
+		}
+		if names[r.Name] {
+			return errors.Errorf("duplicate rule name '%s'", r.Name)
+		}
+		names[r.Name] = true
+		if err := r.validate(); err != nil {
+			return errors.Wrapf(err, "rule '%s'", r.Name)
+		}
+	}
+
+	givers := map[string]bool{}
+	for _, b := range c.Budgets {
+		if givers[b.GiverEmail] {
+			return errors.Errorf("duplicate budget for giver '%s'", b.GiverEmail)
+		}
+		givers[b.GiverEmail] = true
+		if b.Amount <= 0 || b.Period <= 0 {
+			return errors.Errorf("budget for giver '%s' must have a positive amount and period", b.GiverEmail)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	for i := range r.When {
+		if err := r.When[i].validate(); err != nil {
+			return errors.Wrapf(err, "condition %d", i)
+		}
+	}
+	if r.Give.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if r.Give.Recipient == "" || r.Give.Reason == "" {
+		return errors.New("recipient and reason must be set")
+	}
+	var err error
+	if r.Give.recipient, err = parseTemplate("recipient", r.Give.Recipient); err != nil {
+		return err
+	}
+	if r.Give.reason, err = parseTemplate("reason", r.Give.Reason); err != nil {
+		return err
+	}
+	if r.RecipientCap != nil && (r.RecipientCap.Max <= 0 || r.RecipientCap.Period <= 0) {
+		return errors.New("recipient cap must have a positive max and period")
+	}
+	return nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templates.Funcs()).Option("missingkey=zero").Parse(text)
+	return tmpl, errors.Wrapf(err, "parsing %s template", name)
+}
+
+func (c *Condition) validate() error {
+	if c.Field == "" {
+		return errors.New("field must be set")
+	}
+	if c.Matches != "" {
+		var err error
+		if c.matches, err = regexp.Compile(c.Matches); err != nil {
+			return errors.Wrapf(err, "compiling pattern '%s'", c.Matches)
+		}
+	}
+	return nil
+}
+
+// match returns whether the event satisfies the condition.
+func (c *Condition) match(event map[string]interface{}) bool {
+	v, ok := lookup(event, c.Field)
+	if c.Exists != nil && *c.Exists != ok {
+		return false
+	}
+	if !ok {
+		// Only an existence check can match a missing field.
+		return c.Exists != nil && c.Equals == nil && c.NotEquals == nil && c.In == nil &&
+			c.Contains == "" && c.matches == nil && c.GT == nil && c.GTE == nil && c.LT == nil && c.LTE == nil
+	}
+	if c.Equals != nil && !equal(v, c.Equals) {
+		return false
+	}
+	if c.NotEquals != nil && equal(v, c.NotEquals) {
+		return false
+	}
+	if c.In != nil {
+		found := false
+		for _, candidate := range c.In {
+			if equal(v, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.Contains != "" && !contains(v, c.Contains) {
+		return false
+	}
+	if c.matches != nil && !c.matches.MatchString(fmt.Sprint(v)) {
+		return false
+	}
+	for _, cmp := range []struct {
+		bound *float64
+		ok    func(a, b float64) bool
+	}{
+		{c.GT, func(a, b float64) bool { return a > b }},
+		{c.GTE, func(a, b float64) bool { return a >= b }},
+		{c.LT, func(a, b float64) bool { return a < b }},
+		{c.LTE, func(a, b float64) bool { return a <= b }},
+	} {
+		if cmp.bound == nil {
+			continue
+		}
+		n, ok := toFloat(v)
+		if !ok || !cmp.ok(n, *cmp.bound) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the value at the dot-separated path in the event, where
+// numeric parts index into arrays.
+func lookup(event map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = event
+	for _, part := range strings.Split(path, ".") {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			next, ok := cur[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(cur) {
+				return nil, false
+			}
+			v = cur[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// equal returns whether the values are equal, comparing numbers by value so
+// that JSON and YAML numbers of different types match.
+func equal(a, b interface{}) bool {
+	fa, aNum := toFloat(a)
+	fb, bNum := toFloat(b)
+	if aNum && bNum {
+		return fa == fb
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// contains returns whether a string contains the substring or an array
+// contains it as an element.
+func contains(v interface{}, sub string) bool {
+	switch v := v.(type) {
+	case string:
+		return strings.Contains(v, sub)
+	case []interface{}:
+		for _, elem := range v {
+			if equal(elem, sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
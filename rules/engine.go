@@ -0,0 +1,276 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/pkg/errors"
+)
+
+// Status is the outcome of a rule that matched an event.
+type Status string
+
+// Statuses of rules that matched an event.
+const (
+	// StatusGiven is a rule that gave its bonus.
+	StatusGiven Status = "given"
+	// StatusSimulated is a rule that would have given its bonus.
+	StatusSimulated Status = "simulated"
+	// StatusCapped is a rule that did not give its bonus because the
+	// recipient's cap or the giver's budget would have been exceeded.
+	StatusCapped Status = "capped"
+	// StatusFailed is a rule that failed to give its bonus.
+	StatusFailed Status = "failed"
+)
+
+// Outcome is the outcome of a rule that matched an event.
+type Outcome struct {
+	Rule    string                     `json:"rule"`
+	Status  Status                     `json:"status"`
+	Request bonusly.CreateBonusRequest `json:"request"`
+	Bonus   *bonusly.BonusResponse     `json:"bonus,omitempty"`
+	// Detail explains why the rule was capped or failed.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Firing is a bonus given by a rule, which counts towards caps and budgets.
+type Firing struct {
+	Rule       string    `json:"rule"`
+	Recipient  string    `json:"recipient"`
+	GiverEmail string    `json:"giver_email"`
+	Amount     int       `json:"amount"`
+	At         time.Time `json:"at"`
+}
+
+// Options represent options to run rules.
+type Options struct {
+	// Simulate reports which rules would give bonuses without giving them.
+	Simulate bool
+	// History is the bonuses previously given by the rules, which count
+	// towards caps and budgets.
+	History []Firing
+	// SaveHistory, if set, is called with the history after every bonus
+	// that a rule gives, so that it can be persisted before the next event
+	// is handled and caps and budgets are still enforced if the process
+	// stops unexpectedly. It is not called when simulating.
+	SaveHistory func(history []Firing) error
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *Options) Validate() error {
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return nil
+}
+
+// Engine matches events against rules and gives the bonuses of the rules
+// that match. It is safe for concurrent use.
+type Engine struct {
+	config  *Config
+	client  bonusly.Client
+	opts    Options
+	budgets map[string]Budget
+	// maxPeriod is the longest cap or budget period, beyond which firings
+	// no longer matter.
+	maxPeriod time.Duration
+
+	mu      sync.Mutex
+	history []Firing
+}
+
+// New returns an engine of the validated rules that gives bonuses with the
+// client. The client is not used when simulating.
+func New(config *Config, client bonusly.Client, opts Options) (*Engine, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	e := &Engine{
+		config:  config,
+		client:  client,
+		opts:    opts,
+		budgets: map[string]Budget{},
+		history: append([]Firing(nil), opts.History...),
+	}
+	for _, b := range config.Budgets {
+		e.budgets[b.GiverEmail] = b
+		if time.Duration(b.Period) > e.maxPeriod {
+			e.maxPeriod = time.Duration(b.Period)
+		}
+	}
+	for _, r := range config.Rules {
+		if r.RecipientCap != nil && time.Duration(r.RecipientCap.Period) > e.maxPeriod {
+			e.maxPeriod = time.Duration(r.RecipientCap.Period)
+		}
+	}
+	return e, nil
+}
+
+// History returns the bonuses given by the rules that still count towards
+// caps and budgets, including those given in simulations.
+func (e *Engine) History() []Firing {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.prune(e.opts.Now())
+	return append([]Firing(nil), e.history...)
+}
+
+// Handle matches the event against every rule, in order, and gives the
+// bonuses of those that match. It returns the outcomes of the rules that
+// matched. Failures to give bonuses are reported in the outcomes; an error
+// is only returned if the context is done or the history cannot be saved.
+func (e *Engine) Handle(ctx context.Context, event map[string]interface{}) ([]Outcome, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var outcomes []Outcome
+	for i := range e.config.Rules {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+		r := &e.config.Rules[i]
+		if !r.match(event) {
+			continue
+		}
+		out := e.fire(ctx, r, event)
+		outcomes = append(outcomes, out)
+		if out.Status == StatusGiven && e.opts.SaveHistory != nil {
+			if err := e.opts.SaveHistory(append([]Firing(nil), e.history...)); err != nil {
+				return outcomes, errors.Wrapf(err, "saving history after rule '%s' gave a bonus", r.Name)
+			}
+		}
+	}
+	return outcomes, nil
+}
+
+func (r *Rule) match(event map[string]interface{}) bool {
+	for i := range r.When {
+		if !r.When[i].match(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) fire(ctx context.Context, r *Rule, event map[string]interface{}) Outcome {
+	out := Outcome{Rule: r.Name}
+	fail := func(err error) Outcome {
+		out.Status = StatusFailed
+		out.Detail = err.Error()
+		return out
+	}
+
+	data := TemplateData{Event: event, Rule: r.Name, Amount: r.Give.Amount}
+	recipient, err := execute(r.Give.recipient, data)
+	if err != nil {
+		return fail(err)
+	}
+	recipient = strings.TrimPrefix(recipient, "@")
+	if recipient == "" {
+		return fail(errors.New("recipient is empty"))
+	}
+	data.Recipient = recipient
+	reason, err := execute(r.Give.reason, data)
+	if err != nil {
+		return fail(err)
+	}
+	out.Request = bonusly.CreateBonusRequest{GiverEmail: r.Give.GiverEmail, Reason: reason}
+	// Bonusly charges the amount in the reason rather than the rule's declared
+	// amount, so that is what counts towards the budget.
+	cost, err := bonusly.BonusCost(reason)
+	if err != nil {
+		return fail(errors.Wrap(err, "getting cost of reason"))
+	}
+
+	now := e.opts.Now()
+	e.prune(now)
+	if detail := e.capped(r, recipient, cost, now); detail != "" {
+		out.Status = StatusCapped
+		out.Detail = detail
+		return out
+	}
+
+	if e.opts.Simulate {
+		out.Status = StatusSimulated
+	} else {
+		bonus, err := e.client.CreateBonus(ctx, out.Request)
+		if err != nil {
+			return fail(errors.Wrap(err, "creating bonus"))
+		}
+		out.Status = StatusGiven
+		out.Bonus = bonus
+	}
+	e.history = append(e.history, Firing{
+		Rule:       r.Name,
+		Recipient:  recipient,
+		GiverEmail: r.Give.GiverEmail,
+		Amount:     cost,
+		At:         now,
+	})
+	return out
+}
+
+// capped returns why giving the rule's bonus costing the given amount to the
+// recipient would exceed a cap or budget, or an empty string if it would not.
+func (e *Engine) capped(r *Rule, recipient string, cost int, now time.Time) string {
+	if c := r.RecipientCap; c != nil {
+		since := now.Add(-time.Duration(c.Period))
+		var n int
+		for _, f := range e.history {
+			if f.Rule == r.Name && f.Recipient == recipient && f.At.After(since) {
+				n++
+			}
+		}
+		if n >= c.Max {
+			return fmt.Sprintf("recipient '%s' already received %d bonuses from this rule in the last %s",
+				recipient, n, time.Duration(c.Period))
+		}
+	}
+	if b, ok := e.budgets[r.Give.GiverEmail]; ok {
+		since := now.Add(-time.Duration(b.Period))
+		var spent int
+		for _, f := range e.history {
+			if f.GiverEmail == b.GiverEmail && f.At.After(since) {
+				spent += f.Amount
+			}
+		}
+		if spent+cost > b.Amount {
+			giver := b.GiverEmail
+			if giver == "" {
+				giver = "(default)"
+			}
+			return fmt.Sprintf("giver '%s' already gave %d of a budget of %d in the last %s",
+				giver, spent, b.Amount, time.Duration(b.Period))
+		}
+	}
+	return ""
+}
+
+// prune removes firings that are too old to count towards any cap or budget.
+func (e *Engine) prune(now time.Time) {
+	since := now.Add(-e.maxPeriod)
+	kept := e.history[:0]
+	for _, f := range e.history {
+		if f.At.After(since) {
+			kept = append(kept, f)
+		}
+	}
+	e.history = kept
+}
+
+func execute(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "executing %s template", tmpl.Name())
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,366 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - name: merged-pr
+    when:
+      - field: action
+        equals: closed
+      - field: pull_request.merged
+        equals: true
+      - field: pull_request.additions
+        gte: 10
+      - field: pull_request.labels
+        contains: release
+    give:
+      giver_email: bot@example.com
+      recipient: "{{.Event.pull_request.user.login}}"
+      amount: 5
+      reason: "{{amount .Amount}} {{mention .Recipient}} shipped {{.Event.pull_request.title}} {{hashtag \"shipit\"}}"
+    recipient_cap:
+      max: 2
+      period: 1d
+  - name: first-issue
+    when:
+      - field: action
+        in: [opened, reopened]
+      - field: issue.number
+        exists: true
+      - field: issue.title
+        matches: "(?i)^docs?:"
+      - field: issue.draft
+        exists: false
+    give:
+      giver_email: bot@example.com
+      recipient: "@{{.Event.issue.user.login}}"
+      amount: 3
+      reason: "{{amount .Amount}} {{mention .Recipient}} thanks for the docs #documentation"
+budgets:
+  - giver_email: bot@example.com
+    amount: 12
+    period: 24h
+`
+
+func event(t *testing.T, s string) map[string]interface{} {
+	var e map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &e))
+	return e
+}
+
+func mergedPR(t *testing.T, author string) map[string]interface{} {
+	return event(t, `{"action": "closed", "pull_request": {"merged": true, "additions": 25, "title": "Add rules",
+		"labels": ["release", "feature"], "user": {"login": "`+author+`"}}}`)
+}
+
+func newTestEngine(t *testing.T, client bonusly.Client, opts Options, clock *time.Time) *Engine {
+	config, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+	opts.Now = func() time.Time { return *clock }
+	e, err := New(config, client, opts)
+	require.NoError(t, err)
+	return e
+}
+
+var now = time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+	require.Len(t, config.Rules, 2)
+	assert.Equal(t, Duration(24*time.Hour), config.Rules[0].RecipientCap.Period)
+	assert.Equal(t, Duration(24*time.Hour), config.Budgets[0].Period)
+
+	for name, yaml := range map[string]string{
+		"MissingName":      "rules: [{give: {recipient: a, amount: 1, reason: b}}]",
+		"DuplicateName":    "rules: [{name: a, give: {recipient: a, amount: 1, reason: b}}, {name: a, give: {recipient: a, amount: 1, reason: b}}]",
+		"MissingAmount":    "rules: [{name: a, give: {recipient: a, reason: b}}]",
+		"MissingReason":    "rules: [{name: a, give: {recipient: a, amount: 1}}]",
+		"InvalidTemplate":  "rules: [{name: a, give: {recipient: '{{.Event', amount: 1, reason: b}}]",
+		"MissingField":     "rules: [{name: a, when: [{equals: 1}], give: {recipient: a, amount: 1, reason: b}}]",
+		"InvalidPattern":   "rules: [{name: a, when: [{field: x, matches: '('}], give: {recipient: a, amount: 1, reason: b}}]",
+		"InvalidCap":       "rules: [{name: a, recipient_cap: {max: 0, period: 1h}, give: {recipient: a, amount: 1, reason: b}}]",
+		"InvalidDuration":  "budgets: [{giver_email: a, amount: 1, period: soon}]",
+		"InvalidBudget":    "budgets: [{giver_email: a, amount: 0, period: 1h}]",
+		"DuplicateBudgets": "budgets: [{giver_email: a, amount: 1, period: 1h}, {giver_email: a, amount: 1, period: 1h}]",
+		"InvalidYAML":      "rules: {",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(yaml))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEngine(t *testing.T) {
+	t.Run("GivesBonusesOfMatchingRules", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{}, &clock)
+
+		outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, "merged-pr", outcomes[0].Rule)
+		assert.Equal(t, StatusGiven, outcomes[0].Status)
+		require.NotNil(t, outcomes[0].Bonus)
+		assert.Equal(t, []bonusly.CreateBonusRequest{{
+			GiverEmail: "bot@example.com",
+			Reason:     "+5 @alice shipped Add rules #shipit",
+		}}, client.CreateBonusRequests)
+
+		outcomes, err = e.Handle(context.Background(), event(t, `{"action": "opened", "issue": {"number": 1, "title": "Docs: fix typo", "user": {"login": "bob"}}}`))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, "first-issue", outcomes[0].Rule)
+		assert.Equal(t, "+3 @bob thanks for the docs #documentation", outcomes[0].Request.Reason)
+	})
+	t.Run("IgnoresEventsThatDoNotMatch", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{}, &clock)
+
+		for _, s := range []string{
+			`{"action": "opened", "pull_request": {"merged": true, "additions": 25, "labels": ["release"], "user": {"login": "a"}}}`,
+			`{"action": "closed", "pull_request": {"merged": false, "additions": 25, "labels": ["release"], "user": {"login": "a"}}}`,
+			`{"action": "closed", "pull_request": {"merged": true, "additions": 5, "labels": ["release"], "user": {"login": "a"}}}`,
+			`{"action": "closed", "pull_request": {"merged": true, "additions": "many", "labels": ["release"], "user": {"login": "a"}}}`,
+			`{"action": "closed", "pull_request": {"merged": true, "additions": 25, "labels": ["feature"], "user": {"login": "a"}}}`,
+			`{"action": "opened", "issue": {"title": "Docs: fix typo", "user": {"login": "bob"}}}`,
+			`{"action": "opened", "issue": {"number": 1, "title": "Bug: crash", "user": {"login": "bob"}}}`,
+			`{"action": "opened", "issue": {"number": 1, "title": "Docs: fix typo", "draft": true, "user": {"login": "bob"}}}`,
+			`{"action": "closed", "issue": {"number": 1, "title": "Docs: fix typo", "user": {"login": "bob"}}}`,
+		} {
+			outcomes, err := e.Handle(context.Background(), event(t, s))
+			require.NoError(t, err)
+			assert.Empty(t, outcomes, s)
+		}
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+	t.Run("CapsRecipients", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{}, &clock)
+
+		for i := 0; i < 2; i++ {
+			outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+			require.NoError(t, err)
+			require.Len(t, outcomes, 1)
+			assert.Equal(t, StatusGiven, outcomes[0].Status)
+		}
+		outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, StatusCapped, outcomes[0].Status)
+		assert.Contains(t, outcomes[0].Detail, "recipient 'alice'")
+		assert.Len(t, client.CreateBonusRequests, 2)
+
+		clock = now.Add(25 * time.Hour)
+		outcomes, err = e.Handle(context.Background(), mergedPR(t, "alice"))
+		require.NoError(t, err)
+		assert.Equal(t, StatusGiven, outcomes[0].Status, "should reset caps after the period")
+	})
+	t.Run("CapsGiverBudgets", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{History: []Firing{
+			{Rule: "first-issue", Recipient: "bob", GiverEmail: "bot@example.com", Amount: 3, At: now.Add(-time.Hour)},
+			{Rule: "first-issue", Recipient: "bob", GiverEmail: "bot@example.com", Amount: 3, At: now.Add(-48 * time.Hour)},
+		}}, &clock)
+
+		outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+		require.NoError(t, err)
+		assert.Equal(t, StatusGiven, outcomes[0].Status)
+		outcomes, err = e.Handle(context.Background(), mergedPR(t, "carol"))
+		require.NoError(t, err)
+		assert.Equal(t, StatusCapped, outcomes[0].Status)
+		assert.Contains(t, outcomes[0].Detail, "already gave 8 of a budget of 12")
+
+		history := e.History()
+		assert.Len(t, history, 2, "should forget firings older than every period")
+	})
+	t.Run("CountsAmountInReasonTowardsBudget", func(t *testing.T) {
+		config, err := Parse([]byte(`
+rules:
+  - name: generous
+    give:
+      giver_email: bot@example.com
+      recipient: "{{.Event.user}}"
+      amount: 5
+      reason: "+50 {{mention .Recipient}} thanks"
+  - name: no-amount
+    give:
+      giver_email: bot@example.com
+      recipient: "{{.Event.user}}"
+      amount: 5
+      reason: "{{mention .Recipient}} thanks"
+budgets:
+  - giver_email: bot@example.com
+    amount: 12
+    period: 24h
+`))
+		require.NoError(t, err)
+		client := &bonusly.MockClient{}
+		e, err := New(config, client, Options{Now: func() time.Time { return now }})
+		require.NoError(t, err)
+
+		outcomes, err := e.Handle(context.Background(), event(t, `{"user": "alice"}`))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 2)
+		assert.Equal(t, StatusCapped, outcomes[0].Status)
+		assert.Contains(t, outcomes[0].Detail, "already gave 0 of a budget of 12")
+		assert.Equal(t, StatusFailed, outcomes[1].Status)
+		assert.Contains(t, outcomes[1].Detail, "reason does not specify an amount")
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+	t.Run("Simulates", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{Simulate: true}, &clock)
+
+		var statuses []Status
+		for i := 0; i < 3; i++ {
+			outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+			require.NoError(t, err)
+			require.Len(t, outcomes, 1)
+			statuses = append(statuses, outcomes[0].Status)
+		}
+		assert.Equal(t, []Status{StatusSimulated, StatusSimulated, StatusCapped}, statuses)
+		assert.Empty(t, client.CreateBonusRequests)
+	})
+	t.Run("ReportsFailures", func(t *testing.T) {
+		client := &bonusly.MockClient{CreateBonusError: errors.New("insufficient balance")}
+		clock := now
+		e := newTestEngine(t, client, Options{}, &clock)
+
+		outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, StatusFailed, outcomes[0].Status)
+		assert.Contains(t, outcomes[0].Detail, "insufficient balance")
+		assert.Empty(t, e.History(), "should not count failures towards caps")
+
+		outcomes, err = e.Handle(context.Background(), event(t, `{"action": "opened", "issue": {"number": 1, "title": "docs: x", "user": {"login": ""}}}`))
+		require.NoError(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, StatusFailed, outcomes[0].Status)
+		assert.Contains(t, outcomes[0].Detail, "recipient is empty")
+	})
+	t.Run("SavesHistoryAfterEveryBonus", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		var saved [][]Firing
+		e := newTestEngine(t, client, Options{
+			SaveHistory: func(history []Firing) error {
+				saved = append(saved, history)
+				return nil
+			},
+		}, &clock)
+
+		for i := 0; i < 3; i++ {
+			_, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+			require.NoError(t, err)
+		}
+		require.Len(t, saved, 2, "should not save when a rule is capped")
+		assert.Len(t, saved[0], 1)
+		assert.Len(t, saved[1], 2)
+	})
+	t.Run("FailsWhenHistoryCannotBeSaved", func(t *testing.T) {
+		client := &bonusly.MockClient{}
+		clock := now
+		e := newTestEngine(t, client, Options{
+			SaveHistory: func([]Firing) error { return errors.New("disk full") },
+		}, &clock)
+
+		outcomes, err := e.Handle(context.Background(), mergedPR(t, "alice"))
+		assert.Error(t, err)
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, StatusGiven, outcomes[0].Status, "should still report the bonus that was given")
+	})
+}
+
+func TestReadEvents(t *testing.T) {
+	var actions []interface{}
+	err := ReadEvents(context.Background(), strings.NewReader(`{"action": "a"}
+{"action": "b"} {"action": "c"}`), func(e map[string]interface{}) error {
+		actions = append(actions, e["action"])
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, actions)
+
+	err = ReadEvents(context.Background(), strings.NewReader(`{"action": "a"} [1]`), func(map[string]interface{}) error { return nil })
+	assert.Error(t, err, "should only accept objects")
+}
+
+func TestHandler(t *testing.T) {
+	client := &bonusly.MockClient{}
+	clock := now
+	srv := httptest.NewServer(Handler(newTestEngine(t, client, Options{}, &clock), "secret"))
+	defer srv.Close()
+
+	post := func(t *testing.T, body string) (int, handlerResponse) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out handlerResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		return resp.StatusCode, out
+	}
+
+	t.Run("HandlesEvents", func(t *testing.T) {
+		pr, err := json.Marshal(mergedPR(t, "alice"))
+		require.NoError(t, err)
+		status, out := post(t, string(pr)+"\n"+`{"action": "ignored"}`)
+		assert.Equal(t, http.StatusOK, status)
+		require.Len(t, out.Outcomes, 1)
+		assert.Equal(t, StatusGiven, out.Outcomes[0].Status)
+	})
+	t.Run("RejectsInvalidJSON", func(t *testing.T) {
+		status, out := post(t, `{"action":`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.NotEmpty(t, out.Error)
+	})
+	t.Run("RejectsInvalidToken", func(t *testing.T) {
+		for name, url := range map[string]string{
+			"Missing":    srv.URL,
+			"WrongQuery": srv.URL + "?token=wrong",
+		} {
+			t.Run(name, func(t *testing.T) {
+				resp, err := http.Post(url, "application/json", strings.NewReader(`{"action": "ignored"}`))
+				require.NoError(t, err)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			})
+		}
+	})
+	t.Run("AcceptsTokenQueryParameter", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"?token=secret", "application/json", strings.NewReader(`{"action": "ignored"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("RejectsOtherMethods", func(t *testing.T) {
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
@@ -0,0 +1,93 @@
+package rules
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadEvents decodes a stream of JSON objects, such as JSON Lines, and calls
+// fn with each one until the stream ends or fn returns an error.
+func ReadEvents(ctx context.Context, r io.Reader, fn func(event map[string]interface{}) error) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var event map[string]interface{}
+		if err := dec.Decode(&event); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "decoding event %d", n)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// maxEventBytes is the maximum size of the body of an event posted to the
+// handler.
+const maxEventBytes = 1 << 20
+
+type handlerResponse struct {
+	Outcomes []Outcome `json:"outcomes"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Handler returns an HTTP handler that accepts events as JSON objects posted
+// to it, one or more per request, and responds with the outcomes of the
+// rules that matched them. If token is set, every request must include it,
+// either as a bearer token in the Authorization header or as the token query
+// parameter, for webhooks that cannot set headers.
+func Handler(e *Engine, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, handlerResponse{Error: "events must be posted"})
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, handlerResponse{Error: "invalid token"})
+			return
+		}
+
+		resp := handlerResponse{Outcomes: []Outcome{}}
+		var handleErr error
+		err := ReadEvents(r.Context(), io.LimitReader(r.Body, maxEventBytes), func(event map[string]interface{}) error {
+			outcomes, err := e.Handle(r.Context(), event)
+			resp.Outcomes = append(resp.Outcomes, outcomes...)
+			handleErr = err
+			return err
+		})
+		if err != nil {
+			resp.Error = err.Error()
+			status := http.StatusBadRequest
+			if handleErr != nil {
+				status = http.StatusInternalServerError
+			}
+			writeJSON(w, status, resp)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// requestToken returns the token that the request was sent with.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
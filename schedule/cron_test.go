@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *",
+		"*/15 9-17 * * mon-fri",
+		"0 0 1,15 * *",
+		"30 8 * jan,jul 0",
+		"0 12 * * 7",
+		"@weekly",
+	} {
+		_, err := ParseCron(expr)
+		assert.NoError(t, err, expr)
+	}
+
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@sometimes",
+	} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// March 10, 2021 was a Wednesday.
+	start := time.Date(2021, time.March, 10, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "* * * * *", expected: time.Date(2021, time.March, 10, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", expected: time.Date(2021, time.March, 10, 10, 15, 0, 0, time.UTC)},
+		{expr: "0 9 * * mon", expected: time.Date(2021, time.March, 15, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * 0", expected: time.Date(2021, time.March, 14, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * 7", expected: time.Date(2021, time.March, 14, 9, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", expected: time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// When both the day of month and day of week are restricted, either
+		// matches.
+		{expr: "0 0 20 * fri", expected: time.Date(2021, time.March, 12, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", expected: time.Time{}},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, c.Next(start))
+		})
+	}
+
+	t.Run("RespectsLocation", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		require.NoError(t, err)
+		c, err := ParseCron("0 9 * * *")
+		require.NoError(t, err)
+		next := c.Next(start.In(loc))
+		assert.Equal(t, time.Date(2021, time.March, 10, 9, 0, 0, 0, loc), next)
+		// Daylight saving time starts on March 14.
+		next = c.Next(time.Date(2021, time.March, 13, 12, 0, 0, 0, loc))
+		assert.Equal(t, time.Date(2021, time.March, 14, 13, 0, 0, 0, time.UTC), next.UTC())
+	})
+}
@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/pkg/errors"
+)
+
+// Interrupted is the error recorded for an entry whose process stopped while
+// it was running, so it is unknown whether its bonus was given.
+const Interrupted = "interrupted while running: the bonus may or may not have been given"
+
+// staleRunTimeout is how long after an entry started to run that it is
+// considered to have been interrupted if its outcome was not recorded.
+const staleRunTimeout = 10 * time.Minute
+
+// Result is the outcome of running a due entry.
+type Result struct {
+	EntryID string                 `json:"entry_id"`
+	RunAt   time.Time              `json:"run_at"`
+	Bonus   *bonusly.BonusResponse `json:"bonus,omitempty"`
+	Err     error                  `json:"-"`
+}
+
+// RunnerOptions represent options to run scheduled entries.
+type RunnerOptions struct {
+	// Interval is how often Run checks for due entries. Defaults to 1 minute.
+	Interval time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// OnResult, if set, is called with the result of every run.
+	OnResult func(Result)
+}
+
+// Validate checks that the options are valid and sets defaults where
+// possible.
+func (o *RunnerOptions) Validate() error {
+	if o.Interval == 0 {
+		o.Interval = time.Minute
+	}
+	if o.Interval < 0 {
+		return errors.New("interval cannot be negative")
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return nil
+}
+
+// Runner gives the bonuses of scheduled entries when they are due. Each
+// entry is given at most once for each time it is due, even across restarts
+// and with several runners sharing a store: the run is recorded in the store
+// before the bonus is created, so a run that is interrupted is never retried.
+// Missed runs are not made up; an entry that was due several times while
+// nothing was running runs once and is then next due after the current time.
+type Runner struct {
+	store  *Store
+	client bonusly.Client
+	opts   RunnerOptions
+}
+
+// NewRunner returns a runner of the entries in the store.
+func NewRunner(store *Store, client bonusly.Client, opts RunnerOptions) (*Runner, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	return &Runner{store: store, client: client, opts: opts}, nil
+}
+
+// Run runs due entries every interval until the context is done, at which
+// point it returns nil.
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RunDue(ctx); err != nil {
+			if ctx.Err() != nil && errors.Cause(err) == ctx.Err() {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs the entries that are due now and returns their results. Errors
+// giving individual bonuses are recorded in their entries and results rather
+// than returned. If the context is done before every claimed entry runs, the
+// entries that did not run are released to run again and the context's error
+// is returned.
+func (r *Runner) RunDue(ctx context.Context) ([]Result, error) {
+	now := r.opts.Now()
+	claimed, err := r.claimDue(now)
+	if err != nil {
+		return nil, errors.Wrap(err, "claiming due entries")
+	}
+
+	results := make([]Result, 0, len(claimed))
+	for i, c := range claimed {
+		if ctx.Err() != nil {
+			if err := r.release(claimed[i:]); err != nil {
+				return results, errors.Wrap(err, "releasing entries that did not run")
+			}
+			return results, ctx.Err()
+		}
+		e := c.entry
+		req := e.Request
+		req.IdempotencyKey = e.idempotencyKey(e.LastRun)
+		resp, err := r.client.CreateBonus(ctx, req)
+		res := Result{EntryID: e.ID, RunAt: e.LastRun, Bonus: resp, Err: err}
+		if err := r.finish(res); err != nil {
+			return results, errors.Wrapf(err, "recording outcome of entry '%s'", e.ID)
+		}
+		results = append(results, res)
+		if r.opts.OnResult != nil {
+			r.opts.OnResult(res)
+		}
+	}
+	return results, nil
+}
+
+// claim is an entry claimed to run, along with the entry as it was before it
+// was claimed.
+type claim struct {
+	entry    Entry
+	previous Entry
+}
+
+// claimDue marks the entries that are due at the given time as running and
+// advances them to their next run. Entries that were left running for too
+// long by an interrupted process are marked as failed.
+func (r *Runner) claimDue(now time.Time) ([]claim, error) {
+	var claimed []claim
+	err := r.store.update(func(all map[string]*Entry) (bool, error) {
+		changed := false
+		for _, e := range all {
+			if !e.RunningSince.IsZero() {
+				if now.Sub(e.RunningSince) < staleRunTimeout {
+					// Another runner may still be running it.
+					continue
+				}
+				e.RunningSince = time.Time{}
+				e.LastError = Interrupted
+				changed = true
+			}
+			if e.Done() || e.NextRun.After(now) {
+				continue
+			}
+			next, err := e.next(now)
+			if err != nil {
+				return false, errors.Wrapf(err, "getting next run of entry '%s'", e.ID)
+			}
+			previous := *e
+			e.LastRun = e.NextRun
+			e.NextRun = next
+			e.Runs++
+			e.RunningSince = now.UTC()
+			claimed = append(claimed, claim{entry: *e, previous: previous})
+			changed = true
+		}
+		return changed, nil
+	})
+	return claimed, err
+}
+
+// release undoes the claims of entries that did not run, so that they are
+// due again as they were before they were claimed.
+func (r *Runner) release(claimed []claim) error {
+	return r.store.update(func(all map[string]*Entry) (bool, error) {
+		changed := false
+		for _, c := range claimed {
+			e, ok := all[c.entry.ID]
+			if !ok || !e.LastRun.Equal(c.entry.LastRun) || !e.RunningSince.Equal(c.entry.RunningSince) {
+				// The entry was removed or considered interrupted since it
+				// was claimed.
+				continue
+			}
+			e.LastRun = c.previous.LastRun
+			e.NextRun = c.previous.NextRun
+			e.Runs = c.previous.Runs
+			e.RunningSince = time.Time{}
+			changed = true
+		}
+		return changed, nil
+	})
+}
+
+// finish records the outcome of running an entry.
+func (r *Runner) finish(res Result) error {
+	return r.store.update(func(all map[string]*Entry) (bool, error) {
+		e, ok := all[res.EntryID]
+		if !ok || !e.LastRun.Equal(res.RunAt) || e.RunningSince.IsZero() {
+			// The entry was removed or considered interrupted while it was
+			// running.
+			return false, nil
+		}
+		e.RunningSince = time.Time{}
+		e.LastError = ""
+		if res.Err != nil {
+			e.LastError = res.Err.Error()
+		} else if res.Bonus != nil {
+			e.LastBonusID = ptr.String(res.Bonus.ID)
+		}
+		return true, nil
+	})
+}
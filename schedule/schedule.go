@@ -0,0 +1,95 @@
+// Package schedule stores bonuses to give later, either once at a given time
+// or repeatedly on a cron schedule, and gives them when they are due.
+package schedule
+
+import (
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/pkg/errors"
+)
+
+// Entry is a bonus scheduled to be given once or repeatedly.
+type Entry struct {
+	ID string `json:"id"`
+	// Request is the bonus to create each time the entry runs.
+	Request bonusly.CreateBonusRequest `json:"request"`
+	// Cron is the cron expression of a recurring entry. Exactly one of Cron
+	// and At must be set.
+	Cron string `json:"cron,omitempty"`
+	// At is the time of a one-shot entry.
+	At time.Time `json:"at,omitempty"`
+	// TimeZone is the IANA time zone that the cron expression is evaluated
+	// in. Defaults to UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	// NextRun is when the entry is next due. It is zero once a one-shot entry
+	// has run or if a cron expression never matches again.
+	NextRun time.Time `json:"next_run,omitempty"`
+	// LastRun is when the entry last started to run.
+	LastRun time.Time `json:"last_run,omitempty"`
+	// Runs is the number of times that the entry started to run.
+	Runs int `json:"runs"`
+	// RunningSince is when the entry started to run, if its outcome has not
+	// been recorded yet. If the process is interrupted while it is running,
+	// the entry is not run again for the same time.
+	RunningSince time.Time `json:"running_since,omitempty"`
+	// LastBonusID is the ID of the bonus created by the last successful run.
+	LastBonusID string `json:"last_bonus_id,omitempty"`
+	// LastError is the error from the last run, if it failed.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Validate checks that the entry is valid and sets defaults where possible.
+func (e *Entry) Validate() error {
+	if e.Request.Reason == "" {
+		return errors.New("bonus reason must be set")
+	}
+	if (e.Cron == "") == e.At.IsZero() {
+		return errors.New("exactly one of a cron expression or a one-shot time must be set")
+	}
+	if e.TimeZone == "" {
+		e.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(e.TimeZone); err != nil {
+		return errors.Wrapf(err, "loading time zone '%s'", e.TimeZone)
+	}
+	if e.Cron != "" {
+		if _, err := ParseCron(e.Cron); err != nil {
+			return errors.Wrap(err, "parsing cron expression")
+		}
+	}
+	return nil
+}
+
+// Done returns whether the entry will never run again.
+func (e *Entry) Done() bool {
+	return e.NextRun.IsZero()
+}
+
+// next returns the first time the entry is due after the given time, or the
+// zero time if it is never due again.
+func (e *Entry) next(after time.Time) (time.Time, error) {
+	if e.Cron == "" {
+		if e.At.After(after) {
+			return e.At, nil
+		}
+		return time.Time{}, nil
+	}
+	c, err := ParseCron(e.Cron)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "parsing cron expression")
+	}
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "loading time zone '%s'", e.TimeZone)
+	}
+	return c.Next(after.In(loc)).UTC(), nil
+}
+
+// idempotencyKey returns the key that identifies the bonus for the run of the
+// entry at the given time.
+func (e *Entry) idempotencyKey(runAt time.Time) string {
+	return "schedule:" + e.ID + ":" + runAt.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,285 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "schedule")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return NewStore(filepath.Join(dir, "schedules.json"))
+}
+
+var now = time.Date(2021, time.March, 10, 10, 0, 0, 0, time.UTC)
+
+func TestEntryValidate(t *testing.T) {
+	t.Run("SetsDefaults", func(t *testing.T) {
+		e := Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, Cron: "@daily"}
+		require.NoError(t, e.Validate())
+		assert.Equal(t, "UTC", e.TimeZone)
+	})
+	t.Run("FailsWithoutReason", func(t *testing.T) {
+		e := Entry{Cron: "@daily"}
+		assert.Error(t, e.Validate())
+	})
+	t.Run("FailsWithoutSchedule", func(t *testing.T) {
+		e := Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}}
+		assert.Error(t, e.Validate())
+	})
+	t.Run("FailsWithCronAndAt", func(t *testing.T) {
+		e := Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, Cron: "@daily", At: now}
+		assert.Error(t, e.Validate())
+	})
+	t.Run("FailsWithInvalidCron", func(t *testing.T) {
+		e := Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, Cron: "daily"}
+		assert.Error(t, e.Validate())
+	})
+	t.Run("FailsWithInvalidTimeZone", func(t *testing.T) {
+		e := Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, Cron: "@daily", TimeZone: "Mars/Olympus"}
+		assert.Error(t, e.Validate())
+	})
+}
+
+func TestStore(t *testing.T) {
+	s := newTestStore(t)
+
+	entries, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	weekly, err := s.Add(Entry{
+		Request:  bonusly.CreateBonusRequest{Reason: "+1 @bob weekly shoutout #teamwork"},
+		Cron:     "0 9 * * mon",
+		TimeZone: "Europe/Paris",
+	}, now)
+	require.NoError(t, err)
+	assert.NotEmpty(t, weekly.ID)
+	assert.Equal(t, time.Date(2021, time.March, 15, 8, 0, 0, 0, time.UTC), weekly.NextRun)
+
+	once, err := s.Add(Entry{
+		Request: bonusly.CreateBonusRequest{Reason: "+5 @carol happy anniversary"},
+		At:      now.Add(time.Hour),
+	}, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), once.NextRun)
+
+	_, err = s.Add(Entry{
+		Request: bonusly.CreateBonusRequest{Reason: "+5 @carol too late"},
+		At:      now.Add(-time.Hour),
+	}, now)
+	assert.Error(t, err, "should not add one-shot entries in the past")
+
+	entries, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, *weekly, entries[0])
+	assert.Equal(t, *once, entries[1])
+
+	require.NoError(t, s.Remove(weekly.ID))
+	assert.Error(t, s.Remove(weekly.ID))
+	entries, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, once.ID, entries[0].ID)
+
+	_, err = os.Stat(s.path + ".lock")
+	assert.True(t, os.IsNotExist(err), "should remove the lock file")
+}
+
+func TestRunner(t *testing.T) {
+	newRunner := func(t *testing.T, s *Store, client bonusly.Client, clock *time.Time) *Runner {
+		r, err := NewRunner(s, client, RunnerOptions{Now: func() time.Time { return *clock }})
+		require.NoError(t, err)
+		return r
+	}
+
+	t.Run("RunsDueEntries", func(t *testing.T) {
+		s := newTestStore(t)
+		client := &bonusly.MockClient{CreateBonusResponse: bonusly.BonusResponse{ID: ptr.NewString("bonus")}}
+		clock := now
+		r := newRunner(t, s, client, &clock)
+
+		hourly, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob hourly"}, Cron: "@hourly"}, now)
+		require.NoError(t, err)
+		once, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob once", GiverEmail: "alice@example.com"}, At: now.Add(90 * time.Minute)}, now.Add(time.Second))
+		require.NoError(t, err)
+
+		results, err := r.RunDue(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, results, "should not run entries before they are due")
+
+		clock = now.Add(time.Hour)
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, hourly.ID, results[0].EntryID)
+		assert.Equal(t, now.Add(time.Hour), results[0].RunAt)
+		require.Len(t, client.CreateBonusRequests, 1)
+		assert.Equal(t, "+1 @bob hourly", client.CreateBonusRequests[0].Reason)
+		assert.Equal(t, "schedule:"+hourly.ID+":2021-03-10T11:00:00Z", client.CreateBonusRequests[0].IdempotencyKey)
+
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, results, "should run each due time once")
+
+		// Both entries are due, and the hourly entry missed a run.
+		clock = now.Add(3*time.Hour + time.Minute)
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Len(t, client.CreateBonusRequests, 3)
+		assert.ElementsMatch(t, []string{"+1 @bob hourly", "+1 @bob once"}, []string{client.CreateBonusRequests[1].Reason, client.CreateBonusRequests[2].Reason})
+
+		entries, err := s.List()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, 2, entries[0].Runs)
+		assert.Equal(t, now.Add(4*time.Hour), entries[0].NextRun, "should skip missed runs")
+		assert.Equal(t, "bonus", entries[0].LastBonusID)
+		assert.True(t, entries[0].RunningSince.IsZero())
+		assert.Equal(t, once.ID, entries[1].ID)
+		assert.True(t, entries[1].Done())
+		assert.Equal(t, 1, entries[1].Runs)
+
+		clock = now.Add(24 * time.Hour)
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Len(t, results, 1, "should not run one-shot entries again")
+	})
+	t.Run("RecordsErrors", func(t *testing.T) {
+		s := newTestStore(t)
+		client := &bonusly.MockClient{CreateBonusError: errors.New("insufficient balance")}
+		clock := now
+		r := newRunner(t, s, client, &clock)
+
+		_, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, At: now.Add(time.Minute)}, now)
+		require.NoError(t, err)
+
+		clock = now.Add(time.Minute)
+		results, err := r.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Error(t, results[0].Err)
+
+		entries, err := s.List()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "insufficient balance", entries[0].LastError)
+		assert.True(t, entries[0].Done(), "should not retry failed runs")
+	})
+	t.Run("DoesNotRetryInterruptedRuns", func(t *testing.T) {
+		s := newTestStore(t)
+		client := &bonusly.MockClient{}
+		clock := now
+		r := newRunner(t, s, client, &clock)
+
+		_, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: "+1 @bob"}, Cron: "@daily"}, now)
+		require.NoError(t, err)
+
+		// Simulate a process that claimed the run and then crashed.
+		clock = now.Add(14 * time.Hour)
+		claimed, err := r.claimDue(clock)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+
+		results, err := r.RunDue(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, results, "should not run entries that another runner is running")
+
+		clock = clock.Add(staleRunTimeout)
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Empty(t, client.CreateBonusRequests)
+
+		entries, err := s.List()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, Interrupted, entries[0].LastError)
+		assert.True(t, entries[0].RunningSince.IsZero())
+		assert.Equal(t, now.Add(38*time.Hour), entries[0].NextRun)
+	})
+	t.Run("ReleasesUnsentEntriesWhenCancelled", func(t *testing.T) {
+		s := newTestStore(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := &cancellingClient{MockClient: &bonusly.MockClient{}, cancel: cancel}
+		clock := now
+		r := newRunner(t, s, client, &clock)
+
+		for _, reason := range []string{"+1 @bob", "+1 @carol"} {
+			_, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: reason}, At: now.Add(time.Minute)}, now)
+			require.NoError(t, err)
+		}
+
+		clock = now.Add(time.Minute)
+		results, err := r.RunDue(ctx)
+		assert.Equal(t, context.Canceled, err)
+		require.Len(t, results, 1)
+		require.Len(t, client.CreateBonusRequests, 1)
+
+		entries, err := s.List()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		var done, released int
+		for _, e := range entries {
+			assert.True(t, e.RunningSince.IsZero())
+			if e.Done() {
+				done++
+				assert.Equal(t, 1, e.Runs)
+				continue
+			}
+			released++
+			assert.Zero(t, e.Runs)
+			assert.True(t, e.LastRun.IsZero())
+			assert.Equal(t, now.Add(time.Minute), e.NextRun)
+		}
+		assert.Equal(t, 1, done)
+		assert.Equal(t, 1, released, "should release the entry that was not sent")
+
+		results, err = r.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Len(t, results, 1, "should run the released entry")
+		assert.Len(t, client.CreateBonusRequests, 2)
+	})
+	t.Run("RunReturnsNilWhenCancelled", func(t *testing.T) {
+		s := newTestStore(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := &cancellingClient{MockClient: &bonusly.MockClient{}, cancel: cancel}
+		clock := now
+		r := newRunner(t, s, client, &clock)
+
+		for _, reason := range []string{"+1 @bob", "+1 @carol"} {
+			_, err := s.Add(Entry{Request: bonusly.CreateBonusRequest{Reason: reason}, At: now.Add(time.Minute)}, now)
+			require.NoError(t, err)
+		}
+		clock = now.Add(time.Minute)
+		assert.NoError(t, r.Run(ctx))
+		assert.Len(t, client.CreateBonusRequests, 1)
+	})
+}
+
+// cancellingClient cancels the context after creating a bonus, as if the
+// process was asked to stop while running entries.
+type cancellingClient struct {
+	*bonusly.MockClient
+	cancel context.CancelFunc
+}
+
+func (c *cancellingClient) CreateBonus(ctx context.Context, req bonusly.CreateBonusRequest) (*bonusly.BonusResponse, error) {
+	defer c.cancel()
+	return c.MockClient.CreateBonus(ctx, req)
+}
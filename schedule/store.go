@@ -0,0 +1,143 @@
+package schedule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kimchelly/go-bonusly/internal/fileutil"
+	"github.com/pkg/errors"
+)
+
+// lockTimeout is how long to wait for another process to release the store.
+const lockTimeout = 10 * time.Second
+
+// Store persists scheduled entries as JSON in a file. Every operation reads
+// and writes the file while holding a lock file next to it, so that several
+// processes can share the store safely.
+type Store struct {
+	path string
+}
+
+// NewStore returns a store that persists entries in the file at the given
+// path, which is created when an entry is first added.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// List returns all the entries, ordered by when they were created.
+func (s *Store) List() ([]Entry, error) {
+	var entries []Entry
+	err := s.update(func(all map[string]*Entry) (bool, error) {
+		for _, e := range all {
+			entries = append(entries, *e)
+		}
+		return false, nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, err
+}
+
+// Add validates the entry, assigns it an ID and calculates when it is first
+// due after the given time, then stores it.
+func (s *Store) Add(e Entry, now time.Time) (*Entry, error) {
+	if err := e.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid entry")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	e.ID = id
+	e.CreatedAt = now.UTC()
+	e.Runs = 0
+	e.RunningSince = time.Time{}
+	e.LastRun = time.Time{}
+	if e.NextRun, err = e.next(now); err != nil {
+		return nil, err
+	}
+	if e.NextRun.IsZero() {
+		return nil, errors.New("entry is never due after the current time")
+	}
+
+	err = s.update(func(all map[string]*Entry) (bool, error) {
+		all[e.ID] = &e
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Remove removes the entry with the ID.
+func (s *Store) Remove(id string) error {
+	return s.update(func(all map[string]*Entry) (bool, error) {
+		if _, ok := all[id]; !ok {
+			return false, errors.Errorf("no scheduled entry with ID '%s'", id)
+		}
+		delete(all, id)
+		return true, nil
+	})
+}
+
+// update loads all the entries while holding the lock and calls the function
+// with them. If the function returns true, the entries are written back.
+func (s *Store) update(fn func(all map[string]*Entry) (bool, error)) error {
+	unlock, err := fileutil.Lock(s.path, lockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "locking schedule store")
+	}
+	defer unlock()
+
+	all := map[string]*Entry{}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading schedule store file")
+	}
+	if len(b) > 0 {
+		var entries []*Entry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return errors.Wrap(err, "parsing schedule store file")
+		}
+		for _, e := range entries {
+			all[e.ID] = e
+		}
+	}
+
+	changed, err := fn(all)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	entries := make([]*Entry, 0, len(all))
+	for _, e := range all {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	b, err = json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "marshalling scheduled entries")
+	}
+	return errors.Wrap(fileutil.WriteAtomic(s.path, b), "writing schedule store file")
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating ID")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,303 @@
+// Package templates renders bonus reasons from Go text/template templates,
+// with helpers for mentions, hashtags, amounts and pluralization, and
+// variants for different locales.
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/pkg/errors"
+)
+
+// Extension is the file extension of templates in a library directory.
+const Extension = ".tmpl"
+
+// DefaultLocale is the locale of templates without a locale in their file
+// name, which are used when there is no variant for the requested locale.
+const DefaultLocale = ""
+
+// RecipientKey is the key of the recipient in template data, if the
+// recipient is known.
+const RecipientKey = "Recipient"
+
+// Funcs returns the helper functions available to templates:
+//
+//	mention "bob"              => "@bob"
+//	mentions "bob" "carol"     => "@bob @carol"
+//	hashtag "team work"        => "#teamwork"
+//	hashtags "a" "b"           => "#a #b"
+//	amount 5                   => "+5"
+//	plural 2 "point" "points"  => "2 points"
+//
+// Numbers may be given as integers or as strings, such as variables.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"mention":  mention,
+		"mentions": mentions,
+		"hashtag":  hashtag,
+		"hashtags": hashtags,
+		"amount":   amount,
+		"plural":   plural,
+	}
+}
+
+func mention(username interface{}) string {
+	return "@" + strings.TrimPrefix(strings.TrimSpace(toString(username)), "@")
+}
+
+func mentions(usernames ...interface{}) string {
+	out := make([]string, 0, len(usernames))
+	for _, u := range flatten(usernames) {
+		out = append(out, mention(u))
+	}
+	return strings.Join(out, " ")
+}
+
+func hashtag(tag interface{}) string {
+	s := strings.TrimPrefix(strings.TrimSpace(toString(tag)), "#")
+	return "#" + strings.Join(strings.Fields(s), "")
+}
+
+func hashtags(tags ...interface{}) string {
+	out := make([]string, 0, len(tags))
+	for _, t := range flatten(tags) {
+		out = append(out, hashtag(t))
+	}
+	return strings.Join(out, " ")
+}
+
+func amount(n interface{}) (string, error) {
+	i, err := toInt(n)
+	if err != nil {
+		return "", err
+	}
+	return "+" + strconv.Itoa(i), nil
+}
+
+func plural(n interface{}, singular, pluralForm string) (string, error) {
+	i, err := toInt(n)
+	if err != nil {
+		return "", err
+	}
+	if i == 1 || i == -1 {
+		return fmt.Sprintf("%d %s", i, singular), nil
+	}
+	return fmt.Sprintf("%d %s", i, pluralForm), nil
+}
+
+// flatten expands slices of strings among the values, so that helpers can
+// be given either several values or a list.
+func flatten(values []interface{}) []interface{} {
+	var out []interface{}
+	for _, v := range values {
+		switch v := v.(type) {
+		case []string:
+			for _, s := range v {
+				out = append(out, s)
+			}
+		case []interface{}:
+			out = append(out, flatten(v)...)
+		default:
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// toString returns the value as a string, dereferencing string pointers such
+// as those of the recipient's fields.
+func toString(v interface{}) string {
+	if s, ok := v.(*string); ok {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return fmt.Sprint(v)
+}
+
+func toInt(n interface{}) (int, error) {
+	switch n := n.(type) {
+	case *int:
+		if n == nil {
+			return 0, errors.New("number is not set")
+		}
+		return *n, nil
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(n), "+"))
+		if err != nil {
+			return 0, errors.Errorf("'%s' is not a whole number", n)
+		}
+		return i, nil
+	default:
+		return 0, errors.Errorf("'%v' is not a whole number", n)
+	}
+}
+
+// Library is a set of named templates, each with variants for different
+// locales.
+type Library struct {
+	templates map[string]map[string]*template.Template
+}
+
+// NewLibrary returns an empty library.
+func NewLibrary() *Library {
+	return &Library{templates: map[string]map[string]*template.Template{}}
+}
+
+// LoadDir loads a library from the template files in the directory. A file
+// named "<name>.tmpl" is the default variant of the template, and a file
+// named "<name>.<locale>.tmpl", such as "thanks.fr.tmpl" or
+// "thanks.pt-BR.tmpl", is its variant for the locale.
+func LoadDir(dir string) (*Library, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing template files")
+	}
+	l := NewLibrary()
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading template file '%s'", path)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), Extension)
+		locale := DefaultLocale
+		if i := strings.Index(name, "."); i >= 0 {
+			name, locale = name[:i], name[i+1:]
+		}
+		if err := l.Add(name, locale, string(b)); err != nil {
+			return nil, errors.Wrapf(err, "loading template file '%s'", path)
+		}
+	}
+	return l, nil
+}
+
+// Add parses the text as the template's variant for the locale, replacing
+// any existing variant.
+func (l *Library) Add(name, locale, text string) error {
+	if name == "" {
+		return errors.New("template name must be set")
+	}
+	tmpl, err := template.New(name).Funcs(Funcs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return errors.Wrapf(err, "parsing template '%s'", name)
+	}
+	if l.templates[name] == nil {
+		l.templates[name] = map[string]*template.Template{}
+	}
+	l.templates[name][normalizeLocale(locale)] = tmpl
+	return nil
+}
+
+// Names returns the names of the templates, sorted.
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.templates))
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locales returns the locales that the template has variants for, sorted,
+// where the default variant is DefaultLocale.
+func (l *Library) Locales(name string) []string {
+	locales := make([]string, 0, len(l.templates[name]))
+	for locale := range l.templates[name] {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Render executes the template's variant for the locale with the data. If
+// there is no variant for the locale, such as "pt-BR", it falls back to its
+// language, such as "pt", and then to the default variant.
+func (l *Library) Render(name, locale string, data interface{}) (string, error) {
+	tmpl, err := l.lookup(name, locale)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "executing template '%s'", name)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (l *Library) lookup(name, locale string) (*template.Template, error) {
+	variants, ok := l.templates[name]
+	if !ok {
+		return nil, errors.Errorf("no template named '%s'", name)
+	}
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i >= 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+	for _, c := range candidates {
+		if tmpl, ok := variants[c]; ok {
+			return tmpl, nil
+		}
+	}
+	return nil, errors.Errorf("template '%s' has no variant for locale '%s' and no default", name, locale)
+}
+
+// normalizeLocale returns the locale with a hyphen separator and in lower
+// case, so that "pt_BR" and "pt-br" are the same locale.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+// RecipientLocale returns the locale of the recipient from the custom
+// property, or DefaultLocale if it is not set.
+func RecipientLocale(u *bonusly.UserInfoResponse, property string) string {
+	if u == nil {
+		return DefaultLocale
+	}
+	if v, ok := u.CustomProperties[property].(string); ok {
+		return v
+	}
+	return DefaultLocale
+}
+
+// Data returns the template data for the variables and, if it is known, the
+// recipient, which is available as .Recipient.
+func Data(vars map[string]string, recipient *bonusly.UserInfoResponse) map[string]interface{} {
+	data := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		data[k] = v
+	}
+	if recipient != nil {
+		data[RecipientKey] = recipient
+	}
+	return data
+}
+
+// ParseVars parses variables given as "key=value".
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("variable '%s' must be in the form key=value", pair)
+		}
+		vars[pair[:i]] = pair[i+1:]
+	}
+	return vars, nil
+}
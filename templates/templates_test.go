@@ -0,0 +1,96 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/internal/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelpers(t *testing.T) {
+	l := NewLibrary()
+	require.NoError(t, l.Add("helpers", DefaultLocale,
+		`{{amount .n}} {{mention .user}} {{mentions "@bob" "carol"}} {{hashtag "team work"}} {{hashtags "#a" "b"}} {{plural .n "point" "points"}} {{plural 1 "point" "points"}}`))
+
+	out, err := l.Render("helpers", "", map[string]interface{}{"n": "5", "user": "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, "+5 @alice @bob @carol #teamwork #a #b 5 points 1 point", out)
+
+	_, err = l.Render("helpers", "", map[string]interface{}{"n": "five", "user": "alice"})
+	assert.Error(t, err)
+	_, err = l.Render("helpers", "", map[string]interface{}{"n": "5"})
+	assert.Error(t, err, "should fail with missing variables")
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, text := range map[string]string{
+		"thanks.tmpl":       "{{amount .amount}} {{mention .Recipient.UserName}} thanks for {{.what}} {{hashtag \"teamwork\"}}\n",
+		"thanks.fr.tmpl":    "{{amount .amount}} {{mention .Recipient.UserName}} merci pour {{.what}} {{hashtag \"teamwork\"}}",
+		"thanks.pt-BR.tmpl": "{{amount .amount}} {{mention .Recipient.UserName}} obrigado por {{.what}}",
+		"welcome.de.tmpl":   "Willkommen {{mention .user}}",
+		"README.md":         "not a template",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0600))
+	}
+
+	l, err := LoadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"thanks", "welcome"}, l.Names())
+	assert.Equal(t, []string{DefaultLocale, "fr", "pt-br"}, l.Locales("thanks"))
+
+	vars, err := ParseVars([]string{"amount=5", "what=the review"})
+	require.NoError(t, err)
+	recipient := &bonusly.UserInfoResponse{UserName: ptr.NewString("bob")}
+	data := Data(vars, recipient)
+
+	for locale, expected := range map[string]string{
+		"":      "+5 @bob thanks for the review #teamwork",
+		"en-US": "+5 @bob thanks for the review #teamwork",
+		"fr":    "+5 @bob merci pour the review #teamwork",
+		"fr_CA": "+5 @bob merci pour the review #teamwork",
+		"pt_BR": "+5 @bob obrigado por the review",
+		"pt":    "+5 @bob thanks for the review #teamwork",
+	} {
+		out, err := l.Render("thanks", locale, data)
+		require.NoError(t, err, locale)
+		assert.Equal(t, expected, out, locale)
+	}
+
+	_, err = l.Render("welcome", "fr", map[string]interface{}{"user": "bob"})
+	assert.Error(t, err, "should fail without a variant for the locale or a default")
+	_, err = l.Render("missing", "", nil)
+	assert.Error(t, err)
+
+	t.Run("FailsWithInvalidTemplate", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.tmpl"), []byte("{{.oops"), 0600))
+		_, err := LoadDir(dir)
+		assert.Error(t, err)
+	})
+}
+
+func TestRecipientLocale(t *testing.T) {
+	assert.Equal(t, DefaultLocale, RecipientLocale(nil, "locale"))
+	assert.Equal(t, DefaultLocale, RecipientLocale(&bonusly.UserInfoResponse{}, "locale"))
+	assert.Equal(t, "fr", RecipientLocale(&bonusly.UserInfoResponse{
+		CustomProperties: map[string]interface{}{"locale": "fr"},
+	}, "locale"))
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]string{"a=1", "b=x=y", "c="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "x=y", "c": ""}, vars)
+
+	_, err = ParseVars([]string{"novalue"})
+	assert.Error(t, err)
+	_, err = ParseVars([]string{"=value"})
+	assert.Error(t, err)
+}
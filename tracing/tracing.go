@@ -0,0 +1,150 @@
+// Package tracing provides OpenTelemetry tracing for Bonusly clients.
+package tracing
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	bonusly "github.com/kimchelly/go-bonusly"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/kimchelly/go-bonusly/tracing"
+
+// Span attribute keys specific to Bonusly.
+const (
+	OperationKey  = attribute.Key("bonusly.operation")
+	BonusIDKey    = attribute.Key("bonusly.bonus_id")
+	RetriesKey    = attribute.Key("bonusly.retries")
+	AttemptKey    = attribute.Key("bonusly.attempt")
+	ErrorClassKey = attribute.Key("bonusly.error_class")
+)
+
+// Tracer creates spans for calls made by Bonusly clients.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracer returns a tracer that creates spans using the given provider. If
+// the provider is nil, the global provider is used.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: otel.GetTextMapPropagator(),
+	}
+}
+
+// Instrument adds the tracer's middleware to the client options.
+func (t *Tracer) Instrument(opts *bonusly.ClientOptions) {
+	opts.Middleware = append(opts.Middleware, t.Middleware())
+	opts.AttemptMiddleware = append(opts.AttemptMiddleware, t.AttemptMiddleware())
+}
+
+// Middleware returns client middleware that creates a span for every call,
+// which is a child of any span in the context passed to the Client method.
+func (t *Tracer) Middleware() bonusly.Middleware {
+	return func(next bonusly.Doer) bonusly.Doer {
+		return bonusly.DoerFunc(func(call *bonusly.Call) error {
+			ctx, span := t.tracer.Start(call.Request.Context(), "bonusly."+call.Operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					OperationKey.String(call.Operation),
+					semconv.HTTPMethodKey.String(call.Request.Method),
+					semconv.HTTPURLKey.String(spanURL(call.Request.URL)),
+				),
+			)
+			defer span.End()
+			call.Request = call.Request.WithContext(ctx)
+
+			err := next.Do(call)
+
+			if call.Response != nil {
+				span.SetAttributes(semconv.HTTPStatusCodeKey.Int(call.Response.StatusCode))
+			}
+			if call.Attempts > 1 {
+				span.SetAttributes(RetriesKey.Int(call.Attempts - 1))
+			} else {
+				span.SetAttributes(RetriesKey.Int(0))
+			}
+			if id := bonusID(call); id != "" {
+				span.SetAttributes(BonusIDKey.String(id))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.SetAttributes(ErrorClassKey.String(bonusly.ErrorClass(err)))
+			}
+
+			return err
+		})
+	}
+}
+
+// AttemptMiddleware returns transport middleware that creates a child span
+// for each attempt to send a request, including retries, and propagates the
+// trace context in the request headers.
+func (t *Tracer) AttemptMiddleware() bonusly.TransportMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			ctx, span := t.tracer.Start(r.Context(), "bonusly.attempt",
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					AttemptKey.Int(bonusly.AttemptNumber(r.Context())),
+					semconv.HTTPMethodKey.String(r.Method),
+				),
+			)
+			defer span.End()
+
+			r = r.Clone(ctx)
+			t.propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return resp, err
+			}
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+			return resp, nil
+		})
+	}
+}
+
+// spanURL returns the URL to record in a span, without its query or any
+// credentials, since those can hold personal data such as emails.
+func spanURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	redacted.Fragment = ""
+	return redacted.String()
+}
+
+// bonusID returns the ID of the bonus that the call is about, if any.
+func bonusID(call *bonusly.Call) string {
+	if b, ok := call.Result.(*bonusly.BonusResponse); ok && b.ID != nil {
+		return *b.ID
+	}
+	dir, id := path.Split(call.Request.URL.Path)
+	if strings.HasSuffix(dir, "/bonuses/") {
+		return id
+	}
+	return ""
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
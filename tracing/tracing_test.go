@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/rehttp"
+	bonusly "github.com/kimchelly/go-bonusly"
+	"github.com/kimchelly/go-bonusly/tracing/tracingtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var requests int32
+	var traceparents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		switch r.URL.Path {
+		case "/bonuses/bonus_id":
+			// Fail the first attempt so that it is retried.
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"success": true, "result": {"id": "bonus_id"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "message": "not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	tp, exporter := tracingtest.NewInMemoryTracerProvider()
+	defer func() {
+		assert.NoError(t, tp.Shutdown(ctx))
+	}()
+
+	opts := bonusly.ClientOptions{
+		AccessToken: "access_token",
+		BaseURL:     srv.URL,
+		HTTPClient: &http.Client{
+			Transport: rehttp.NewTransport(http.DefaultTransport,
+				rehttp.RetryAll(rehttp.RetryMaxRetries(2), rehttp.RetryStatuses(http.StatusServiceUnavailable)),
+				rehttp.ConstDelay(time.Millisecond)),
+		},
+	}
+	NewTracer(tp).Instrument(&opts)
+	c, err := bonusly.NewClient(opts)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, c.Close(ctx))
+	}()
+
+	spansByName := func(spans tracetest.SpanStubs, name string) []tracetest.SpanStub {
+		var matching []tracetest.SpanStub
+		for _, s := range spans {
+			if s.Name == name {
+				matching = append(matching, s)
+			}
+		}
+		return matching
+	}
+	attrs := func(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	t.Run("CreatesSpansForCallAndAttempts", func(t *testing.T) {
+		exporter.Reset()
+		traceparents = nil
+
+		parentCtx, parent := tp.Tracer("test").Start(ctx, "parent")
+		_, err := c.GetBonus(parentCtx, "bonus_id")
+		parent.End()
+		require.NoError(t, err)
+
+		spans := exporter.GetSpans()
+		calls := spansByName(spans, "bonusly.GetBonus")
+		require.Len(t, calls, 1)
+		call := calls[0]
+		assert.Equal(t, parent.SpanContext().SpanID(), call.Parent.SpanID())
+		assert.Equal(t, parent.SpanContext().TraceID(), call.SpanContext.TraceID())
+		callAttrs := attrs(call)
+		assert.Equal(t, "GetBonus", callAttrs[OperationKey].AsString())
+		assert.Equal(t, "bonus_id", callAttrs[BonusIDKey].AsString())
+		assert.EqualValues(t, 1, callAttrs[RetriesKey].AsInt64())
+		assert.EqualValues(t, http.StatusOK, callAttrs["http.status_code"].AsInt64())
+
+		attempts := spansByName(spans, "bonusly.attempt")
+		require.Len(t, attempts, 2)
+		for i, attempt := range attempts {
+			assert.Equal(t, call.SpanContext.SpanID(), attempt.Parent.SpanID())
+			assert.EqualValues(t, i+1, attrs(attempt)[AttemptKey].AsInt64())
+		}
+		assert.Equal(t, codes.Error, attempts[0].Status.Code)
+
+		require.Len(t, traceparents, 2)
+		for i, tp := range traceparents {
+			assert.Contains(t, tp, attempts[i].SpanContext.SpanID().String())
+		}
+	})
+	t.Run("RecordsErrors", func(t *testing.T) {
+		exporter.Reset()
+
+		_, err := c.GetBonus(ctx, "nonexistent")
+		require.Error(t, err)
+
+		calls := spansByName(exporter.GetSpans(), "bonusly.GetBonus")
+		require.Len(t, calls, 1)
+		assert.Equal(t, codes.Error, calls[0].Status.Code)
+		assert.Equal(t, bonusly.ErrorClassClient, attrs(calls[0])[ErrorClassKey].AsString())
+		assert.NotEmpty(t, calls[0].Events)
+	})
+	t.Run("OmitsQueryFromURL", func(t *testing.T) {
+		exporter.Reset()
+
+		_, _ = c.ListBonuses(ctx, bonusly.ListBonusesRequest{UserEmail: "alice@example.com"})
+
+		calls := spansByName(exporter.GetSpans(), "bonusly.ListBonuses")
+		require.Len(t, calls, 1)
+		assert.Equal(t, srv.URL+"/bonuses", attrs(calls[0])["http.url"].AsString())
+	})
+}